@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/alert"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+// alertNotifiers builds the notifiers configured under alerts in the project config
+func alertNotifiers(project *config.ProjectConfig) []alert.Notifier {
+	var notifiers []alert.Notifier
+	if pd := project.Alerts.PagerDuty; pd != nil {
+		notifiers = append(notifiers, &alert.PagerDuty{RoutingKey: os.ExpandEnv(pd.RoutingKey), URL: pd.URL})
+	}
+	if og := project.Alerts.Opsgenie; og != nil {
+		notifiers = append(notifiers, &alert.Opsgenie{APIKey: os.ExpandEnv(og.APIKey), Priority: og.Priority, URL: og.URL})
+	}
+	return notifiers
+}
+
+// alertOnFailure pages when an up run in a production environment failed or
+// left a database dirty. Failures to send only warn.
+func alertOnFailure(ctx context.Context, out io.Writer, infraConfig *config.InfraConfig, project *config.ProjectConfig, run *state.Run) {
+	if run.Direction != "up" || !infraConfig.IsProduction() {
+		return
+	}
+	notifiers := alertNotifiers(project)
+	if len(notifiers) == 0 {
+		return
+	}
+
+	var failed []string
+	details := map[string]string{"run_id": run.ID}
+	for _, db := range run.Databases {
+		dirty := db.State != nil && db.State.Dirty
+		if db.Status != state.StatusFailed && !dirty {
+			continue
+		}
+		failed = append(failed, db.Name)
+		detail := string(db.Status)
+		if db.State != nil {
+			detail += fmt.Sprintf(" at version %d, %d pending", db.State.Version, len(db.State.PendingFiles))
+		}
+		if dirty {
+			detail += ", left dirty"
+		}
+		if db.Error != "" {
+			detail += ": " + db.Error
+		}
+		details[db.Name] = detail
+	}
+	if len(failed) == 0 {
+		return
+	}
+
+	env := infraConfig.Metadata.EnvName
+	if env == "" {
+		env = config.EnvTypeProduction
+	}
+	if run.Ticket != "" {
+		details["ticket"] = run.Ticket
+	}
+	a := alert.Alert{
+		Summary:  fmt.Sprintf("encore-migrator up failed in %s: %s", env, strings.Join(failed, ", ")),
+		Source:   env,
+		DedupKey: "encore-migrator-" + run.ID,
+		Details:  details,
+	}
+
+	for _, n := range notifiers {
+		if err := n.Notify(ctx, a); err != nil {
+			warn(os.Stderr, warnAlertFailed, "could not alert %s: %v", n.Name(), err)
+			continue
+		}
+		fmt.Fprintf(out, "Alerted %s\n", n.Name())
+	}
+}
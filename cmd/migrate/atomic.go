@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// atomicGroupCaveats is printed before a run with --atomic-group, so nobody
+// mistakes the rollback for a distributed transaction
+const atomicGroupCaveats = `Atomic group: %s. If one of them fails, the others are rolled back to their
+versions before this run with their down migrations. This is best effort, not a transaction:
+  - the database that failed is left as it failed (possibly dirty) for you to recover
+  - rolling back needs correct down files, and loses data written since the up migrations ran
+  - a rollback can fail too, leaving the group inconsistent; the run report says which
+`
+
+// parseAtomicGroup validates the --atomic-group databases against the
+// databases being migrated
+func parseAtomicGroup(cmd *cli.Command, databases []types.EncoreDatabase) ([]string, error) {
+	group := cmd.StringSlice("atomic-group")
+	if len(group) == 0 {
+		return nil, nil
+	}
+	if len(group) < 2 {
+		return nil, fmt.Errorf("--atomic-group needs at least two databases")
+	}
+	for _, name := range group {
+		if !slices.ContainsFunc(databases, func(db types.EncoreDatabase) bool { return db.Name == name }) {
+			return nil, fmt.Errorf("--atomic-group database %q is not among the databases being migrated", name)
+		}
+	}
+	return group, nil
+}
+
+// rollBackAtomicGroup returns the databases of the group that this run
+// migrated to the versions they had before it, latest migrated first, once
+// another database of the group failed. It returns the errors of rollbacks
+// that failed.
+func rollBackAtomicGroup(cmd *cli.Command, out, errOut io.Writer, group []string, failed string, databases []types.EncoreDatabase,
+	infraConfig *config.InfraConfig, project *config.ProjectConfig, migrator *migration.Migrator, store *state.Store, run *state.Run) []string {
+	var errs []string
+	header := false
+	for _, db := range slices.Backward(databases) {
+		entry := run.Database(db.Name)
+		if !slices.Contains(group, db.Name) || entry == nil || entry.Status != state.StatusCompleted || entry.VersionAfter == entry.VersionBefore {
+			continue
+		}
+		reached := entry.VersionAfter
+		if !header {
+			fmt.Fprintf(out, "\n%q failed; rolling back the rest of its atomic group\n", failed)
+			header = true
+		}
+		fmt.Fprintf(out, "Rolling back %q: %d -> %d\n", db.Name, reached, entry.VersionBefore)
+
+		result, err := func() (*types.MigrationResult, error) {
+			mapping, err := infraConfig.GetMapping(db.Name)
+			if err != nil {
+				return nil, err
+			}
+			if err := applyConnectionOverrides(cmd, mapping); err != nil {
+				return nil, err
+			}
+			connStr, err := migration.BuildConnectionString(mapping)
+			if err != nil {
+				return nil, err
+			}
+			if connStr, err = migration.WithApplicationName(connStr, migration.ApplicationName(run.ID)); err != nil {
+				return nil, err
+			}
+			session, err := sessionOptions(cmd, project, db.Name)
+			if err != nil {
+				return nil, err
+			}
+			return migrator.WithSession(session).RollBackTo(connStr, db.MigrationsPath, entry.VersionBefore)
+		}()
+		if err != nil {
+			slog.Error("atomic group rollback failed", "database", db.Name, "error", err)
+			fmt.Fprintf(errOut, "  Error: rollback failed, %q is still at version %d or dirty: %v\n", db.Name, reached, err)
+			errs = append(errs, fmt.Sprintf("%s: rollback after %q failed: %v", db.Name, failed, err))
+			entry.Error = fmt.Sprintf("rollback after %q failed: %v", failed, err)
+			saveRun(store, run)
+			continue
+		}
+
+		fmt.Fprintf(out, "  Rolled back to version %d\n", result.VersionAfter)
+		run.Record(state.DatabaseRun{
+			Name:          db.Name,
+			Status:        state.StatusRolledBack,
+			VersionBefore: entry.VersionBefore,
+			VersionAfter:  result.VersionAfter,
+			Error:         fmt.Sprintf("rolled back from version %d because %q failed", reached, failed),
+		})
+		saveRun(store, run)
+	}
+	return errs
+}
@@ -0,0 +1,290 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func benchCommand() *cli.Command {
+	iterationsFlag := func() cli.Flag {
+		return &cli.IntFlag{
+			Name:    "iterations",
+			Aliases: []string{"n"},
+			Usage:   "Number of times to repeat the operation",
+			Value:   5,
+		}
+	}
+
+	return &cli.Command{
+		Name:  "bench",
+		Usage: "Time discovery and status on this app with per-phase breakdowns",
+		Commands: []*cli.Command{
+			{
+				Name:  "discovery",
+				Usage: "Time database discovery: walking and parsing (parse-cpu sums the parsing workers), then deduplicating",
+				Flags: []cli.Flag{iterationsFlag()},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return benchDiscovery(ctx, cmd)
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "Time status: loading the config, discovery, resolving connections and reading versions",
+				Flags: []cli.Flag{
+					iterationsFlag(),
+					&cli.StringFlag{
+						Name:    "database",
+						Aliases: []string{"d"},
+						Usage:   "Benchmark only this Encore database",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return benchStatus(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+// benchReport is the `bench` document with the global --output json.
+// Counters are per iteration; phase durations are in microseconds.
+//
+//	{"schema_version": 1, "benchmark": "status", "iterations": 5, "counters": {"databases": 3, "connections_opened": 3},
+//	 "phases": [{"name": "status", "min_us": 8120, "mean_us": 9433, "max_us": 12011}]}
+type benchReport struct {
+	SchemaVersion int            `json:"schema_version"`
+	Benchmark     string         `json:"benchmark"`
+	Iterations    int            `json:"iterations"`
+	Counters      map[string]int `json:"counters"`
+	Phases        []benchPhase   `json:"phases"`
+}
+
+type benchPhase struct {
+	Name   string `json:"name"`
+	MinUS  int64  `json:"min_us"`
+	MeanUS int64  `json:"mean_us"`
+	MaxUS  int64  `json:"max_us"`
+}
+
+// benchTimings collects the duration of each phase across iterations
+type benchTimings struct {
+	order   []string
+	samples map[string][]time.Duration
+}
+
+func (t *benchTimings) add(phase string, d time.Duration) {
+	if t.samples == nil {
+		t.samples = make(map[string][]time.Duration)
+	}
+	if _, ok := t.samples[phase]; !ok {
+		t.order = append(t.order, phase)
+	}
+	t.samples[phase] = append(t.samples[phase], d)
+}
+
+// phases summarizes the samples in the order the phases first ran
+func (t *benchTimings) phases() []benchPhase {
+	phases := make([]benchPhase, 0, len(t.order))
+	for _, name := range t.order {
+		samples := t.samples[name]
+		lo, hi, sum := samples[0], samples[0], time.Duration(0)
+		for _, d := range samples {
+			lo, hi, sum = min(lo, d), max(hi, d), sum+d
+		}
+		phases = append(phases, benchPhase{
+			Name:   name,
+			MinUS:  lo.Microseconds(),
+			MeanUS: (sum / time.Duration(len(samples))).Microseconds(),
+			MaxUS:  hi.Microseconds(),
+		})
+	}
+	return phases
+}
+
+func benchIterations(cmd *cli.Command) (int, error) {
+	n := cmd.Int("iterations")
+	if n < 1 {
+		return 0, fmt.Errorf("--iterations must be at least 1")
+	}
+	return n, nil
+}
+
+func benchDiscovery(ctx context.Context, cmd *cli.Command) error {
+	iterations, err := benchIterations(cmd)
+	if err != nil {
+		return err
+	}
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+
+	opts, err := discoveryOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	report := benchReport{SchemaVersion: reportSchemaVersion, Benchmark: "discovery", Iterations: iterations, Counters: map[string]int{}}
+	var timings benchTimings
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		var databases []types.EncoreDatabase
+		if opts.ManifestPath != "" || opts.Mode == discovery.ModeTyped {
+			databases, err = discovery.New(opts).Discover(root)
+			if err != nil {
+				return fmt.Errorf("discovering databases: %w", err)
+			}
+			phase := "manifest"
+			if opts.ManifestPath == "" {
+				phase = "typed-load"
+			}
+			timings.add(phase, time.Since(start))
+		} else {
+			d := &discovery.ASTDiscoverer{MaxFileSize: opts.MaxFileSize, SkipDirs: opts.SkipDirs, IncludeDirs: opts.IncludeDirs}
+			databases, err = d.Discover(root)
+			if err != nil {
+				return fmt.Errorf("discovering databases: %w", err)
+			}
+			timings.add("discover", time.Since(start))
+			timings.add("parse-cpu", d.ParseTime)
+			report.Counters["files_parsed"] = d.FilesParsed
+			report.Counters["files_skipped"] = d.FilesSkipped
+		}
+
+		dedupeStart := time.Now()
+		databases = discovery.DeduplicateDatabases(databases)
+		timings.add("dedupe", time.Since(dedupeStart))
+		timings.add("total", time.Since(start))
+		report.Counters["databases"] = len(databases)
+	}
+
+	report.Phases = timings.phases()
+	return printBenchReport(cmd, report)
+}
+
+func benchStatus(ctx context.Context, cmd *cli.Command) error {
+	iterations, err := benchIterations(cmd)
+	if err != nil {
+		return err
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	migrator := newMigrator(cmd)
+
+	report := benchReport{SchemaVersion: reportSchemaVersion, Benchmark: "status", Iterations: iterations, Counters: map[string]int{}}
+	var timings benchTimings
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+		if err != nil {
+			return fmt.Errorf("loading InfraConfig: %w", err)
+		}
+		timings.add("config", time.Since(start))
+
+		phaseStart := time.Now()
+		databases, err := discoverDatabases(cmd)
+		if err != nil {
+			return err
+		}
+		if target := cmd.String("database"); target != "" {
+			databases = discovery.FilterDatabases(databases, target)
+			if len(databases) == 0 {
+				return fmt.Errorf("database %q not found", target)
+			}
+		}
+		timings.add("discover", time.Since(phaseStart))
+
+		phaseStart = time.Now()
+		type target struct {
+			db      types.EncoreDatabase
+			connStr string
+			session migration.SessionOptions
+		}
+		var targets []target
+		for _, db := range databases {
+			mapping, err := infraConfig.GetMapping(db.Name)
+			if err != nil {
+				slog.Debug("no config for database", "database", db.Name, "error", err)
+				continue
+			}
+			if err := applyConnectionOverrides(cmd, mapping); err != nil {
+				return err
+			}
+			connStr, err := migration.BuildConnectionString(mapping)
+			if err != nil {
+				return fmt.Errorf("%s: %w", db.Name, err)
+			}
+			session, err := sessionOptions(cmd, project, db.Name)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target{db: db, connStr: connStr, session: session})
+		}
+		timings.add("resolve", time.Since(phaseStart))
+
+		phaseStart = time.Now()
+		opened := migration.ConnectionsOpened()
+		for _, t := range targets {
+			if _, err := migrator.WithSession(t.session).GetStatus(t.connStr, t.db.MigrationsPath); err != nil {
+				return fmt.Errorf("%s: %w", t.db.Name, err)
+			}
+		}
+		timings.add("status", time.Since(phaseStart))
+		timings.add("total", time.Since(start))
+
+		report.Counters["databases"] = len(targets)
+		report.Counters["connections_opened"] = int(migration.ConnectionsOpened() - opened)
+	}
+
+	report.Phases = timings.phases()
+	return printBenchReport(cmd, report)
+}
+
+func printBenchReport(cmd *cli.Command, report benchReport) error {
+	return outputRenderer(cmd).report(os.Stdout, report)
+}
+
+func (report benchReport) text(w io.Writer) {
+	fmt.Fprintf(w, "Benchmark %s: %d iterations", report.Benchmark, report.Iterations)
+	for _, name := range []string{"databases", "files_parsed", "files_skipped", "connections_opened"} {
+		if n, ok := report.Counters[name]; ok {
+			fmt.Fprintf(w, ", %d %s", n, strings.ReplaceAll(name, "_", " "))
+		}
+	}
+	fmt.Fprintf(w, " per iteration\n\n")
+
+	fmt.Fprintf(w, "%-10s %12s %12s %12s\n", "PHASE", "MIN", "MEAN", "MAX")
+	for _, p := range report.Phases {
+		fmt.Fprintf(w, "%-10s %12s %12s %12s\n", p.Name, usDuration(p.MinUS), usDuration(p.MeanUS), usDuration(p.MaxUS))
+	}
+}
+
+func (report benchReport) markdown(w io.Writer) {
+	fmt.Fprintf(w, "### Benchmark `%s` (%d iterations)\n\n", report.Benchmark, report.Iterations)
+	fmt.Fprintf(w, "| Phase | Min | Mean | Max |\n")
+	fmt.Fprintf(w, "|---|---|---|---|\n")
+	for _, p := range report.Phases {
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", p.Name, usDuration(p.MinUS), usDuration(p.MeanUS), usDuration(p.MaxUS))
+	}
+}
+
+// records are the report itself, on one line
+func (report benchReport) records() []any { return []any{report} }
+
+func usDuration(us int64) time.Duration {
+	return time.Duration(us) * time.Microsecond
+}
@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+func cancelCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "cancel",
+		Usage: "Cancel a running migration by signalling its database backend",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Encore database name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "run-id",
+				Usage: "Only cancel backends of this run (default: any migrator run)",
+			},
+			&cli.BoolFlag{
+				Name:  "terminate",
+				Usage: "Terminate the backend (pg_terminate_backend) instead of cancelling its statement",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return cancelRun(ctx, cmd)
+		},
+	}
+}
+
+func cancelRun(ctx context.Context, cmd *cli.Command) error {
+	db, mapping, err := resolveDatabase(cmd, cmd.String("database"))
+	if err != nil {
+		return err
+	}
+
+	// Signalling another role's backend needs elevated privileges
+	connStr, err := migration.BuildConnectionString(adminMapping(cmd, mapping))
+	if err != nil {
+		return fmt.Errorf("building connection string: %w", err)
+	}
+
+	migrator := newMigrator(cmd)
+	backends, err := migrator.CancelRun(connStr, cmd.String("run-id"), cmd.Bool("terminate"))
+	if err != nil {
+		return fmt.Errorf("cancelling migration: %w", err)
+	}
+
+	if len(backends) == 0 {
+		fmt.Printf("No running migration found for %q\n", db.Name)
+		return nil
+	}
+
+	store, err := stateStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	action := "Cancelled"
+	if cmd.Bool("terminate") {
+		action = "Terminated"
+	}
+
+	for _, b := range backends {
+		fmt.Printf("%s backend %d (run %s, %s): %s\n", action, b.PID, b.RunID, b.State, b.Query)
+		markCancelled(store, b.RunID, db.Name)
+	}
+
+	fmt.Printf("The database may be left dirty; check with: encore-migrator status -d %s\n", db.Name)
+	return nil
+}
+
+// markCancelled records the cancellation in the local run state, if this
+// machine has state for the run
+func markCancelled(store *state.Store, runID, database string) {
+	run, err := store.LoadRun(runID)
+	if err != nil {
+		if !errors.Is(err, state.ErrRunNotFound) {
+			slog.Warn("failed to load run state", "run_id", runID, "error", err)
+		}
+		return
+	}
+
+	entry := state.DatabaseRun{Name: database}
+	if existing := run.Database(database); existing != nil {
+		entry = *existing
+		entry.FinishedAt = nil
+	}
+	entry.Status = state.StatusCancelled
+	entry.Error = "cancelled by operator"
+	run.Record(entry)
+	saveRun(store, run)
+}
@@ -0,0 +1,81 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// downWithCheckpoints rolls back what down --steps or --all asks for in
+// chunks of --checkpoint-interval migrations, printing the version reached
+// after each. It reports paused when the operator stops at a checkpoint;
+// the result then holds the versions rolled back so far.
+func downWithCheckpoints(ctx context.Context, cmd *cli.Command, out io.Writer, m *migration.Migrator, connStr string, db types.EncoreDatabase) (*types.MigrationResult, bool, error) {
+	steps := int(cmd.Int("steps"))
+	if cmd.Bool("all") {
+		steps = 0
+	}
+	// Planned up front: asking golang-migrate for more steps than are left is an error
+	plan, err := m.Plan(connStr, db.MigrationsPath, "down", steps)
+	if err != nil {
+		return nil, false, err
+	}
+	interval, left := int(cmd.Int("checkpoint-interval")), len(plan.Steps)
+	result := &types.MigrationResult{Direction: "down", VersionBefore: plan.CurrentVersion, VersionAfter: plan.CurrentVersion}
+	for left > 0 {
+		chunk, err := m.Down(connStr, db.MigrationsPath, min(interval, left))
+		if err != nil {
+			return nil, false, err
+		}
+		result.VersionAfter = chunk.VersionAfter
+		result.Statements = append(result.Statements, chunk.Statements...)
+		result.Server = chunk.Server
+		left -= min(interval, left)
+		if left == 0 {
+			break
+		}
+		fmt.Fprintf(out, "  Checkpoint: version %d, %d more to roll back\n", chunk.VersionAfter, left)
+		proceed, err := continueAtCheckpoint(ctx, cmd, db.Name, chunk.VersionAfter)
+		if err != nil {
+			return nil, false, err
+		}
+		if !proceed {
+			return result, true, nil
+		}
+	}
+	return result, false, nil
+}
+
+// continueAtCheckpoint waits --checkpoint-wait and then, on a terminal
+// without --yes, asks whether to roll back further
+func continueAtCheckpoint(ctx context.Context, cmd *cli.Command, name string, version uint) (bool, error) {
+	if wait := cmd.Duration("checkpoint-wait"); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	if cmd.Bool("yes") || !isTerminal(os.Stdin) {
+		return true, nil
+	}
+	fmt.Fprintf(os.Stderr, "Continue rolling back %q from version %d? [y/N] ", name, version)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("reading confirmation: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,248 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+)
+
+// modulePath is where CI installs the CLI from
+const modulePath = "github.com/theoffensivecoder/encoredev-migrator"
+
+func ciCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ci",
+		Usage: "CI pipeline helpers",
+		Commands: []*cli.Command{
+			{
+				Name:  "generate",
+				Usage: "Emit a pipeline that checks migrations on pull requests and applies them on deploy",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "provider",
+						Usage:    "CI provider: github or gitlab",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the pipeline to this file instead of stdout",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return generateCI(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+// pipeline holds the values the CI templates are rendered with
+type pipeline struct {
+	Branch      string
+	Environment string
+	Install     string   // go install target
+	Migrator    string   // encore-migrator invocation including global flags
+	UpFlags     string   // extra flags for up
+	Secrets     []string // environment variables the jobs need from CI secrets
+}
+
+func generateCI(ctx context.Context, cmd *cli.Command) error {
+	provider := cmd.String("provider")
+	tmpl, ok := ciTemplates[provider]
+	if !ok {
+		return fmt.Errorf("unsupported provider %q: expected github or gitlab", provider)
+	}
+
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	p, err := buildPipeline(cmd, project)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, p); err != nil {
+		return fmt.Errorf("rendering %s pipeline: %w", provider, err)
+	}
+
+	out := cmd.String("out")
+	if out == "" {
+		fmt.Print(b.String())
+		return nil
+	}
+	if err := os.WriteFile(out, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("writing pipeline: %w", err)
+	}
+	fmt.Printf("Wrote %s pipeline to %s\n", provider, out)
+	return nil
+}
+
+// buildPipeline derives the pipeline parameters from the project config and global flags
+func buildPipeline(cmd *cli.Command, project *config.ProjectConfig) (*pipeline, error) {
+	ci := project.CI
+
+	p := &pipeline{
+		Branch:      ci.Branch,
+		Environment: ci.Environment,
+	}
+	if p.Branch == "" {
+		p.Branch = "main"
+	}
+	if p.Environment == "" {
+		p.Environment = "production"
+	}
+
+	version := ci.Version
+	if version == "" {
+		version = Version
+	}
+	if version == "" || version == "dev" {
+		version = "latest"
+	}
+	p.Install = modulePath + "@" + version
+
+	configPath := ci.Config
+	if configPath == "" {
+		configPath = cmd.String("config")
+	}
+
+	args := []string{"encore-migrator", "--config", configPath}
+	if appSource != "" {
+		args = append(args, "--app", appSource)
+	} else if cmd.IsSet("app") {
+		args = append(args, "--app", cmd.String("app"))
+	}
+	if cmd.IsSet("manifest") {
+		args = append(args, "--manifest", cmd.String("manifest"))
+	}
+	if cmd.IsSet("project-config") {
+		args = append(args, "--project-config", cmd.String("project-config"))
+	}
+	if ci.Profile != "" {
+		if _, err := project.Profile(ci.Profile); err != nil {
+			return nil, err
+		}
+		args = append(args, "--profile", ci.Profile)
+	}
+	p.Migrator = strings.Join(args, " ")
+
+	for _, db := range project.Databases {
+		if len(db.Extensions) > 0 {
+			p.UpFlags = " --create-extensions"
+			break
+		}
+	}
+
+	// Credentials referenced by the InfraConfig must come from CI secrets
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		slog.Warn("could not read InfraConfig; add its $env variables to the pipeline by hand", "error", err)
+	} else {
+		p.Secrets = infraConfig.EnvVars()
+	}
+
+	return p, nil
+}
+
+// ciTemplates are keyed by provider. Pull requests list discovered databases,
+// validate their migration files, check the migration lockfile and show
+// pending versions; pushes to the deploy branch apply them.
+var ciTemplates = map[string]*template.Template{
+	"github": template.Must(template.New("github").Parse(`# Generated by encore-migrator ci generate --provider github
+name: Database migrations
+
+on:
+  pull_request:
+  push:
+    branches: [{{.Branch}}]
+
+jobs:
+  check:
+    if: github.event_name == 'pull_request'
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: stable
+      - run: go install {{.Install}}
+      - name: Discover databases
+        run: {{.Migrator}} list
+      - name: Validate migration files
+        run: {{.Migrator}} validate
+      - name: Migration lockfile
+        run: {{.Migrator}} state snapshot --check
+      - name: Pending migrations
+        run: {{.Migrator}} up --dry-run
+{{- if .Secrets}}
+        env:
+{{- range .Secrets}}
+          {{.}}: ${{"{{"}} secrets.{{.}} {{"}}"}}
+{{- end}}
+{{- end}}
+
+  migrate:
+    if: github.event_name == 'push'
+    runs-on: ubuntu-latest
+    environment: {{.Environment}}
+    concurrency:
+      group: encore-migrator-{{.Environment}}
+      cancel-in-progress: false
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: stable
+      - run: go install {{.Install}}
+      - name: Apply migrations
+        run: {{.Migrator}} up{{.UpFlags}}
+{{- if .Secrets}}
+        env:
+{{- range .Secrets}}
+          {{.}}: ${{"{{"}} secrets.{{.}} {{"}}"}}
+{{- end}}
+{{- end}}
+`)),
+	"gitlab": template.Must(template.New("gitlab").Parse(`# Generated by encore-migrator ci generate --provider gitlab
+{{- if .Secrets}}
+# Define these as masked CI/CD variables: {{range $i, $s := .Secrets}}{{if $i}}, {{end}}{{$s}}{{end}}
+{{- end}}
+
+.encore-migrator:
+  image: golang:1.24
+  before_script:
+    - go install {{.Install}}
+    - export PATH="$(go env GOPATH)/bin:$PATH"
+
+migrations:check:
+  extends: .encore-migrator
+  stage: test
+  rules:
+    - if: $CI_PIPELINE_SOURCE == "merge_request_event"
+  script:
+    - {{.Migrator}} list
+    - {{.Migrator}} validate
+    - {{.Migrator}} state snapshot --check
+    - {{.Migrator}} up --dry-run
+
+migrations:up:
+  extends: .encore-migrator
+  stage: deploy
+  environment: {{.Environment}}
+  resource_group: encore-migrator-{{.Environment}}
+  rules:
+    - if: $CI_COMMIT_BRANCH == "{{.Branch}}"
+  script:
+    - {{.Migrator}} up{{.UpFlags}}
+`)),
+}
@@ -0,0 +1,279 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+)
+
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Inspect the configuration the migrator will use",
+		Commands: []*cli.Command{
+			{
+				Name:  "effective",
+				Usage: "Print the effective merged configuration with the source of every field (precedence: " + precedenceDoc + ")",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return showEffectiveConfig(ctx, cmd)
+				},
+			},
+			{
+				Name:  "show",
+				Usage: "Print the InfraConfig as JSON with credentials redacted",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "resolved",
+						Usage: "Resolve $env references and apply profile, env and flag overrides before printing",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return showConfig(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+func showEffectiveConfig(ctx context.Context, cmd *cli.Command) error {
+	fmt.Printf("Precedence (lowest to highest): %s\n", precedenceDoc)
+
+	fmt.Printf("\nGlobal settings:\n")
+	for _, name := range []string{"config", "app", "manifest"} {
+		printGlobal(cmd, name, cmd.String(name))
+	}
+
+	projectPath, projectSource := cmd.String("project-config"), "flag --project-config"
+	if projectPath == "" {
+		appPath := cmd.String("app")
+		if appPath == "" {
+			appPath = "."
+		}
+		projectPath, projectSource = config.FindProjectConfig(appPath), "auto-detected"
+	}
+	printSetting("project-config", setting{Value: projectPath, Source: projectSource})
+
+	store, err := stateStore(cmd)
+	if err != nil {
+		return err
+	}
+	stateSource := "default"
+	if cmd.IsSet("state-dir") {
+		stateSource = "flag --state-dir"
+		if os.Getenv(envStateDir) == cmd.String("state-dir") {
+			stateSource = "env " + envStateDir
+		}
+	}
+	printSetting("state-dir", setting{Value: store.Dir(), Source: stateSource})
+
+	overrides, err := resolveOverrides(cmd)
+	if err != nil {
+		return err
+	}
+	printSetting("profile", overrides.Profile)
+
+	fmt.Printf("\nConnection overrides:\n")
+	fmt.Printf("  %s\n", describeSetting("host", overrides.Host, false))
+	fmt.Printf("  %s\n", describeSetting("user", overrides.User, false))
+	fmt.Printf("  %s\n", describeSetting("password", overrides.Password, true))
+	fmt.Printf("  %s\n", describeSetting("ssh", overrides.SSH, false))
+	fmt.Printf("  %s\n", describeSetting("ssh key", overrides.SSHKey, false))
+	fmt.Printf("  %s\n", describeSetting("db suffix", overrides.DatabaseSuffix, false))
+
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+
+	names := infraConfig.ListDatabaseNames()
+	sort.Strings(names)
+
+	fmt.Printf("\nDatabases:\n")
+	for _, name := range names {
+		fmt.Printf("  %s:\n", name)
+
+		mapping, res, err := infraConfig.ResolveMapping(name)
+		if err != nil {
+			fmt.Printf("    error: %v\n", err)
+			continue
+		}
+
+		serverSource := fmt.Sprintf("config file sql_servers[%d].host", res.ServerIndex)
+		hostSource, userSource, passwordSource := serverSource, "", ""
+		for _, f := range res.Fields {
+			src := fieldSource(f)
+			switch f.Field {
+			case "username":
+				userSource = src
+			case "password":
+				passwordSource = src
+			}
+		}
+		if overrides.Host.Set() {
+			hostSource = overrides.Host.Source
+		}
+		if overrides.User.Set() {
+			userSource = overrides.User.Source
+		}
+		if overrides.Password.Set() {
+			passwordSource = overrides.Password.Source
+		}
+
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+
+		nameSource := ""
+		for _, f := range res.Fields {
+			if f.Field == "name" {
+				nameSource = fieldSource(f)
+			}
+		}
+		if overrides.DatabaseSuffix.Set() {
+			nameSource += " + suffix from " + overrides.DatabaseSuffix.Source
+		}
+
+		if mapping.CloudSQLInstance != "" && mapping.Host == "" {
+			printField("cloudsql_instance", mapping.CloudSQLInstance, "config file")
+			printField("cloudsql_iam_auth", fmt.Sprint(mapping.CloudSQLIAMAuth), "config file")
+		} else {
+			printField("host", mapping.Host, hostSource)
+			printField("port", mapping.Port, hostSource)
+			if mapping.SSHBastion != "" {
+				printField("ssh", mapping.SSHBastion, overrides.SSH.Source)
+			}
+			if mapping.KerberosServiceName != "" {
+				printField("krb_srvname", mapping.KerberosServiceName, "config file")
+			}
+			if mapping.KerberosSPN != "" {
+				printField("krb_spn", mapping.KerberosSPN, "config file")
+			}
+		}
+		printField("database", mapping.PGDBName, nameSource)
+		printField("user", mapping.Username, userSource)
+		printField("password", "(redacted)", passwordSource)
+		printField("sslmode", mapping.SSLMode, "config file: "+res.SSLReason)
+		for _, f := range tlsFields(mapping) {
+			printField(f[0], f[1], "config file: tls_config")
+		}
+		if mapping.TLSMinVersion != "" {
+			minVersion, err := minTLSVersion(cmd)
+			if err != nil {
+				return err
+			}
+			printField("tls_min_version", mapping.TLSMinVersion, minVersion.Source)
+		}
+	}
+
+	return nil
+}
+
+func showConfig(ctx context.Context, cmd *cli.Command) error {
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+
+	if cmd.Bool("resolved") {
+		infraConfig, err = infraConfig.Resolved()
+		if err != nil {
+			// Unresolved references stay as $env so the rest of the config can still be checked
+			slog.Warn("some $env references could not be resolved", "error", err)
+		}
+
+		overrides, err := resolveOverrides(cmd)
+		if err != nil {
+			return err
+		}
+		applyConfigOverrides(infraConfig, overrides)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(infraConfig.Redacted()); err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+	return nil
+}
+
+// applyConfigOverrides applies connection overrides to every server and database in the config
+func applyConfigOverrides(c *config.InfraConfig, overrides *connectionOverrides) {
+	for i := range c.SQLServers {
+		server := &c.SQLServers[i]
+		if overrides.Host.Set() {
+			server.Host = overrides.Host.Value
+		}
+		for name, db := range server.Databases {
+			if overrides.User.Set() {
+				db.Username = config.StringOrEnvRef{Value: overrides.User.Value}
+			}
+			if overrides.Password.Set() {
+				db.Password = config.StringOrEnvRef{Value: overrides.Password.Value}
+			}
+			if overrides.DatabaseSuffix.Set() && db.Name.IsLiteral() {
+				pgName := db.Name.Value
+				if pgName == "" {
+					pgName = name
+				}
+				db.Name = config.StringOrEnvRef{Value: pgName + overrides.DatabaseSuffix.Value}
+			}
+			server.Databases[name] = db
+		}
+	}
+}
+
+// printGlobal prints a global flag value noting whether it was set or defaulted
+func printGlobal(cmd *cli.Command, name, value string) {
+	source := "default"
+	if cmd.IsSet(name) {
+		source = "flag --" + name
+		// A flag that matches the env var is indistinguishable from it, and equivalent
+		if name == "config" && os.Getenv(envConfig) == value {
+			source = "env " + envConfig
+		}
+	}
+	printSetting(name, setting{Value: value, Source: source})
+}
+
+// printSetting prints a global setting and its source
+func printSetting(name string, s setting) {
+	value := s.Value
+	if value == "" {
+		fmt.Printf("  %-16s (none)\n", name)
+		return
+	}
+	if name == "app" || name == "config" {
+		if abs, err := filepath.Abs(value); err == nil {
+			value = abs
+		}
+	}
+	fmt.Printf("  %-16s %-40s [%s]\n", name, value, s.Source)
+}
+
+// printField prints a resolved database field and its source
+func printField(name, value, source string) {
+	fmt.Printf("    %-10s %-30s [%s]\n", name, value, source)
+}
+
+// fieldSource describes where an InfraConfig field came from
+func fieldSource(f config.FieldResolution) string {
+	switch f.Source {
+	case "env":
+		return "env " + f.EnvVar + " (via config file)"
+	case "exec":
+		return "command " + f.Exec + " (via config file)"
+	case "default":
+		return "default (Encore name)"
+	default:
+		return "config file"
+	}
+}
@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+// yesFlag skips the confirmation of a destructive operation
+func yesFlag() *cli.BoolFlag {
+	return &cli.BoolFlag{
+		Name:  "yes",
+		Usage: "Don't ask to type the database name first (for automation; required when stdin is not a terminal)",
+	}
+}
+
+// confirmDestructive asks the user to type the name of each database before
+// an operation that can lose data or tracking state. --yes skips the prompt;
+// without it stdin must be a terminal, so a script never hangs on it.
+func confirmDestructive(cmd *cli.Command, action string, names []string) error {
+	if cmd.Bool("yes") {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("refusing to %s without confirmation: stdin is not a terminal; pass --yes to proceed", action)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	fmt.Fprintf(os.Stderr, "About to %s.\n", action)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "Type %q to confirm: ", name)
+		answer, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading confirmation: %w", err)
+		}
+		if strings.TrimSpace(answer) != name {
+			return fmt.Errorf("confirmation did not match %q; nothing was changed", name)
+		}
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a character device such as a terminal,
+// other than the null device CI jobs often get as stdin
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
@@ -0,0 +1,176 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func createCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "create",
+		Usage:     "Scaffold the next up/down migration files for a database",
+		ArgsUsage: "<name> | --with-down-from up [version]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Encore database to add the migration to",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "numbering",
+				Usage: "Version numbering: sequential (latest version + 1) or timestamp (UTC YYYYMMDDHHMMSS)",
+				Value: migration.NumberingSequential,
+			},
+			&cli.StringFlag{
+				Name:  "with-down-from",
+				Usage: "Instead of scaffolding, draft the down file of an existing migration (the latest, or the version given as argument) by inverting its up file; the only source is \"up\"",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "With --with-down-from, overwrite a down file that already has statements",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := requireAppDirectory("create migration files"); err != nil {
+				return err
+			}
+			if cmd.IsSet("with-down-from") {
+				return createDownFromUp(ctx, cmd)
+			}
+			return createMigration(ctx, cmd)
+		},
+	}
+}
+
+func createMigration(ctx context.Context, cmd *cli.Command) error {
+	name := migration.MigrationName(strings.Join(cmd.Args().Slice(), " "))
+	if name == "" {
+		return fmt.Errorf("usage: create --database <db> <name>")
+	}
+
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	databases = discovery.FilterDatabases(databases, cmd.String("database"))
+	if len(databases) == 0 {
+		return fmt.Errorf("database %q not found", cmd.String("database"))
+	}
+	dir := databases[0].MigrationsPath
+
+	files, err := migration.ListFiles(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	version, width, err := migration.NextVersion(files, cmd.String("numbering"), time.Now())
+	if err != nil {
+		return err
+	}
+
+	up, down, err := migration.CreateFiles(dir, version, width, name)
+	if err != nil {
+		return err
+	}
+
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{up, down} {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+		fmt.Printf("Created %s\n", path)
+	}
+	return nil
+}
+
+// createDownFromUp writes a best-effort down file for a migration once its up
+// file has been written, inverting the simple statements and leaving TODOs
+// for the rest
+func createDownFromUp(ctx context.Context, cmd *cli.Command) error {
+	if from := cmd.String("with-down-from"); from != "up" {
+		return fmt.Errorf("--with-down-from: unknown source %q (want up)", from)
+	}
+
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	databases = discovery.FilterDatabases(databases, cmd.String("database"))
+	if len(databases) == 0 {
+		return fmt.Errorf("database %q not found", cmd.String("database"))
+	}
+	dir := databases[0].MigrationsPath
+
+	files, err := migration.ListFiles(dir)
+	if err != nil {
+		return err
+	}
+	up := migration.UpFiles(files)
+	if len(up) == 0 {
+		return fmt.Errorf("no up migrations in %s", dir)
+	}
+	target := up[len(up)-1]
+	if arg := cmd.Args().First(); arg != "" {
+		version, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", arg)
+		}
+		found := false
+		for _, f := range up {
+			if f.Version == uint(version) {
+				target, found = f, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no up migration with version %d", version)
+		}
+	}
+
+	content, err := os.ReadFile(target.Path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", target.Name, err)
+	}
+	down, todo := migration.DownFromUp(target.Name, string(content))
+
+	path := downPath(dir, target)
+	if existing, err := os.ReadFile(path); err == nil && len(migration.SplitStatements(string(existing))) > 0 && !cmd.Bool("force") {
+		return fmt.Errorf("%s already has statements; use --force to overwrite it", filepath.Base(path))
+	}
+	if err := os.WriteFile(path, []byte(down), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(root, path); err == nil {
+		path = rel
+	}
+	fmt.Printf("Wrote %s\n", path)
+	if todo > 0 {
+		fmt.Printf("%d statements could not be inverted; see the TODO comments\n", todo)
+	}
+	return nil
+}
+
+// downPath is where the down file pairing an up migration file goes
+func downPath(dir string, up migration.File) string {
+	ext := filepath.Ext(up.Name)
+	return filepath.Join(dir, strings.TrimSuffix(strings.TrimSuffix(up.Name, ext), ".up")+".down"+ext)
+}
@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func cutoverCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "cutover",
+		Usage: "Switch the default search_path to the blue/green schema given by --schema (cut over to the old schema to roll back)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name to cut over (default: all)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return cutover(ctx, cmd)
+		},
+	}
+}
+
+func cutover(ctx context.Context, cmd *cli.Command) error {
+	schema := cmd.String("schema")
+	if schema == "" {
+		return fmt.Errorf("cutover requires --schema (or %s) naming the schema to make live", envSchema)
+	}
+
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if targetDB := cmd.String("database"); targetDB != "" {
+		databases = discovery.FilterDatabases(databases, targetDB)
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found", targetDB)
+		}
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+
+	migrator := newMigrator(cmd)
+
+	fmt.Printf("Cutting over to schema %s:\n", schema)
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+
+		connStr, err := migration.BuildConnectionString(adminMapping(cmd, mapping))
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+
+		result, err := migrator.Cutover(connStr, migration.Cutover{
+			Database: mapping.PGDBName,
+			Role:     mapping.Username,
+			Schema:   schema,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+
+		previous := result.Previous
+		if previous == "" {
+			previous = "(server default)"
+		}
+		fmt.Printf("  %-20s search_path %s -> %s (version %d)\n", db.Name, previous, result.Current, result.Version)
+	}
+
+	fmt.Println("\nNew sessions use the new schema; restart or recycle connection pools to move existing ones.")
+	return nil
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// checkPending checks the migrations up is about to apply to db: unknown
+// directives warn, and the destructive rules lint them. Issues only warn
+// unless blocking is on, with --block-destructive or lint.block_destructive,
+// and --allow-destructive is not set; then issues at error severity refuse
+// the database.
+func checkPending(cmd *cli.Command, errOut io.Writer, project *config.ProjectConfig, m *migration.Migrator, connStr string, db types.EncoreDatabase, phase migration.Phase, steps int) error {
+	settings := project.LintSettings(db.Name)
+	opts := migration.LintOptions{Severities: settings.Rules, EarlyMigrations: settings.EarlyMigrations}
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("lint settings: %w", err)
+	}
+	files, err := pendingUpFiles(m, connStr, db, phase, steps)
+	if err != nil {
+		return err
+	}
+	if err := warnUnknownDirectives(errOut, files); err != nil {
+		return err
+	}
+	issues, err := migration.LintDestructive(files, opts)
+	if err != nil {
+		return err
+	}
+
+	block := (cmd.Bool("block-destructive") || settings.BlockDestructive) && !cmd.Bool("allow-destructive")
+	var refused []string
+	for _, issue := range issues {
+		line := fmt.Sprintf("%s:%d: %s [%s]", issue.File, issue.Line, issue.Message, issue.Rule)
+		if block && issue.Severity == migration.SeverityError {
+			refused = append(refused, line)
+			continue
+		}
+		warn(errOut, warnDestructiveSQL, "%s", line)
+	}
+	if len(refused) > 0 {
+		return fmt.Errorf("refusing destructive statements (review them, then pass --allow-destructive):\n    %s", strings.Join(refused, "\n    "))
+	}
+	return nil
+}
+
+// warnUnknownDirectives warns about the directives of up files the migrator
+// does not act on, which are usually misspelt and would otherwise be ignored
+func warnUnknownDirectives(errOut io.Writer, files []migration.File) error {
+	for _, f := range files {
+		if f.Direction != "up" {
+			continue
+		}
+		directives, err := migration.ReadDirectives(f.Path)
+		if err != nil {
+			return err
+		}
+		for _, name := range directives.Unknown() {
+			warn(errOut, warnUnknownDirective, "%s: unknown directive %q is ignored", f.Name, name)
+		}
+	}
+	return nil
+}
+
+// pendingUpFiles returns the up migrations an up run with these options would apply
+func pendingUpFiles(m *migration.Migrator, connStr string, db types.EncoreDatabase, phase migration.Phase, steps int) ([]migration.File, error) {
+	plan, err := m.Plan(connStr, db.MigrationsPath, "up", steps)
+	if err != nil {
+		return nil, fmt.Errorf("planning the migrations to lint: %w", err)
+	}
+	var files []migration.File
+	for _, step := range plan.Steps {
+		if step.File != nil {
+			files = append(files, *step.File)
+		}
+	}
+	if phase == "" {
+		return files, nil
+	}
+	phased, err := migration.ReadPhases(db.MigrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	n, err := migration.PhaseSteps(phased, plan.CurrentVersion, phase)
+	if err != nil {
+		return nil, err
+	}
+	return files[:min(n, len(files))], nil
+}
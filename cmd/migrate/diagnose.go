@@ -0,0 +1,129 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// maxDiagnosisLines caps how much of the dirty migration file is printed
+const maxDiagnosisLines = 40
+
+// printFailureState prints the version, dirty flag and pending files of a database after a failure
+func printFailureState(w io.Writer, inspection *migration.Inspection) {
+	dirty := "no"
+	if inspection.Dirty {
+		dirty = "YES"
+	}
+	fmt.Fprintf(w, "  State after failure: version %d, dirty: %s, %d pending\n", inspection.Version, dirty, len(inspection.Pending))
+	for _, f := range inspection.Pending {
+		fmt.Fprintf(w, "    %s\n", f.Name)
+	}
+}
+
+// reportDirtyState prints a recovery report if a failed migration left the database dirty
+func reportDirtyState(migrator *migration.Migrator, store *state.Store, runID string, db types.EncoreDatabase, connStr string, migErr error) {
+	status, err := migrator.GetStatus(connStr, db.MigrationsPath)
+	if err != nil || !status.Dirty {
+		return
+	}
+
+	diag, err := migrator.Diagnose(connStr, db.MigrationsPath, status.Version)
+	if diag == nil {
+		slog.Warn("failed to diagnose dirty state", "database", db.Name, "error", err)
+		return
+	}
+	if err != nil {
+		slog.Debug("partial dirty state diagnosis", "database", db.Name, "error", err)
+	}
+
+	w := os.Stderr
+	fmt.Fprintf(w, "\n  Dirty state diagnosis for %q (version %d):\n", db.Name, diag.Version)
+
+	// The error that dirtied the database: this run's, unless the database was already dirty
+	var pre *types.DirtyStateError
+	if errors.As(migErr, &pre) {
+		if run, entry := lastRealFailure(store, runID, db.Name); entry != nil {
+			fmt.Fprintf(w, "\n  Last recorded failure (run %s):\n    %s\n", run.ID, entry.Error)
+		} else {
+			fmt.Fprintf(w, "\n  No earlier failure recorded in local run history.\n")
+		}
+	}
+
+	for _, f := range diag.Files {
+		fmt.Fprintf(w, "\n  %s:\n", f.Path)
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			fmt.Fprintf(w, "    (unreadable: %v)\n", err)
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+		for i, line := range lines {
+			if i == maxDiagnosisLines {
+				fmt.Fprintf(w, "    ... (%d more lines)\n", len(lines)-maxDiagnosisLines)
+				break
+			}
+			fmt.Fprintf(w, "    %4d | %s\n", i+1, line)
+		}
+	}
+	if len(diag.Files) == 0 {
+		fmt.Fprintf(w, "\n  No migration file found for version %d in %s\n", diag.Version, db.MigrationsPath)
+	}
+
+	if len(diag.Locks) > 0 {
+		fmt.Fprintf(w, "\n  Locks held or awaited by other sessions:\n")
+		for _, l := range diag.Locks {
+			granted := "held"
+			if !l.Granted {
+				granted = "WAITING"
+			}
+			target := l.Relation
+			if target == "" {
+				target = l.LockType
+			}
+			fmt.Fprintf(w, "    pid %-7d %-7s %-24s %-20s %s %s\n", l.PID, granted, l.Mode, target, l.ApplicationName, l.Query)
+		}
+	} else {
+		fmt.Fprintf(w, "\n  No other sessions hold locks in this database.\n")
+	}
+
+	fmt.Fprintf(w, "\n  Suggested recovery:\n")
+	fmt.Fprintf(w, "    If the failed migration was rolled back (the default for a single-transaction file),\n")
+	fmt.Fprintf(w, "    reset to the previous version and fix the file before rerunning up:\n")
+	fmt.Fprintf(w, "      encore-migrator force -d %s --version %d\n", db.Name, diag.PreviousVersion)
+	fmt.Fprintf(w, "    If you completed the migration by hand, mark it applied:\n")
+	fmt.Fprintf(w, "      encore-migrator force -d %s --version %d\n\n", db.Name, diag.Version)
+}
+
+// lastRealFailure finds the most recent failure for a database in runs other than the current one
+func lastRealFailure(store *state.Store, currentRunID, database string) (*state.Run, *state.DatabaseRun) {
+	runs, err := store.ListRuns()
+	if err != nil {
+		slog.Debug("failed to list runs", "error", err)
+		return nil, nil
+	}
+
+	for _, run := range runs {
+		if run.ID == currentRunID {
+			continue
+		}
+		entry := run.Database(database)
+		if entry == nil || (entry.Status != state.StatusFailed && entry.Status != state.StatusCancelled) {
+			continue
+		}
+		// Attempts against an already-dirty database don't explain how it got dirty
+		if strings.Contains(entry.Error, "database is in dirty state") {
+			continue
+		}
+		return run, entry
+	}
+
+	return nil, nil
+}
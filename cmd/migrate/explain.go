@@ -0,0 +1,231 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func explainCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "explain",
+		Usage: "Explain step by step how a database's migrations and connection were resolved",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Encore database name",
+				Required: true,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return explainDatabase(ctx, cmd)
+		},
+	}
+}
+
+func explainDatabase(ctx context.Context, cmd *cli.Command) error {
+	name := cmd.String("database")
+	fmt.Printf("Explaining database %q\n", name)
+
+	// Step 1: discovery
+	appPath := cmd.String("app")
+	if appPath == "" {
+		appPath = "."
+	}
+	absPath, err := filepath.Abs(appPath)
+	if err != nil {
+		return fmt.Errorf("resolving app path: %w", err)
+	}
+
+	opts, err := discoveryOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n1. Discovery\n")
+	switch {
+	case opts.ManifestPath != "":
+		fmt.Printf("   Source: manifest %s (--manifest)\n", opts.ManifestPath)
+	case opts.Mode == discovery.ModeTyped:
+		fmt.Printf("   Source: type-checked packages of %s for sqldb.NewDatabase calls (--discovery typed)\n", absPath)
+	default:
+		fmt.Printf("   Source: AST scan of %s for sqldb.NewDatabase calls\n", absPath)
+	}
+	opts.Verbose = false
+	discoverer := discovery.New(opts)
+	databases, err := discoverer.Discover(absPath)
+	if err != nil {
+		return fmt.Errorf("discovering databases: %w", err)
+	}
+	databases = discovery.FilterDatabases(discovery.DeduplicateDatabases(databases), name)
+	if len(databases) == 0 {
+		fmt.Printf("   Result: database %q was not discovered\n", name)
+		return fmt.Errorf("database %q not found", name)
+	}
+	db := databases[0]
+	fmt.Printf("   Declared in: %s\n", db.SourceFile)
+	explainMigrations(db)
+
+	// Step 2: InfraConfig
+	configPath := cmd.String("config")
+	fmt.Printf("\n2. InfraConfig (%s)\n", configPath)
+	infraConfig, err := config.LoadInfraConfig(configPath)
+	if err != nil {
+		fmt.Printf("   Failed to load: %v\n", err)
+		return err
+	}
+
+	mapping, res, err := infraConfig.ResolveMapping(name)
+	if res != nil {
+		fmt.Printf("   Matched sql_servers[%d] (host %q)\n", res.ServerIndex, res.ServerHost)
+		for _, f := range res.Fields {
+			fmt.Printf("   %s\n", describeField(f))
+		}
+	}
+	if err != nil {
+		fmt.Printf("   Resolution failed: %v\n", err)
+		return err
+	}
+	fmt.Printf("   sslmode: %s (%s)\n", res.SSLMode, res.SSLReason)
+	for _, f := range tlsFields(mapping) {
+		fmt.Printf("   %s: %s\n", f[0], f[1])
+	}
+
+	// Step 3: overrides
+	fmt.Printf("\n3. Overrides (precedence: %s)\n", precedenceDoc)
+	overrides, err := resolveOverrides(cmd)
+	if err != nil {
+		fmt.Printf("   Failed: %v\n", err)
+		return err
+	}
+	if overrides.Profile.Set() {
+		fmt.Printf("   Profile %q selected [%s]\n", overrides.Profile.Value, overrides.Profile.Source)
+	}
+	before := *mapping
+	if err := applyConnectionOverrides(cmd, mapping); err != nil {
+		return err
+	}
+	explainOverrides(overrides, &before, mapping)
+
+	// Step 4: final parameters
+	fmt.Printf("\n4. Final connection\n")
+	if mapping.CloudSQLInstance != "" && mapping.Host == "" {
+		fmt.Printf("   cloudsql_instance=%s iam_auth=%t database=%s user=%s\n",
+			mapping.CloudSQLInstance, mapping.CloudSQLIAMAuth, mapping.PGDBName, mapping.Username)
+	} else {
+		fmt.Printf("   host=%s port=%s database=%s user=%s sslmode=%s\n",
+			mapping.Host, mapping.Port, mapping.PGDBName, mapping.Username, mapping.SSLMode)
+		if mapping.SSHBastion != "" {
+			fmt.Printf("   tunnelled through ssh %s (started on first connection)\n", mapping.SSHBastion)
+		}
+		switch {
+		case mapping.KerberosSPN != "":
+			fmt.Printf("   Kerberos principal %s if the server asks for GSSAPI\n", mapping.KerberosSPN)
+		case mapping.KerberosServiceName != "":
+			fmt.Printf("   Kerberos principal %s/%s if the server asks for GSSAPI\n", mapping.KerberosServiceName, mapping.Host)
+		}
+	}
+	if mapping.TLSMinVersion != "" {
+		fmt.Printf("   TLS %s or later required (enforced in the TLS handshake)\n", mapping.TLSMinVersion)
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		fmt.Printf("   Invalid: %v\n", err)
+		return err
+	}
+	fmt.Printf("   URL: %s\n", redactDSN(connStr))
+
+	return nil
+}
+
+// explainMigrations summarizes the migrations directory
+func explainMigrations(db types.EncoreDatabase) {
+	files, err := migration.ListFiles(db.MigrationsPath)
+	if err != nil {
+		fmt.Printf("   Migrations: %s (%v)\n", db.MigrationsPath, err)
+		return
+	}
+	up := migration.UpFiles(files)
+	fmt.Printf("   Migrations: %s (%d up, %d down files)\n", db.MigrationsPath, len(up), len(files)-len(up))
+}
+
+// describeField renders a field resolution, never printing passwords
+func describeField(f config.FieldResolution) string {
+	value := fmt.Sprintf("%q", f.Value)
+	if f.Field == "password" {
+		value = "(redacted)"
+		if f.Value == "" {
+			value = "(empty)"
+		}
+	}
+
+	switch f.Source {
+	case "env":
+		return fmt.Sprintf("%s: from env var %s = %s", f.Field, f.EnvVar, value)
+	case "gcp_secret":
+		return fmt.Sprintf("%s: from GCP secret %s = %s", f.Field, f.GCPSecret, value)
+	case "exec":
+		return fmt.Sprintf("%s: from command %s = %s", f.Field, f.Exec, value)
+	case "default":
+		return fmt.Sprintf("%s: not set, defaulting to the Encore name %s", f.Field, value)
+	default:
+		return fmt.Sprintf("%s: literal %s", f.Field, value)
+	}
+}
+
+// explainOverrides prints the connection fields changed by overrides and where each came from
+func explainOverrides(overrides *connectionOverrides, before, after *types.DatabaseMapping) {
+	changed := false
+	if overrides.Host.Set() {
+		fmt.Printf("   host: %s:%s -> %s:%s [%s]\n", before.Host, before.Port, after.Host, after.Port, overrides.Host.Source)
+		changed = true
+	}
+	if overrides.User.Set() {
+		fmt.Printf("   user: %q -> %q [%s]\n", before.Username, after.Username, overrides.User.Source)
+		changed = true
+	}
+	if overrides.Password.Set() {
+		fmt.Printf("   password: replaced (redacted) [%s]\n", overrides.Password.Source)
+		changed = true
+	}
+	if after.SSHBastion != "" {
+		fmt.Printf("   ssh: %s:%s via bastion %s [%s]\n", after.Host, after.Port, after.SSHBastion, overrides.SSH.Source)
+		changed = true
+	}
+	if overrides.DatabaseSuffix.Set() {
+		fmt.Printf("   database: %q -> %q [%s]\n", before.PGDBName, after.PGDBName, overrides.DatabaseSuffix.Source)
+		changed = true
+	}
+	if !changed {
+		fmt.Printf("   None\n")
+	}
+}
+
+// tlsFields names the TLS material of a mapping and where it comes from,
+// without printing inline PEM
+func tlsFields(mapping *types.DatabaseMapping) [][2]string {
+	var fields [][2]string
+	for _, f := range [][2]string{
+		{"sslrootcert", mapping.SSLRootCert},
+		{"sslcert", mapping.SSLCert},
+		{"sslkey", mapping.SSLKey},
+	} {
+		switch {
+		case f[1] == "":
+		case strings.Contains(f[1], "-----BEGIN"):
+			fields = append(fields, [2]string{f[0], "inline PEM in tls_config (written to a temporary file)"})
+		default:
+			fields = append(fields, [2]string{f[0], f[1]})
+		}
+	}
+	return fields
+}
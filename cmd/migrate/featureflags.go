@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/featureflag"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// flagSwitcher switches the feature flags that migrations ask for with
+// flag-before and flag-after directives
+type flagSwitcher struct {
+	client *featureflag.Client // nil without feature_flags.provider
+	runID  string
+}
+
+// newFlagSwitcher resolves the project config's feature flag provider, if any
+func newFlagSwitcher(project *config.ProjectConfig, runID string) (*flagSwitcher, error) {
+	settings := project.FeatureFlags
+	if settings.Provider == "" {
+		return &flagSwitcher{runID: runID}, nil
+	}
+	client := &featureflag.Client{
+		Provider:    settings.Provider,
+		URL:         settings.URL,
+		Project:     settings.Project,
+		Environment: os.ExpandEnv(settings.Environment),
+	}
+	if err := client.Validate(); err != nil {
+		return nil, fmt.Errorf("feature_flags: %w", err)
+	}
+	if settings.Token == nil {
+		return nil, fmt.Errorf("feature_flags: the %s provider needs a token", settings.Provider)
+	}
+	token, err := settings.Token.Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("resolving feature_flags.token: %w", err)
+	}
+	client.Token = token
+	return &flagSwitcher{client: client, runID: runID}, nil
+}
+
+// prepare switches the flag-before flags of db's pending migrations and has
+// m switch the flag-after flags of each as it is applied. A failed
+// flag-before switch fails the database before it migrates; a failed
+// flag-after switch only warns, the migration being applied already.
+func (s *flagSwitcher) prepare(ctx context.Context, out, errOut io.Writer, m *migration.Migrator, connStr string, db types.EncoreDatabase, direction string, steps int) error {
+	if s.client == nil {
+		// Spare the connection when no migration could ask for a switch
+		tagged, err := hasFlagSwitches(db.MigrationsPath, direction)
+		if err != nil || !tagged {
+			return err
+		}
+	}
+	plan, err := m.Plan(connStr, db.MigrationsPath, direction, steps)
+	if err != nil {
+		return fmt.Errorf("planning which migrations switch feature flags: %w", err)
+	}
+	// Switched in plan order, so a later migration's switch of a flag wins
+	var before []migration.File
+	switches := make(map[string][]migration.FlagSwitch)
+	after := make(map[string][]migration.FlagSwitch)
+	for _, step := range plan.Steps {
+		if step.File == nil {
+			continue
+		}
+		b, a, err := migration.ReadFlagSwitches(*step.File)
+		if err != nil {
+			return err
+		}
+		if len(b)+len(a) == 0 {
+			continue
+		}
+		if s.client == nil {
+			return fmt.Errorf("%s switches feature flags, but the project config sets no feature_flags.provider", step.File.Name)
+		}
+		if len(b) > 0 {
+			before = append(before, *step.File)
+			switches[step.File.Name] = b
+		}
+		if len(a) > 0 {
+			after[step.File.Name] = a
+		}
+	}
+
+	for _, file := range before {
+		comment := fmt.Sprintf("encore-migrator run %s: before %s of %s", s.runID, file.Name, db.Name)
+		for _, flag := range switches[file.Name] {
+			if err := s.client.Set(ctx, flag.Flag, flag.On, comment); err != nil {
+				return fmt.Errorf("%s of %s: %w", migration.FlagBeforeDirective, file.Name, err)
+			}
+			fmt.Fprintf(out, "  Switched feature flag %s before %s\n", flag, file.Name)
+		}
+	}
+	if len(after) == 0 {
+		return nil
+	}
+
+	applied := m.OnMigrationApplied
+	m.OnMigrationApplied = func(file migration.File, elapsed time.Duration) {
+		if applied != nil {
+			applied(file, elapsed)
+		}
+		// The run may have been cancelled; the schema has changed regardless
+		ctx := context.WithoutCancel(ctx)
+		for _, flag := range after[file.Name] {
+			comment := fmt.Sprintf("encore-migrator run %s: after %s of %s", s.runID, file.Name, db.Name)
+			if err := s.client.Set(ctx, flag.Flag, flag.On, comment); err != nil {
+				warn(errOut, warnFlagSwitchFailed, "%s was applied but feature flag %s was not switched, switch it by hand: %v", file.Name, flag, err)
+				continue
+			}
+			fmt.Fprintf(out, "  Switched feature flag %s after %s\n", flag, file.Name)
+		}
+	}
+	return nil
+}
+
+// hasFlagSwitches reports whether any migration file of a direction has
+// flag-before or flag-after directives
+func hasFlagSwitches(migrationsPath, direction string) (bool, error) {
+	files, err := migration.ListFiles(migrationsPath)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range files {
+		if f.Direction != direction {
+			continue
+		}
+		before, after, err := migration.ReadFlagSwitches(f)
+		if err != nil {
+			return false, err
+		}
+		if len(before)+len(after) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,97 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func healthcheckCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "healthcheck",
+		Usage: "Check the InfraConfig resolves and every configured database is reachable (exits non-zero on failure)",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "Only check that the configuration loads and resolves; do not connect",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Connect timeout per database",
+				Value: 5 * time.Second,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return healthcheck(ctx, cmd)
+		},
+	}
+}
+
+func healthcheck(ctx context.Context, cmd *cli.Command) error {
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+
+	names := infraConfig.ListDatabaseNames()
+	if len(names) == 0 {
+		return fmt.Errorf("no databases configured")
+	}
+	sort.Strings(names)
+
+	migrator := newMigrator(cmd)
+	timeout := strconv.Itoa(max(1, int(cmd.Duration("timeout").Seconds())))
+
+	failed := 0
+	for _, name := range names {
+		err := checkDatabase(cmd, infraConfig, migrator, name, timeout)
+		if err != nil {
+			failed++
+			fmt.Printf("%-20s FAIL  %v\n", name, err)
+			continue
+		}
+		fmt.Printf("%-20s OK\n", name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d databases unhealthy", failed, len(names))
+	}
+	return nil
+}
+
+// checkDatabase resolves a database's connection and, unless --offline, connects to it
+func checkDatabase(cmd *cli.Command, infraConfig *config.InfraConfig, migrator *migration.Migrator, name, timeout string) error {
+	mapping, err := infraConfig.GetMapping(name)
+	if err != nil {
+		return err
+	}
+	if err := applyConnectionOverrides(cmd, mapping); err != nil {
+		return err
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return err
+	}
+	if cmd.Bool("offline") {
+		return nil
+	}
+
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("connect_timeout", timeout)
+	u.RawQuery = q.Encode()
+
+	_, err = migrator.Ping(u.String())
+	return err
+}
@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/k8s"
+)
+
+func helmCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "helm",
+		Usage: "Helm chart helpers",
+		Commands: []*cli.Command{
+			{
+				Name:  "values",
+				Usage: "Render values for the migration-job chart from the discovered databases",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "image",
+						Usage:    "Migrator image containing the app's migrations",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "config-secret",
+						Usage:    "Secret holding the InfraConfig",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "config-secret-key",
+						Usage: "Key of the InfraConfig within --config-secret",
+						Value: k8s.ConfigFileName,
+					},
+					&cli.StringFlag{
+						Name:  "env-secret",
+						Usage: "Secret exposed as environment variables, for $env references and ENCORE_MIGRATE_* overrides",
+					},
+					&cli.StringSliceFlag{
+						Name:    "database",
+						Aliases: []string{"d"},
+						Usage:   "Only include these databases (default: all discovered)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "migrate-args",
+						Usage: "Migrator arguments the Job runs",
+						Value: []string{"up"},
+					},
+					&cli.StringFlag{
+						Name:  "cpu-request",
+						Usage: "CPU request",
+						Value: "100m",
+					},
+					&cli.StringFlag{
+						Name:  "memory-request",
+						Usage: "Memory request",
+						Value: "128Mi",
+					},
+					&cli.StringFlag{
+						Name:  "cpu-limit",
+						Usage: "CPU limit (default: none)",
+					},
+					&cli.StringFlag{
+						Name:  "memory-limit",
+						Usage: "Memory limit",
+						Value: "256Mi",
+					},
+					&cli.StringFlag{
+						Name:  "key",
+						Usage: "Nest the values under this key, e.g. the chart's alias in an umbrella chart",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the values to this file instead of stdout",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return renderHelmValues(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+func renderHelmValues(ctx context.Context, cmd *cli.Command) error {
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+
+	only := cmd.StringSlice("database")
+	var dbs []k8s.ValuesDatabase
+	for _, db := range databases {
+		if len(only) > 0 && !slices.Contains(only, db.Name) {
+			continue
+		}
+		rel, err := filepath.Rel(root, db.MigrationsPath)
+		if err != nil {
+			return fmt.Errorf("migrations path for %q: %w", db.Name, err)
+		}
+		dbs = append(dbs, k8s.ValuesDatabase{Name: db.Name, Migrations: filepath.ToSlash(rel)})
+	}
+	if len(dbs) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+	for _, name := range only {
+		if !slices.ContainsFunc(dbs, func(d k8s.ValuesDatabase) bool { return d.Name == name }) {
+			return fmt.Errorf("database %q not found", name)
+		}
+	}
+
+	data, err := k8s.Values(k8s.ValuesOptions{
+		Image:           cmd.String("image"),
+		ConfigSecret:    cmd.String("config-secret"),
+		ConfigSecretKey: cmd.String("config-secret-key"),
+		EnvSecret:       cmd.String("env-secret"),
+		Args:            cmd.StringSlice("migrate-args"),
+		Databases:       dbs,
+		Resources: k8s.Resources{
+			CPURequest:    cmd.String("cpu-request"),
+			MemoryRequest: cmd.String("memory-request"),
+			CPULimit:      cmd.String("cpu-limit"),
+			MemoryLimit:   cmd.String("memory-limit"),
+		},
+		Key: cmd.String("key"),
+	})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.String("out")
+	if out == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("writing values: %w", err)
+	}
+	fmt.Printf("Wrote Helm values to %s\n", out)
+	return nil
+}
@@ -0,0 +1,242 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+// envOperator names who runs migrations in the history table, overriding the
+// CI or local user detected
+const envOperator = "ENCORE_MIGRATE_OPERATOR"
+
+func historyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "List the up and down runs recorded in each database's encore_migrate_history table, newest first",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name (default: all)",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of runs to show per database (0 for all)",
+				Value: 20,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return showHistory(ctx, cmd)
+		},
+	}
+}
+
+// databaseHistory is one database's entry in the `history` document:
+//
+//	{"schema_version": 1, "databases": [{"name": "users", "runs": [{"run_id": "...", "direction": "up", ...}]}]}
+type databaseHistory struct {
+	Name  string                   `json:"name"`
+	Runs  []migration.HistoryEntry `json:"runs"`
+	Error string                   `json:"error,omitempty"`
+}
+
+func showHistory(ctx context.Context, cmd *cli.Command) error {
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if name := cmd.String("database"); name != "" {
+		if databases = discovery.FilterDatabases(databases, name); len(databases) == 0 {
+			return fmt.Errorf("database %q not found", name)
+		}
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	migrator := newMigrator(cmd)
+	var histories []databaseHistory
+	for _, db := range databases {
+		entry := databaseHistory{Name: db.Name, Runs: []migration.HistoryEntry{}}
+		runs, err := func() ([]migration.HistoryEntry, error) {
+			mapping, err := infraConfig.GetMapping(db.Name)
+			if err != nil {
+				return nil, err
+			}
+			if err := applyConnectionOverrides(cmd, mapping); err != nil {
+				return nil, err
+			}
+			connStr, err := migration.BuildConnectionString(mapping)
+			if err != nil {
+				return nil, err
+			}
+			session, err := sessionOptions(cmd, project, db.Name)
+			if err != nil {
+				return nil, err
+			}
+			return migrator.WithSession(session).History(connStr, int(cmd.Int("limit")))
+		}()
+		if err != nil {
+			slog.Debug("failed to read history", "database", db.Name, "error", err)
+			entry.Error = err.Error()
+		} else if runs != nil {
+			entry.Runs = runs
+		}
+		histories = append(histories, entry)
+	}
+
+	return outputRenderer(cmd).report(os.Stdout, historyReport{SchemaVersion: reportSchemaVersion, Databases: histories})
+}
+
+// historyReport is the `history` document
+type historyReport struct {
+	SchemaVersion int               `json:"schema_version"`
+	Databases     []databaseHistory `json:"databases"`
+}
+
+func (report historyReport) text(w io.Writer) {
+	now := time.Now()
+	for i, h := range report.Databases {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n", h.Name)
+		switch {
+		case h.Error != "":
+			fmt.Fprintf(w, "  error: %s\n", h.Error)
+			continue
+		case len(h.Runs) == 0:
+			fmt.Fprintf(w, "  no recorded runs\n")
+			continue
+		}
+		fmt.Fprintf(w, "  %-36s %-5s %-12s %-10s %-8s %-20s %-12s %s\n", "STARTED", "DIR", "VERSION", "DURATION", "RESULT", "OPERATOR", "GIT SHA", "TOOL")
+		for _, run := range h.Runs {
+			started := fmt.Sprintf("%s (%s)", run.StartedAt.Local().Format("2006-01-02 15:04:05"), relativeTime(run.StartedAt, now))
+			result := "ok"
+			if !run.Succeeded {
+				result = "FAILED"
+			}
+			fmt.Fprintf(w, "  %-36s %-5s %-12s %-10s %-8s %-20s %-12s %s\n", started, run.Direction,
+				fmt.Sprintf("%d -> %d", run.VersionBefore, run.VersionAfter), humanDuration(run.Duration), result,
+				orDash(run.Operator), orDash(shortSHA(run.GitSHA)), orDash(run.ToolVersion))
+			if run.Error != "" {
+				fmt.Fprintf(w, "      %s\n", run.Error)
+			}
+		}
+	}
+}
+
+func (report historyReport) markdown(w io.Writer) {
+	for i, h := range report.Databases {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "### Migration history of `%s`\n\n", h.Name)
+		switch {
+		case h.Error != "":
+			fmt.Fprintf(w, "Error: %s\n", markdownCell(h.Error))
+			continue
+		case len(h.Runs) == 0:
+			fmt.Fprintf(w, "No recorded runs.\n")
+			continue
+		}
+		fmt.Fprintf(w, "| Started | Direction | Version | Duration | Result | Operator | Git SHA | Tool |\n")
+		fmt.Fprintf(w, "|---|---|---|---|---|---|---|---|\n")
+		for _, run := range h.Runs {
+			result := "ok"
+			if !run.Succeeded {
+				result = "failed: " + markdownCell(run.Error)
+			}
+			fmt.Fprintf(w, "| %s | %s | %d → %d | %s | %s | %s | %s | %s |\n", run.StartedAt.UTC().Format(time.RFC3339), run.Direction,
+				run.VersionBefore, run.VersionAfter, humanDuration(run.Duration), result,
+				markdownCell(orDash(run.Operator)), orDash(shortSHA(run.GitSHA)), orDash(run.ToolVersion))
+		}
+	}
+}
+
+func (report historyReport) records() []any { return databaseRecords(report.Databases) }
+
+// runInfo identifies an up or down run for the databases' history tables
+func runInfo(cmd *cli.Command, run *state.Run) *migration.RunInfo {
+	return &migration.RunInfo{
+		RunID:       run.ID,
+		Ticket:      run.Ticket,
+		Operator:    operator(),
+		GitSHA:      gitSHA(cmd),
+		ToolVersion: Version,
+	}
+}
+
+// operator is who runs migrations: $ENCORE_MIGRATE_OPERATOR, the CI
+// identity, or the local user
+func operator() string {
+	if name := os.Getenv(envOperator); name != "" {
+		return name
+	}
+	for _, ci := range []struct{ env, system string }{
+		{"GITHUB_ACTOR", "github"},
+		{"GITLAB_USER_LOGIN", "gitlab"},
+		{"BUILDKITE_BUILD_CREATOR_EMAIL", "buildkite"},
+		{"CIRCLE_USERNAME", "circleci"},
+		{"BITBUCKET_STEP_TRIGGERER_UUID", "bitbucket"},
+	} {
+		if name := os.Getenv(ci.env); name != "" {
+			return ci.system + ":" + name
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// gitSHA is the commit being deployed: from the CI environment, else the
+// app directory's checkout. Unknown is empty.
+func gitSHA(cmd *cli.Command) string {
+	for _, env := range []string{"GITHUB_SHA", "CI_COMMIT_SHA", "BUILDKITE_COMMIT", "CIRCLE_SHA1", "BITBUCKET_COMMIT", "GIT_COMMIT"} {
+		if sha := os.Getenv(env); sha != "" {
+			return sha
+		}
+	}
+	root, err := appRoot(cmd)
+	if err != nil {
+		return ""
+	}
+	out, err := exec.Command("git", "-C", root, "rev-parse", "HEAD").Output()
+	if err != nil {
+		slog.Debug("git commit unknown", "dir", root, "error", err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package migrate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+// relativeTime describes t relative to now for people scanning output, e.g.
+// "3 days ago"; machine formats print timestamps instead. Past a month it
+// gives the date.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < 0:
+		return "in the future" // clock skew between machines
+	case d < 10*time.Second:
+		return "just now"
+	case d < time.Minute:
+		return plural(int(d/time.Second), "second") + " ago"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day") + " ago"
+	}
+	return "on " + t.Local().Format("2006-01-02")
+}
+
+// plural formats a count with its unit, e.g. "1 day" or "3 days"
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// humanDuration rounds d to what matters at its scale: milliseconds under a
+// second, tenths of a second under a minute, whole seconds above
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// lastApplied finds when each database last had migrations applied or
+// rolled back, from the run history in the state directory. Only runs made
+// from this state directory are known.
+func lastApplied(store *state.Store) map[string]time.Time {
+	runs, err := store.ListRuns()
+	if err != nil {
+		return nil
+	}
+	last := make(map[string]time.Time)
+	for _, run := range runs {
+		for _, db := range run.Databases {
+			if db.Status != state.StatusCompleted || db.FinishedAt == nil || db.VersionBefore == db.VersionAfter {
+				continue
+			}
+			if db.FinishedAt.After(last[db.Name]) {
+				last[db.Name] = *db.FinishedAt
+			}
+		}
+	}
+	return last
+}
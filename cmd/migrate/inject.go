@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// parseInjectedFailures parses the hidden --inject-failure <database>:<version>
+// values used to test how pipelines handle dirty databases, notifications and
+// resumes. Injection is refused in production.
+func parseInjectedFailures(values []string, infraConfig *config.InfraConfig, databases []types.EncoreDatabase) (map[string]uint, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	if infraConfig.IsProduction() {
+		return nil, fmt.Errorf("refusing --inject-failure: the InfraConfig is labelled %s", config.EnvTypeProduction)
+	}
+
+	injected := make(map[string]uint, len(values))
+	for _, value := range values {
+		name, v, ok := strings.Cut(value, ":")
+		version, err := strconv.ParseUint(v, 10, 64)
+		if !ok || name == "" || err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid --inject-failure %q (want <database>:<version>)", value)
+		}
+		if !slices.ContainsFunc(databases, func(db types.EncoreDatabase) bool { return db.Name == name }) {
+			return nil, fmt.Errorf("--inject-failure: database %q is not part of this run", name)
+		}
+		injected[name] = uint(version)
+		warn(os.Stderr, warnFailureInjected, "injecting a failure into %s version %d", name, version)
+	}
+	return injected, nil
+}
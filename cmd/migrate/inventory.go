@@ -0,0 +1,165 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+// inventory is the `inventory` document consumed by infrastructure-as-code
+// programs (Pulumi, CDK) to provision databases before the first migration run.
+// The schema is stable; incompatible changes bump SchemaVersion.
+//
+//	{
+//	  "schema_version": 1,
+//	  "databases": [
+//	    {
+//	      "name": "users",
+//	      "migrations": "users/migrations",
+//	      "database": "users",
+//	      "user": {"$env": "USERS_DB_USER"},
+//	      "extensions": ["pgcrypto"],
+//	      "schemas": ["audit"]
+//	    }
+//	  ]
+//	}
+//
+// database and user come from the InfraConfig and are omitted if it can't be
+// read; each is a string or an {"$env": "VAR"} reference, which is never resolved.
+// extensions are those required before migrating (directives, project config,
+// dialect); schemas are those created by up migrations.
+type inventory struct {
+	SchemaVersion int                 `json:"schema_version"`
+	Databases     []inventoryDatabase `json:"databases"`
+}
+
+type inventoryDatabase struct {
+	Name       string                 `json:"name"`
+	Migrations string                 `json:"migrations"`
+	Database   *config.StringOrEnvRef `json:"database,omitempty"`
+	User       *config.StringOrEnvRef `json:"user,omitempty"`
+	Extensions []string               `json:"extensions"`
+	Schemas    []string               `json:"schemas"`
+}
+
+// inventorySchemaVersion is the current inventory schema version
+const inventorySchemaVersion = 1
+
+func inventoryCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "inventory",
+		Usage: "Export a machine-readable JSON inventory of databases, required extensions and schemas",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "Write the inventory to this file instead of stdout",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return exportInventory(ctx, cmd)
+		},
+	}
+}
+
+func exportInventory(ctx context.Context, cmd *cli.Command) error {
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		slog.Warn("InfraConfig not readable; omitting database and user", "error", err)
+		infraConfig = nil
+	}
+
+	inv := inventory{SchemaVersion: inventorySchemaVersion, Databases: []inventoryDatabase{}}
+	for _, db := range databases {
+		entry := inventoryDatabase{Name: db.Name, Migrations: filepath.ToSlash(db.MigrationsPath)}
+		if rel, err := filepath.Rel(root, db.MigrationsPath); err == nil {
+			entry.Migrations = filepath.ToSlash(rel)
+		}
+
+		entry.Extensions, err = requiredExtensions(db, project)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+
+		files, err := migration.ListFiles(db.MigrationsPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		entry.Schemas, err = migration.CreatedSchemas(migration.UpFiles(files))
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		for i, s := range entry.Schemas {
+			entry.Schemas[i] = strings.Trim(s, `"`)
+		}
+
+		if infraConfig != nil {
+			entry.Database, entry.User = infraIdentity(infraConfig, db.Name)
+		}
+
+		// Always emit arrays so consumers needn't handle null
+		if entry.Extensions == nil {
+			entry.Extensions = []string{}
+		}
+		if entry.Schemas == nil {
+			entry.Schemas = []string{}
+		}
+
+		inv.Databases = append(inv.Databases, entry)
+	}
+
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding inventory: %w", err)
+	}
+	data = append(data, '\n')
+
+	out := cmd.String("out")
+	if out == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("writing inventory: %w", err)
+	}
+	fmt.Printf("Wrote inventory to %s\n", out)
+	return nil
+}
+
+// infraIdentity returns the unresolved PostgreSQL database name and user for an Encore database
+func infraIdentity(c *config.InfraConfig, name string) (database, user *config.StringOrEnvRef) {
+	for _, server := range c.SQLServers {
+		dbConfig, ok := server.Databases[name]
+		if !ok {
+			continue
+		}
+		database = &dbConfig.Name
+		if database.IsLiteral() && database.Value == "" {
+			// Encore defaults the database name to the Encore name
+			database = &config.StringOrEnvRef{Value: name}
+		}
+		return database, &dbConfig.Username
+	}
+	return nil, nil
+}
@@ -0,0 +1,171 @@
+package migrate
+
+import (
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// The reports of status, up and down, printed as JSON documents with the
+// global --output json and rendered by the other formats (see renderer).
+// Like databaseList, the schemas are stable; incompatible changes bump
+// reportSchemaVersion. Progress that is normally printed goes to stderr with
+// any format but text, so stdout holds exactly the report.
+const reportSchemaVersion = 1
+
+// statusReport is the `status` document:
+//
+//	{"schema_version": 1, "databases": [{"name": "users", "pg_database": "users", "version": 3, "dirty": false}]}
+type statusReport struct {
+	SchemaVersion int              `json:"schema_version"`
+	Databases     []databaseStatus `json:"databases"`
+	Extended      bool             `json:"-"` // pending files were inspected
+}
+
+type databaseStatus struct {
+	Name       string `json:"name"`
+	PGDatabase string `json:"pg_database,omitempty"`
+	Version    uint   `json:"version"`
+	Dirty      bool   `json:"dirty"`
+	Error      string `json:"error,omitempty"`
+
+	PendingFiles []string `json:"pending_files,omitempty"` // with --extended
+
+	// LastApplied is when a run from this state directory last changed the
+	// database's version
+	LastApplied *time.Time `json:"last_applied,omitempty"`
+}
+
+// runReport is the `up` and `down` document. applied_files lists the files
+// run for each database, oldest first going up and newest first going down.
+//
+//	{"schema_version": 1, "run_id": "...", "direction": "up", "succeeded": true,
+//	 "databases": [{"name": "users", "status": "completed", "version_before": 2,
+//	                "version_after": 3, "dirty": false, "applied_files": ["3_add_email.up.sql"]}]}
+type runReport struct {
+	SchemaVersion int           `json:"schema_version"`
+	RunID         string        `json:"run_id"`
+	Direction     string        `json:"direction"`
+	Ticket        string        `json:"ticket,omitempty"`
+	Succeeded     bool          `json:"succeeded"`
+	Databases     []runDatabase `json:"databases"`
+}
+
+type runDatabase struct {
+	Name          string               `json:"name"`
+	Status        state.DatabaseStatus `json:"status"`
+	VersionBefore uint                 `json:"version_before"`
+	VersionAfter  uint                 `json:"version_after"`
+	Dirty         bool                 `json:"dirty"`
+	Error         string               `json:"error,omitempty"`
+	AppliedFiles  []string             `json:"applied_files"`
+	State         *state.DatabaseState `json:"state,omitempty"`      // captured after a failure: version, dirty flag and pending files
+	Statements    []state.Statement    `json:"statements,omitempty"` // with --per-statement: file, line, sql and duration_ms
+}
+
+// planReport is the `up --dry-run`, `down --dry-run` and `plan` with the global --output json document
+//
+//	{"schema_version": 1, "direction": "up", "databases": [{"name": "users", "pg_database": "users",
+//	 "current_version": 2, "target_version": 3, "dirty": false,
+//	 "steps": [{"version": 3, "file": "3_add_email.up.sql"}]}]}
+type planReport struct {
+	SchemaVersion int              `json:"schema_version"`
+	Direction     string           `json:"direction"`
+	Databases     []plannedChanges `json:"databases"`
+}
+
+type plannedChanges struct {
+	Name           string        `json:"name"`
+	PGDatabase     string        `json:"pg_database,omitempty"`
+	CurrentVersion uint          `json:"current_version"`
+	TargetVersion  uint          `json:"target_version"`
+	Dirty          bool          `json:"dirty"`
+	Steps          []plannedStep `json:"steps"`
+	Error          string        `json:"error,omitempty"`
+}
+
+type plannedStep struct {
+	Version uint   `json:"version"`
+	File    string `json:"file,omitempty"` // empty for a down step without a down file
+}
+
+// newRunReport builds the report of a finished run, listing the migration
+// files between each database's versions before and after
+func newRunReport(run *state.Run, databases []types.EncoreDatabase, succeeded bool) runReport {
+	paths := make(map[string]string, len(databases))
+	for _, db := range databases {
+		paths[db.Name] = db.MigrationsPath
+	}
+
+	report := runReport{
+		SchemaVersion: reportSchemaVersion,
+		RunID:         run.ID,
+		Direction:     run.Direction,
+		Ticket:        run.Ticket,
+		Succeeded:     succeeded,
+		Databases:     []runDatabase{},
+	}
+	for _, db := range run.Databases {
+		entry := runDatabase{
+			Name:          db.Name,
+			Status:        db.Status,
+			VersionBefore: db.VersionBefore,
+			VersionAfter:  db.VersionAfter,
+			Dirty:         db.State != nil && db.State.Dirty,
+			Error:         db.Error,
+			AppliedFiles:  []string{},
+			State:         db.State,
+			Statements:    db.Statements,
+		}
+		if db.Status == state.StatusCompleted || db.Status == state.StatusPaused {
+			entry.AppliedFiles = appliedFiles(paths[db.Name], run.Direction, db.VersionBefore, db.VersionAfter)
+		}
+		report.Databases = append(report.Databases, entry)
+	}
+	return report
+}
+
+// appliedFiles names the migration files a database went through between two versions
+func appliedFiles(migrationsPath, direction string, before, after uint) []string {
+	names := []string{}
+	if migrationsPath == "" || before == after {
+		return names
+	}
+
+	files, err := migration.ListFiles(migrationsPath)
+	if err != nil {
+		return names
+	}
+	var plan *migration.Plan
+	if direction == "down" {
+		plan = migration.PlanDown(files, before, 0)
+	} else {
+		plan = migration.PlanUp(files, before, 0)
+	}
+	for _, step := range plan.Steps {
+		if direction == "down" && step.Version <= after {
+			break
+		}
+		if direction == "up" && step.Version > after {
+			break
+		}
+		if step.File != nil {
+			names = append(names, step.File.Name)
+		}
+	}
+	return names
+}
+
+// progressOutput is where human-readable progress goes: stdout, or stderr
+// when stdout is reserved for a report in another format
+func progressOutput(cmd *cli.Command) *os.File {
+	if cmd.Root().String("output") != "text" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
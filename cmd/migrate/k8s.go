@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/k8s"
+)
+
+func k8sCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "k8s",
+		Usage: "Kubernetes manifest helpers",
+		Commands: []*cli.Command{
+			{
+				Name:  "generate",
+				Usage: "Emit a Job manifest that runs the migrator in-cluster",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "image",
+						Usage:    "Migrator image containing the app's migrations",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Job name",
+						Value: "encore-migrator",
+					},
+					&cli.StringFlag{
+						Name:  "namespace",
+						Usage: "Job namespace (default: the namespace applied to)",
+					},
+					&cli.StringFlag{
+						Name:     "config-secret",
+						Usage:    "Secret holding the InfraConfig",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "config-secret-key",
+						Usage: "Key of the InfraConfig within --config-secret",
+						Value: k8s.ConfigFileName,
+					},
+					&cli.StringFlag{
+						Name:  "env-secret",
+						Usage: "Secret exposed as environment variables, for $env references and ENCORE_MIGRATE_* overrides",
+					},
+					&cli.StringSliceFlag{
+						Name:  "migrate-args",
+						Usage: "Migrator arguments the Job runs",
+						Value: []string{"up"},
+					},
+					&cli.IntFlag{
+						Name:  "backoff-limit",
+						Usage: "Job retries; keep at 0 so a failed migration is inspected rather than retried against a dirty database",
+					},
+					&cli.DurationFlag{
+						Name:  "deadline",
+						Usage: "Job activeDeadlineSeconds (0 for none)",
+						Value: 30 * time.Minute,
+					},
+					&cli.BoolFlag{
+						Name:  "argocd",
+						Usage: "Emit the Job as an ArgoCD PreSync hook",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the manifest to this file instead of stdout",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return generateK8s(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+func generateK8s(ctx context.Context, cmd *cli.Command) error {
+	data, err := k8s.Job(k8s.JobOptions{
+		Name:            cmd.String("name"),
+		Namespace:       cmd.String("namespace"),
+		Image:           cmd.String("image"),
+		Args:            cmd.StringSlice("migrate-args"),
+		ConfigSecret:    cmd.String("config-secret"),
+		ConfigSecretKey: cmd.String("config-secret-key"),
+		EnvSecret:       cmd.String("env-secret"),
+		BackoffLimit:    int(cmd.Int("backoff-limit")),
+		Deadline:        cmd.Duration("deadline"),
+		ArgoCD:          cmd.Bool("argocd"),
+	})
+	if err != nil {
+		return err
+	}
+
+	out := cmd.String("out")
+	if out == "" {
+		fmt.Print(string(data))
+		return nil
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	fmt.Printf("Wrote Job manifest to %s\n", out)
+	return nil
+}
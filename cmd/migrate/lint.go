@@ -0,0 +1,245 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func lintCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "lint",
+		Usage: "Flag migration and seed statements that fail when run a second time",
+		Description: "Rules (configure per project or per database under lint.rules as error, warning or off):\n" +
+			"  create-table-if-not-exists  CREATE TABLE without IF NOT EXISTS in the first lint.early_migrations migrations\n" +
+			"  down-if-exists              DROP without IF EXISTS in a down file\n" +
+			"  idempotent-seed             INSERT without ON CONFLICT in a <database>.sql seed file under lint.seed_dir\n\n" +
+			"With --pending, also the destructive rules, on the up migrations pending on each database\n" +
+			"(as up checks before applying; see up --block-destructive):\n" +
+			"  drop-table                  DROP TABLE\n" +
+			"  drop-column                 ALTER TABLE ... DROP COLUMN\n" +
+			"  truncate                    TRUNCATE\n" +
+			"  non-concurrent-index        CREATE INDEX without CONCURRENTLY on a table the file does not create\n" +
+			"  narrowing-alter             ALTER COLUMN ... TYPE to a type with a length or precision, or a smaller number\n\n" +
+			"Exits non-zero if any rule at error severity is broken. Runs offline, except with --pending.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Lint only this Encore database",
+			},
+			&cli.StringFlag{
+				Name:  "seed-dir",
+				Usage: "Directory of <database>.sql seed files to lint (overrides lint.seed_dir)",
+			},
+			&cli.BoolFlag{
+				Name:  "pending",
+				Usage: "Connect to each database in the InfraConfig and lint its pending up migrations with the destructive rules too",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return lintMigrations(ctx, cmd)
+		},
+	}
+}
+
+// lintReport is the `lint` document with the global --output json
+//
+//	{"schema_version": 1, "errors": 1, "warnings": 0, "issues": [{"database": "users",
+//	 "file": "1_init.up.sql", "line": 3, "rule": "create-table-if-not-exists", "severity": "error", "message": "..."}]}
+type lintReport struct {
+	SchemaVersion int         `json:"schema_version"`
+	Errors        int         `json:"errors"`
+	Warnings      int         `json:"warnings"`
+	Issues        []lintIssue `json:"issues"`
+	databases     int         // linted
+}
+
+func (report lintReport) text(w io.Writer) {
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "%s: %s:%d: %s: %s [%s]\n", issue.Database, issue.File, issue.Line, issue.Severity, issue.Message, issue.Rule)
+	}
+	if len(report.Issues) == 0 {
+		fmt.Fprintf(w, "No lint issues in %d databases\n", report.databases)
+	} else {
+		fmt.Fprintf(w, "\n%d errors, %d warnings\n", report.Errors, report.Warnings)
+	}
+}
+
+func (report lintReport) markdown(w io.Writer) {
+	fmt.Fprintf(w, "### Migration lint: %d errors, %d warnings\n\n", report.Errors, report.Warnings)
+	if len(report.Issues) == 0 {
+		fmt.Fprintf(w, "No lint issues in %d databases.\n", report.databases)
+		return
+	}
+	fmt.Fprintf(w, "| Database | File | Severity | Rule | Message |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|\n")
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "| `%s` | `%s:%d` | %s | %s | %s |\n", issue.Database, issue.File, issue.Line, issue.Severity, issue.Rule, markdownCell(issue.Message))
+	}
+}
+
+// records are a line per issue:
+//
+//	{"schema_version": 1, "database": "users", "file": "2_drop.up.sql", "line": 1, "rule": "...", ...}
+func (report lintReport) records() []any {
+	type record struct {
+		SchemaVersion int `json:"schema_version"`
+		lintIssue
+	}
+	records := make([]any, len(report.Issues))
+	for i, issue := range report.Issues {
+		records[i] = record{report.SchemaVersion, issue}
+	}
+	return records
+}
+
+type lintIssue struct {
+	Database string `json:"database"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func lintMigrations(ctx context.Context, cmd *cli.Command) error {
+	var infraConfig *config.InfraConfig
+	var databases []types.EncoreDatabase
+	var err error
+	if cmd.Bool("pending") {
+		infraConfig, databases, err = loadConfigAndDiscover(cmd)
+	} else {
+		databases, err = discoverDatabases(cmd)
+	}
+	if err != nil {
+		return err
+	}
+	if target := cmd.String("database"); target != "" {
+		databases = discovery.FilterDatabases(databases, target)
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found", target)
+		}
+	}
+
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+
+	report := lintReport{SchemaVersion: reportSchemaVersion, Issues: []lintIssue{}}
+	for _, db := range databases {
+		settings := project.LintSettings(db.Name)
+		opts := migration.LintOptions{Severities: settings.Rules, EarlyMigrations: settings.EarlyMigrations}
+		if err := opts.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+
+		files, err := migration.ListFiles(db.MigrationsPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if err := warnUnknownDirectives(os.Stderr, files); err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		issues, err := migration.LintFiles(files, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if infraConfig != nil {
+			destructive, err := lintPending(cmd, infraConfig, project, db, opts)
+			if err != nil {
+				return fmt.Errorf("%s: %w", db.Name, err)
+			}
+			issues = append(issues, destructive...)
+		}
+
+		seedDir := settings.SeedDir
+		if cmd.IsSet("seed-dir") {
+			seedDir = cmd.String("seed-dir")
+		}
+		if seedDir != "" {
+			if !filepath.IsAbs(seedDir) {
+				seedDir = filepath.Join(root, seedDir)
+			}
+			seed := filepath.Join(seedDir, db.Name+".sql")
+			if _, err := os.Stat(seed); err == nil {
+				seedIssues, err := migration.LintSeed(seed, opts)
+				if err != nil {
+					return fmt.Errorf("%s: %w", db.Name, err)
+				}
+				for i := range seedIssues {
+					if rel, err := filepath.Rel(root, seedIssues[i].File); err == nil {
+						seedIssues[i].File = rel
+					}
+				}
+				issues = append(issues, seedIssues...)
+			}
+		}
+
+		for _, issue := range issues {
+			if issue.Severity == migration.SeverityError {
+				report.Errors++
+			} else {
+				report.Warnings++
+			}
+			report.Issues = append(report.Issues, lintIssue{
+				Database: db.Name,
+				File:     issue.File,
+				Line:     issue.Line,
+				Rule:     issue.Rule,
+				Severity: issue.Severity,
+				Message:  issue.Message,
+			})
+		}
+	}
+
+	report.databases = len(databases)
+	if err := outputRenderer(cmd).report(os.Stdout, report); err != nil {
+		return err
+	}
+
+	if report.Errors > 0 {
+		return fmt.Errorf("lint found %d errors", report.Errors)
+	}
+	return nil
+}
+
+// lintPending checks the up migrations pending on a database with the destructive rules
+func lintPending(cmd *cli.Command, infraConfig *config.InfraConfig, project *config.ProjectConfig, db types.EncoreDatabase, opts migration.LintOptions) ([]migration.LintIssue, error) {
+	mapping, err := infraConfig.GetMapping(db.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyConnectionOverrides(cmd, mapping); err != nil {
+		return nil, err
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return nil, err
+	}
+	session, err := sessionOptions(cmd, project, db.Name)
+	if err != nil {
+		return nil, err
+	}
+	files, err := pendingUpFiles(newMigrator(cmd).WithSession(session), connStr, db, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	return migration.LintDestructive(files, opts)
+}
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// databaseList is the `list` document with the global --output json. The schema is stable;
+// incompatible changes bump SchemaVersion.
+//
+//	{
+//	  "schema_version": 1,
+//	  "databases": [
+//	    {"name": "users", "migrations": "users/migrations"},
+//	    {"name": "legacy", "migrations": "legacy/migrations", "retired": true}
+//	  ]
+//	}
+//
+// name is the Encore database name; migrations is the slash-separated
+// migrations directory relative to the app root; retired is only present
+// for databases marked retired.
+type databaseList struct {
+	SchemaVersion int              `json:"schema_version"`
+	Databases     []listedDatabase `json:"databases"`
+}
+
+type listedDatabase struct {
+	Name       string `json:"name"`
+	Migrations string `json:"migrations"`
+	Retired    bool   `json:"retired,omitempty"`
+}
+
+// listSchemaVersion is the current databaseList schema version
+const listSchemaVersion = 1
+
+// newDatabaseList builds the export document with paths relative to root
+func newDatabaseList(root string, databases []types.EncoreDatabase) databaseList {
+	list := databaseList{SchemaVersion: listSchemaVersion, Databases: []listedDatabase{}}
+	for _, db := range databases {
+		path := db.MigrationsPath
+		if rel, err := filepath.Rel(root, path); err == nil {
+			path = rel
+		}
+		list.Databases = append(list.Databases, listedDatabase{Name: db.Name, Migrations: filepath.ToSlash(path), Retired: db.Retired})
+	}
+	return list
+}
+
+func (list databaseList) text(w io.Writer) {
+	if len(list.Databases) == 0 {
+		fmt.Fprintln(w, "No databases found.")
+		return
+	}
+	fmt.Fprintf(w, "%-20s %-50s\n", "DATABASE", "MIGRATIONS PATH")
+	fmt.Fprintln(w, strings.Repeat("-", 70))
+	for _, db := range list.Databases {
+		if db.Retired {
+			fmt.Fprintf(w, "%-20s %-50s (retired)\n", db.Name, db.Migrations)
+			continue
+		}
+		fmt.Fprintf(w, "%-20s %-50s\n", db.Name, db.Migrations)
+	}
+}
+
+func (list databaseList) markdown(w io.Writer) {
+	fmt.Fprintf(w, "### Databases\n\n")
+	fmt.Fprintf(w, "| Database | Migrations | Retired |\n")
+	fmt.Fprintf(w, "|---|---|---|\n")
+	for _, db := range list.Databases {
+		retired := ""
+		if db.Retired {
+			retired = "yes"
+		}
+		fmt.Fprintf(w, "| `%s` | `%s` | %s |\n", db.Name, db.Migrations, retired)
+	}
+}
+
+func (list databaseList) records() []any { return databaseRecords(list.Databases) }
+
+// printDatabaseListTFVars writes a .tfvars file declaring encore_databases, a
+// map of Encore database name to its migrations path, e.g. for for_each over
+// postgresql_database resources
+func printDatabaseListTFVars(list databaseList) {
+	var b strings.Builder
+	b.WriteString("# Generated by encore-migrator --output tfvars list\n")
+	b.WriteString("encore_databases = {\n")
+	for _, db := range list.Databases {
+		fmt.Fprintf(&b, "  %s = {\n    migrations = %s\n", hclString(db.Name), hclString(db.Migrations))
+		if db.Retired {
+			b.WriteString("    retired    = true\n")
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	fmt.Print(b.String())
+}
+
+// hclString quotes s as an HCL string literal, escaping template sequences
+func hclString(s string) string {
+	q := strconv.Quote(s)
+	q = strings.ReplaceAll(q, "${", "$${")
+	return strings.ReplaceAll(q, "%{", "%%{")
+}
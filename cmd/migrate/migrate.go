@@ -2,86 +2,330 @@ package migrate
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/urfave/cli/v3"
 
+	"github.com/theoffensivecoder/encoredev-migrator/internal/appsource"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/credexec"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/kerberos"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/logging"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/manifest"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/secretcache"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/sshtunnel"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
 )
 
+// Version is the CLI version, set at build time with -ldflags "-X .../cmd/migrate.Version=v1.2.3"
+var Version = "dev"
+
 // Run executes the CLI application
 func Run(ctx context.Context, args []string) error {
+	// lib/pq asks for a GSSAPI provider when a server wants Kerberos
+	pq.RegisterGSSProvider(func() (pq.GSS, error) { return kerberos.NewGSS() })
+
 	app := &cli.Command{
-		Name:  "encore-migrator",
-		Usage: "Run database migrations for Encore.dev applications",
+		Name:    "encore-migrator",
+		Usage:   "Run database migrations for Encore.dev applications",
+		Version: Version,
+		// cli's version flag takes -v, which is --verbose; ours is below
+		HideVersion: true,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "config",
-				Aliases:  []string{"c"},
-				Usage:    "Path to InfraConfig JSON file",
-				Required: true,
-				Value:    "infra.config.json",
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Path to InfraConfig JSON file",
+				Value:   "infra.config.json",
+				Sources: cli.EnvVars(envConfig),
 			},
 			&cli.StringFlag{
 				Name:    "app",
 				Aliases: []string{"a"},
-				Usage:   "Path to Encore application root",
+				Usage:   "Path to Encore application root, a .tar.gz, .tgz, .tar or .zip of its source, or an OCI artifact oci://registry/repo:tag[@sha256:digest], unpacked to a temporary directory",
 				Value:   ".",
 			},
 			&cli.StringFlag{
 				Name:    "manifest",
 				Aliases: []string{"m"},
-				Usage:   "Path to manifest file (overrides AST discovery)",
+				Usage:   "Path to manifest file (overrides AST discovery; default for an oci:// app: manifest.yaml, .yml or .json at its root)",
+			},
+			&cli.StringFlag{
+				Name:  "discovery",
+				Usage: "How to scan the source for databases: ast parses files one by one; typed type-checks the module's packages with the go command, following imports, constants of other packages and wrapper functions (default: discovery.mode, else ast)",
+			},
+			&cli.Int64Flag{
+				Name:  "max-file-size",
+				Usage: "Skip Go files larger than this many bytes during discovery, with a warning naming each (-1 for no limit)",
+				Value: discovery.DefaultMaxFileSize,
+			},
+			&cli.StringFlag{
+				Name:    "app-image",
+				Usage:   "Application image being deployed; refuse to run unless its --app-image-label names the digest of the --app archive or oci:// bundle",
+				Sources: cli.EnvVars(envAppImage),
+			},
+			&cli.StringFlag{
+				Name:  "app-image-label",
+				Usage: "Image label holding the bundle digest (sha256:... or a reference ending in @sha256:...)",
+				Value: appsource.DefaultBundleLabel,
+			},
+			&cli.StringSliceFlag{
+				Name:  "skip-dir",
+				Usage: "Also skip directories matching this pattern during discovery, e.g. gen or services/*/fixtures (repeatable; adds to discovery.skip_dirs)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "include-dir",
+				Usage: "Walk directories matching this pattern even if skipped by default, e.g. vendor (repeatable; adds to discovery.include_dirs)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "Scan every Go file during discovery instead of reusing what the cache under <state-dir>/cache recorded for unchanged files",
 			},
 			&cli.BoolFlag{
 				Name:    "verbose",
 				Aliases: []string{"v"},
 				Usage:   "Enable verbose output",
 			},
+			&cli.BoolFlag{
+				Name:  "version",
+				Usage: "print the version",
+			},
 			&cli.BoolFlag{
 				Name:  "debug",
 				Usage: "Enable debug logging",
 			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output format of reports, e.g. of status, list, up, verify or lint: text, json, ndjson (a line per record, usually a database) or markdown; list also takes tfvars and plan github-comment. Except with text, progress goes to stderr",
+				Value:   "text",
+			},
 			&cli.StringFlag{
 				Name:  "host",
-				Usage: "Override database host (e.g., tailscale-hostname:5432)",
+				Usage: "Override database host (e.g., tailscale-hostname:5432) (env: " + envHost + ")",
 			},
 			&cli.StringFlag{
 				Name:    "user",
 				Aliases: []string{"u"},
-				Usage:   "Override database username",
+				Usage:   "Override database username (env: " + envUser + ")",
 			},
 			&cli.StringFlag{
 				Name:    "password",
 				Aliases: []string{"p"},
-				Usage:   "Override database password",
+				Usage:   "Override database password (env: " + envPassword + ")",
+			},
+			&cli.StringFlag{
+				Name:  "ssh",
+				Usage: "Reach database hosts through an SSH tunnel from this bastion, user@host[:port], using the system ssh client (env: " + envSSH + ")",
+			},
+			&cli.StringFlag{
+				Name:  "ssh-key",
+				Usage: "Private key for --ssh; only this key is offered (env: " + envSSHKey + ")",
+			},
+			&cli.BoolFlag{
+				Name:  "ssh-no-agent",
+				Usage: "Don't offer keys from ssh-agent to the --ssh bastion",
+			},
+			&cli.StringSliceFlag{
+				Name:  "ssh-option",
+				Usage: "Extra ssh -o option for --ssh, e.g. StrictHostKeyChecking=accept-new (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:  "tls-min-version",
+				Usage: "Refuse database connections without TLS or negotiating a version older than this, 1.2 or 1.3 (default: tls.min_version) (env: " + envTLSMinVersion + ")",
+			},
+			&cli.StringFlag{
+				Name:  "database-suffix",
+				Usage: "Append this suffix to every PostgreSQL database name (env: " + envDatabaseSuffix + ")",
+			},
+			&cli.StringFlag{
+				Name:    "schema",
+				Usage:   "Run migrations in this schema instead of the default search_path, for blue/green deploys (see cutover)",
+				Sources: cli.EnvVars(envSchema),
+			},
+			&cli.BoolFlag{
+				Name:  "include-retired",
+				Usage: "Include databases marked retired (see retire), which up, down and status skip by default",
+			},
+			&cli.DurationFlag{
+				Name:    "statement-timeout",
+				Usage:   "Set statement_timeout on migration sessions, e.g. 5m (default: timeouts.statement; a database's own timeouts win)",
+				Sources: cli.EnvVars(envStatementTimeout),
+			},
+			&cli.DurationFlag{
+				Name:    "lock-timeout",
+				Usage:   "Set lock_timeout on migration sessions so a blocked ALTER TABLE gives up, e.g. 10s (default: timeouts.lock; a database's own timeouts win)",
+				Sources: cli.EnvVars(envLockTimeout),
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "Connection override profile from the project config (env: " + envProfile + ")",
+			},
+			&cli.StringFlag{
+				Name:  "admin-user",
+				Usage: "Username for privileged operations such as CREATE EXTENSION (default: the database user)",
+			},
+			&cli.StringFlag{
+				Name:  "admin-password",
+				Usage: "Password for --admin-user",
+			},
+			&cli.StringFlag{
+				Name:  "env-file",
+				Usage: "Load variables missing from the environment from this file before resolving $env references (default: .env in the app root, if present)",
+			},
+			&cli.StringFlag{
+				Name:  "project-config",
+				Usage: "Path to project config file (default: encore-migrate.yaml in the app root, if present)",
+			},
+			&cli.StringFlag{
+				Name:    "state-dir",
+				Usage:   "Directory for local run state and run reports (default: <app>/.encore-migrate; beside an --app archive; ./.encore-migrate for an oci:// app)",
+				Sources: cli.EnvVars(envStateDir),
+			},
+			&cli.IntFlag{
+				Name:  "retries",
+				Usage: "Retry connecting or taking the migration lock this many times after transient failures",
+			},
+			&cli.DurationFlag{
+				Name:  "retry-backoff",
+				Usage: "Wait before the first retry; doubles on each further retry",
+				Value: time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "no-lock",
+				Usage: "Do not take the local run lock (allows overlapping invocations)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-telemetry",
+				Usage: "Never send usage telemetry, even if ENCORE_MIGRATE_TELEMETRY=1",
+			},
+			&cli.BoolFlag{
+				Name:    "offline",
+				Usage:   "Forbid network access other than database connections (and their SSH tunnels): no secret managers, registries, Cloud SQL connector, webhooks, alerts or telemetry",
+				Sources: cli.EnvVars(envOffline),
+			},
+			&cli.StringSliceFlag{
+				Name:    "allow-exec",
+				Usage:   "Let {\"$exec\": ...} InfraConfig values run this credential command, a name looked up in PATH or an exact path (repeatable)",
+				Sources: cli.EnvVars(envAllowExec),
+			},
+			&cli.StringSliceFlag{
+				Name:    "suppress",
+				Usage:   "Don't print warnings with this code, e.g. W004 (repeatable; adds to the project config's warnings.suppress; `encore-migrator warnings` lists the codes)",
+				Sources: cli.EnvVars(envSuppress),
+			},
+			&cli.BoolFlag{
+				Name:    "warnings-as-errors",
+				Usage:   "Print every warning as an error and exit non-zero once the command finishes (e.g. in CI)",
+				Sources: cli.EnvVars(envWarningsAsErrors),
+			},
+			&cli.StringSliceFlag{
+				Name:    "warning-as-error",
+				Usage:   "Treat warnings with this code, e.g. W001, as errors, like --warnings-as-errors (repeatable; adds to the project config's warnings.errors)",
+				Sources: cli.EnvVars(envWarningAsError),
+			},
+			&cli.DurationFlag{
+				Name:    "secret-cache-ttl",
+				Usage:   "Fetch $gcp_secret and $exec values again once cached this long (default: once per run, however many databases share them)",
+				Sources: cli.EnvVars(envSecretCacheTTL),
 			},
 		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			if cmd.Bool("version") {
+				cli.ShowVersion(cmd)
+				return ctx, cli.Exit("", 0)
+			}
 			logging.Setup(cmd.Bool("debug"))
 			slog.Debug("debug logging enabled")
+			if err := checkOutputFormat(cmd.String("output"), cmd.Args().First()); err != nil {
+				return ctx, err
+			}
+			if cmd.Bool("offline") {
+				offline.Enable()
+				slog.Debug("offline mode enabled")
+			}
+			credexec.Allow(cmd.StringSlice("allow-exec")...)
+			if err := suppressWarnings(cmd.StringSlice("suppress")...); err != nil {
+				return ctx, fmt.Errorf("--suppress: %w", err)
+			}
+			if err := escalateWarnings(cmd.Bool("warnings-as-errors"), cmd.StringSlice("warning-as-error")...); err != nil {
+				return ctx, fmt.Errorf("--warning-as-error: %w", err)
+			}
+			if cmd.Duration("secret-cache-ttl") < 0 {
+				return ctx, fmt.Errorf("--secret-cache-ttl must not be negative")
+			}
+			secretcache.SetTTL(cmd.Duration("secret-cache-ttl"))
+			if err := fetchAppSource(ctx, cmd); err != nil {
+				return ctx, err
+			}
+			if err := loadEnvFile(cmd); err != nil {
+				return ctx, err
+			}
+			startUsage(cmd)
 			return ctx, nil
 		},
+		After: reportUsage,
 		Commands: []*cli.Command{
 			upCommand(),
 			downCommand(),
+			planCommand(),
 			statusCommand(),
 			listCommand(),
+			createCommand(),
+			lintCommand(),
+			validateCommand(),
+			suggestDownCommand(),
 			forceCommand(),
+			cancelCommand(),
+			explainCommand(),
+			configCommand(),
+			telemetryCommand(),
+			healthcheckCommand(),
+			selftestCommand(),
+			benchCommand(),
+			ciCommand(),
+			k8sCommand(),
+			helmCommand(),
+			inventoryCommand(),
+			reconcileCommand(),
+			teardownCommand(),
+			previewCommand(),
+			simulateCommand(),
+			cutoverCommand(),
+			runsCommand(),
+			historyCommand(),
+			verifyCommand(),
+			stateCommand(),
+			renameCommand(),
+			retireCommand(),
+			restoreSnapshotCommand(),
 			generateManifestCommand(),
+			warningsCommand(),
 		},
 	}
 
-	return app.Run(ctx, args)
+	defer migration.RemoveTLSFiles()
+	defer sshtunnel.CloseAll()
+	defer removeAppSource()
+	if err := app.Run(ctx, args); err != nil {
+		return err
+	}
+	return escalatedWarnings()
 }
 
 func upCommand() *cli.Command {
@@ -98,8 +342,100 @@ func upCommand() *cli.Command {
 				Name:  "steps",
 				Usage: "Number of migrations to apply (default: all pending)",
 			},
+			&cli.IntFlag{
+				Name:  "to-version",
+				Usage: "Apply pending migrations up to and including this version, then stop (needs --database when several databases are selected)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the migrations that would be applied per database without executing any SQL",
+			},
+			&cli.StringFlag{
+				Name:  "resume",
+				Usage: "Resume an interrupted run by ID, skipping databases it already completed",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-verify",
+				Usage: "Skip read-back verification of the schema version after migrating",
+			},
+			&cli.BoolFlag{
+				Name:  "no-history",
+				Usage: "Don't record the run in each database's encore_migrate_history table",
+			},
+			&cli.DurationFlag{
+				Name:  "heartbeat",
+				Usage: "Interval for logging the running statement and elapsed time (0 disables)",
+				Value: 30 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "per-statement",
+				Usage: "Run each statement of a migration file separately within its transaction, reporting the failing statement and per-statement timings",
+			},
+			&cli.StringSliceFlag{
+				Name:   "inject-failure",
+				Usage:  "TESTING: fail the migration file of <database>:<version> instead of running it, leaving the database dirty (repeatable; refused in production)",
+				Hidden: true,
+			},
+			&cli.BoolFlag{
+				Name:  "skip-failed-statement",
+				Usage: "EMERGENCY: with --per-statement, roll back a failing statement to its savepoint and carry on with the rest (only for idempotent statements failing spuriously)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "wait-for-replicas",
+				Usage: "Replica host[:port] or DSNs to poll until they report the new version (adds to project config replicas)",
+			},
+			&cli.DurationFlag{
+				Name:  "replica-timeout",
+				Usage: "How long to wait for replicas to catch up; one still behind is a warning (W018), not a failed migration",
+				Value: 5 * time.Minute,
+			},
+			&cli.BoolFlag{
+				Name:  "skip-analyze",
+				Usage: "Skip running ANALYZE on tables touched by applied migrations",
+			},
+			&cli.BoolFlag{
+				Name:  "create-extensions",
+				Usage: "Create missing required extensions (using --admin-user if set) instead of failing",
+			},
+			&cli.StringFlag{
+				Name:  "phase",
+				Usage: "Apply only expand (before code rollout) or contract (after) migrations, per their \"-- phase:\" directive",
+			},
+			&cli.IntFlag{
+				Name:  "parallel",
+				Usage: "Migrate up to this many independent databases at once; dependencies still finish first",
+				Value: 1,
+			},
+			&cli.StringSliceFlag{
+				Name:  "atomic-group",
+				Usage: "Comma-separated databases whose changes go together, e.g. billing,users: if one fails, roll the others back to their versions before the run (best effort, needs down files)",
+			},
+			&cli.BoolFlag{
+				Name:  "block-destructive",
+				Usage: "Refuse pending migrations that drop tables or columns, truncate, build indexes without CONCURRENTLY or narrow column types (rules at error severity; default: lint.block_destructive)",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-destructive",
+				Usage: "Apply destructive migrations that --block-destructive or lint.block_destructive would refuse",
+			},
+			&cli.StringFlag{
+				Name:    "ticket",
+				Usage:   "Change ticket (e.g. ENG-1234) to record with the run and notify via the project config tickets.webhook",
+				Sources: cli.EnvVars(envTicket),
+			},
+			&cli.StringFlag{
+				Name:  "require-app-version",
+				Usage: "With --phase contract, first confirm via the project config app_version_gate that every app instance runs at least this version",
+			},
+			&cli.BoolFlag{
+				Name:  "watch",
+				Usage: "Keep running and apply new migrations whenever .sql files appear in the migrations directories, for local development (refused in production)",
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.Bool("watch") {
+				return watchMigrations(ctx, cmd)
+			}
 			return runMigrations(ctx, cmd, "up")
 		},
 	}
@@ -124,6 +460,64 @@ func downCommand() *cli.Command {
 				Name:  "all",
 				Usage: "Rollback all migrations (dangerous!)",
 			},
+			&cli.IntFlag{
+				Name:  "checkpoint-interval",
+				Usage: "Roll back this many migrations at a time, printing the version reached and, on a terminal without --yes, asking before going on; stopping pauses the database for --resume",
+			},
+			&cli.DurationFlag{
+				Name:  "checkpoint-wait",
+				Usage: "With --checkpoint-interval, wait this long at each checkpoint, e.g. 30s to let replicas and caches catch up",
+			},
+			&cli.StringFlag{
+				Name:  "resume",
+				Usage: "Resume a paused or interrupted rollback by run ID, skipping databases it already completed (pass the same flags again)",
+			},
+			yesFlag(),
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the migrations that would be rolled back per database without executing any SQL",
+			},
+			&cli.StringFlag{
+				Name:  "missing-down",
+				Usage: "When a database would pass a version without a down file: fail before rolling anything back, or skip that database with a warning (fail|skip)",
+				Value: missingDownFail,
+			},
+			&cli.IntFlag{
+				Name:  "parallel",
+				Usage: "Roll back up to this many independent databases at once; dependents still finish first",
+				Value: 1,
+			},
+			&cli.BoolFlag{
+				Name:  "skip-verify",
+				Usage: "Skip read-back verification of the schema version after migrating",
+			},
+			&cli.BoolFlag{
+				Name:  "no-history",
+				Usage: "Don't record the run in each database's encore_migrate_history table",
+			},
+			&cli.DurationFlag{
+				Name:  "heartbeat",
+				Usage: "Interval for logging the running statement and elapsed time (0 disables)",
+				Value: 30 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "per-statement",
+				Usage: "Run each statement of a migration file separately within its transaction, reporting the failing statement and per-statement timings",
+			},
+			&cli.StringSliceFlag{
+				Name:   "inject-failure",
+				Usage:  "TESTING: fail the migration file of <database>:<version> instead of running it, leaving the database dirty (repeatable; refused in production)",
+				Hidden: true,
+			},
+			&cli.BoolFlag{
+				Name:  "skip-failed-statement",
+				Usage: "EMERGENCY: with --per-statement, roll back a failing statement to its savepoint and carry on with the rest (only for idempotent statements failing spuriously)",
+			},
+			&cli.StringFlag{
+				Name:    "ticket",
+				Usage:   "Change ticket (e.g. ENG-1234) to record with the run and notify via the project config tickets.webhook",
+				Sources: cli.EnvVars(envTicket),
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			return runMigrations(ctx, cmd, "down")
@@ -141,9 +535,24 @@ func statusCommand() *cli.Command {
 				Aliases: []string{"d"},
 				Usage:   "Specific Encore database name to check (default: all)",
 			},
+			&cli.BoolFlag{
+				Name:    "extended",
+				Aliases: []string{"pending", "wide"},
+				Usage:   "Also list the file names of the migrations pending on each database, oldest first",
+			},
+			&cli.BoolFlag{
+				Name:  "exit-code",
+				Usage: "Exit with 1 when any database has pending migrations and 2 when any is dirty or unreachable, for CI gates",
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			return showStatus(ctx, cmd)
+			err := showStatus(ctx, cmd)
+			var exit cli.ExitCoder
+			if err != nil && cmd.Bool("exit-code") && !errors.As(err, &exit) {
+				// 1 means pending migrations here; any other failure is 2
+				return cli.Exit("Error: "+err.Error(), statusExitUnhealthy)
+			}
+			return err
 		},
 	}
 }
@@ -151,7 +560,7 @@ func statusCommand() *cli.Command {
 func listCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "list",
-		Usage: "List discovered Encore databases",
+		Usage: "List discovered Encore databases (with the global --output json, in a stable schema; --output tfvars for Terraform)",
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			return listDatabases(ctx, cmd)
 		},
@@ -174,6 +583,7 @@ func forceCommand() *cli.Command {
 				Usage:    "Version to set",
 				Required: true,
 			},
+			yesFlag(),
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			return forceVersion(ctx, cmd)
@@ -187,8 +597,7 @@ func generateManifestCommand() *cli.Command {
 		Usage: "Generate a manifest file from discovered databases",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "output",
-				Aliases:  []string{"o"},
+				Name:     "out",
 				Usage:    "Output manifest path (format auto-detected from extension)",
 				Required: true,
 			},
@@ -213,19 +622,28 @@ func generateManifest(ctx context.Context, cmd *cli.Command) error {
 		appPath = "."
 	}
 
+	opts, err := discoveryOptions(cmd)
+	if err != nil {
+		return err
+	}
 	generator := manifest.NewGenerator(manifest.GenerateOptions{
-		AppPath:    appPath,
-		OutputPath: cmd.String("output"),
-		CopyTo:     cmd.String("copy-to"),
-		Format:     cmd.String("format"),
-		Verbose:    cmd.Bool("verbose"),
+		AppPath:     appPath,
+		OutputPath:  cmd.String("out"),
+		CopyTo:      cmd.String("copy-to"),
+		Format:      cmd.String("format"),
+		Verbose:     cmd.Bool("verbose"),
+		Mode:        opts.Mode,
+		MaxFileSize: opts.MaxFileSize,
+		SkipDirs:    opts.SkipDirs,
+		IncludeDirs: opts.IncludeDirs,
+		CacheDir:    opts.CacheDir,
 	})
 
 	if err := generator.Generate(); err != nil {
 		return fmt.Errorf("generating manifest: %w", err)
 	}
 
-	fmt.Printf("Manifest generated: %s\n", cmd.String("output"))
+	fmt.Printf("Manifest generated: %s\n", cmd.String("out"))
 	if copyTo := cmd.String("copy-to"); copyTo != "" {
 		fmt.Printf("Migrations copied to: %s\n", copyTo)
 	}
@@ -234,40 +652,212 @@ func generateManifest(ctx context.Context, cmd *cli.Command) error {
 }
 
 func runMigrations(ctx context.Context, cmd *cli.Command, direction string) error {
-	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	var phase migration.Phase
+	if name := cmd.String("phase"); name != "" {
+		var err error
+		if phase, err = migration.ParsePhase(name); err != nil {
+			return err
+		}
+		if cmd.IsSet("steps") {
+			return fmt.Errorf("--phase cannot be combined with --steps")
+		}
+	}
+	if cmd.String("require-app-version") != "" && phase != migration.PhaseContract {
+		return fmt.Errorf("--require-app-version only applies to --phase contract")
+	}
+	if cmd.Bool("skip-failed-statement") && !cmd.Bool("per-statement") {
+		return fmt.Errorf("--skip-failed-statement requires --per-statement")
+	}
+	if interval := cmd.Int("checkpoint-interval"); interval < 0 {
+		return fmt.Errorf("--checkpoint-interval cannot be negative")
+	} else if interval > 0 && cmd.Int("parallel") > 1 && !cmd.Bool("yes") {
+		return fmt.Errorf("--checkpoint-interval asks at each checkpoint, one database at a time: drop --parallel or pass --yes")
+	}
+
+	targets, err := selectTargets(cmd, direction)
 	if err != nil {
 		return err
 	}
+	infraConfig, project, databases := targets.infraConfig, targets.project, targets.databases
+	dependencies, requirements, priorities := targets.dependencies, targets.requirements, targets.priorities
+	if err := checkToVersion(cmd, databases); err != nil {
+		return err
+	}
 
-	// Filter to specific database if requested
-	targetDB := cmd.String("database")
-	if targetDB != "" {
-		slog.Debug("filtering to specific database", "database", targetDB)
-		databases = discovery.FilterDatabases(databases, targetDB)
+	if err := validateTicket(cmd.String("ticket"), project); err != nil {
+		return err
+	}
+
+	injected, err := parseInjectedFailures(cmd.StringSlice("inject-failure"), infraConfig, databases)
+	if err != nil {
+		return err
+	}
+	var group []string
+	if direction == "up" {
+		if group, err = parseAtomicGroup(cmd, databases); err != nil {
+			return err
+		}
+	}
+
+	if cmd.Bool("dry-run") {
+		return printPlans(ctx, cmd, infraConfig, project, databases, direction, phase, outputRenderer(cmd))
+	}
+	if err := checkOffline(cmd, infraConfig, project, databases, direction, phase); err != nil {
+		return err
+	}
+
+	if direction == "down" {
+		if databases, err = checkMissingDown(cmd, targets); err != nil {
+			return err
+		}
 		if len(databases) == 0 {
-			return fmt.Errorf("database %q not found", targetDB)
+			return fmt.Errorf("no databases left to roll back")
+		}
+		if cmd.Bool("all") {
+			names := make([]string, len(databases))
+			for i, db := range databases {
+				names[i] = db.Name
+			}
+			if err := confirmDestructive(cmd, "roll back every migration of "+strings.Join(names, ", "), names); err != nil {
+				return err
+			}
 		}
 	}
 
-	if len(databases) == 0 {
-		return fmt.Errorf("no databases found")
+	store, err := stateStore(cmd)
+	if err != nil {
+		return err
 	}
 
-	slog.Info("starting migrations", "direction", direction, "database_count", len(databases))
+	release, err := acquireRunLock(cmd, store, direction)
+	if err != nil {
+		return err
+	}
+	defer release()
 
-	migrator := migration.NewMigrator(cmd.Bool("verbose"))
+	// Resume a previous run or start a new one
+	var run *state.Run
+	if resumeID := cmd.String("resume"); resumeID != "" {
+		run, err = store.LoadRun(resumeID)
+		if err != nil {
+			return err
+		}
+		if run.Direction != direction {
+			return fmt.Errorf("run %s was a %q run, cannot resume it as %q", run.ID, run.Direction, direction)
+		}
+		run.FinishedAt = nil
+		slog.Info("resuming run", "run_id", run.ID)
+	} else {
+		run = state.NewRun(direction)
+	}
+	if id := cmd.String("ticket"); id != "" {
+		run.Ticket = id
+	}
+	if run.Ticket == "" && project.Tickets.Required {
+		return fmt.Errorf("the project config requires a change ticket: pass --ticket (or set %s)", envTicket)
+	}
+
+	stdout := progressOutput(cmd)
+	fmt.Fprintf(stdout, "Run ID: %s\n", run.ID)
+	if run.Ticket != "" {
+		fmt.Fprintf(stdout, "Ticket: %s\n", run.Ticket)
+	}
+
+	slog.Info("starting migrations", "direction", direction, "database_count", len(databases), "run_id", run.ID)
+
+	migrator := newMigrator(cmd)
+	migrator.HeartbeatInterval = cmd.Duration("heartbeat")
+	migrator.PerStatement = cmd.Bool("per-statement")
+	migrator.SkipFailedStatements = cmd.Bool("skip-failed-statement")
+	if !cmd.Bool("no-history") {
+		migrator.RecordRun = runInfo(cmd, run)
+	}
+	if len(group) > 0 {
+		fmt.Fprintf(stdout, atomicGroupCaveats, strings.Join(group, ", "))
+	}
+	pauses, err := newPauser(cmd, project, run.ID)
+	if err != nil {
+		return err
+	}
+	flags, err := newFlagSwitcher(project, run.ID)
+	if err != nil {
+		return err
+	}
+	if migrator.SkipFailedStatements {
+		warn(os.Stderr, warnSkipFailedEnabled, "--skip-failed-statement is set. A failing statement is rolled back to its savepoint and SKIPPED;\n"+
+			"its migration is still recorded as applied. Skipped statements are listed in the run record.")
+	}
 	var errs []string
 
-	for _, db := range databases {
+	// mu guards errs and run while databases migrate in parallel
+	var mu sync.Mutex
+
+	// outputs returns where a database's progress goes; in parallel runs every line is prefixed with its name
+	parallel := int(cmd.Int("parallel"))
+	outputs := func(db types.EncoreDatabase) (io.Writer, io.Writer) {
+		if parallel <= 1 {
+			return stdout, os.Stderr
+		}
+		prefix := []byte("[" + db.Name + "] ")
+		return &prefixWriter{mu: &outputMu, w: stdout, prefix: prefix}, &prefixWriter{mu: &outputMu, w: os.Stderr, prefix: prefix}
+	}
+
+	// fail records a database failure in the error summary and the run state
+	fail := func(name string, errOut io.Writer, err error) {
+		slog.Error("migration failed", "database", name, "error", err)
+		fmt.Fprintf(errOut, "  Error: %v\n", err)
+		status := state.StatusFailed
+		if migration.IsCancelled(err) {
+			status = state.StatusCancelled
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		run.Record(state.DatabaseRun{Name: name, Status: status, Error: err.Error()})
+		saveRun(store, run)
+	}
+
+	// captureState prints the state a failure left the database in and
+	// records it in the run report, so responders need not run status
+	captureState := func(db types.EncoreDatabase, errOut io.Writer, m *migration.Migrator, connStr string) {
+		inspection, err := m.Inspect(connStr, db.MigrationsPath)
+		if err != nil {
+			slog.Debug("could not capture state after failure", "database", db.Name, "error", err)
+			return
+		}
+		printFailureState(errOut, inspection)
+		mu.Lock()
+		defer mu.Unlock()
+		run.Database(db.Name).State = &state.DatabaseState{Version: inspection.Version, Dirty: inspection.Dirty, PendingFiles: inspection.PendingNames()}
+		saveRun(store, run)
+	}
+
+	migrateDatabase := func(db types.EncoreDatabase) (bool, error) {
+		out, errOut := outputs(db)
+
+		mu.Lock()
+		completed := run.Completed(db.Name)
+		mu.Unlock()
+		if completed {
+			slog.Info("skipping database completed in previous attempt", "database", db.Name, "run_id", run.ID)
+			fmt.Fprintf(out, "Skipping %q (already completed in run %s)\n", db.Name, run.ID)
+			return true, nil
+		}
+
 		mapping, err := infraConfig.GetMapping(db.Name)
 		if err != nil {
-			slog.Warn("skipping database - no config found", "database", db.Name, "error", err)
-			fmt.Fprintf(os.Stderr, "Warning: skipping %q: %v\n", db.Name, err)
-			continue
+			warn(errOut, warnNoConfig, "skipping %q: %v", db.Name, err)
+			mu.Lock()
+			run.Record(state.DatabaseRun{Name: db.Name, Status: state.StatusSkipped, Error: err.Error()})
+			saveRun(store, run)
+			mu.Unlock()
+			return false, nil
 		}
 
 		// Apply host override if provided
-		applyConnectionOverrides(cmd, mapping)
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return false, err
+		}
 
 		slog.Debug("resolved database mapping",
 			"encore_name", db.Name,
@@ -280,7 +870,13 @@ func runMigrations(ctx context.Context, cmd *cli.Command, direction string) erro
 
 		connStr, err := migration.BuildConnectionString(mapping)
 		if err != nil {
-			return fmt.Errorf("building connection string for %q: %w", db.Name, err)
+			return false, fmt.Errorf("building connection string for %q: %w", db.Name, err)
+		}
+
+		// Tag our connections so `cancel` can find them in pg_stat_activity
+		connStr, err = migration.WithApplicationName(connStr, migration.ApplicationName(run.ID))
+		if err != nil {
+			return false, fmt.Errorf("building connection string for %q: %w", db.Name, err)
 		}
 
 		slog.Info("connecting to database",
@@ -290,13 +886,101 @@ func runMigrations(ctx context.Context, cmd *cli.Command, direction string) erro
 			"port", mapping.Port,
 		)
 
-		fmt.Printf("Migrating %q (%s)...\n", db.Name, mapping.PGDBName)
+		fmt.Fprintf(out, "Migrating %q (%s)...\n", db.Name, mapping.PGDBName)
+		started := time.Now()
 
-		var result *types.MigrationResult
+		session, err := sessionOptions(cmd, project, db.Name)
+		if err != nil {
+			fail(db.Name, errOut, err)
+			return false, nil
+		}
+		dbMigrator := migrator.WithSession(session)
+		dbMigrator.FailAtVersion = injected[db.Name]
+
+		if direction == "up" {
+			if err := ensureExtensions(cmd, out, dbMigrator, db, mapping, project); err != nil {
+				fail(db.Name, errOut, err)
+				captureState(db, errOut, dbMigrator, connStr)
+				return false, nil
+			}
+			if err := dbMigrator.EnsureSchema(connStr); err != nil {
+				fail(db.Name, errOut, err)
+				captureState(db, errOut, dbMigrator, connStr)
+				return false, nil
+			}
+			if err := checkRequirements(cmd, project, dbMigrator, connStr, db, requirements[db.Name]); err != nil {
+				fail(db.Name, errOut, err)
+				captureState(db, errOut, dbMigrator, connStr)
+				return false, nil
+			}
+		}
+
+		planSteps := int(cmd.Int("steps"))
+		if phase != "" || cmd.Bool("all") {
+			planSteps = 0
+		}
+		if direction == "up" && cmd.IsSet("to-version") {
+			version := uint(cmd.Int("to-version"))
+			if planSteps, err = stepsToVersion(dbMigrator, connStr, db, version); err != nil {
+				fail(db.Name, errOut, err)
+				captureState(db, errOut, dbMigrator, connStr)
+				return false, nil
+			}
+			// Up with 0 steps would apply everything pending
+			if planSteps == 0 {
+				mu.Lock()
+				run.Record(state.DatabaseRun{Name: db.Name, Status: state.StatusCompleted, VersionBefore: version, VersionAfter: version})
+				saveRun(store, run)
+				mu.Unlock()
+				slog.Info("no migration changes", "database", db.Name, "version", version)
+				fmt.Fprintf(out, "  No changes (version %d)\n", version)
+				return true, nil
+			}
+		}
 		if direction == "up" {
+			if err := checkPending(cmd, errOut, project, dbMigrator, connStr, db, phase, planSteps); err != nil {
+				fail(db.Name, errOut, err)
+				captureState(db, errOut, dbMigrator, connStr)
+				return false, nil
+			}
+		}
+		resumeWriters, err := quiesceDatabase(ctx, out, errOut, project, dbMigrator, connStr, db, mapping, direction, planSteps, run.ID)
+		if err != nil {
+			fail(db.Name, errOut, err)
+			captureState(db, errOut, dbMigrator, connStr)
+			return false, nil
+		}
+		resume, err := pauses.pause(ctx, out, errOut, dbMigrator, connStr, db, direction, planSteps)
+		if err != nil {
+			resumeWriters(false)
+			fail(db.Name, errOut, err)
+			captureState(db, errOut, dbMigrator, connStr)
+			return false, nil
+		}
+		if err := flags.prepare(ctx, out, errOut, dbMigrator, connStr, db, direction, planSteps); err != nil {
+			resume()
+			resumeWriters(false)
+			fail(db.Name, errOut, err)
+			captureState(db, errOut, dbMigrator, connStr)
+			return false, nil
+		}
+
+		var result *types.MigrationResult
+		var paused bool
+		if direction == "up" && phase != "" {
+			slog.Debug("applying up migrations", "database", db.Name, "phase", phase)
+			result, err = dbMigrator.UpPhase(ctx, connStr, db.MigrationsPath, phaseOptions(cmd, project, db.Name, phase))
+		} else if direction == "up" && cmd.IsSet("to-version") {
+			version := uint(cmd.Int("to-version"))
+			slog.Debug("applying up migrations", "database", db.Name, "to_version", version)
+			result, err = dbMigrator.UpTo(connStr, db.MigrationsPath, version)
+		} else if direction == "up" {
 			steps := int(cmd.Int("steps"))
 			slog.Debug("applying up migrations", "database", db.Name, "steps", steps)
-			result, err = migrator.Up(connStr, db.MigrationsPath, steps)
+			result, err = dbMigrator.Up(connStr, db.MigrationsPath, steps)
+		} else if cmd.Int("checkpoint-interval") > 0 {
+			slog.Debug("applying down migrations with checkpoints", "database", db.Name, "interval", cmd.Int("checkpoint-interval"))
+			result, paused, err = downWithCheckpoints(ctx, cmd, out, dbMigrator, connStr, db)
 		} else {
 			steps := int(cmd.Int("steps"))
 			if cmd.Bool("all") {
@@ -304,36 +988,193 @@ func runMigrations(ctx context.Context, cmd *cli.Command, direction string) erro
 				slog.Warn("rolling back ALL migrations", "database", db.Name)
 			}
 			slog.Debug("applying down migrations", "database", db.Name, "steps", steps)
-			result, err = migrator.Down(connStr, db.MigrationsPath, steps)
+			result, err = dbMigrator.Down(connStr, db.MigrationsPath, steps)
+		}
+
+		// Confirm on a fresh connection that the version actually landed
+		if err == nil && !cmd.Bool("skip-verify") {
+			var server *types.ServerInfo
+			server, err = dbMigrator.VerifyVersion(connStr, result)
+			if err == nil {
+				slog.Debug("version verified", "database", db.Name, "version", result.VersionAfter, "server", server.String())
+			}
+		}
+		resume()
+		resumeWriters(err == nil)
+
+		// A replica still behind is not a failed migration: the primary has it
+		if err == nil && direction == "up" {
+			replicas := append(slices.Clone(project.Database(db.Name).Replicas), cmd.StringSlice("wait-for-replicas")...)
+			if lagErr := waitForReplicas(ctx, cmd, out, dbMigrator, mapping, connStr, replicas, result.VersionAfter); lagErr != nil {
+				warn(errOut, warnReplicaLag, "%s migrated, but %v", db.Name, lagErr)
+			}
 		}
 
 		if err != nil {
-			slog.Error("migration failed", "database", db.Name, "error", err)
-			errs = append(errs, fmt.Sprintf("%s: %v", db.Name, err))
-			fmt.Fprintf(os.Stderr, "  Error: %v\n", err)
-			continue
+			fail(db.Name, errOut, err)
+			captureState(db, errOut, dbMigrator, connStr)
+			reportDirtyState(dbMigrator, store, run.ID, db, connStr, err)
+			return false, nil
+		}
+
+		if direction == "up" && !cmd.Bool("skip-analyze") && result.VersionAfter > result.VersionBefore {
+			refreshStatistics(out, errOut, dbMigrator, db, connStr, result)
+		}
+
+		status := state.StatusCompleted
+		if paused {
+			status = state.StatusPaused
 		}
+		mu.Lock()
+		run.Record(state.DatabaseRun{
+			Name:          db.Name,
+			Status:        status,
+			VersionBefore: result.VersionBefore,
+			VersionAfter:  result.VersionAfter,
+			Statements:    statementTimings(result.Statements),
+		})
+		saveRun(store, run)
+		mu.Unlock()
 
 		if result.VersionBefore == result.VersionAfter {
 			slog.Info("no migration changes", "database", db.Name, "version", result.VersionAfter)
-			fmt.Printf("  No changes (version %d)\n", result.VersionAfter)
+			fmt.Fprintf(out, "  No changes (version %d)\n", result.VersionAfter)
 		} else {
 			slog.Info("migration completed",
 				"database", db.Name,
 				"version_before", result.VersionBefore,
 				"version_after", result.VersionAfter,
 			)
-			fmt.Printf("  Version: %d -> %d\n", result.VersionBefore, result.VersionAfter)
+			fmt.Fprintf(out, "  Version: %d -> %d (took %s)\n", result.VersionBefore, result.VersionAfter, humanDuration(time.Since(started)))
 		}
+		for _, st := range result.Statements {
+			if st.Skipped != "" {
+				warn(errOut, warnStatementSkipped, "skipped failed statement %s:%d: %s\n    %s", st.File, st.Line, st.SQL, st.Skipped)
+			}
+		}
+		if len(result.Statements) > 0 {
+			fmt.Fprintf(out, "  Slowest statements:\n")
+			printStatementTimings(out, statementTimings(result.Statements), slowestInProgress)
+		}
+		if paused {
+			// What it depends on must wait until it is rolled back all the way
+			fmt.Fprintf(out, "  Paused at version %d\n", result.VersionAfter)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	after := runAfter(databases, dependencies, direction)
+	waitFor := priorityBarriers(databases, priorities, direction)
+	if project.SkipLowerPriorityOnFailure {
+		for name, earlier := range waitFor {
+			after[name] = append(after[name], earlier...)
+		}
+		waitFor = nil
+	}
+	skip := func(db types.EncoreDatabase, failedDep string) {
+		out, errOut := outputs(db)
+		fmt.Fprintf(out, "Skipping %q...\n", db.Name)
+		fail(db.Name, errOut, fmt.Errorf("not attempted: %q did not complete", failedDep))
+	}
+	// Once a database of the atomic group fails, the rest of the group is
+	// skipped and what it already applied rolled back
+	var groupFailed string
+	migrateMember := func(db types.EncoreDatabase) (bool, error) {
+		if !slices.Contains(group, db.Name) {
+			return migrateDatabase(db)
+		}
+		mu.Lock()
+		failed := groupFailed
+		mu.Unlock()
+		if failed != "" {
+			skip(db, failed)
+			return false, nil
+		}
+		ok, err := migrateDatabase(db)
+		if !ok || err != nil {
+			mu.Lock()
+			if groupFailed == "" {
+				groupFailed = db.Name
+			}
+			mu.Unlock()
+		}
+		return ok, err
+	}
+	if err := schedule(databases, after, waitFor, parallel, migrateMember, skip); err != nil {
+		return err
+	}
+	// A member skipped because a database it depends on failed counts too
+	for _, name := range group {
+		if groupFailed == "" && !run.Completed(name) {
+			groupFailed = name
+		}
+	}
+	if groupFailed != "" {
+		errs = append(errs, rollBackAtomicGroup(cmd, stdout, os.Stderr, group, groupFailed, databases, infraConfig, project, migrator, store, run)...)
+	}
+
+	var pausedAt []string
+	for _, entry := range run.Databases {
+		if entry.Status == state.StatusPaused {
+			pausedAt = append(pausedAt, fmt.Sprintf("%s at version %d", entry.Name, entry.VersionAfter))
+		}
+	}
+	succeeded := len(errs) == 0 && len(pausedAt) == 0
+
+	run.Finish()
+	saveRun(store, run)
+	pruneRuns(store, project)
+	notifyTicket(ctx, stdout, project, run, succeeded)
+	alertOnFailure(ctx, stdout, infraConfig, project, run)
+
+	if err := outputRenderer(cmd).run(os.Stdout, newRunReport(run, databases, succeeded)); err != nil {
+		return err
 	}
 
+	if direction == "up" && len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "Resume with: encore-migrator up --resume %s\n", run.ID)
+	} else if direction == "down" && (len(errs) > 0 || len(pausedAt) > 0) {
+		fmt.Fprintf(os.Stderr, "Resume with: encore-migrator down --resume %s and the same flags\n", run.ID)
+	}
 	if len(errs) > 0 {
 		return fmt.Errorf("migration errors:\n  %s", strings.Join(errs, "\n  "))
 	}
+	if len(pausedAt) > 0 {
+		return fmt.Errorf("rollback paused at a checkpoint: %s", strings.Join(pausedAt, ", "))
+	}
 
 	return nil
 }
 
+// refreshStatistics runs ANALYZE on the tables touched by the migrations just applied.
+// Failures only warn: stale statistics should not fail a successful migration.
+func refreshStatistics(out, errOut io.Writer, migrator *migration.Migrator, db types.EncoreDatabase, connStr string, result *types.MigrationResult) {
+	analyzed, err := migrator.AnalyzeApplied(connStr, db.MigrationsPath, result.VersionBefore, result.VersionAfter)
+	if err != nil {
+		warn(errOut, warnAnalyzeFailed, "ANALYZE of %s failed: %v", db.Name, err)
+		return
+	}
+
+	if len(analyzed) > 0 {
+		slog.Info("statistics refreshed", "database", db.Name, "tables", analyzed)
+		fmt.Fprintf(out, "  Analyzed %d table(s)\n", len(analyzed))
+	}
+}
+
+// saveRun checkpoints run progress; failures are logged but never abort a migration
+func saveRun(store *state.Store, run *state.Run) {
+	if err := store.SaveRun(run); err != nil {
+		warn(os.Stderr, warnRunNotSaved, "run %s not saved: %v", run.ID, err)
+	}
+}
+
+// Exit codes of status --exit-code; 0 means every database is up to date
+const (
+	statusExitPending   = 1
+	statusExitUnhealthy = 2 // dirty or unreachable
+)
+
 func showStatus(ctx context.Context, cmd *cli.Command) error {
 	infraConfig, databases, err := loadConfigAndDiscover(cmd)
 	if err != nil {
@@ -348,26 +1189,50 @@ func showStatus(ctx context.Context, cmd *cli.Command) error {
 			return fmt.Errorf("database %q not found", targetDB)
 		}
 	}
+	if databases, err = activeDatabases(cmd, databases); err != nil {
+		return err
+	}
 
 	if len(databases) == 0 {
 		return fmt.Errorf("no databases found")
 	}
 
-	migrator := migration.NewMigrator(cmd.Bool("verbose"))
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("%-20s %-30s %-10s %-10s\n", "DATABASE", "PG_NAME", "VERSION", "DIRTY")
-	fmt.Println(strings.Repeat("-", 70))
+	migrator := newMigrator(cmd)
+
+	extended, exitCode := cmd.Bool("extended"), cmd.Bool("exit-code")
+	pending := false
+
+	var applied map[string]time.Time
+	if store, err := stateStore(cmd); err == nil {
+		applied = lastApplied(store)
+	}
+
+	// emit collects a database's row for the report
+	report := statusReport{SchemaVersion: reportSchemaVersion, Databases: []databaseStatus{}, Extended: extended}
+	emit := func(entry databaseStatus) {
+		if t, ok := applied[entry.Name]; ok {
+			entry.LastApplied = &t
+		}
+		report.Databases = append(report.Databases, entry)
+	}
 
 	for _, db := range databases {
 		mapping, err := infraConfig.GetMapping(db.Name)
 		if err != nil {
 			slog.Debug("no config for database", "database", db.Name, "error", err)
-			fmt.Printf("%-20s %-30s %-10s %-10s\n", db.Name, "N/A", "error", err.Error())
+			emit(databaseStatus{Name: db.Name, Error: err.Error()})
 			continue
 		}
 
 		// Apply host override if provided
-		applyConnectionOverrides(cmd, mapping)
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
 
 		slog.Debug("checking status",
 			"encore_name", db.Name,
@@ -377,20 +1242,36 @@ func showStatus(ctx context.Context, cmd *cli.Command) error {
 
 		connStr, err := migration.BuildConnectionString(mapping)
 		if err != nil {
-			fmt.Printf("%-20s %-30s %-10s %-10s\n", db.Name, mapping.PGDBName, "error", err.Error())
+			emit(databaseStatus{Name: db.Name, PGDatabase: mapping.PGDBName, Error: err.Error()})
 			continue
 		}
 
-		status, err := migrator.GetStatus(connStr, db.MigrationsPath)
+		session, err := sessionOptions(cmd, project, db.Name)
 		if err != nil {
-			slog.Debug("failed to get status", "database", db.Name, "error", err)
-			fmt.Printf("%-20s %-30s %-10s %-10s\n", db.Name, mapping.PGDBName, "error", err.Error())
+			return err
+		}
+
+		if extended || exitCode {
+			inspection, err := migrator.WithSession(session).Inspect(connStr, db.MigrationsPath)
+			if err != nil {
+				slog.Debug("failed to get status", "database", db.Name, "error", err)
+				emit(databaseStatus{Name: db.Name, PGDatabase: mapping.PGDBName, Error: err.Error()})
+				continue
+			}
+			pending = pending || len(inspection.Pending) > 0
+			entry := databaseStatus{Name: db.Name, PGDatabase: mapping.PGDBName, Version: inspection.Version, Dirty: inspection.Dirty}
+			if extended {
+				entry.PendingFiles = inspection.PendingNames()
+			}
+			emit(entry)
 			continue
 		}
 
-		dirtyStr := "no"
-		if status.Dirty {
-			dirtyStr = "YES"
+		status, err := migrator.WithSession(session).GetStatus(connStr, db.MigrationsPath)
+		if err != nil {
+			slog.Debug("failed to get status", "database", db.Name, "error", err)
+			emit(databaseStatus{Name: db.Name, PGDatabase: mapping.PGDBName, Error: err.Error()})
+			continue
 		}
 
 		slog.Debug("database status",
@@ -399,86 +1280,84 @@ func showStatus(ctx context.Context, cmd *cli.Command) error {
 			"dirty", status.Dirty,
 		)
 
-		fmt.Printf("%-20s %-30s %-10d %-10s\n", db.Name, mapping.PGDBName, status.Version, dirtyStr)
+		emit(databaseStatus{Name: db.Name, PGDatabase: mapping.PGDBName, Version: status.Version, Dirty: status.Dirty})
 	}
 
+	if err := outputRenderer(cmd).status(os.Stdout, report); err != nil || !exitCode {
+		return err
+	}
+	for _, entry := range report.Databases {
+		if entry.Error != "" || entry.Dirty {
+			return cli.Exit("", statusExitUnhealthy)
+		}
+	}
+	if pending {
+		return cli.Exit("", statusExitPending)
+	}
 	return nil
 }
 
 func listDatabases(ctx context.Context, cmd *cli.Command) error {
-	appPath := cmd.String("app")
-	if appPath == "" {
-		appPath = "."
-	}
-
-	absPath, err := filepath.Abs(appPath)
+	databases, err := discoverDatabases(cmd)
 	if err != nil {
-		return fmt.Errorf("resolving app path: %w", err)
+		return err
 	}
-
-	slog.Debug("discovering databases", "app_path", absPath)
-
-	discoverer := discovery.New(discovery.Options{
-		ManifestPath: cmd.String("manifest"),
-		Verbose:      cmd.Bool("verbose"),
-	})
-
-	databases, err := discoverer.Discover(absPath)
+	root, err := appRoot(cmd)
 	if err != nil {
-		return fmt.Errorf("discovering databases: %w", err)
+		return err
 	}
 
-	slog.Debug("discovery complete", "database_count", len(databases))
-
-	if len(databases) == 0 {
-		fmt.Println("No databases found.")
+	list := newDatabaseList(root, databases)
+	if cmd.Root().String("output") == "tfvars" {
+		printDatabaseListTFVars(list)
 		return nil
 	}
-
-	fmt.Printf("%-20s %-50s\n", "DATABASE", "MIGRATIONS PATH")
-	fmt.Println(strings.Repeat("-", 70))
-
-	for _, db := range databases {
-		fmt.Printf("%-20s %-50s\n", db.Name, db.MigrationsPath)
-	}
-
-	return nil
+	return outputRenderer(cmd).report(os.Stdout, list)
 }
 
 func forceVersion(ctx context.Context, cmd *cli.Command) error {
-	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	db, mapping, err := resolveDatabase(cmd, cmd.String("database"))
 	if err != nil {
 		return err
 	}
 
-	targetDB := cmd.String("database")
-	databases = discovery.FilterDatabases(databases, targetDB)
-	if len(databases) == 0 {
-		return fmt.Errorf("database %q not found", targetDB)
-	}
-
-	db := databases[0]
-	mapping, err := infraConfig.GetMapping(db.Name)
+	connStr, err := migration.BuildConnectionString(mapping)
 	if err != nil {
-		return fmt.Errorf("getting config for %q: %w", db.Name, err)
+		return fmt.Errorf("building connection string: %w", err)
 	}
 
-	// Apply host override if provided
-	applyConnectionOverrides(cmd, mapping)
+	version := int(cmd.Int("version"))
+	if err := confirmDestructive(cmd, fmt.Sprintf("force %q to version %d without running any migration", db.Name, version), []string{db.Name}); err != nil {
+		return err
+	}
 
-	connStr, err := migration.BuildConnectionString(mapping)
+	store, err := stateStore(cmd)
 	if err != nil {
-		return fmt.Errorf("building connection string: %w", err)
+		return err
 	}
 
-	version := int(cmd.Int("version"))
+	release, err := acquireRunLock(cmd, store, "force")
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	slog.Warn("forcing migration version",
 		"database", db.Name,
 		"version", version,
 	)
 
-	migrator := migration.NewMigrator(cmd.Bool("verbose"))
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	session, err := sessionOptions(cmd, project, db.Name)
+	if err != nil {
+		return err
+	}
+
+	migrator := newMigrator(cmd).WithSession(session)
 
 	if err := migrator.Force(connStr, db.MigrationsPath, version); err != nil {
 		return fmt.Errorf("forcing version: %w", err)
@@ -489,6 +1368,33 @@ func forceVersion(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// resolveDatabase discovers a single database by name and resolves its
+// connection mapping with CLI overrides applied
+func resolveDatabase(cmd *cli.Command, name string) (types.EncoreDatabase, *types.DatabaseMapping, error) {
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return types.EncoreDatabase{}, nil, err
+	}
+
+	databases = discovery.FilterDatabases(databases, name)
+	if len(databases) == 0 {
+		return types.EncoreDatabase{}, nil, fmt.Errorf("database %q not found", name)
+	}
+
+	db := databases[0]
+	mapping, err := infraConfig.GetMapping(db.Name)
+	if err != nil {
+		return types.EncoreDatabase{}, nil, fmt.Errorf("getting config for %q: %w", db.Name, err)
+	}
+
+	// Apply host override if provided
+	if err := applyConnectionOverrides(cmd, mapping); err != nil {
+		return types.EncoreDatabase{}, nil, err
+	}
+
+	return db, mapping, nil
+}
+
 func loadConfigAndDiscover(cmd *cli.Command) (*config.InfraConfig, []types.EncoreDatabase, error) {
 	// Load InfraConfig
 	configPath := cmd.String("config")
@@ -501,37 +1407,95 @@ func loadConfigAndDiscover(cmd *cli.Command) (*config.InfraConfig, []types.Encor
 
 	slog.Debug("infra config loaded", "sql_servers", len(infraConfig.SQLServers))
 
-	// Get app path
-	appPath := cmd.String("app")
-	if appPath == "" {
-		appPath = "."
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	absPath, err := filepath.Abs(appPath)
+	return infraConfig, databases, nil
+}
+
+// discoveryOptions combines the discovery flags with the project config's
+// discovery section; --skip-dir and --include-dir add to its lists
+func discoveryOptions(cmd *cli.Command) (discovery.Options, error) {
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return discovery.Options{}, err
+	}
+	mode := project.Discovery.Mode
+	if cmd.IsSet("discovery") {
+		mode = cmd.String("discovery")
+	}
+	if err := discovery.ValidMode(mode); err != nil {
+		return discovery.Options{}, err
+	}
+	var cacheDir string
+	if !cmd.Bool("no-cache") {
+		store, err := stateStore(cmd)
+		if err != nil {
+			return discovery.Options{}, err
+		}
+		cacheDir = filepath.Join(store.Dir(), "cache")
+	}
+	return discovery.Options{
+		ManifestPath: cmd.String("manifest"),
+		Mode:         mode,
+		Verbose:      cmd.Bool("verbose"),
+		MaxFileSize:  cmd.Int64("max-file-size"),
+		SkipDirs:     append(slices.Clone(project.Discovery.SkipDirs), cmd.StringSlice("skip-dir")...),
+		IncludeDirs:  append(slices.Clone(project.Discovery.IncludeDirs), cmd.StringSlice("include-dir")...),
+		CacheDir:     cacheDir,
+	}, nil
+}
+
+// discoverDatabases finds the app's databases from the manifest or by AST scan, deduplicated
+func discoverDatabases(cmd *cli.Command) ([]types.EncoreDatabase, error) {
+	absPath, err := appRoot(cmd)
 	if err != nil {
-		return nil, nil, fmt.Errorf("resolving app path: %w", err)
+		return nil, err
 	}
 
-	// Discover databases
-	manifestPath := cmd.String("manifest")
+	opts, err := discoveryOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
 	slog.Debug("discovering databases",
 		"app_path", absPath,
-		"manifest_path", manifestPath,
+		"manifest_path", opts.ManifestPath,
 	)
 
-	discoverer := discovery.New(discovery.Options{
-		ManifestPath: manifestPath,
-		Verbose:      cmd.Bool("verbose"),
-	})
+	discoverer := discovery.New(opts)
 
 	databases, err := discoverer.Discover(absPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("discovering databases: %w", err)
+		return nil, fmt.Errorf("discovering databases: %w", err)
+	}
+	// e.g. a NewDatabase call whose name isn't a constant of its package
+	var skipped []error
+	switch scanner := discoverer.(type) {
+	case *discovery.ASTDiscoverer:
+		skipped = scanner.Errors
+	case *discovery.TypedDiscoverer:
+		skipped = scanner.Errors
+	}
+	for _, err := range skipped {
+		warn(os.Stderr, warnDiscoverySkipped, "skipped during discovery: %v", err)
 	}
 
 	// Deduplicate
 	databases = discovery.DeduplicateDatabases(databases)
 
+	// Databases of removed services are retired in the manifest, or here
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	for i := range databases {
+		if project.Database(databases[i].Name).Retired != nil {
+			databases[i].Retired = true
+		}
+	}
+
 	slog.Debug("databases discovered", "count", len(databases))
 	for _, db := range databases {
 		slog.Debug("found database",
@@ -541,13 +1505,530 @@ func loadConfigAndDiscover(cmd *cli.Command) (*config.InfraConfig, []types.Encor
 		)
 	}
 
-	return infraConfig, databases, nil
+	return databases, nil
+}
+
+// serverAddress describes where a mapping connects: host:port, or the Cloud SQL instance
+func serverAddress(m *types.DatabaseMapping) string {
+	if m.CloudSQLInstance != "" && m.Host == "" {
+		return "Cloud SQL " + m.CloudSQLInstance
+	}
+	return m.Host + ":" + m.Port
 }
 
-// applyConnectionOverrides applies CLI flag overrides for host, user, and password
-func applyConnectionOverrides(cmd *cli.Command, mapping *types.DatabaseMapping) {
+// appRoot returns the absolute Encore app root
+func appRoot(cmd *cli.Command) (string, error) {
+	appPath := cmd.String("app")
+	if appPath == "" {
+		appPath = "."
+	}
+
+	absPath, err := filepath.Abs(appPath)
+	if err != nil {
+		return "", fmt.Errorf("resolving app path: %w", err)
+	}
+	return absPath, nil
+}
+
+// appSource is the --app archive or OCI reference the app was unpacked from,
+// and appSourceDir the temporary directory holding it; both empty otherwise
+var appSource, appSourceDir string
+
+// bundleManifests are the manifest names looked for at the root of an OCI
+// migration bundle, such as the output of generate-manifest --copy-to
+var bundleManifests = []string{"manifest.yaml", "manifest.yml", "manifest.json"}
+
+// fetchAppSource unpacks an --app archive or pulls an oci:// artifact and
+// points --app at the unpacked root, so every command sees a plain directory.
+// With --app-image, the bundle's digest must match the image's label.
+func fetchAppSource(ctx context.Context, cmd *cli.Command) error {
+	path := cmd.String("app")
+	var root, digest string
+	var err error
+	switch {
+	case appsource.IsOCI(path):
+		root, appSourceDir, digest, err = appsource.Pull(ctx, path)
+		if err != nil {
+			return err
+		}
+		slog.Info("pulled migration bundle", "reference", path, "digest", digest)
+
+		if !cmd.IsSet("manifest") {
+			for _, name := range bundleManifests {
+				if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+					if err := cmd.Set("manifest", filepath.Join(root, name)); err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+	case appsource.IsArchive(path) && !isDir(path):
+		if digest, err = appsource.ArchiveDigest(path); err != nil {
+			return fmt.Errorf("opening app archive: %w", err)
+		}
+		if root, appSourceDir, err = appsource.Extract(path); err != nil {
+			return err
+		}
+	default:
+		if cmd.String("app-image") != "" {
+			return fmt.Errorf("--app-image needs --app to be an archive or oci:// bundle whose digest it can check")
+		}
+		return nil
+	}
+
+	appSource = path
+	slog.Debug("unpacked app source", "source", path, "root", root, "digest", digest)
+	if err := verifyAppImage(ctx, cmd, digest); err != nil {
+		return err
+	}
+	return cmd.Set("app", root)
+}
+
+// verifyAppImage checks that the --app-image being deployed was built with
+// the bundle of this digest, as recorded in its --app-image-label
+func verifyAppImage(ctx context.Context, cmd *cli.Command, digest string) error {
+	image := cmd.String("app-image")
+	if image == "" {
+		return nil
+	}
+	label := cmd.String("app-image-label")
+	labels, err := appsource.ImageLabels(ctx, image)
+	if err != nil {
+		return err
+	}
+	value, ok := labels[label]
+	if !ok {
+		return fmt.Errorf("app image %s has no %s label; label it with the bundle digest %s at build time", image, label, digest)
+	}
+	if !appsource.LabelMatches(value, digest) {
+		return fmt.Errorf("bundle %s (%s) was not built with app image %s, whose %s label is %s", appSource, digest, image, label, value)
+	}
+	slog.Info("bundle matches app image", "image", image, "digest", digest)
+	return nil
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// removeAppSource deletes the unpacked copy of an --app archive or artifact
+func removeAppSource() {
+	if appSourceDir != "" {
+		os.RemoveAll(appSourceDir)
+	}
+}
+
+// requireAppDirectory rejects writing into an unpacked --app archive or
+// artifact, whose copy is deleted when the command ends
+func requireAppDirectory(action string) error {
+	if appSource != "" {
+		return fmt.Errorf("cannot %s: --app %s is not a directory; run against a checkout", action, appSource)
+	}
+	return nil
+}
+
+// loadEnvFile loads --env-file, or the app root's .env if there is one.
+// Global flags read from the environment (--config, --state-dir, --schema)
+// were parsed before it runs and must be exported instead.
+func loadEnvFile(cmd *cli.Command) error {
+	path := cmd.String("env-file")
+	if path == "" {
+		root, err := appRoot(cmd)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(root, config.DefaultEnvFile)
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	set, err := config.LoadEnvFile(path)
+	if err != nil {
+		return err
+	}
+	slog.Debug("loaded env file", "path", path, "variables", set)
+	return nil
+}
+
+// requiredExtensions merges the extensions declared by migration directives,
+// the project config and the database's dialect
+func requiredExtensions(db types.EncoreDatabase, project *config.ProjectConfig) ([]string, error) {
+	required, err := migration.RequiredExtensions(db.MigrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading extension directives: %w", err)
+	}
+	settings := project.Database(db.Name)
+	extensions := settings.Extensions
+	if dialect, err := migration.ParseDialect(settings.Dialect); err == nil && dialect.Extension() != "" {
+		extensions = append([]string{dialect.Extension()}, extensions...)
+	}
+	for _, ext := range extensions {
+		if !slices.Contains(required, ext) {
+			required = append(required, ext)
+		}
+	}
+	return required, nil
+}
+
+// ensureExtensions verifies that the extensions required by the project config and
+// migration directives are installed, creating them when --create-extensions is set
+func ensureExtensions(cmd *cli.Command, out io.Writer, migrator *migration.Migrator, db types.EncoreDatabase, mapping *types.DatabaseMapping, project *config.ProjectConfig) error {
+	required, err := requiredExtensions(db, project)
+	if err != nil {
+		return err
+	}
+	if len(required) == 0 {
+		return nil
+	}
+
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return err
+	}
+
+	missing, err := migrator.MissingExtensions(connStr, required)
+	if err != nil {
+		return fmt.Errorf("checking extensions: %w", err)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if !cmd.Bool("create-extensions") {
+		return fmt.Errorf("required extensions are not installed: %s (install them or rerun with --create-extensions)",
+			strings.Join(missing, ", "))
+	}
+
+	adminConnStr, err := migration.BuildConnectionString(adminMapping(cmd, mapping))
+	if err != nil {
+		return fmt.Errorf("building admin connection string: %w", err)
+	}
+
+	fmt.Fprintf(out, "  Creating extensions: %s\n", strings.Join(missing, ", "))
+	return migrator.CreateExtensions(adminConnStr, missing)
+}
+
+// sessionOptions builds the connection session options for a database from
+// the project config and the --schema flag
+func sessionOptions(cmd *cli.Command, project *config.ProjectConfig, name string) (migration.SessionOptions, error) {
+	settings := project.Database(name)
+
+	dialect, err := migration.ParseDialect(settings.Dialect)
+	if err != nil {
+		return migration.SessionOptions{}, err
+	}
+
+	statement, lock, err := sessionTimeouts(cmd, project, name)
+	if err != nil {
+		return migration.SessionOptions{}, err
+	}
+
+	return migration.SessionOptions{
+		Dialect:          dialect,
+		Role:             settings.RunAsRole,
+		Schema:           cmd.String("schema"),
+		StatementTimeout: statement,
+		LockTimeout:      lock,
+	}, nil
+}
+
+// sessionTimeouts resolves a database's statement and lock timeouts. Lowest
+// to highest precedence: the project config's timeouts, --statement-timeout
+// and --lock-timeout, the database's own timeouts.
+func sessionTimeouts(cmd *cli.Command, project *config.ProjectConfig, name string) (statement, lock time.Duration, err error) {
+	var global config.Timeouts
+	if project != nil {
+		global = project.Timeouts
+	}
+	override := project.Database(name).Timeouts
+	if override == nil {
+		override = &config.Timeouts{}
+	}
+
+	resolve := func(flag, setting, configured, databaseValue string) (time.Duration, error) {
+		value, source := configured, "timeouts."+setting
+		if cmd.IsSet(flag) {
+			value, source = cmd.Duration(flag).String(), "--"+flag
+		}
+		if databaseValue != "" {
+			value, source = databaseValue, "databases."+name+".timeouts."+setting
+		}
+		if value == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", source, value, err)
+		}
+		if d < 0 || (d > 0 && d < time.Millisecond) {
+			return 0, fmt.Errorf("invalid %s %q: must be 0 or at least 1ms", source, value)
+		}
+		return d, nil
+	}
+
+	if statement, err = resolve("statement-timeout", "statement", global.Statement, override.Statement); err != nil {
+		return 0, 0, err
+	}
+	if lock, err = resolve("lock-timeout", "lock", global.Lock, override.Lock); err != nil {
+		return 0, 0, err
+	}
+	return statement, lock, nil
+}
+
+// phaseOptions builds the expand/contract options for a database
+func phaseOptions(cmd *cli.Command, project *config.ProjectConfig, name string, phase migration.Phase) migration.PhaseOptions {
+	opts := migration.PhaseOptions{
+		Phase:             phase,
+		RequireAppVersion: cmd.String("require-app-version"),
+	}
+	if gate := project.Database(name).AppVersionGate; gate != nil {
+		opts.Gate = &migration.AppVersionGate{URL: gate.URL, Query: gate.Query}
+	}
+	return opts
+}
+
+// adminMapping returns a copy of mapping using --admin-user/--admin-password when set
+func adminMapping(cmd *cli.Command, mapping *types.DatabaseMapping) *types.DatabaseMapping {
+	admin := *mapping
+	if user := cmd.String("admin-user"); user != "" {
+		admin.Username = user
+		admin.Password = cmd.String("admin-password")
+	}
+	return &admin
+}
+
+// waitForReplicas blocks until every replica has replayed the migrations up
+// to version from the primary at primaryConnStr, or --replica-timeout passes.
+// Replicas are host[:port] entries reusing the primary's credentials, or full DSNs.
+func waitForReplicas(ctx context.Context, cmd *cli.Command, out io.Writer, migrator *migration.Migrator, mapping *types.DatabaseMapping, primaryConnStr string, replicas []string, version uint) error {
+	if len(replicas) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cmd.Duration("replica-timeout"))
+	defer cancel()
+
+	for _, replica := range replicas {
+		connStr := replica
+		if !strings.Contains(replica, "://") {
+			replicaMapping := *mapping
+			replicaMapping.Host = replica
+			if idx := strings.LastIndex(replica, ":"); idx != -1 {
+				replicaMapping.Host = replica[:idx]
+				replicaMapping.Port = replica[idx+1:]
+			}
+
+			var err error
+			connStr, err = migration.BuildConnectionString(&replicaMapping)
+			if err != nil {
+				return fmt.Errorf("building connection string for replica %s: %w", replica, err)
+			}
+		}
+
+		fmt.Fprintf(out, "  Waiting for replica %s to replay version %d...\n", redactDSN(replica), version)
+		if err := migrator.WaitForReplica(ctx, primaryConnStr, connStr, version, 2*time.Second); err != nil {
+			return fmt.Errorf("replica %s: %w", redactDSN(replica), err)
+		}
+	}
+
+	return nil
+}
+
+// redactDSN hides the password in a connection URL; non-URLs are returned as-is
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	return u.Redacted()
+}
+
+// runTargets are the databases an up or down run covers, in run order, with
+// the configuration needed to migrate them
+type runTargets struct {
+	infraConfig  *config.InfraConfig
+	project      *config.ProjectConfig
+	databases    []types.EncoreDatabase
+	dependencies map[string][]string
+	requirements map[string][]migration.Requirement
+	priorities   map[string]int
+}
+
+// selectTargets discovers the databases, applies --database and orders them
+// by priority and dependencies for direction
+func selectTargets(cmd *cli.Command, direction string) (*runTargets, error) {
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter to specific database if requested
+	targetDB := cmd.String("database")
+	if targetDB != "" {
+		slog.Debug("filtering to specific database", "database", targetDB)
+		databases = discovery.FilterDatabases(databases, targetDB)
+		if len(databases) == 0 {
+			return nil, fmt.Errorf("database %q not found", targetDB)
+		}
+	}
+	if databases, err = activeDatabases(cmd, databases); err != nil {
+		return nil, err
+	}
+
+	if len(databases) == 0 {
+		return nil, fmt.Errorf("no databases found")
+	}
+	recordDatabaseCount(cmd, len(databases))
+
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Migrations may declare "-- requires: <db>>=<version>" on other databases,
+	// and the project config may list depends_on
+	dependencies, requirements, err := readDependencies(cmd, project, databases)
+	if err != nil {
+		return nil, err
+	}
+	priorities := effectivePriorities(project, databases, dependencies)
+	sortByPriority(databases, priorities)
+	databases, err = orderByDependencies(databases, dependencies, direction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runTargets{
+		infraConfig:  infraConfig,
+		project:      project,
+		databases:    databases,
+		dependencies: dependencies,
+		requirements: requirements,
+		priorities:   priorities,
+	}, nil
+}
+
+// activeDatabases drops retired databases unless --include-retired is set.
+// Naming a retired database with --database is an error rather than a no-op.
+func activeDatabases(cmd *cli.Command, databases []types.EncoreDatabase) ([]types.EncoreDatabase, error) {
+	if cmd.Bool("include-retired") {
+		return databases, nil
+	}
+	var active []types.EncoreDatabase
+	for _, db := range databases {
+		if !db.Retired {
+			active = append(active, db)
+			continue
+		}
+		if cmd.String("database") == db.Name {
+			return nil, fmt.Errorf("database %q is retired; pass --include-retired to use it", db.Name)
+		}
+		slog.Debug("skipping retired database", "database", db.Name)
+	}
+	return active, nil
+}
+
+// newMigrator creates a Migrator honoring --verbose, --retries and --retry-backoff
+func newMigrator(cmd *cli.Command) *migration.Migrator {
+	migrator := migration.NewMigrator(cmd.Bool("verbose"))
+	migrator.Retries = int(cmd.Int("retries"))
+	migrator.RetryBackoff = cmd.Duration("retry-backoff")
+	return migrator
+}
+
+// loadProjectConfig loads the project config from --project-config or the app
+// root. A missing default file yields an empty config.
+func loadProjectConfig(cmd *cli.Command) (*config.ProjectConfig, error) {
+	path := cmd.String("project-config")
+	if path == "" {
+		appPath := cmd.String("app")
+		if appPath == "" {
+			appPath = "."
+		}
+		path = config.FindProjectConfig(appPath)
+	}
+
+	if path == "" {
+		return &config.ProjectConfig{}, nil
+	}
+
+	slog.Debug("loading project config", "path", path)
+	project, err := config.LoadProjectConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading project config: %w", err)
+	}
+	if err := suppressWarnings(project.Warnings.Suppress...); err != nil {
+		return nil, fmt.Errorf("project config warnings.suppress: %w", err)
+	}
+	if err := escalateWarnings(false, project.Warnings.Errors...); err != nil {
+		return nil, fmt.Errorf("project config warnings.errors: %w", err)
+	}
+	return project, nil
+}
+
+// stateStore returns the local state store, defaulting to <app>/.encore-migrate
+func stateStore(cmd *cli.Command) (*state.Store, error) {
+	if dir := cmd.String("state-dir"); dir != "" {
+		return state.NewStore(dir), nil
+	}
+
+	appPath := cmd.String("app")
+	if appPath == "" {
+		appPath = "."
+	}
+	switch {
+	case appsource.IsOCI(appSource):
+		// The unpacked copy is temporary; keep state in the working directory
+		appPath = "."
+	case appSource != "":
+		// ... or next to the archive
+		appPath = filepath.Dir(appSource)
+	}
+
+	absPath, err := filepath.Abs(appPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolving app path: %w", err)
+	}
+
+	return state.NewStore(state.DefaultDir(absPath)), nil
+}
+
+// acquireRunLock takes the local run lock unless --no-lock is set.
+// The returned release function is always safe to call.
+func acquireRunLock(cmd *cli.Command, store *state.Store, command string) (func(), error) {
+	if cmd.Bool("no-lock") {
+		slog.Debug("run lock disabled")
+		return func() {}, nil
+	}
+
+	lock, err := store.AcquireLock(command)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("run lock acquired", "dir", store.Dir())
+
+	return func() {
+		if err := lock.Release(); err != nil {
+			slog.Warn("failed to release run lock", "error", err)
+		}
+	}, nil
+}
+
+// applyConnectionOverrides applies host, user, and password overrides from
+// profiles, environment variables, and flags (in increasing precedence)
+func applyConnectionOverrides(cmd *cli.Command, mapping *types.DatabaseMapping) error {
+	overrides, err := resolveOverrides(cmd)
+	if err != nil {
+		return err
+	}
+
 	// Host override
-	if hostOverride := cmd.String("host"); hostOverride != "" {
+	if overrides.Host.Set() {
+		hostOverride := overrides.Host.Value
 		originalHost := mapping.Host
 		originalPort := mapping.Port
 
@@ -559,26 +2040,77 @@ func applyConnectionOverrides(cmd *cli.Command, mapping *types.DatabaseMapping)
 			mapping.Host = hostOverride
 		}
 
-		slog.Info("host override applied",
+		if mapping.CloudSQLInstance != "" {
+			slog.Info("host override replaces the Cloud SQL connector", "cloudsql_instance", mapping.CloudSQLInstance)
+			mapping.CloudSQLInstance = ""
+			if mapping.Port == "" {
+				mapping.Port = "5432"
+			}
+		}
+
+		warn(os.Stderr, warnOverride, "host overridden with %s [%s]", hostOverride, overrides.Host.Source)
+		slog.Debug("host override applied",
 			"original_host", originalHost,
 			"original_port", originalPort,
 			"new_host", mapping.Host,
 			"new_port", mapping.Port,
+			"source", overrides.Host.Source,
 		)
 	}
 
 	// Username override
-	if userOverride := cmd.String("user"); userOverride != "" {
-		slog.Info("user override applied",
+	if overrides.User.Set() {
+		warn(os.Stderr, warnOverride, "user overridden with %s [%s]", overrides.User.Value, overrides.User.Source)
+		slog.Debug("user override applied",
 			"original_user", mapping.Username,
-			"new_user", userOverride,
+			"new_user", overrides.User.Value,
+			"source", overrides.User.Source,
 		)
-		mapping.Username = userOverride
+		mapping.Username = overrides.User.Value
 	}
 
 	// Password override
-	if passOverride := cmd.String("password"); passOverride != "" {
-		slog.Info("password override applied")
-		mapping.Password = passOverride
+	if overrides.Password.Set() {
+		warn(os.Stderr, warnOverride, "password overridden [%s]", overrides.Password.Source)
+		mapping.Password = overrides.Password.Value
+	}
+
+	// SSH tunnel; it is started when the first connection is made
+	if overrides.SSH.Set() {
+		if _, err := sshtunnel.ParseBastion(overrides.SSH.Value); err != nil {
+			return fmt.Errorf("%w [%s]", err, overrides.SSH.Source)
+		}
+		if mapping.CloudSQLInstance != "" && mapping.Host == "" {
+			warn(os.Stderr, warnSSHCloudSQL, "SSH tunnel not used for %s: Cloud SQL connector connections are direct", mapping.EncoreName)
+		} else {
+			mapping.SSHBastion = overrides.SSH.Value
+			mapping.SSHIdentityFile = overrides.SSHKey.Value
+			mapping.SSHNoAgent = cmd.Bool("ssh-no-agent")
+			mapping.SSHOptions = cmd.StringSlice("ssh-option")
+			slog.Debug("SSH tunnel applied",
+				"host", mapping.Host,
+				"port", mapping.Port,
+				"bastion", mapping.SSHBastion,
+				"source", overrides.SSH.Source,
+			)
+		}
+	}
+
+	if mapping.CloudSQLInstance != "" {
+		if err := offline.Check("Cloud SQL connector for " + mapping.CloudSQLInstance); err != nil {
+			return fmt.Errorf("database %s: %w (pass --host to connect directly)", mapping.EncoreName, err)
+		}
+	}
+
+	// Database name suffix, e.g. for preview environments sharing a server
+	if overrides.DatabaseSuffix.Set() {
+		slog.Debug("database suffix applied",
+			"database", mapping.PGDBName,
+			"suffix", overrides.DatabaseSuffix.Value,
+			"source", overrides.DatabaseSuffix.Source,
+		)
+		mapping.PGDBName += overrides.DatabaseSuffix.Value
 	}
+
+	return enforceTLSPolicy(cmd, mapping)
 }
@@ -0,0 +1,63 @@
+package migrate
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// Policies for down runs that would pass a version without a down file (--missing-down)
+const (
+	missingDownFail = "fail"
+	missingDownSkip = "skip"
+)
+
+// checkMissingDown plans each database's rollback before anything runs and
+// applies the --missing-down policy to databases that would pass a version
+// without a down file: fail fast naming them all, or leave them out of the
+// run with a warning. Databases that can't be planned are kept, so the run
+// reports their errors as usual.
+func checkMissingDown(cmd *cli.Command, targets *runTargets) ([]types.EncoreDatabase, error) {
+	policy := cmd.String("missing-down")
+	if policy != missingDownFail && policy != missingDownSkip {
+		return nil, fmt.Errorf("invalid --missing-down %q (want %s or %s)", policy, missingDownFail, missingDownSkip)
+	}
+
+	migrator := newMigrator(cmd)
+	var keep []types.EncoreDatabase
+	var missing []string
+	for _, db := range targets.databases {
+		plan, _, err := planDatabase(cmd, targets.infraConfig, targets.project, migrator, db, "down", "")
+		if err != nil {
+			slog.Debug("could not plan rollback", "database", db.Name, "error", err)
+			keep = append(keep, db)
+			continue
+		}
+
+		var versions []string
+		for _, step := range plan.Steps {
+			if step.File == nil {
+				versions = append(versions, fmt.Sprint(step.Version))
+			}
+		}
+		if len(versions) == 0 {
+			keep = append(keep, db)
+			continue
+		}
+
+		missing = append(missing, fmt.Sprintf("%s (versions %s)", db.Name, strings.Join(versions, ", ")))
+		if policy == missingDownSkip {
+			warn(os.Stderr, warnNoDownFiles, "skipping %q: no down file for versions %s", db.Name, strings.Join(versions, ", "))
+		}
+	}
+
+	if len(missing) > 0 && policy == missingDownFail {
+		return nil, fmt.Errorf("down would pass versions without a down file (use --missing-down skip to leave these databases out):\n  %s", strings.Join(missing, "\n  "))
+	}
+	return keep, nil
+}
@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// checkOffline refuses an up/down run under --offline before any database
+// is touched when the run would later need the network: reporting to the
+// ticket webhook, quiescing writers, pausing cron jobs and subscriptions,
+// switching feature flags, paging on failure or asking a version endpoint.
+func checkOffline(cmd *cli.Command, infraConfig *config.InfraConfig, project *config.ProjectConfig, databases []types.EncoreDatabase, direction string, phase migration.Phase) error {
+	if !offline.Enabled() {
+		return nil
+	}
+	if cmd.String("ticket") != "" && project.Tickets.Webhook != "" {
+		return fmt.Errorf("%w (drop --ticket or tickets.webhook)", offline.Check("reporting to the ticket webhook"))
+	}
+	if project.Pauses.Endpoint != "" {
+		return fmt.Errorf("%w (remove pauses.endpoint from the project config)", offline.Check("pausing cron jobs and subscriptions"))
+	}
+	if project.FeatureFlags.Provider != "" {
+		return fmt.Errorf("%w (remove feature_flags from the project config)", offline.Check("switching feature flags"))
+	}
+	for _, db := range databases {
+		if project.Database(db.Name).Quiesce != nil {
+			return fmt.Errorf("database %s: %w (remove its quiesce settings)", db.Name, offline.Check("quiescing its writers"))
+		}
+	}
+	if direction == "up" && infraConfig.IsProduction() && len(alertNotifiers(project)) > 0 {
+		return fmt.Errorf("%w (remove alerts from the project config)", offline.Check("paging through alerts on failure"))
+	}
+	if phase == migration.PhaseContract && cmd.String("require-app-version") != "" {
+		for _, db := range databases {
+			if gate := project.Database(db.Name).AppVersionGate; gate != nil && gate.URL != "" {
+				return fmt.Errorf("database %s: %w (use an app_version_gate query instead)", db.Name, offline.Check("app version gate "+gate.URL))
+			}
+		}
+	}
+	return nil
+}
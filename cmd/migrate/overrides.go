@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+)
+
+// envConfig sets the InfraConfig path, e.g. to a secret mounted into a container
+const envConfig = "ENCORE_MIGRATE_CONFIG"
+
+// envStateDir relocates local run state, e.g. to a persistent volume
+const envStateDir = "ENCORE_MIGRATE_STATE_DIR"
+
+// envSchema selects the blue/green schema migrations run in
+const envSchema = "ENCORE_MIGRATE_SCHEMA"
+
+// envAppImage names the application image being deployed, e.g. from the deploy pipeline
+const envAppImage = "ENCORE_MIGRATE_APP_IMAGE"
+
+// envOffline forbids network access other than to databases, e.g. set for a whole air-gapped runner
+const envOffline = "ENCORE_MIGRATE_OFFLINE"
+
+// envTLSMinVersion sets the minimum TLS version of database connections, e.g. for a whole compliance-scoped runner
+const envTLSMinVersion = "ENCORE_MIGRATE_TLS_MIN_VERSION"
+
+// envAllowExec lists the credential commands $exec values may run, comma-separated
+const envAllowExec = "ENCORE_MIGRATE_ALLOW_EXEC"
+
+// envSuppress lists warning codes not to print, comma-separated
+const envSuppress = "ENCORE_MIGRATE_SUPPRESS"
+
+// envWarningsAsErrors, when true, fails commands that print any warning
+const envWarningsAsErrors = "ENCORE_MIGRATE_WARNINGS_AS_ERRORS"
+
+// envWarningAsError lists warning codes that fail commands, comma-separated
+const envWarningAsError = "ENCORE_MIGRATE_WARNING_AS_ERROR"
+
+// envSecretCacheTTL bounds how long resolved secrets are reused, e.g. 10m
+const envSecretCacheTTL = "ENCORE_MIGRATE_SECRET_CACHE_TTL"
+
+// envStatementTimeout and envLockTimeout bound migration sessions, e.g. 30s
+const (
+	envStatementTimeout = "ENCORE_MIGRATE_STATEMENT_TIMEOUT"
+	envLockTimeout      = "ENCORE_MIGRATE_LOCK_TIMEOUT"
+)
+
+// envTicket sets the change ticket of up/down runs, e.g. from a CI variable
+const envTicket = "ENCORE_MIGRATE_TICKET"
+
+// Environment variables for connection overrides. Precedence, lowest to highest:
+// config file < profile < environment < flags.
+const (
+	envProfile  = "ENCORE_MIGRATE_PROFILE"
+	envHost     = "ENCORE_MIGRATE_HOST"
+	envUser     = "ENCORE_MIGRATE_USER"
+	envPassword = "ENCORE_MIGRATE_PASSWORD"
+	envSSH      = "ENCORE_MIGRATE_SSH"
+	envSSHKey   = "ENCORE_MIGRATE_SSH_KEY"
+
+	envDatabaseSuffix = "ENCORE_MIGRATE_DATABASE_SUFFIX"
+)
+
+// precedenceDoc documents how override layers combine
+const precedenceDoc = "config file < profile < environment variables < flags"
+
+// setting is an override value and the layer it came from
+type setting struct {
+	Value  string
+	Source string // e.g. "flag --host", "env ENCORE_MIGRATE_HOST", "profile staging"; empty if unset
+}
+
+// Set reports whether any override layer provided a value
+func (s setting) Set() bool {
+	return s.Source != ""
+}
+
+// connectionOverrides are the merged connection overrides
+type connectionOverrides struct {
+	Profile        setting
+	Host           setting
+	User           setting
+	Password       setting
+	SSH            setting // user@bastion[:port]
+	SSHKey         setting
+	DatabaseSuffix setting
+}
+
+// resolveOverrides merges profile, environment and flag overrides for the connection settings
+func resolveOverrides(cmd *cli.Command) (*connectionOverrides, error) {
+	var o connectionOverrides
+
+	o.Profile = layered(cmd, "profile", envProfile, "")
+	var profile config.Profile
+	if o.Profile.Set() {
+		project, err := loadProjectConfig(cmd)
+		if err != nil {
+			return nil, err
+		}
+		profile, err = project.Profile(o.Profile.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	profileSource := "profile " + o.Profile.Value
+	o.Host = layered(cmd, "host", envHost, profile.Host)
+	o.User = layered(cmd, "user", envUser, profile.User)
+	o.Password = layered(cmd, "password", envPassword, profile.Password)
+	o.SSH = layered(cmd, "ssh", envSSH, profile.SSH)
+	o.SSHKey = layered(cmd, "ssh-key", envSSHKey, profile.SSHKey)
+	o.DatabaseSuffix = layered(cmd, "database-suffix", envDatabaseSuffix, "")
+	for _, s := range []*setting{&o.Host, &o.User, &o.Password, &o.SSH, &o.SSHKey} {
+		if s.Source == "profile" {
+			s.Source = profileSource
+		}
+	}
+
+	return &o, nil
+}
+
+// layered picks the highest-precedence value among a flag, an environment variable and a profile value
+func layered(cmd *cli.Command, flag, env, profileValue string) setting {
+	if v := cmd.String(flag); v != "" {
+		return setting{Value: v, Source: "flag --" + flag}
+	}
+	if v := os.Getenv(env); v != "" {
+		return setting{Value: v, Source: "env " + env}
+	}
+	if profileValue != "" {
+		return setting{Value: profileValue, Source: "profile"}
+	}
+	return setting{}
+}
+
+// describeSetting renders a setting with provenance, redacting secrets
+func describeSetting(name string, s setting, secret bool) string {
+	if !s.Set() {
+		return fmt.Sprintf("%-10s (not overridden; from config file)", name)
+	}
+	value := s.Value
+	if secret {
+		value = "(redacted)"
+	}
+	return fmt.Sprintf("%-10s %-30s [%s]", name, value, s.Source)
+}
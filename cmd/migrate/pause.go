@@ -0,0 +1,142 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/pause"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// pauser pauses the cron jobs and PubSub subscriptions of a database's
+// service around its migrations, as the project config's pauses section asks
+type pauser struct {
+	settings  config.Pauses
+	resources []types.EncoreResource
+	runID     string
+}
+
+// newPauser finds the app's cron jobs and subscriptions when the project
+// config sets pauses.endpoint, and returns nil otherwise
+func newPauser(cmd *cli.Command, project *config.ProjectConfig, runID string) (*pauser, error) {
+	if project.Pauses.Endpoint == "" {
+		return nil, nil
+	}
+	root, err := appRoot(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := discoveryOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+	resources, problems, err := discovery.FindResources(root, opts)
+	if err != nil {
+		return nil, fmt.Errorf("finding cron jobs and subscriptions: %w", err)
+	}
+	for _, problem := range problems {
+		warn(os.Stderr, warnDiscoverySkipped, "%v", problem)
+	}
+	slog.Debug("found Encore cron jobs and subscriptions", "count", len(resources))
+	return &pauser{settings: project.Pauses, resources: resources, runID: runID}, nil
+}
+
+// pause pauses the resources of db's service that use a table the pending
+// migrations touch and returns a function resuming them, latest paused
+// first. A failed pause only warns unless pauses.required is set; then the
+// resources already paused are resumed and the error returned.
+func (p *pauser) pause(ctx context.Context, out, errOut io.Writer, m *migration.Migrator, connStr string, db types.EncoreDatabase, direction string, steps int) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+	owned := discovery.ResourcesOf(db, p.resources)
+	if len(owned) == 0 {
+		return func() {}, nil
+	}
+
+	plan, err := m.Plan(connStr, db.MigrationsPath, direction, steps)
+	if err != nil {
+		return nil, fmt.Errorf("planning which tables the migrations touch: %w", err)
+	}
+	var files []migration.File
+	for _, step := range plan.Steps {
+		if step.File != nil {
+			files = append(files, *step.File)
+		}
+	}
+	tables, err := migration.TouchedTables(files)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return func() {}, nil
+	}
+
+	var paused []pause.Request
+	resume := func() {
+		// The run may have been cancelled; resuming must still go out
+		ctx := context.WithoutCancel(ctx)
+		for _, r := range slices.Backward(paused) {
+			r.Action = pause.ActionResume
+			if err := pause.Post(ctx, p.settings.Endpoint, p.settings.Headers, r); err != nil {
+				warn(errOut, warnPauseFailed, "%s %q is still paused, resume it by hand: %v", r.Kind, r.Name, err)
+				continue
+			}
+			fmt.Fprintf(out, "  Resumed %s %q\n", r.Kind, r.Name)
+		}
+	}
+	for _, r := range owned {
+		if uses, ok := p.settings.Tables[r.Name]; ok && !sharesTable(uses, tables) {
+			continue
+		}
+		req := pause.Request{
+			Action:   pause.ActionPause,
+			Kind:     r.Kind,
+			Name:     r.Name,
+			Topic:    r.Topic,
+			Database: db.Name,
+			Tables:   tables,
+			RunID:    p.runID,
+		}
+		if err := pause.Post(ctx, p.settings.Endpoint, p.settings.Headers, req); err != nil {
+			if p.settings.Required {
+				resume()
+				return nil, fmt.Errorf("pauses.required is set: %w", err)
+			}
+			warn(errOut, warnPauseFailed, "migrating with %s %q running: %v", r.Kind, r.Name, err)
+			continue
+		}
+		fmt.Fprintf(out, "  Paused %s %q\n", r.Kind, r.Name)
+		paused = append(paused, req)
+	}
+	return resume, nil
+}
+
+// sharesTable reports whether the configured tables of a resource include
+// one of the touched tables, ignoring schemas, quotes and case
+func sharesTable(configured, touched []string) bool {
+	key := func(table string) string {
+		if i := strings.LastIndex(table, "."); i >= 0 {
+			table = table[i+1:]
+		}
+		return strings.ToLower(strings.Trim(table, `"`))
+	}
+	for _, a := range configured {
+		for _, b := range touched {
+			if key(a) == key(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
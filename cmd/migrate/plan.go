@@ -0,0 +1,222 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func planCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "plan",
+		Usage: "Show the migrations up (or down with --down) would run, with destructive changes and estimated locks",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name to plan (default: all)",
+			},
+			&cli.BoolFlag{
+				Name:  "down",
+				Usage: "Plan a rollback instead of applying pending migrations",
+			},
+			&cli.IntFlag{
+				Name:  "steps",
+				Usage: "Number of migrations to plan (default: all pending up, 1 down)",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "With --down, plan rolling back every migration",
+			},
+			&cli.StringFlag{
+				Name:  "phase",
+				Usage: "Plan only expand or contract migrations, like up --phase",
+			},
+			&cli.IntFlag{
+				Name:  "to-version",
+				Usage: "Plan the pending migrations up to and including this version, like up --to-version",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return planMigrations(ctx, cmd)
+		},
+	}
+}
+
+func planMigrations(ctx context.Context, cmd *cli.Command) error {
+	direction := "up"
+	if cmd.Bool("down") {
+		direction = "down"
+		if !cmd.IsSet("steps") {
+			if err := cmd.Set("steps", "1"); err != nil {
+				return err
+			}
+		}
+	}
+
+	var phase migration.Phase
+	if name := cmd.String("phase"); name != "" {
+		var err error
+		if phase, err = migration.ParsePhase(name); err != nil {
+			return err
+		}
+		if direction == "down" || cmd.IsSet("steps") {
+			return fmt.Errorf("--phase cannot be combined with --down or --steps")
+		}
+	}
+
+	// The global --output, or github-comment: collapsed markdown for a PR
+	// comment, with destructive changes and locks
+	format := cmd.Root().String("output")
+
+	targets, err := selectTargets(cmd, direction)
+	if err != nil {
+		return err
+	}
+	if err := checkToVersion(cmd, targets.databases); err != nil {
+		return err
+	}
+	if format != "github-comment" {
+		return printPlans(ctx, cmd, targets.infraConfig, targets.project, targets.databases, direction, phase, outputRenderer(cmd))
+	}
+	return printPlanComment(cmd, targets, direction, phase)
+}
+
+// printPlans connects to each database and renders the migrations up or
+// down would run, without executing any SQL or touching run state
+func printPlans(ctx context.Context, cmd *cli.Command, infraConfig *config.InfraConfig, project *config.ProjectConfig, databases []types.EncoreDatabase, direction string, phase migration.Phase, r renderer) error {
+	migrator := newMigrator(cmd)
+	report := planReport{SchemaVersion: reportSchemaVersion, Direction: direction, Databases: []plannedChanges{}}
+	var errs []string
+	for _, db := range databases {
+		plan, pgName, err := planDatabase(cmd, infraConfig, project, migrator, db, direction, phase)
+		report.Databases = append(report.Databases, newPlannedChanges(db.Name, pgName, plan, err))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", db.Name, err))
+		}
+	}
+
+	if err := r.plan(os.Stdout, report); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("planning errors:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// newPlannedChanges converts one database's plan, or the error computing it, for a planReport
+func newPlannedChanges(name, pgName string, plan *migration.Plan, err error) plannedChanges {
+	entry := plannedChanges{Name: name, PGDatabase: pgName, Steps: []plannedStep{}}
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	entry.CurrentVersion = plan.CurrentVersion
+	entry.TargetVersion = plan.TargetVersion
+	entry.Dirty = plan.Dirty
+	for _, step := range plan.Steps {
+		ps := plannedStep{Version: step.Version}
+		if step.File != nil {
+			ps.File = step.File.Name
+		}
+		entry.Steps = append(entry.Steps, ps)
+	}
+	return entry
+}
+
+// planDatabase computes the plan for one database, honoring --steps, --all, --to-version and --phase
+func planDatabase(cmd *cli.Command, infraConfig *config.InfraConfig, project *config.ProjectConfig, migrator *migration.Migrator, db types.EncoreDatabase, direction string, phase migration.Phase) (*migration.Plan, string, error) {
+	mapping, err := infraConfig.GetMapping(db.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := applyConnectionOverrides(cmd, mapping); err != nil {
+		return nil, "", err
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return nil, mapping.PGDBName, err
+	}
+	session, err := sessionOptions(cmd, project, db.Name)
+	if err != nil {
+		return nil, mapping.PGDBName, err
+	}
+
+	steps := int(cmd.Int("steps"))
+	if cmd.Bool("all") {
+		steps = 0
+	}
+	plan, err := migrator.WithSession(session).Plan(connStr, db.MigrationsPath, direction, steps)
+	if err != nil {
+		return nil, mapping.PGDBName, err
+	}
+
+	if direction == "up" && cmd.IsSet("to-version") {
+		if err := plan.StopAt(uint(cmd.Int("to-version"))); err != nil {
+			return nil, mapping.PGDBName, err
+		}
+	}
+
+	if phase != "" {
+		files, err := migration.ReadPhases(db.MigrationsPath)
+		if err != nil {
+			return nil, mapping.PGDBName, err
+		}
+		if err := migration.ValidatePhases(files); err != nil {
+			return nil, mapping.PGDBName, err
+		}
+		n, err := migration.PhaseSteps(files, plan.CurrentVersion, phase)
+		if err != nil {
+			return nil, mapping.PGDBName, err
+		}
+		plan.Steps = plan.Steps[:n]
+		plan.TargetVersion = plan.CurrentVersion
+		if n > 0 {
+			plan.TargetVersion = plan.Steps[n-1].Version
+		}
+	}
+
+	return plan, mapping.PGDBName, nil
+}
+
+// checkToVersion validates --to-version, which stops the up migrations of
+// one database at one of its versions
+func checkToVersion(cmd *cli.Command, databases []types.EncoreDatabase) error {
+	if !cmd.IsSet("to-version") {
+		return nil
+	}
+	if cmd.Int("to-version") < 0 {
+		return fmt.Errorf("--to-version cannot be negative")
+	}
+	for _, flag := range []string{"down", "steps", "phase"} {
+		if cmd.IsSet(flag) {
+			return fmt.Errorf("--to-version cannot be combined with --%s", flag)
+		}
+	}
+	if len(databases) > 1 {
+		return fmt.Errorf("--to-version names a version of one database: pick it with --database")
+	}
+	return nil
+}
+
+// stepsToVersion returns how many pending up migrations of a database lead
+// to version, for the checks and pauses ahead of up --to-version; UpTo
+// itself reads the version again under the migration lock
+func stepsToVersion(m *migration.Migrator, connStr string, db types.EncoreDatabase, version uint) (int, error) {
+	plan, err := m.Plan(connStr, db.MigrationsPath, "up", 0)
+	if err != nil {
+		return 0, fmt.Errorf("planning the migrations up to version %d: %w", version, err)
+	}
+	if err := plan.StopAt(version); err != nil {
+		return 0, err
+	}
+	return len(plan.Steps), nil
+}
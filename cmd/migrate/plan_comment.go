@@ -0,0 +1,206 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+// maxCommentBytes keeps the rendered comment under GitHub's 65536 character
+// limit, with room for a bot to add its own header
+const maxCommentBytes = 60000
+
+// maxFindingsPerFile caps the findings listed under a single migration file
+const maxFindingsPerFile = 20
+
+// plannedDatabase is one database's plan and the findings of the files it would run
+type plannedDatabase struct {
+	name     string
+	pgName   string
+	plan     *migration.Plan
+	findings map[uint][]migration.Finding // by step version
+	err      error
+}
+
+func (p plannedDatabase) destructive() int {
+	n := 0
+	for _, findings := range p.findings {
+		for _, f := range findings {
+			if f.Destructive != "" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (p plannedDatabase) blockingLocks() int {
+	n := 0
+	for _, findings := range p.findings {
+		for _, f := range findings {
+			if f.Lock != "" && f.Lock != migration.LockShareUpdateExclusive {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// printPlanComment prints the plan as markdown for a pull request comment: a
+// summary table of the affected databases followed by one collapsed section
+// per database listing its files, destructive changes and estimated locks
+func printPlanComment(cmd *cli.Command, targets *runTargets, direction string, phase migration.Phase) error {
+	migrator := newMigrator(cmd)
+
+	var planned []plannedDatabase
+	var errs []string
+	for _, db := range targets.databases {
+		p := plannedDatabase{name: db.Name, findings: make(map[uint][]migration.Finding)}
+		p.plan, p.pgName, p.err = planDatabase(cmd, targets.infraConfig, targets.project, migrator, db, direction, phase)
+		if p.err == nil {
+			for _, step := range p.plan.Steps {
+				if step.File == nil {
+					continue
+				}
+				findings, err := migration.AssessFile(*step.File)
+				if err != nil {
+					p.err = err
+					break
+				}
+				p.findings[step.Version] = findings
+			}
+		}
+		if p.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", db.Name, p.err))
+		}
+		planned = append(planned, p)
+	}
+
+	fmt.Print(renderPlanComment(planned, direction))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("planning errors:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+func renderPlanComment(planned []plannedDatabase, direction string) string {
+	var affected []plannedDatabase
+	var upToDate []string
+	migrations, destructive, blocking := 0, 0, 0
+	for _, p := range planned {
+		if p.err == nil && !p.plan.Dirty && len(p.plan.Steps) == 0 {
+			upToDate = append(upToDate, "`"+p.name+"`")
+			continue
+		}
+		affected = append(affected, p)
+		if p.err == nil {
+			migrations += len(p.plan.Steps)
+			destructive += p.destructive()
+			blocking += p.blockingLocks()
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Migration plan (%s)\n\n", direction)
+	if len(affected) == 0 {
+		fmt.Fprintf(&b, "No pending migrations in %d databases.\n", len(planned))
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "**%d of %d databases affected**, %d migrations", len(affected), len(planned), migrations)
+	if destructive > 0 {
+		fmt.Fprintf(&b, " · :warning: **%d destructive**", destructive)
+	}
+	if blocking > 0 {
+		fmt.Fprintf(&b, " · %d blocking locks", blocking)
+	}
+	b.WriteString("\n\n")
+
+	b.WriteString("| Database | Version | Migrations | Destructive | Blocking locks |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+	for _, p := range affected {
+		switch {
+		case p.err != nil:
+			fmt.Fprintf(&b, "| `%s` | error | - | - | - |\n", p.name)
+		case p.plan.Dirty:
+			fmt.Fprintf(&b, "| `%s` | dirty at %d | - | - | - |\n", p.name, p.plan.CurrentVersion)
+		default:
+			flag := "0"
+			if n := p.destructive(); n > 0 {
+				flag = fmt.Sprintf(":warning: %d", n)
+			}
+			fmt.Fprintf(&b, "| `%s` | %d → %d | %d | %s | %d |\n", p.name, p.plan.CurrentVersion, p.plan.TargetVersion, len(p.plan.Steps), flag, p.blockingLocks())
+		}
+	}
+	b.WriteString("\n")
+
+	footer := "<sub>Locks are estimated from each statement's shape. Generated by `encore-migrator plan`.</sub>\n"
+	if len(upToDate) > 0 {
+		footer = fmt.Sprintf("Up to date: %s\n\n", strings.Join(upToDate, ", ")) + footer
+	}
+
+	for i, p := range affected {
+		section := renderPlanSection(p, direction)
+		if b.Len()+len(section)+len(footer) > maxCommentBytes {
+			fmt.Fprintf(&b, "_%d more databases omitted to fit the comment; run `encore-migrator plan` for the full plan._\n\n", len(affected)-i)
+			break
+		}
+		b.WriteString(section)
+	}
+
+	b.WriteString(footer)
+	return b.String()
+}
+
+// renderPlanSection renders one database as a collapsed <details> block
+func renderPlanSection(p plannedDatabase, direction string) string {
+	var b strings.Builder
+
+	switch {
+	case p.err != nil:
+		fmt.Fprintf(&b, "<details><summary><b>%s</b>: error</summary>\n\n```\n%v\n```\n\n</details>\n\n", p.name, p.err)
+		return b.String()
+	case p.plan.Dirty:
+		fmt.Fprintf(&b, "<details><summary><b>%s</b>: dirty at version %d</summary>\n\n%s would refuse until the database is recovered with `force`.\n\n</details>\n\n", p.name, p.plan.CurrentVersion, direction)
+		return b.String()
+	}
+
+	summary := fmt.Sprintf("%d → %d, %d migrations", p.plan.CurrentVersion, p.plan.TargetVersion, len(p.plan.Steps))
+	if n := p.destructive(); n > 0 {
+		summary += fmt.Sprintf(", :warning: %d destructive", n)
+	}
+	fmt.Fprintf(&b, "<details><summary><b>%s</b> (%s): %s</summary>\n\n", p.name, p.pgName, summary)
+
+	for _, step := range p.plan.Steps {
+		if step.File == nil {
+			fmt.Fprintf(&b, "- `%d` (no down file; only the version changes)\n", step.Version)
+			continue
+		}
+		fmt.Fprintf(&b, "- `%s`\n", step.File.Name)
+
+		findings := p.findings[step.Version]
+		for i, f := range findings {
+			if i == maxFindingsPerFile {
+				fmt.Fprintf(&b, "  - _%d more statements_\n", len(findings)-i)
+				break
+			}
+			on := ""
+			if f.Table != "" {
+				on = fmt.Sprintf(" on `%s`", f.Table)
+			}
+			if f.Destructive != "" {
+				fmt.Fprintf(&b, "  - :warning: line %d: %s%s\n", f.Line, f.Destructive, on)
+			}
+			if f.Lock != "" {
+				fmt.Fprintf(&b, "  - line %d: `%s` lock%s (%s)\n", f.Line, f.Lock, on, migration.Blocking(f.Lock))
+			}
+		}
+	}
+
+	b.WriteString("\n</details>\n\n")
+	return b.String()
+}
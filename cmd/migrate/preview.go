@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// maxIdentifierLength is PostgreSQL's NAMEDATALEN-1; longer names are silently truncated
+const maxIdentifierLength = 63
+
+func previewCommand() *cli.Command {
+	idFlag := func() cli.Flag {
+		return &cli.StringFlag{
+			Name:     "id",
+			Usage:    "Preview environment identifier (e.g., pr-123); database names get the suffix _<id>",
+			Required: true,
+		}
+	}
+
+	return &cli.Command{
+		Name:  "preview",
+		Usage: "Manage per-pull-request databases on a shared server",
+		Commands: []*cli.Command{
+			{
+				Name:  "create",
+				Usage: "Provision, migrate and seed the preview databases, then print their connection strings (requires --admin-user)",
+				Flags: append(reconcileCommand().Flags,
+					idFlag(),
+					&cli.StringFlag{
+						Name:  "seed-dir",
+						Usage: "Directory of <database>.sql seed files applied after migrating",
+					},
+					&cli.StringFlag{
+						Name:  "env-file",
+						Usage: "Write <DATABASE>_DATABASE_URL lines with unredacted connection strings to this file",
+					},
+				),
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return previewCreate(ctx, cmd)
+				},
+			},
+			{
+				Name:  "migrate",
+				Usage: "Apply pending migrations to the preview databases",
+				Flags: append(upCommand().Flags, idFlag()),
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if err := setPreviewSuffix(cmd); err != nil {
+						return err
+					}
+					return runMigrations(ctx, cmd, "up")
+				},
+			},
+			{
+				Name:  "destroy",
+				Usage: "Drop the preview databases",
+				Flags: append(teardownCommand().Flags, idFlag()),
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if err := setPreviewSuffix(cmd); err != nil {
+						return err
+					}
+					return teardown(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+// previewSuffix turns an identifier such as pr-123 into a database name suffix (_pr_123)
+func previewSuffix(id string) (string, error) {
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '_'
+		}
+	}, id)
+	s = strings.Trim(s, "_")
+	if s == "" {
+		return "", fmt.Errorf("invalid preview id %q: needs at least one letter or digit", id)
+	}
+	return "_" + s, nil
+}
+
+// setPreviewSuffix routes the preview suffix through --database-suffix so
+// every command path names databases the same way
+func setPreviewSuffix(cmd *cli.Command) error {
+	suffix, err := previewSuffix(cmd.String("id"))
+	if err != nil {
+		return err
+	}
+	overrides, err := resolveOverrides(cmd)
+	if err != nil {
+		return err
+	}
+	if overrides.DatabaseSuffix.Set() {
+		return fmt.Errorf("--id cannot be combined with a database suffix (%s)", overrides.DatabaseSuffix.Source)
+	}
+	return cmd.Root().Set("database-suffix", suffix)
+}
+
+func previewCreate(ctx context.Context, cmd *cli.Command) error {
+	if err := setPreviewSuffix(cmd); err != nil {
+		return err
+	}
+
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if infraConfig.IsProduction() {
+		return fmt.Errorf("refusing to create a preview: %s has metadata.env_type %q", cmd.String("config"), config.EnvTypeProduction)
+	}
+
+	mappings := make(map[string]*types.DatabaseMapping)
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+		if len(mapping.PGDBName) > maxIdentifierLength {
+			return fmt.Errorf("%s: database name %s exceeds %d characters; use a shorter --id", db.Name, mapping.PGDBName, maxIdentifierLength)
+		}
+		mappings[db.Name] = mapping
+	}
+
+	fmt.Printf("Provisioning preview %s:\n", cmd.String("id"))
+	if err := reconcile(ctx, cmd); err != nil {
+		return err
+	}
+
+	if dir := cmd.String("seed-dir"); dir != "" {
+		migrator := newMigrator(cmd)
+		for _, db := range databases {
+			if target := cmd.String("database"); target != "" && target != db.Name {
+				continue
+			}
+			path := filepath.Join(dir, db.Name+".sql")
+			if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			connStr, err := migration.BuildConnectionString(mappings[db.Name])
+			if err != nil {
+				return fmt.Errorf("%s: %w", db.Name, err)
+			}
+			if err := migrator.Seed(connStr, path); err != nil {
+				return fmt.Errorf("%s: %w", db.Name, err)
+			}
+			fmt.Printf("  %s: seeded from %s\n", db.Name, path)
+		}
+	}
+
+	var env strings.Builder
+	fmt.Printf("\nPreview %s connection strings:\n", cmd.String("id"))
+	for _, db := range databases {
+		if target := cmd.String("database"); target != "" && target != db.Name {
+			continue
+		}
+		connStr, err := migration.BuildConnectionString(mappings[db.Name])
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		fmt.Printf("  %-20s %s\n", db.Name, redactDSN(connStr))
+		fmt.Fprintf(&env, "%s=%s\n", previewEnvVar(db.Name), connStr)
+	}
+
+	if path := cmd.String("env-file"); path != "" {
+		if err := os.WriteFile(path, []byte(env.String()), 0600); err != nil {
+			return fmt.Errorf("writing env file: %w", err)
+		}
+		fmt.Printf("\nWrote connection strings to %s\n", path)
+	}
+
+	return nil
+}
+
+// previewEnvVar names the environment variable carrying a database's connection string
+func previewEnvVar(name string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)) + "_DATABASE_URL"
+}
@@ -0,0 +1,74 @@
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/quiesce"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// quiesceDatabase calls a database's quiesce endpoint before its pending
+// migrations run and returns a function calling its resume endpoint with the
+// outcome. Databases without quiesce settings or pending migrations are
+// left alone.
+func quiesceDatabase(ctx context.Context, out, errOut io.Writer, project *config.ProjectConfig, m *migration.Migrator, connStr string,
+	db types.EncoreDatabase, mapping *types.DatabaseMapping, direction string, steps int, runID string) (func(succeeded bool), error) {
+	noop := func(bool) {}
+	settings := project.Database(db.Name).Quiesce
+	if settings == nil {
+		return noop, nil
+	}
+	if settings.QuiesceURL == "" || settings.ResumeURL == "" {
+		return nil, fmt.Errorf("databases.%s.quiesce needs both quiesce_url and resume_url", db.Name)
+	}
+	timeout, err := time.ParseDuration(cmp.Or(settings.Timeout, config.DefaultQuiesceTimeout))
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid databases.%s.quiesce.timeout %q: want a positive Go duration such as 30s", db.Name, settings.Timeout)
+	}
+	header, value := cmp.Or(settings.AuthHeader, "Authorization"), ""
+	if settings.Auth != nil {
+		if value, err = settings.Auth.Resolve(); err != nil {
+			return nil, fmt.Errorf("resolving databases.%s.quiesce.auth: %w", db.Name, err)
+		}
+	}
+
+	plan, err := m.Plan(connStr, db.MigrationsPath, direction, steps)
+	if err != nil {
+		return nil, fmt.Errorf("planning which migrations run: %w", err)
+	}
+	if len(plan.Steps) == 0 {
+		return noop, nil
+	}
+	notice := quiesce.Notice{
+		Database:    db.Name,
+		PGDatabase:  mapping.PGDBName,
+		Direction:   direction,
+		RunID:       runID,
+		FromVersion: plan.CurrentVersion,
+		ToVersion:   plan.TargetVersion,
+	}
+
+	resume := func(succeeded bool) {
+		n := notice
+		n.Succeeded = &succeeded
+		// The run may have been cancelled; the writers must still resume
+		if err := quiesce.Post(context.WithoutCancel(ctx), settings.ResumeURL, header, value, timeout, n); err != nil {
+			warn(errOut, warnResumeFailed, "writers of %q may still be quiesced, resume them by hand: %v", db.Name, err)
+			return
+		}
+		fmt.Fprintf(out, "  Resumed writers of %q\n", db.Name)
+	}
+	fmt.Fprintf(out, "  Quiescing writers of %q...\n", db.Name)
+	if err := quiesce.Post(ctx, settings.QuiesceURL, header, value, timeout, notice); err != nil {
+		// The service may have started draining before failing
+		resume(false)
+		return nil, fmt.Errorf("quiescing writers: %w", err)
+	}
+	return resume, nil
+}
@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func reconcileCommand() *cli.Command {
+	flags := append(upCommand().Flags,
+		&cli.StringFlag{
+			Name:  "maintenance-db",
+			Usage: "Database the admin connects to for creating roles and databases",
+			Value: "postgres",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-migrate",
+			Usage: "Only provision roles and databases; do not run migrations",
+		},
+	)
+
+	return &cli.Command{
+		Name:  "reconcile",
+		Usage: "Ensure every discovered database and its role exist with baseline grants (requires --admin-user), then migrate up",
+		Flags: flags,
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return reconcile(ctx, cmd)
+		},
+	}
+}
+
+func reconcile(ctx context.Context, cmd *cli.Command) error {
+	if cmd.String("admin-user") == "" {
+		return fmt.Errorf("reconcile requires --admin-user (and --admin-password) with rights to create roles and databases")
+	}
+
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if targetDB := cmd.String("database"); targetDB != "" {
+		databases = discovery.FilterDatabases(databases, targetDB)
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found", targetDB)
+		}
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+
+	migrator := newMigrator(cmd)
+
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+
+		admin := adminMapping(cmd, mapping)
+		targetConnStr, err := migration.BuildConnectionString(admin)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		maintenance := *admin
+		maintenance.PGDBName = cmd.String("maintenance-db")
+		maintenanceConnStr, err := migration.BuildConnectionString(&maintenance)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+
+		result, err := migrator.EnsureDatabase(maintenanceConnStr, targetConnStr, migration.Provision{
+			Database: mapping.PGDBName,
+			Role:     mapping.Username,
+			Password: mapping.Password,
+		})
+		if err != nil {
+			return fmt.Errorf("provisioning %s: %w", db.Name, err)
+		}
+
+		var changes []string
+		if result.CreatedRole {
+			changes = append(changes, "created role "+mapping.Username)
+		}
+		if result.CreatedDatabase {
+			changes = append(changes, "created database "+mapping.PGDBName)
+		}
+		changes = append(changes, "password and grants in sync")
+		fmt.Printf("  %s: %s\n", db.Name, strings.Join(changes, ", "))
+	}
+
+	if cmd.Bool("skip-migrate") {
+		return nil
+	}
+
+	fmt.Println()
+	return runMigrations(ctx, cmd, "up")
+}
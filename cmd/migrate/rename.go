@@ -0,0 +1,266 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/snapshot"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func renameCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "rename",
+		Usage: "Rename an Encore database in the manifest, project config, lockfile and optionally the InfraConfig, and check its tracking tables on the server",
+		Description: "The NewDatabase call in the source is left to you; rename reminds you where it is.\n" +
+			"With --update-infra-config the InfraConfig entry keeps pointing at the same PostgreSQL database,\n" +
+			"so nothing moves. If the new entry points at another database, its tracking tables are copied\n" +
+			"from the old one when it has none (as state export | state import would).",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "Current Encore database name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "New Encore database name",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "update-infra-config",
+				Usage: "Also rename the database in the InfraConfig (--config)",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-tracking",
+				Usage: "Don't connect to check or copy the tracking tables",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show what would change without writing files or databases",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return renameDatabase(ctx, cmd)
+		},
+	}
+}
+
+func renameDatabase(ctx context.Context, cmd *cli.Command) error {
+	from, to := cmd.String("from"), cmd.String("to")
+	if from == "" || to == "" || from == to {
+		return fmt.Errorf("--from and --to must be two different database names")
+	}
+	dryRun := cmd.Bool("dry-run")
+	if dryRun {
+		fmt.Printf("Dry run: nothing will be written.\n\n")
+	}
+
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	var found *types.EncoreDatabase
+	for i := range databases {
+		if databases[i].Name == from || databases[i].Name == to {
+			found = &databases[i]
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("database %q not found", from)
+	}
+
+	// Read everything that still names the old database before editing it
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	oldMapping, oldErr := infraConfig.GetMapping(from)
+
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+	manifestPath := cmd.String("manifest")
+	if manifestPath == "" {
+		manifestPath = config.FindManifest(root)
+	}
+	projectPath := cmd.String("project-config")
+	if projectPath == "" {
+		projectPath = config.FindProjectConfig(root)
+	}
+	files := []struct {
+		path   string
+		target config.RenameTarget
+	}{
+		{manifestPath, config.RenameManifest},
+		{projectPath, config.RenameProjectConfig},
+	}
+	if cmd.Bool("update-infra-config") {
+		files = append(files, struct {
+			path   string
+			target config.RenameTarget
+		}{cmd.String("config"), config.RenameInfraConfig})
+	}
+	// Check every file before writing any, so a clash leaves them all untouched
+	type update struct {
+		path string
+		data []byte
+	}
+	var updates []update
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		updated, changed, err := config.RenameDatabase(f.path, f.target, from, to)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Printf("%s: no mention of %q\n", f.path, from)
+			continue
+		}
+		updates = append(updates, update{f.path, updated})
+	}
+	lockPath := filepath.Join(root, snapshot.FileName)
+	lock, err := snapshot.Load(lockPath)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		if _, exists := lock.Databases[to]; exists {
+			return fmt.Errorf("%s: database %q already exists", lockPath, to)
+		}
+	}
+
+	for _, u := range updates {
+		if !dryRun {
+			if err := writeKeepingMode(u.path, u.data); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s: renamed %q to %q\n", u.path, from, to)
+	}
+	if lock == nil {
+		lock = &snapshot.Snapshot{}
+	}
+	if entry, ok := lock.Databases[from]; ok {
+		delete(lock.Databases, from)
+		lock.Databases[to] = entry
+		if !dryRun {
+			if err := lock.Write(lockPath); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%s: renamed %q to %q\n", lockPath, from, to)
+	}
+
+	if !cmd.Bool("skip-tracking") {
+		if err := moveTracking(cmd, project, oldMapping, oldErr, from, to, dryRun); err != nil {
+			return err
+		}
+	}
+
+	if found.Name == from && found.SourceFile != manifestPath {
+		fmt.Printf("\nStill to do by hand: rename sqldb.NewDatabase(%q, ...) to %q in %s\n", from, to, found.SourceFile)
+	}
+	return nil
+}
+
+// moveTracking checks that the new name reaches the old tracking state,
+// copying it when the InfraConfig points the new name at an empty database
+func moveTracking(cmd *cli.Command, project *config.ProjectConfig, oldMapping *types.DatabaseMapping, oldErr error, from, to string, dryRun bool) error {
+	var newMapping *types.DatabaseMapping
+	if dryRun && cmd.Bool("update-infra-config") && oldErr == nil {
+		// The InfraConfig wasn't written; its renamed entry would keep the old database
+		copied := *oldMapping
+		newMapping = &copied
+	} else {
+		infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+		if err != nil {
+			return fmt.Errorf("loading InfraConfig: %w", err)
+		}
+		if newMapping, err = infraConfig.GetMapping(to); err != nil {
+			fmt.Printf("\nThe InfraConfig has no entry for %q yet; rename it (or pass --update-infra-config) and re-run to check the tracking tables.\n", to)
+			return nil
+		}
+	}
+
+	if err := applyConnectionOverrides(cmd, newMapping); err != nil {
+		return err
+	}
+	if oldErr == nil {
+		if err := applyConnectionOverrides(cmd, oldMapping); err != nil {
+			return err
+		}
+	}
+
+	session, err := sessionOptions(cmd, project, from)
+	if err != nil {
+		return err
+	}
+	migrator := newMigrator(cmd).WithSession(session)
+	readTracking := func(mapping *types.DatabaseMapping) (string, *migration.TrackingState, error) {
+		connStr, err := migration.BuildConnectionString(mapping)
+		if err != nil {
+			return "", nil, err
+		}
+		state, err := migrator.ExportTracking(connStr, "")
+		return connStr, state, err
+	}
+
+	newConnStr, newState, err := readTracking(newMapping)
+	if err != nil {
+		return fmt.Errorf("reading tracking tables of %q: %w", to, err)
+	}
+	if oldErr != nil || sameDatabase(oldMapping, newMapping) {
+		fmt.Printf("\nTracking tables: %q reaches %s at version %d with %d history rows; nothing to move.\n", to, newMapping.PGDBName, newState.Version, len(newState.History))
+		return nil
+	}
+
+	_, oldState, err := readTracking(oldMapping)
+	if err != nil {
+		return fmt.Errorf("reading tracking tables of %q: %w", from, err)
+	}
+	switch {
+	case newState.Version == oldState.Version && newState.Dirty == oldState.Dirty:
+		fmt.Printf("\nTracking tables: %s and %s are both at version %d; nothing to move.\n", oldMapping.PGDBName, newMapping.PGDBName, newState.Version)
+		return nil
+	case newState.Version != 0 || len(newState.History) > 0:
+		return fmt.Errorf("%s is at version %d but %s is at version %d; reconcile them by hand (see state export/import)", newMapping.PGDBName, newState.Version, oldMapping.PGDBName, oldState.Version)
+	}
+	if !dryRun {
+		if err := migrator.ImportTracking(newConnStr, *oldState, false); err != nil {
+			return fmt.Errorf("copying tracking tables to %q: %w", to, err)
+		}
+	}
+	fmt.Printf("\nTracking tables: copied version %d and %d history rows from %s to %s.\n", oldState.Version, len(oldState.History), oldMapping.PGDBName, newMapping.PGDBName)
+	return nil
+}
+
+// sameDatabase reports whether two mappings reach the same PostgreSQL database
+func sameDatabase(a, b *types.DatabaseMapping) bool {
+	return a.Host == b.Host && a.Port == b.Port && a.CloudSQLInstance == b.CloudSQLInstance && a.PGDBName == b.PGDBName
+}
+
+// writeKeepingMode rewrites a file without changing its permissions
+func writeKeepingMode(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
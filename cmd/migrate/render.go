@@ -0,0 +1,341 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// outputFormats are the values of the global --output, which every report
+// renders in
+var outputFormats = []string{"text", "json", "ndjson", "markdown"}
+
+// commandFormats are further --output formats only one command's report
+// has, by format
+var commandFormats = map[string]string{"tfvars": "list", "github-comment": "plan"}
+
+// renderer writes the reports of every command in one output format, so
+// every format, present or future, works from the same data
+type renderer interface {
+	status(w io.Writer, report statusReport) error
+	run(w io.Writer, report runReport) error
+	plan(w io.Writer, report planReport) error
+	// report writes the report of any other command
+	report(w io.Writer, r report) error
+}
+
+// report is the document of a command other than status, up, down and dry
+// runs. The json renderer prints it whole; the others use its methods.
+type report interface {
+	text(w io.Writer)
+	markdown(w io.Writer)
+	// records are its ndjson lines, e.g. one per database
+	records() []any
+}
+
+// newRenderer returns the renderer of an output format
+func newRenderer(format string) (renderer, error) {
+	switch format {
+	case "text":
+		return textRenderer{}, nil
+	case "json":
+		return jsonRenderer{}, nil
+	case "ndjson":
+		return ndjsonRenderer{}, nil
+	case "markdown":
+		return markdownRenderer{}, nil
+	}
+	return nil, fmt.Errorf("unknown --output %q (want %s)", format, strings.Join(outputFormats, ", "))
+}
+
+// checkOutputFormat checks the global --output is a format every report
+// renders in, or one of command's own
+func checkOutputFormat(format, command string) error {
+	if _, err := newRenderer(format); err == nil {
+		return nil
+	}
+	if only, ok := commandFormats[format]; ok {
+		if only == command {
+			return nil
+		}
+		return fmt.Errorf("--output %s is only supported by %s", format, only)
+	}
+	return fmt.Errorf("unknown --output %q (want %s; a file to write is --out)", format, strings.Join(outputFormats, ", "))
+}
+
+// outputRenderer is the renderer of the global --output, validated in Before
+func outputRenderer(cmd *cli.Command) renderer {
+	r, err := newRenderer(cmd.Root().String("output"))
+	if err != nil {
+		return textRenderer{}
+	}
+	return r
+}
+
+// textRenderer prints the tables and lines meant for a terminal. A run's
+// progress was already printed as it happened, so runs end with a summary.
+type textRenderer struct{}
+
+func (textRenderer) status(w io.Writer, report statusReport) error {
+	if report.Extended {
+		fmt.Fprintf(w, "%-20s %-30s %-10s %-10s %-16s %s\n", "DATABASE", "PG_NAME", "VERSION", "DIRTY", "LAST APPLIED", "PENDING")
+		fmt.Fprintln(w, strings.Repeat("-", 97))
+	} else {
+		fmt.Fprintf(w, "%-20s %-30s %-10s %-10s %s\n", "DATABASE", "PG_NAME", "VERSION", "DIRTY", "LAST APPLIED")
+		fmt.Fprintln(w, strings.Repeat("-", 87))
+	}
+	now := time.Now()
+	for _, entry := range report.Databases {
+		pgName := entry.PGDatabase
+		if pgName == "" {
+			pgName = "N/A"
+		}
+		if entry.Error != "" {
+			fmt.Fprintf(w, "%-20s %-30s %-10s %-10s\n", entry.Name, pgName, "error", entry.Error)
+			continue
+		}
+		dirtyStr := "no"
+		if entry.Dirty {
+			dirtyStr = "YES"
+		}
+		applied := "-"
+		if entry.LastApplied != nil {
+			applied = relativeTime(*entry.LastApplied, now)
+		}
+		if !report.Extended {
+			fmt.Fprintf(w, "%-20s %-30s %-10d %-10s %s\n", entry.Name, pgName, entry.Version, dirtyStr, applied)
+			continue
+		}
+		fmt.Fprintf(w, "%-20s %-30s %-10d %-10s %-16s %d\n", entry.Name, pgName, entry.Version, dirtyStr, applied, len(entry.PendingFiles))
+		for _, name := range entry.PendingFiles {
+			fmt.Fprintf(w, "  pending: %s\n", name)
+		}
+	}
+	return nil
+}
+
+func (textRenderer) run(w io.Writer, report runReport) error {
+	outcome := "succeeded"
+	if !report.Succeeded {
+		outcome = "failed"
+	}
+	fmt.Fprintf(w, "\nRun %s (%s) %s\n", report.RunID, report.Direction, outcome)
+	for _, db := range report.Databases {
+		fmt.Fprintf(w, "  %-20s %-12s %d -> %d", db.Name, db.Status, db.VersionBefore, db.VersionAfter)
+		if n := len(db.AppliedFiles); n > 0 {
+			fmt.Fprintf(w, " (%d files)", n)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (textRenderer) report(w io.Writer, r report) error {
+	r.text(w)
+	return nil
+}
+
+func (textRenderer) plan(w io.Writer, report planReport) error {
+	fmt.Fprintf(w, "Dry run: no SQL will be executed.\n\n")
+	for _, db := range report.Databases {
+		switch {
+		case db.Error != "":
+			fmt.Fprintf(w, "%q: error: %s\n", db.Name, db.Error)
+		case db.Dirty:
+			fmt.Fprintf(w, "%q (%s): DIRTY at version %d; %s would refuse until it is recovered with force\n", db.Name, db.PGDatabase, db.CurrentVersion, report.Direction)
+		case len(db.Steps) == 0:
+			fmt.Fprintf(w, "%q (%s): nothing to do at version %d\n", db.Name, db.PGDatabase, db.CurrentVersion)
+		default:
+			fmt.Fprintf(w, "%q (%s): version %d -> %d\n", db.Name, db.PGDatabase, db.CurrentVersion, db.TargetVersion)
+			for _, step := range db.Steps {
+				file := step.File
+				if file == "" {
+					file = "(no down file; only the version changes)"
+				}
+				fmt.Fprintf(w, "  %-4s %-16d %s\n", report.Direction, step.Version, file)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonRenderer prints each report as one indented JSON document
+type jsonRenderer struct{}
+
+func (jsonRenderer) status(w io.Writer, report statusReport) error { return encodeJSON(w, report) }
+func (jsonRenderer) run(w io.Writer, report runReport) error       { return encodeJSON(w, report) }
+func (jsonRenderer) plan(w io.Writer, report planReport) error     { return encodeJSON(w, report) }
+func (jsonRenderer) report(w io.Writer, r report) error            { return encodeJSON(w, r) }
+
+func encodeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ndjsonRenderer prints one compact JSON line per database, for log
+// pipelines that take a record at a time:
+//
+//	{"schema_version": 1, "run_id": "...", "direction": "up", "database": {"name": "users", "status": "completed", ...}}
+//
+// database is the entry of the matching JSON document; run_id and direction
+// are set for runs, direction for dry runs.
+type ndjsonRenderer struct{}
+
+type ndjsonRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	RunID         string `json:"run_id,omitempty"`
+	Direction     string `json:"direction,omitempty"`
+	Database      any    `json:"database"`
+}
+
+func (ndjsonRenderer) status(w io.Writer, report statusReport) error {
+	enc := json.NewEncoder(w)
+	for _, db := range report.Databases {
+		if err := enc.Encode(ndjsonRecord{SchemaVersion: report.SchemaVersion, Database: db}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonRenderer) run(w io.Writer, report runReport) error {
+	enc := json.NewEncoder(w)
+	for _, db := range report.Databases {
+		if err := enc.Encode(ndjsonRecord{SchemaVersion: report.SchemaVersion, RunID: report.RunID, Direction: report.Direction, Database: db}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonRenderer) plan(w io.Writer, report planReport) error {
+	enc := json.NewEncoder(w)
+	for _, db := range report.Databases {
+		if err := enc.Encode(ndjsonRecord{SchemaVersion: report.SchemaVersion, Direction: report.Direction, Database: db}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ndjsonRenderer) report(w io.Writer, r report) error {
+	enc := json.NewEncoder(w)
+	for _, record := range r.records() {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// databaseRecords are the ndjson lines of a report's databases
+func databaseRecords[T any](databases []T) []any {
+	records := make([]any, len(databases))
+	for i, db := range databases {
+		records[i] = ndjsonRecord{SchemaVersion: reportSchemaVersion, Database: db}
+	}
+	return records
+}
+
+// markdownRenderer prints tables for wikis, tickets and CI job summaries
+type markdownRenderer struct{}
+
+func (markdownRenderer) status(w io.Writer, report statusReport) error {
+	fmt.Fprintf(w, "### Migration status\n\n")
+	fmt.Fprintf(w, "| Database | PostgreSQL database | Version | Dirty | Last applied | Pending |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|---|\n")
+	now := time.Now()
+	for _, db := range report.Databases {
+		if db.Error != "" {
+			fmt.Fprintf(w, "| `%s` | %s | error: %s | - | - | - |\n", db.Name, markdownCell(db.PGDatabase), markdownCell(db.Error))
+			continue
+		}
+		applied := "-"
+		if db.LastApplied != nil {
+			applied = fmt.Sprintf("%s (%s)", relativeTime(*db.LastApplied, now), db.LastApplied.UTC().Format(time.RFC3339))
+		}
+		pending := "-"
+		if report.Extended {
+			pending = markdownFiles(db.PendingFiles)
+		}
+		fmt.Fprintf(w, "| `%s` | %s | %d | %s | %s | %s |\n", db.Name, markdownCell(db.PGDatabase), db.Version, yesNo(db.Dirty), applied, pending)
+	}
+	return nil
+}
+
+func (markdownRenderer) run(w io.Writer, report runReport) error {
+	outcome := "succeeded"
+	if !report.Succeeded {
+		outcome = "failed"
+	}
+	fmt.Fprintf(w, "### Migration run `%s` (%s) %s\n\n", report.RunID, report.Direction, outcome)
+	if report.Ticket != "" {
+		fmt.Fprintf(w, "Ticket: %s\n\n", markdownCell(report.Ticket))
+	}
+	fmt.Fprintf(w, "| Database | Status | Version | Applied | Error |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|\n")
+	for _, db := range report.Databases {
+		fmt.Fprintf(w, "| `%s` | %s | %d → %d | %s | %s |\n", db.Name, db.Status, db.VersionBefore, db.VersionAfter, markdownFiles(db.AppliedFiles), markdownCell(db.Error))
+	}
+	return nil
+}
+
+func (markdownRenderer) plan(w io.Writer, report planReport) error {
+	fmt.Fprintf(w, "### Migration plan (%s)\n\n", report.Direction)
+	fmt.Fprintf(w, "| Database | Version | Migrations |\n")
+	fmt.Fprintf(w, "|---|---|---|\n")
+	for _, db := range report.Databases {
+		switch {
+		case db.Error != "":
+			fmt.Fprintf(w, "| `%s` | error: %s | - |\n", db.Name, markdownCell(db.Error))
+		case db.Dirty:
+			fmt.Fprintf(w, "| `%s` | dirty at %d | - |\n", db.Name, db.CurrentVersion)
+		default:
+			files := make([]string, 0, len(db.Steps))
+			for _, step := range db.Steps {
+				if step.File == "" {
+					files = append(files, fmt.Sprintf("%d (no down file)", step.Version))
+					continue
+				}
+				files = append(files, step.File)
+			}
+			fmt.Fprintf(w, "| `%s` | %d → %d | %s |\n", db.Name, db.CurrentVersion, db.TargetVersion, markdownFiles(files))
+		}
+	}
+	return nil
+}
+
+func (markdownRenderer) report(w io.Writer, r report) error {
+	r.markdown(w)
+	return nil
+}
+
+// markdownCell makes s safe inside a table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownFiles lists file names in one cell
+func markdownFiles(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "`" + name + "`"
+	}
+	return strings.Join(quoted, "<br>")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
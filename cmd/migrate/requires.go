@@ -0,0 +1,168 @@
+package migrate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// readDependencies loads the cross-database requirements of each database's
+// migrations and merges them with the project config's depends_on into a
+// dependency graph, rejecting references to databases that don't exist
+func readDependencies(cmd *cli.Command, project *config.ProjectConfig, databases []types.EncoreDatabase) (map[string][]string, map[string][]migration.Requirement, error) {
+	all, err := discoverDatabases(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	known := make(map[string]bool, len(all))
+	for _, db := range all {
+		known[db.Name] = true
+	}
+
+	dependencies := make(map[string][]string)
+	requirements := make(map[string][]migration.Requirement)
+	for _, db := range databases {
+		reqs, err := migration.ReadRequirements(db.MigrationsPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", db.Name, err)
+		}
+		for _, r := range reqs {
+			switch {
+			case !known[r.Database]:
+				return nil, nil, fmt.Errorf("%s: %s requires unknown database %q", db.Name, r.File.Name, r.Database)
+			case r.Database == db.Name:
+				return nil, nil, fmt.Errorf("%s: %s requires its own database", db.Name, r.File.Name)
+			}
+			if !slices.Contains(dependencies[db.Name], r.Database) {
+				dependencies[db.Name] = append(dependencies[db.Name], r.Database)
+			}
+		}
+		requirements[db.Name] = reqs
+
+		for _, dep := range project.Database(db.Name).DependsOn {
+			switch {
+			case !known[dep]:
+				return nil, nil, fmt.Errorf("%s: depends_on unknown database %q", db.Name, dep)
+			case dep == db.Name:
+				return nil, nil, fmt.Errorf("%s: depends_on its own database", db.Name)
+			}
+			if !slices.Contains(dependencies[db.Name], dep) {
+				dependencies[db.Name] = append(dependencies[db.Name], dep)
+			}
+		}
+	}
+	return dependencies, requirements, nil
+}
+
+// orderByDependencies sorts databases so that dependencies migrate up before
+// the databases depending on them (and roll back after them), keeping
+// discovery order otherwise
+func orderByDependencies(databases []types.EncoreDatabase, dependencies map[string][]string, direction string) ([]types.EncoreDatabase, error) {
+	byName := make(map[string]types.EncoreDatabase, len(databases))
+	for _, db := range databases {
+		byName[db.Name] = db
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	marks := make(map[string]int)
+	var ordered []types.EncoreDatabase
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch marks[name] {
+		case done:
+			return nil
+		case visiting:
+			cycle := append(path[slices.Index(path, name):], name)
+			return fmt.Errorf("circular database dependencies: %s", strings.Join(cycle, " -> "))
+		}
+		marks[name] = visiting
+		path = append(path, name)
+		for _, dep := range dependencies[name] {
+			// Databases outside this run are checked, not ordered
+			if _, ok := byName[dep]; ok {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		marks[name] = done
+		ordered = append(ordered, byName[name])
+		return nil
+	}
+
+	for _, db := range databases {
+		if err := visit(db.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	if direction == "down" {
+		slices.Reverse(ordered)
+	}
+	return ordered, nil
+}
+
+// checkRequirements fails unless every database required by the pending
+// migrations is already at the declared minimum version
+func checkRequirements(cmd *cli.Command, project *config.ProjectConfig, migrator *migration.Migrator, connStr string, db types.EncoreDatabase, requirements []migration.Requirement) error {
+	if len(requirements) == 0 {
+		return nil
+	}
+
+	status, err := migrator.GetStatus(connStr, db.MigrationsPath)
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]uint)
+	for _, r := range migration.PendingRequirements(requirements, status.Version) {
+		version, ok := versions[r.Database]
+		if !ok {
+			version, err = databaseVersion(cmd, project, r.Database)
+			if err != nil {
+				return fmt.Errorf("checking requirement %s of %s: %w", r, r.File.Name, err)
+			}
+			versions[r.Database] = version
+		}
+		if version < r.MinVersion {
+			return fmt.Errorf("%s requires %s, but %s is at version %d; migrate %s first", r.File.Name, r, r.Database, version, r.Database)
+		}
+	}
+	return nil
+}
+
+// databaseVersion reads the current schema version of another Encore database
+func databaseVersion(cmd *cli.Command, project *config.ProjectConfig, name string) (uint, error) {
+	db, mapping, err := resolveDatabase(cmd, name)
+	if err != nil {
+		return 0, err
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return 0, err
+	}
+	session, err := sessionOptions(cmd, project, name)
+	if err != nil {
+		return 0, err
+	}
+	status, err := newMigrator(cmd).WithSession(session).GetStatus(connStr, db.MigrationsPath)
+	if err != nil {
+		return 0, err
+	}
+	if status.Dirty {
+		return 0, &types.DirtyStateError{Version: status.Version}
+	}
+	return status.Version, nil
+}
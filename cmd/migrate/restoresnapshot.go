@@ -0,0 +1,245 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/snapshot"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+func restoreSnapshotCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "restore-snapshot",
+		Usage: "Rebuild a database of a non-production environment at the schema of an older release, for debugging regressions",
+		Description: "The version comes from the " + snapshot.FileName + " committed at --tag. The schema is\n" +
+			"rebuilt by replaying the migrations up to that version, or with --schema-from restored from\n" +
+			"the schema snapshot (see state schema) of that environment committed at --tag. --data then\n" +
+			"loads the rows of a pg_dump custom-format backup, e.g. one taken by retire --backup; it\n" +
+			"should come from a database at the same version. Everything in the --target database is\n" +
+			"dropped first, and its schema_migrations version is set to the tag's.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Encore database name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "tag",
+				Usage:    "Git tag or other revision of the release to go back to, e.g. v1.40",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "target",
+				Usage:    "InfraConfig of the environment to rebuild the database in, e.g. dev.json (a bare name like dev means dev.json); production is refused",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "schema-from",
+				Usage: "Restore the schema snapshot this environment had at --tag, e.g. prod, instead of replaying migrations",
+			},
+			&cli.StringFlag{
+				Name:  "data",
+				Usage: "Also load the data of this pg_dump custom-format backup (needs pg_restore on the PATH)",
+			},
+			yesFlag(),
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return restoreSnapshot(ctx, cmd)
+		},
+	}
+}
+
+func restoreSnapshot(ctx context.Context, cmd *cli.Command) error {
+	name, tag := cmd.String("database"), cmd.String("tag")
+	root, err := appRoot(cmd)
+	if err != nil {
+		return err
+	}
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	// Retired databases are allowed: debugging an old release may need them
+	found := discovery.FilterDatabases(databases, name)
+	if len(found) == 0 {
+		return fmt.Errorf("database %q not found", name)
+	}
+	db := found[0]
+
+	data, err := showAtRevision(root, tag, snapshot.FileName)
+	if err != nil {
+		return err
+	}
+	lockfile, err := snapshot.Parse(data, tag+":"+snapshot.FileName)
+	if err != nil {
+		return err
+	}
+	entry, ok := lockfile.Databases[name]
+	if !ok {
+		return fmt.Errorf("%s at %s has no database %q", snapshot.FileName, tag, name)
+	}
+	version := entry.Version
+
+	var schema *snapshot.Schema
+	if env := cmd.String("schema-from"); env != "" {
+		path := filepath.ToSlash(snapshot.SchemaPath(filepath.Join(snapshot.SchemaDir, env), name))
+		data, err := showAtRevision(root, tag, path)
+		if err != nil {
+			return err
+		}
+		if schema, err = snapshot.ParseSchema(data, tag+":"+path); err != nil {
+			return err
+		}
+		if schema.Dirty {
+			return fmt.Errorf("the %s schema snapshot of %q at %s was captured dirty at version %d", env, name, tag, schema.Version)
+		}
+		if schema.Version != version {
+			fmt.Printf("Note: %s was at version %d when its snapshot was captured; %s records %d. Using %d.\n", env, schema.Version, snapshot.FileName, version, schema.Version)
+			version = schema.Version
+		}
+	}
+	// Checked up front: older migrations may have been squashed since the tag
+	steps, err := stepsTo(db.MigrationsPath, version)
+	if schema == nil && err != nil {
+		return fmt.Errorf("%s at %s: %w", name, tag, err)
+	}
+
+	targetPath := cmd.String("target")
+	if filepath.Ext(targetPath) == "" {
+		if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+			targetPath += ".json"
+		}
+	}
+	infraConfig, err := config.LoadInfraConfig(targetPath)
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	if infraConfig.IsProduction() {
+		return fmt.Errorf("refusing to restore into %s: it has metadata.env_type %q", targetPath, config.EnvTypeProduction)
+	}
+	mapping, err := infraConfig.GetMapping(name)
+	if err != nil {
+		return fmt.Errorf("getting config for %q: %w", name, err)
+	}
+	if err := applyConnectionOverrides(cmd, mapping); err != nil {
+		return err
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return fmt.Errorf("building connection string: %w", err)
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	session, err := sessionOptions(cmd, project, name)
+	if err != nil {
+		return err
+	}
+
+	action := fmt.Sprintf("drop everything in %s on %s and rebuild it at %s (version %d)", mapping.PGDBName, serverAddress(mapping), tag, version)
+	if err := confirmDestructive(cmd, action, []string{name}); err != nil {
+		return err
+	}
+
+	store, err := stateStore(cmd)
+	if err != nil {
+		return err
+	}
+	release, err := acquireRunLock(cmd, store, "restore-snapshot")
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	migrator := newMigrator(cmd).WithSession(session)
+	start := time.Now()
+	dropped, err := migrator.DropSchemas(connStr)
+	if err != nil {
+		return fmt.Errorf("emptying %s: %w", mapping.PGDBName, err)
+	}
+	fmt.Printf("Emptied %s (dropped schemas: %s)\n", mapping.PGDBName, strings.Join(dropped, ", "))
+
+	if schema != nil {
+		if err := migrator.RestoreSchema(connStr, schema.SQL); err != nil {
+			return err
+		}
+		fmt.Printf("Restored the %s schema snapshot captured %s\n", cmd.String("schema-from"), schema.CapturedAt.Format(time.RFC3339))
+	} else if version > 0 {
+		result, err := migrator.Up(connStr, db.MigrationsPath, steps)
+		if err != nil {
+			return fmt.Errorf("replaying migrations: %w", err)
+		}
+		fmt.Printf("Replayed %d migrations up to version %d\n", steps, result.VersionAfter)
+	}
+
+	if backup := cmd.String("data"); backup != "" {
+		// The backup carries its own tracking rows; clear ours so they load
+		if err := migrator.ImportTracking(connStr, migration.TrackingState{}, true); err != nil {
+			return err
+		}
+		if err := migration.RestoreData(ctx, mapping, backup); err != nil {
+			return fmt.Errorf("loading data from %s: %w", backup, err)
+		}
+		fmt.Printf("Loaded data from %s\n", backup)
+	}
+	if err := migrator.ImportTracking(connStr, migration.TrackingState{Version: version}, true); err != nil {
+		return err
+	}
+
+	info := migration.RunInfo{
+		RunID:       state.NewRunID(time.Now()),
+		Operator:    operator(),
+		GitSHA:      gitSHA(cmd),
+		ToolVersion: Version,
+	}
+	if _, err := migrator.RecordEvent(connStr, "restore-snapshot", info); err != nil {
+		warn(os.Stderr, warnHistoryNotRecorded, "restore of %q not recorded in its history table: %v", name, err)
+	}
+	fmt.Printf("Rebuilt %q at %s, version %d (took %s)\n", name, tag, version, humanDuration(time.Since(start)))
+	return nil
+}
+
+// showAtRevision returns a file of the app as committed at a git revision
+func showAtRevision(root, revision, path string) ([]byte, error) {
+	// ./ makes the path relative to the app root rather than the repository's
+	out, err := exec.Command("git", "-C", root, "show", revision+":./"+path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s at %s: %w", path, revision, execError(err))
+	}
+	return out, nil
+}
+
+// stepsTo returns how many up migrations lead from an empty database to version
+func stepsTo(migrationsPath string, version uint) (int, error) {
+	files, err := migration.ListFiles(migrationsPath)
+	if err != nil {
+		return 0, err
+	}
+	steps := 0
+	for _, f := range migration.UpFiles(files) {
+		if f.Version > version {
+			break
+		}
+		steps++
+		if f.Version == version {
+			return steps, nil
+		}
+	}
+	if version == 0 {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("no up migration with version %d in %s", version, migrationsPath)
+}
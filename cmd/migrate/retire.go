@@ -0,0 +1,156 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+func retireCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "retire",
+		Usage: "Mark a database of a removed service retired, so up, down and status skip it, optionally after a final backup",
+		Description: "The retirement is recorded on the database's manifest entry when it comes from the manifest,\n" +
+			"else under databases.<name>.retired in the project config, and as a \"retire\" row in the\n" +
+			"database's encore_migrate_history table when the InfraConfig can still reach it.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "database",
+				Aliases:  []string{"d"},
+				Usage:    "Encore database name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "reason",
+				Usage: "Why the database is retired, e.g. the service that was removed",
+			},
+			&cli.StringFlag{
+				Name:  "backup",
+				Usage: "Take a final pg_dump custom-format backup to this file first (needs pg_dump on the PATH)",
+			},
+			&cli.StringFlag{
+				Name:    "ticket",
+				Usage:   "Change ticket recorded in the history table",
+				Sources: cli.EnvVars(envTicket),
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return retireDatabase(ctx, cmd)
+		},
+	}
+}
+
+func retireDatabase(ctx context.Context, cmd *cli.Command) error {
+	name := cmd.String("database")
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	found := discovery.FilterDatabases(databases, name)
+	if len(found) == 0 {
+		return fmt.Errorf("database %q not found", name)
+	}
+	if found[0].Retired {
+		return fmt.Errorf("database %q is already retired", name)
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if err := validateTicket(cmd.String("ticket"), project); err != nil {
+		return err
+	}
+
+	// Where the retirement is recorded: the manifest the database came from,
+	// else the project config, created if there is none
+	path, target := cmd.String("manifest"), config.RenameManifest
+	if path == "" || found[0].SourceFile != path {
+		path, target = cmd.String("project-config"), config.RenameProjectConfig
+		if path == "" {
+			root, err := appRoot(cmd)
+			if err != nil {
+				return err
+			}
+			if path = config.FindProjectConfig(root); path == "" {
+				path = filepath.Join(root, config.DefaultProjectConfigPaths()[0])
+			}
+		}
+	}
+	retirement := config.Retirement{At: time.Now().UTC().Format(time.RFC3339), Reason: cmd.String("reason")}
+
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	mapping, mappingErr := infraConfig.GetMapping(name)
+	if mappingErr == nil {
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+	}
+
+	if backup := cmd.String("backup"); backup != "" {
+		if mappingErr != nil {
+			return fmt.Errorf("cannot back up %q: %w", name, mappingErr)
+		}
+		fmt.Printf("Backing up %s to %s...\n", mapping.PGDBName, backup)
+		start := time.Now()
+		if err := migration.Backup(ctx, mapping, backup); err != nil {
+			return fmt.Errorf("backing up %q: %w", name, err)
+		}
+		if abs, err := filepath.Abs(backup); err == nil {
+			backup = abs
+		}
+		retirement.Backup = backup
+		fmt.Printf("  done (took %s)\n", humanDuration(time.Since(start)))
+	}
+
+	updated, err := config.RetireDatabase(path, target, name, retirement)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(path, updated, mode); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	fmt.Printf("Marked %q retired in %s\n", name, path)
+
+	// The history row is documentation; a database that's already gone
+	// shouldn't keep it from being retired
+	if mappingErr != nil {
+		fmt.Printf("Not recorded in %q's history table: %v\n", name, mappingErr)
+		return nil
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err == nil {
+		var session migration.SessionOptions
+		if session, err = sessionOptions(cmd, project, name); err == nil {
+			info := migration.RunInfo{
+				RunID:       state.NewRunID(time.Now()),
+				Ticket:      cmd.String("ticket"),
+				Operator:    operator(),
+				GitSHA:      gitSHA(cmd),
+				ToolVersion: Version,
+			}
+			var version uint
+			if version, err = newMigrator(cmd).WithSession(session).RecordEvent(connStr, "retire", info); err == nil {
+				fmt.Printf("Recorded the retirement at version %d in %s's history table\n", version, mapping.PGDBName)
+				return nil
+			}
+		}
+	}
+	warn(os.Stderr, warnHistoryNotRecorded, "retirement of %q not recorded in its history table: %v", name, err)
+	return nil
+}
@@ -0,0 +1,273 @@
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func runsCommand() *cli.Command {
+	jsonFlag := func() cli.Flag {
+		return &cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the saved run reports as JSON",
+		}
+	}
+
+	return &cli.Command{
+		Name:  "runs",
+		Usage: "Inspect the reports of past up/down runs saved in the state directory",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "List recent runs, newest first",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "limit",
+						Usage: "Maximum number of runs to show (0 for all)",
+						Value: 20,
+					},
+					jsonFlag(),
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return listRuns(ctx, cmd)
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "Show the per-database outcome of a run",
+				ArgsUsage: "<run-id|latest>",
+				Flags:     []cli.Flag{jsonFlag()},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return showRun(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+func listRuns(ctx context.Context, cmd *cli.Command) error {
+	store, err := stateStore(cmd)
+	if err != nil {
+		return err
+	}
+	runs, err := store.ListRuns()
+	if err != nil {
+		return err
+	}
+	if limit := int(cmd.Int("limit")); limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	if cmd.Bool("json") {
+		if runs == nil {
+			runs = []*state.Run{}
+		}
+		return encodeJSON(os.Stdout, runs)
+	}
+
+	if len(runs) == 0 {
+		fmt.Printf("No runs recorded in %s\n", store.Dir())
+		return nil
+	}
+
+	fmt.Printf("%-24s %-5s %-36s %-10s %s\n", "RUN ID", "DIR", "STARTED", "DURATION", "RESULT")
+	fmt.Println(strings.Repeat("-", 96))
+	now := time.Now()
+	for _, run := range runs {
+		started := fmt.Sprintf("%s (%s)", run.StartedAt.Local().Format("2006-01-02 15:04:05"), relativeTime(run.StartedAt, now))
+		fmt.Printf("%-24s %-5s %-36s %-10s %s\n", run.ID, run.Direction, started, runDuration(run), runSummary(run))
+	}
+	return nil
+}
+
+func showRun(ctx context.Context, cmd *cli.Command) error {
+	id := cmd.Args().First()
+	if id == "" {
+		return fmt.Errorf("usage: runs show <run-id|latest>")
+	}
+
+	store, err := stateStore(cmd)
+	if err != nil {
+		return err
+	}
+
+	var run *state.Run
+	if id == "latest" {
+		runs, err := store.ListRuns()
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return fmt.Errorf("no runs recorded in %s", store.Dir())
+		}
+		run = runs[0]
+	} else if run, err = store.LoadRun(id); err != nil {
+		return err
+	}
+
+	if cmd.Bool("json") {
+		return encodeJSON(os.Stdout, run)
+	}
+
+	fmt.Printf("Run:       %s\n", run.ID)
+	fmt.Printf("Direction: %s\n", run.Direction)
+	if run.Ticket != "" {
+		fmt.Printf("Ticket:    %s\n", run.Ticket)
+	}
+	now := time.Now()
+	fmt.Printf("Started:   %s (%s)\n", run.StartedAt.Local().Format(time.RFC3339), relativeTime(run.StartedAt, now))
+	if run.FinishedAt != nil {
+		fmt.Printf("Finished:  %s (%s, took %s)\n", run.FinishedAt.Local().Format(time.RFC3339), relativeTime(*run.FinishedAt, now), runDuration(run))
+	} else {
+		fmt.Printf("Finished:  no (interrupted or still running; resume with %s --resume %s)\n", run.Direction, run.ID)
+	}
+	fmt.Printf("Result:    %s\n\n", runSummary(run))
+
+	fmt.Printf("%-20s %-11s %-15s %s\n", "DATABASE", "STATUS", "VERSION", "ERROR")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, db := range run.Databases {
+		version := fmt.Sprintf("%d -> %d", db.VersionBefore, db.VersionAfter)
+		if db.Status != state.StatusCompleted && db.Status != state.StatusRolledBack && db.Status != state.StatusPaused {
+			version = "-"
+		}
+		fmt.Printf("%-20s %-11s %-15s %s\n", db.Name, db.Status, version, db.Error)
+	}
+
+	// State captured when databases failed
+	for _, db := range run.Databases {
+		if db.State == nil {
+			continue
+		}
+		dirty := "no"
+		if db.State.Dirty {
+			dirty = "YES"
+		}
+		fmt.Printf("\n%s after failure: version %d, dirty: %s, %d pending\n", db.Name, db.State.Version, dirty, len(db.State.PendingFiles))
+		for _, name := range db.State.PendingFiles {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+
+	// Statements skipped with --skip-failed-statement
+	for _, db := range run.Databases {
+		for _, st := range db.Statements {
+			if st.Skipped != "" {
+				fmt.Printf("\nWARNING: %s skipped failed statement %s:%d: %s\n  %s\n", db.Name, st.File, st.Line, st.SQL, st.Skipped)
+			}
+		}
+	}
+
+	// Timings recorded in per-statement mode
+	for _, db := range run.Databases {
+		if len(db.Statements) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s slowest statements:\n", db.Name)
+		printStatementTimings(os.Stdout, db.Statements, slowestInRunShow)
+	}
+	return nil
+}
+
+// How many of the slowest statements are printed after a database migrates
+// and by runs show
+const (
+	slowestInProgress = 3
+	slowestInRunShow  = 10
+)
+
+// statementTimings converts the migrator's timings for the run record
+func statementTimings(timings []types.StatementTiming) []state.Statement {
+	var statements []state.Statement
+	for _, t := range timings {
+		statements = append(statements, state.Statement{
+			File:       t.File,
+			Line:       t.Line,
+			SQL:        t.SQL,
+			DurationMS: t.Duration.Milliseconds(),
+			Skipped:    t.Skipped,
+		})
+	}
+	return statements
+}
+
+// printStatementTimings prints up to limit statements, slowest first
+func printStatementTimings(w io.Writer, statements []state.Statement, limit int) {
+	sorted := slices.Clone(statements)
+	slices.SortStableFunc(sorted, func(a, b state.Statement) int {
+		return cmp.Compare(b.DurationMS, a.DurationMS)
+	})
+	for i, st := range sorted {
+		if i == limit {
+			fmt.Fprintf(w, "    ... %d more\n", len(sorted)-i)
+			break
+		}
+		duration := time.Duration(st.DurationMS) * time.Millisecond
+		fmt.Fprintf(w, "    %8s  %s:%d  %s\n", humanDuration(duration), st.File, st.Line, st.SQL)
+	}
+}
+
+// runDuration formats how long a run took, or "-" if it never finished
+func runDuration(run *state.Run) string {
+	if run.FinishedAt == nil {
+		return "-"
+	}
+	return humanDuration(run.FinishedAt.Sub(run.StartedAt))
+}
+
+// runSummary counts the databases of a run by status, e.g. "2 completed, 1 failed"
+func runSummary(run *state.Run) string {
+	counts := make(map[state.DatabaseStatus]int)
+	for _, db := range run.Databases {
+		counts[db.Status]++
+	}
+
+	var parts []string
+	for _, status := range []state.DatabaseStatus{state.StatusCompleted, state.StatusFailed, state.StatusRolledBack, state.StatusPaused, state.StatusCancelled, state.StatusSkipped, state.StatusPending} {
+		if n := counts[status]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, status))
+		}
+	}
+	if len(parts) == 0 {
+		return "no databases"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pruneRuns applies the project config's run retention. Failures only warn.
+func pruneRuns(store *state.Store, project *config.ProjectConfig) {
+	keep := project.Runs.Keep
+	if keep == 0 {
+		keep = config.DefaultKeepRuns
+	}
+
+	var olderThan time.Time
+	if project.Runs.MaxAge != "" {
+		maxAge, err := time.ParseDuration(project.Runs.MaxAge)
+		if err != nil {
+			slog.Warn("ignoring invalid runs.max_age", "value", project.Runs.MaxAge, "error", err)
+		} else {
+			olderThan = time.Now().Add(-maxAge)
+		}
+	}
+
+	pruned, err := store.PruneRuns(keep, olderThan)
+	if err != nil {
+		slog.Warn("failed to prune run history", "error", err)
+	}
+	if len(pruned) > 0 {
+		slog.Debug("pruned run history", "runs", pruned)
+	}
+}
@@ -0,0 +1,210 @@
+package migrate
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// outputMu serializes progress lines of databases migrating in parallel
+var outputMu sync.Mutex
+
+// Scheduling states of a database within a run
+const (
+	dbPending = iota
+	dbRunning
+	dbSucceeded
+	dbFailed
+)
+
+// schedule runs fn for the databases in order, starting each once the
+// databases in after have succeeded and those in waitFor have finished either
+// way, with up to parallel running at once. ordered must be a topological order
+// of both. A database whose prerequisite failed is not run; skip is called with
+// the failed prerequisite instead. A non-nil error from fn stops new work and
+// is returned once running work ends.
+func schedule(ordered []types.EncoreDatabase, after, waitFor map[string][]string, parallel int, fn func(types.EncoreDatabase) (bool, error), skip func(db types.EncoreDatabase, failedDep string)) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	type outcome struct {
+		name string
+		ok   bool
+		err  error
+	}
+	done := make(chan outcome)
+	states := make(map[string]int, len(ordered))
+	active := 0
+	var fatal error
+
+	for {
+		for _, db := range ordered {
+			if fatal != nil || active >= parallel {
+				break
+			}
+			if states[db.Name] != dbPending {
+				continue
+			}
+
+			ready, failedDep := true, ""
+			for _, dep := range after[db.Name] {
+				switch states[dep] {
+				case dbSucceeded:
+				case dbFailed:
+					failedDep = dep
+				default:
+					ready = false
+				}
+			}
+			for _, dep := range waitFor[db.Name] {
+				if states[dep] != dbSucceeded && states[dep] != dbFailed {
+					ready = false
+				}
+			}
+			if failedDep != "" {
+				// Later databases in ordered see this failure in the same pass
+				states[db.Name] = dbFailed
+				skip(db, failedDep)
+				continue
+			}
+			if !ready {
+				continue
+			}
+
+			states[db.Name] = dbRunning
+			active++
+			go func(db types.EncoreDatabase) {
+				ok, err := fn(db)
+				done <- outcome{db.Name, ok, err}
+			}(db)
+		}
+
+		if active == 0 {
+			return fatal
+		}
+
+		o := <-done
+		active--
+		if o.err != nil && fatal == nil {
+			fatal = o.err
+		}
+		if o.ok && o.err == nil {
+			states[o.name] = dbSucceeded
+		} else {
+			states[o.name] = dbFailed
+		}
+	}
+}
+
+// runAfter returns, for each database in a run, the databases that must finish
+// first: its dependencies going up, its dependents going down
+func runAfter(databases []types.EncoreDatabase, dependencies map[string][]string, direction string) map[string][]string {
+	inRun := make(map[string]bool, len(databases))
+	for _, db := range databases {
+		inRun[db.Name] = true
+	}
+
+	after := make(map[string][]string)
+	for _, db := range databases {
+		for _, dep := range dependencies[db.Name] {
+			if !inRun[dep] {
+				continue
+			}
+			if direction == "down" {
+				after[dep] = append(after[dep], db.Name)
+			} else {
+				after[db.Name] = append(after[db.Name], dep)
+			}
+		}
+	}
+	return after
+}
+
+// prefixWriter prefixes every line with a label, so output of databases
+// migrating in parallel stays attributable. Writers sharing mu never interleave
+// within a write.
+type prefixWriter struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	prefix  []byte
+	midLine bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !p.midLine {
+			buf.Write(p.prefix)
+		}
+		buf.Write(line)
+		p.midLine = line[len(line)-1] != '\n'
+	}
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// effectivePriorities returns each database's priority from the project
+// config, raised to the priority of any database depending on it so a
+// dependency never waits behind a later priority group
+func effectivePriorities(project *config.ProjectConfig, databases []types.EncoreDatabase, dependencies map[string][]string) map[string]int {
+	priorities := make(map[string]int, len(databases))
+	for _, db := range databases {
+		priorities[db.Name] = project.Database(db.Name).Priority
+	}
+
+	// Each round raises priorities by at least one dependency edge; cycles are reported by orderByDependencies
+	for range databases {
+		changed := false
+		for _, db := range databases {
+			for _, dep := range dependencies[db.Name] {
+				if p, ok := priorities[dep]; ok && p < priorities[db.Name] {
+					priorities[dep] = priorities[db.Name]
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return priorities
+}
+
+// sortByPriority orders databases by descending priority, keeping discovery order within a priority
+func sortByPriority(databases []types.EncoreDatabase, priorities map[string]int) {
+	slices.SortStableFunc(databases, func(a, b types.EncoreDatabase) int {
+		return cmp.Compare(priorities[b.Name], priorities[a.Name])
+	})
+}
+
+// priorityBarriers returns, for each database, the databases of the priority
+// groups that run before its own: higher priorities going up, lower going down
+func priorityBarriers(databases []types.EncoreDatabase, priorities map[string]int, direction string) map[string][]string {
+	barriers := make(map[string][]string)
+	for _, db := range databases {
+		for _, other := range databases {
+			earlier := priorities[other.Name] > priorities[db.Name]
+			if direction == "down" {
+				earlier = priorities[other.Name] < priorities[db.Name]
+			}
+			if earlier {
+				barriers[db.Name] = append(barriers[db.Name], other.Name)
+			}
+		}
+	}
+	return barriers
+}
@@ -0,0 +1,195 @@
+package migrate
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// testDatabases are Encore databases with the given names, in order
+func testDatabases(names ...string) []types.EncoreDatabase {
+	databases := make([]types.EncoreDatabase, len(names))
+	for i, name := range names {
+		databases[i] = types.EncoreDatabase{Name: name}
+	}
+	return databases
+}
+
+// recorder is a fake schedule fn recording the databases it ran
+type recorder struct {
+	mu   sync.Mutex
+	ran  []string
+	fail map[string]bool  // databases reported failed
+	errs map[string]error // databases returning a fatal error
+}
+
+func (r *recorder) fn(db types.EncoreDatabase) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran = append(r.ran, db.Name)
+	return !r.fail[db.Name], r.errs[db.Name]
+}
+
+func TestScheduleOrder(t *testing.T) {
+	r := &recorder{}
+	after := map[string][]string{"orders": {"users"}, "billing": {"orders"}}
+	err := schedule(testDatabases("users", "orders", "billing"), after, nil, 1, r.fn, func(types.EncoreDatabase, string) {
+		t.Error("skip called without a failure")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"users", "orders", "billing"}; !slices.Equal(r.ran, want) {
+		t.Errorf("ran %v, want %v", r.ran, want)
+	}
+}
+
+func TestScheduleSkipsDependentsOfFailures(t *testing.T) {
+	r := &recorder{fail: map[string]bool{"users": true}}
+	// orders needs users, billing needs orders; audit only waits for users
+	after := map[string][]string{"orders": {"users"}, "billing": {"orders"}}
+	waitFor := map[string][]string{"audit": {"users"}}
+	skipped := map[string]string{}
+	err := schedule(testDatabases("users", "orders", "billing", "audit", "search"), after, waitFor, 1, r.fn, func(db types.EncoreDatabase, failedDep string) {
+		skipped[db.Name] = failedDep
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"users", "audit", "search"}; !slices.Equal(r.ran, want) {
+		t.Errorf("ran %v, want %v", r.ran, want)
+	}
+	if want := map[string]string{"orders": "users", "billing": "orders"}; !maps.Equal(skipped, want) {
+		t.Errorf("skipped %v, want %v", skipped, want)
+	}
+}
+
+func TestScheduleStopsAfterFatalError(t *testing.T) {
+	fatal := errors.New("lost connection")
+	r := &recorder{errs: map[string]error{"users": fatal}}
+	err := schedule(testDatabases("users", "orders", "billing"), nil, nil, 1, r.fn, func(types.EncoreDatabase, string) {})
+	if !errors.Is(err, fatal) {
+		t.Fatalf("schedule returned %v, want %v", err, fatal)
+	}
+	if want := []string{"users"}; !slices.Equal(r.ran, want) {
+		t.Errorf("ran %v, want %v: pending databases must not start after a fatal error", r.ran, want)
+	}
+}
+
+func TestScheduleFatalErrorWaitsForRunningWork(t *testing.T) {
+	fatal := errors.New("lost connection")
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var ran []string
+	slowFinished := false
+	fn := func(db types.EncoreDatabase) (bool, error) {
+		mu.Lock()
+		ran = append(ran, db.Name)
+		mu.Unlock()
+		switch db.Name {
+		case "slow":
+			<-release
+			mu.Lock()
+			slowFinished = true
+			mu.Unlock()
+			return true, nil
+		case "broken":
+			// slow finishes only after schedule has seen this error
+			time.AfterFunc(20*time.Millisecond, func() { close(release) })
+			return false, fatal
+		}
+		return true, nil
+	}
+	err := schedule(testDatabases("slow", "broken", "pending"), nil, nil, 2, fn, func(types.EncoreDatabase, string) {})
+	if !errors.Is(err, fatal) {
+		t.Fatalf("schedule returned %v, want %v", err, fatal)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slowFinished {
+		t.Error("schedule returned while a database was still running")
+	}
+	if slices.Contains(ran, "pending") {
+		t.Errorf("ran %v: pending started after the fatal error", ran)
+	}
+}
+
+func TestScheduleParallelLimit(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	fn := func(types.EncoreDatabase) (bool, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return true, nil
+	}
+	if err := schedule(testDatabases("a", "b", "c", "d", "e", "f"), nil, nil, 2, fn, func(types.EncoreDatabase, string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if peak != 2 {
+		t.Errorf("peak concurrency %d, want 2", peak)
+	}
+}
+
+func TestRunAfter(t *testing.T) {
+	databases := testDatabases("users", "orders", "billing")
+	// external is not part of the run and must not be waited for
+	dependencies := map[string][]string{"orders": {"users", "external"}, "billing": {"orders"}}
+	tests := []struct {
+		direction string
+		want      map[string][]string
+	}{
+		{"up", map[string][]string{"orders": {"users"}, "billing": {"orders"}}},
+		{"down", map[string][]string{"users": {"orders"}, "orders": {"billing"}}},
+	}
+	for _, tt := range tests {
+		got := runAfter(databases, dependencies, tt.direction)
+		if !maps.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("runAfter(%s) = %v, want %v", tt.direction, got, tt.want)
+		}
+	}
+}
+
+func TestEffectivePriorities(t *testing.T) {
+	project := &config.ProjectConfig{Databases: map[string]config.ProjectDatabase{
+		"orders": {Priority: 10},
+		"audit":  {Priority: -5},
+	}}
+	databases := testDatabases("users", "orders", "billing", "audit")
+	// orders depends on users, users on billing: both are raised to 10
+	dependencies := map[string][]string{"orders": {"users"}, "users": {"billing"}}
+	got := effectivePriorities(project, databases, dependencies)
+	want := map[string]int{"users": 10, "orders": 10, "billing": 10, "audit": -5}
+	if !maps.Equal(got, want) {
+		t.Errorf("effectivePriorities = %v, want %v", got, want)
+	}
+}
+
+func TestPriorityBarriers(t *testing.T) {
+	databases := testDatabases("high", "mid", "low")
+	priorities := map[string]int{"high": 2, "mid": 1, "low": 0}
+	tests := []struct {
+		direction string
+		want      map[string][]string
+	}{
+		{"up", map[string][]string{"mid": {"high"}, "low": {"high", "mid"}}},
+		{"down", map[string][]string{"high": {"mid", "low"}, "mid": {"low"}}},
+	}
+	for _, tt := range tests {
+		got := priorityBarriers(databases, priorities, tt.direction)
+		if !maps.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("priorityBarriers(%s) = %v, want %v", tt.direction, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/snapshot"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func stateSchemaCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "schema",
+		Usage: "Capture the schema and migration version of each database in the InfraConfig's environment, for simulate",
+		Description: "Runs pg_dump --schema-only against every database (it must be on the PATH) and writes\n" +
+			"<dir>/<database>.sql with the version the database was at. Only the schema is read;\n" +
+			"no data leaves the server. Commit the files, or keep them as a CI artifact, and\n" +
+			"refresh them after each deploy.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name (default: all)",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "Directory to write (default: <app>/" + snapshot.SchemaDir + "/<InfraConfig file name>)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return captureSchemas(ctx, cmd)
+		},
+	}
+}
+
+func simulateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "simulate",
+		Usage: "Restore an environment's schema snapshots into a scratch Postgres and apply the pending migrations there",
+		Description: "Answers \"will the upgrade of this environment work\" without connecting to it: the\n" +
+			"schema snapshots taken with `state schema --config <file>` are restored into fresh\n" +
+			"databases, their recorded versions are set, and up runs against them. The --config\n" +
+			"InfraConfig only picks the snapshots and tells which databases the environment has;\n" +
+			"a database it lacks is simulated from empty, as its first deploy would create it.\n" +
+			"Snapshots hold no data, so migrations that depend on existing rows can still fail\n" +
+			"in the real environment. Without --dsn a Postgres container is started with the\n" +
+			"docker CLI and removed afterwards; use --image to match the environment's version.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name (default: all)",
+			},
+			&cli.StringFlag{
+				Name:  "snapshots",
+				Usage: "Schema snapshot directory (default: <app>/" + snapshot.SchemaDir + "/<InfraConfig file name>)",
+			},
+			&cli.StringFlag{
+				Name:  "dsn",
+				Usage: "Admin connection URL of an existing scratch server to use instead of a container",
+			},
+			&cli.StringFlag{
+				Name:  "image",
+				Usage: "Postgres image to start when --dsn is not given",
+				Value: "postgres:16-alpine",
+			},
+			&cli.BoolFlag{
+				Name:  "keep",
+				Usage: "Keep the container and the simulated databases for inspection",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return simulate(ctx, cmd)
+		},
+	}
+}
+
+// schemaDir returns the schema snapshot directory of the InfraConfig's
+// environment: flag if set, else under the app root
+func schemaDir(cmd *cli.Command, flag string) (string, error) {
+	if dir := cmd.String(flag); dir != "" {
+		return dir, nil
+	}
+	root, err := appRoot(cmd)
+	if err != nil {
+		return "", err
+	}
+	return snapshot.EnvironmentDir(filepath.Join(root, snapshot.SchemaDir), cmd.String("config")), nil
+}
+
+// targetDatabases discovers the databases, narrowed by --database, without
+// retired ones
+func targetDatabases(cmd *cli.Command) ([]types.EncoreDatabase, error) {
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if name := cmd.String("database"); name != "" {
+		if databases = discovery.FilterDatabases(databases, name); len(databases) == 0 {
+			return nil, fmt.Errorf("database %q not found", name)
+		}
+	}
+	if databases, err = activeDatabases(cmd, databases); err != nil {
+		return nil, err
+	}
+	if len(databases) == 0 {
+		return nil, fmt.Errorf("no databases found")
+	}
+	return databases, nil
+}
+
+func captureSchemas(ctx context.Context, cmd *cli.Command) error {
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	databases, err := targetDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dir, err := schemaDir(cmd, "out")
+	if err != nil {
+		return err
+	}
+
+	migrator := newMigrator(cmd)
+	captured := 0
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			warn(os.Stderr, warnNoConfig, "skipping %q: %v", db.Name, err)
+			continue
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+		connStr, err := migration.BuildConnectionString(mapping)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		session, err := sessionOptions(cmd, project, db.Name)
+		if err != nil {
+			return err
+		}
+
+		// The version is read first: a migration finishing during the dump
+		// then makes the snapshot look behind, which simulate tolerates
+		status, err := migrator.WithSession(session).GetStatus(connStr, db.MigrationsPath)
+		if err != nil {
+			return fmt.Errorf("reading the version of %s: %w", db.Name, err)
+		}
+		dump, err := migration.DumpSchema(ctx, mapping)
+		if err != nil {
+			return fmt.Errorf("dumping %s: %w", db.Name, err)
+		}
+		schema := &snapshot.Schema{Database: db.Name, Version: status.Version, Dirty: status.Dirty, CapturedAt: time.Now(), SQL: dump}
+		path := snapshot.SchemaPath(dir, db.Name)
+		if err := schema.Write(path); err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		fmt.Printf("Captured %s at version %d to %s\n", db.Name, status.Version, path)
+		captured++
+	}
+	if captured == 0 {
+		return fmt.Errorf("no database schema captured")
+	}
+	return nil
+}
+
+// simulatedDatabase is a database of the app with the snapshot it starts
+// from, nil when the environment doesn't have it yet
+type simulatedDatabase struct {
+	db     types.EncoreDatabase
+	schema *snapshot.Schema
+}
+
+func simulate(ctx context.Context, cmd *cli.Command) error {
+	out := progressOutput(cmd)
+
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	databases, err := targetDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	dir, err := schemaDir(cmd, "snapshots")
+	if err != nil {
+		return err
+	}
+
+	// Every snapshot is loaded before a container is started, so a missing
+	// one fails fast
+	var simulated []simulatedDatabase
+	for _, db := range databases {
+		schema, err := snapshot.LoadSchema(snapshot.SchemaPath(dir, db.Name))
+		if err != nil {
+			return err
+		}
+		if schema == nil {
+			if _, err := infraConfig.GetMapping(db.Name); err == nil {
+				return fmt.Errorf("no schema snapshot of %q in %s; capture one with `state schema --config %s`", db.Name, dir, cmd.String("config"))
+			}
+			fmt.Fprintf(out, "%q is not in %s; simulating it as a new database\n", db.Name, cmd.String("config"))
+		}
+		simulated = append(simulated, simulatedDatabase{db: db, schema: schema})
+	}
+
+	run := &selftestRun{out: out, render: outputRenderer(cmd), report: selftestReport{SchemaVersion: reportSchemaVersion, Steps: []selftestStep{}, title: "Simulation"}}
+	migrator := newMigrator(cmd)
+
+	dsn := cmd.String("dsn")
+	if dsn == "" {
+		var stop func()
+		ok := run.step("postgres", func() (string, error) {
+			var err error
+			dsn, stop, err = startPostgres(ctx, cmd.String("image"))
+			if err != nil {
+				return "", err
+			}
+			return "started " + cmd.String("image"), waitForPostgres(ctx, migrator, dsn)
+		})
+		if stop != nil && !cmd.Bool("keep") {
+			defer stop()
+		}
+		if !ok {
+			return finishSimulate(run)
+		}
+	} else if !run.step("connect", func() (string, error) {
+		info, err := migrator.Ping(dsn)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s:%d", info.Addr, info.Port), nil
+	}) {
+		return finishSimulate(run)
+	}
+
+	suffix := strings.ToLower(state.NewRunID(time.Now())[len("20060102T150405Z-"):])
+	for _, sim := range simulated {
+		name := sim.db.Name
+		pgName := fmt.Sprintf("simulate_%s_%s", name, suffix)
+		connStr, err := withDatabase(dsn, pgName)
+		if err != nil {
+			return err
+		}
+		session, err := sessionOptions(cmd, project, name)
+		if err != nil {
+			return err
+		}
+		if cmd.Bool("keep") {
+			fmt.Fprintf(out, "Keeping %s as %s\n", name, connStr)
+		} else {
+			defer func() {
+				if err := migrator.DropDatabase(dsn, pgName); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}()
+		}
+
+		// A failed database doesn't stop the others: the report should list
+		// everything that would fail in the environment
+		if !run.step("restore", func() (string, error) {
+			if _, err := migrator.EnsureDatabase(dsn, connStr, migration.Provision{Database: pgName, Role: adminUser(dsn)}); err != nil {
+				return "", err
+			}
+			if sim.schema == nil {
+				return name + ": new database", nil
+			}
+			if err := migrator.RestoreSchema(connStr, sim.schema.SQL); err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			tracking := migration.TrackingState{Version: sim.schema.Version, Dirty: sim.schema.Dirty}
+			if err := migrator.WithSession(session).ImportTracking(connStr, tracking, false); err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			return fmt.Sprintf("%s: version %d, captured %s", name, sim.schema.Version, sim.schema.CapturedAt.Format(time.RFC3339)), nil
+		}) {
+			continue
+		}
+		run.step("up", func() (string, error) {
+			result, err := migrator.WithSession(session).Up(connStr, sim.db.MigrationsPath, 0)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			if result.VersionAfter == result.VersionBefore {
+				return fmt.Sprintf("%s: nothing pending at version %d", name, result.VersionAfter), nil
+			}
+			return fmt.Sprintf("%s: %d → %d", name, result.VersionBefore, result.VersionAfter), nil
+		})
+	}
+
+	run.report.Passed = true
+	return finishSimulate(run)
+}
+
+// finishSimulate prints the report and fails the command unless every step
+// passed
+func finishSimulate(run *selftestRun) error {
+	var failed []string
+	for _, s := range run.report.Steps {
+		if !s.OK {
+			failed = append(failed, s.Name)
+		}
+	}
+	if len(failed) > 0 {
+		run.report.Passed = false
+	}
+
+	if err := run.render.report(os.Stdout, run.report); err != nil {
+		return err
+	}
+
+	if !run.report.Passed {
+		return fmt.Errorf("simulation failed (%d failed steps: %s)", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
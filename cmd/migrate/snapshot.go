@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/snapshot"
+)
+
+func stateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "state",
+		Usage: "Maintain the committed migration lockfile (" + snapshot.FileName + ") and schema snapshots, and move tracking state between databases",
+		Commands: []*cli.Command{
+			{
+				Name:  "snapshot",
+				Usage: "Record the latest migration version of every database in the lockfile",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Lockfile path (default: <app>/" + snapshot.FileName + ")",
+					},
+					&cli.BoolFlag{
+						Name:  "check",
+						Usage: "Fail instead of writing if the lockfile is missing or out of date (for CI)",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return snapshotState(ctx, cmd)
+				},
+			},
+			stateExportCommand(),
+			stateImportCommand(),
+			stateSchemaCommand(),
+		},
+	}
+}
+
+func snapshotState(ctx context.Context, cmd *cli.Command) error {
+	path := cmd.String("out")
+	if path == "" {
+		root, err := appRoot(cmd)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(root, snapshot.FileName)
+	}
+
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	current, err := snapshot.Build(databases)
+	if err != nil {
+		return err
+	}
+
+	committed, err := snapshot.Load(path)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Bool("check") {
+		if committed == nil {
+			return fmt.Errorf("%s not found; run `encore-migrator state snapshot` and commit it", path)
+		}
+		diff := snapshot.Diff(committed, current)
+		if len(diff) == 0 {
+			fmt.Printf("%s is up to date (%d databases)\n", path, len(current.Databases))
+			return nil
+		}
+		fmt.Printf("Migrations changed since %s was written:\n", path)
+		for _, line := range diff {
+			fmt.Printf("  %s\n", line)
+		}
+		return fmt.Errorf("lockfile out of date; run `encore-migrator state snapshot` and commit the result")
+	}
+
+	if committed != nil {
+		for _, line := range snapshot.Diff(committed, current) {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	if err := current.Write(path); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s (%d databases)\n", path, len(current.Databases))
+	return nil
+}
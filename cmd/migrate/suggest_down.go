@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func suggestDownCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "suggest-down",
+		Usage: "Draft down files for databases whose migrations have none, with TODOs for statements that can't be inverted",
+		Description: "Each up file is parsed and its simple statements inverted in reverse order. Statements that\n" +
+			"can't be inverted become TODO comments, marked IRREVERSIBLE when they destroy data. Databases\n" +
+			"that already have down files are skipped; draft single files with create --with-down-from up.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Only this Encore database",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the drafts instead of writing them",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return suggestDown(ctx, cmd)
+		},
+	}
+}
+
+func suggestDown(ctx context.Context, cmd *cli.Command) error {
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	if target := cmd.String("database"); target != "" {
+		databases = discovery.FilterDatabases(databases, target)
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found", target)
+		}
+	}
+	dryRun := cmd.Bool("dry-run")
+	if !dryRun {
+		if err := requireAppDirectory("write down files (use --dry-run)"); err != nil {
+			return err
+		}
+	}
+
+	for _, db := range databases {
+		files, err := migration.ListFiles(db.MigrationsPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		up := migration.UpFiles(files)
+		if len(up) < len(files) {
+			fmt.Printf("%s: skipped, already has down files\n", db.Name)
+			continue
+		}
+		if len(up) == 0 {
+			fmt.Printf("%s: no migrations\n", db.Name)
+			continue
+		}
+
+		drafted, withTODOs, todos := 0, 0, 0
+		for _, f := range up {
+			content, err := os.ReadFile(f.Path)
+			if err != nil {
+				return fmt.Errorf("%s: reading %s: %w", db.Name, f.Name, err)
+			}
+			down, todo := migration.DownFromUp(f.Name, string(content))
+			if todo > 0 {
+				withTODOs++
+				todos += todo
+			}
+
+			path := downPath(db.MigrationsPath, f)
+			if dryRun {
+				fmt.Printf("==> %s <==\n%s\n", path, down)
+				continue
+			}
+			if err := os.WriteFile(path, []byte(down), 0644); err != nil {
+				return fmt.Errorf("%s: writing %s: %w", db.Name, path, err)
+			}
+			drafted++
+		}
+
+		if dryRun {
+			fmt.Printf("%s: %d drafts, %d with TODOs (%d statements)\n\n", db.Name, len(up), withTODOs, todos)
+		} else {
+			fmt.Printf("%s: wrote %d down files, %d with TODOs (%d statements)\n", db.Name, drafted, withTODOs, todos)
+		}
+	}
+	return nil
+}
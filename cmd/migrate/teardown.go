@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func teardownCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "teardown",
+		Usage: "Drop the databases (or their schemas) of an ephemeral environment; refuses production-labelled configs",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name to tear down (default: all)",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "What to drop: database, or schema to empty the database but keep it",
+				Value: "database",
+			},
+			&cli.StringFlag{
+				Name:  "maintenance-db",
+				Usage: "Database the admin connects to for dropping databases",
+				Value: "postgres",
+			},
+			&cli.BoolFlag{
+				Name:  "yes",
+				Usage: "Confirm the teardown; without it only the plan is printed",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-unlabeled",
+				Usage: "Allow InfraConfigs without metadata.env_type",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return teardown(ctx, cmd)
+		},
+	}
+}
+
+func teardown(ctx context.Context, cmd *cli.Command) error {
+	mode := cmd.String("mode")
+	if mode != "database" && mode != "schema" {
+		return fmt.Errorf("unknown mode %q: expected database or schema", mode)
+	}
+
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if err := checkTeardownAllowed(cmd, infraConfig); err != nil {
+		return err
+	}
+
+	if targetDB := cmd.String("database"); targetDB != "" {
+		databases = discovery.FilterDatabases(databases, targetDB)
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found", targetDB)
+		}
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+
+	mappings := make(map[string]*types.DatabaseMapping)
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+		mappings[db.Name] = adminMapping(cmd, mapping)
+	}
+
+	envName := "(unlabeled)"
+	if infraConfig.Metadata != nil && infraConfig.Metadata.EnvName != "" {
+		envName = infraConfig.Metadata.EnvName
+	}
+	fmt.Printf("Teardown of environment %s (%s mode):\n", envName, mode)
+	for _, db := range databases {
+		m := mappings[db.Name]
+		fmt.Printf("  %-20s %s on %s\n", db.Name, m.PGDBName, serverAddress(m))
+	}
+
+	if !cmd.Bool("yes") {
+		fmt.Printf("\nNothing dropped. Re-run with --yes to proceed.\n")
+		return nil
+	}
+
+	migrator := newMigrator(cmd)
+	for _, db := range databases {
+		m := mappings[db.Name]
+		if err := dropDatabase(cmd, migrator, m, mode); err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		fmt.Printf("  %s: dropped\n", db.Name)
+	}
+
+	return nil
+}
+
+// checkTeardownAllowed refuses production environments and, unless allowed, unlabeled ones
+func checkTeardownAllowed(cmd *cli.Command, infraConfig *config.InfraConfig) error {
+	if infraConfig.IsProduction() {
+		return fmt.Errorf("refusing to tear down: %s has metadata.env_type %q", cmd.String("config"), config.EnvTypeProduction)
+	}
+	if (infraConfig.Metadata == nil || infraConfig.Metadata.EnvType == "") && !cmd.Bool("allow-unlabeled") {
+		return fmt.Errorf("refusing to tear down: %s has no metadata.env_type; pass --allow-unlabeled if it is not production", cmd.String("config"))
+	}
+	return nil
+}
+
+func dropDatabase(cmd *cli.Command, migrator *migration.Migrator, mapping *types.DatabaseMapping, mode string) error {
+	if mode == "schema" {
+		connStr, err := migration.BuildConnectionString(mapping)
+		if err != nil {
+			return err
+		}
+		_, err = migrator.DropSchemas(connStr)
+		return err
+	}
+
+	maintenance := *mapping
+	maintenance.PGDBName = cmd.String("maintenance-db")
+	connStr, err := migration.BuildConnectionString(&maintenance)
+	if err != nil {
+		return err
+	}
+	return migrator.DropDatabase(connStr, mapping.PGDBName)
+}
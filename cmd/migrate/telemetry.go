@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/telemetry"
+)
+
+// Root command metadata keys used to build the usage event
+const (
+	metaCommand   = "telemetry.command"
+	metaStarted   = "telemetry.started"
+	metaDatabases = "telemetry.databases"
+)
+
+func telemetryCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "telemetry",
+		Usage: "Inspect opt-in anonymous usage telemetry",
+		Commands: []*cli.Command{
+			{
+				Name:  "status",
+				Usage: "Show whether telemetry is enabled and exactly what would be sent",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return telemetryStatus(ctx, cmd)
+				},
+			},
+		},
+	}
+}
+
+func telemetryStatus(ctx context.Context, cmd *cli.Command) error {
+	settings := usageSettings(cmd)
+
+	state := "disabled"
+	if settings.Enabled {
+		state = "enabled"
+	}
+	fmt.Printf("Telemetry: %s (%s)\n", state, settings.Reason)
+	if settings.Endpoint != "" {
+		fmt.Printf("Endpoint:  %s\n", settings.Endpoint)
+	} else {
+		fmt.Printf("Endpoint:  (none)\n")
+	}
+
+	fmt.Printf("\nOne event is sent per invocation, after the command finishes. Example for `up` on 3 databases:\n")
+	example, err := json.MarshalIndent(telemetry.Event{Command: "up", DatabaseCount: 3, DurationMS: 1840}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(example))
+	fmt.Printf("\nNever sent: hostnames, database names, usernames, passwords, connection strings, file paths.\n")
+	fmt.Printf("To enable, set %s=1 and %s. --no-telemetry always disables it.\n", telemetry.EnvEnabled, telemetry.EnvEndpoint)
+
+	return nil
+}
+
+// startUsage records the invoked command and start time on the root command.
+// Only known command names are recorded so stray arguments never leak.
+func startUsage(cmd *cli.Command) {
+	name := cmd.Args().First()
+	if cmd.Command(name) == nil {
+		return
+	}
+	cmd.Metadata = map[string]any{
+		metaCommand: name,
+		metaStarted: time.Now(),
+	}
+}
+
+// recordDatabaseCount notes how many databases the command operated on
+func recordDatabaseCount(cmd *cli.Command, n int) {
+	if root := cmd.Root(); root.Metadata != nil {
+		root.Metadata[metaDatabases] = n
+	}
+}
+
+// usageSettings resolves telemetry, which --offline also turns off
+func usageSettings(cmd *cli.Command) telemetry.Settings {
+	settings := telemetry.Resolve(cmd.Bool("no-telemetry"))
+	if settings.Enabled && cmd.Bool("offline") {
+		settings.Enabled = false
+		settings.Reason = "disabled by --offline"
+	}
+	return settings
+}
+
+// reportUsage sends the usage event if telemetry is enabled. Failures are
+// only logged at debug level and never affect the command's outcome.
+func reportUsage(ctx context.Context, cmd *cli.Command) error {
+	settings := usageSettings(cmd)
+	if !settings.Enabled {
+		return nil
+	}
+
+	name, ok := cmd.Metadata[metaCommand].(string)
+	if !ok {
+		return nil
+	}
+	started, _ := cmd.Metadata[metaStarted].(time.Time)
+	count, _ := cmd.Metadata[metaDatabases].(int)
+
+	event := telemetry.Event{
+		Command:       name,
+		DatabaseCount: count,
+		DurationMS:    time.Since(started).Milliseconds(),
+	}
+	if err := telemetry.Send(ctx, settings.Endpoint, event); err != nil {
+		slog.Debug("telemetry not sent", "error", err)
+	}
+	return nil
+}
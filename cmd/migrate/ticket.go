@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/ticket"
+)
+
+// validateTicket checks the --ticket of a run against the project config
+func validateTicket(id string, project *config.ProjectConfig) error {
+	if id == "" {
+		return nil
+	}
+	return ticket.Validate(id, project.Tickets.Pattern)
+}
+
+// notifyTicket posts the finished run's summary to the configured ticket
+// webhook. Failures only warn: the migrations already ran.
+func notifyTicket(ctx context.Context, out io.Writer, project *config.ProjectConfig, run *state.Run, succeeded bool) {
+	webhook := project.Tickets.Webhook
+	if run.Ticket == "" || webhook == "" {
+		return
+	}
+
+	outcome := "succeeded"
+	if !succeeded {
+		outcome = "failed"
+	}
+	summary := runSummary(run)
+	n := ticket.Notification{
+		Ticket:    run.Ticket,
+		RunID:     run.ID,
+		Direction: run.Direction,
+		Succeeded: succeeded,
+		Summary:   summary,
+		Text:      fmt.Sprintf("encore-migrator %s run %s %s: %s", run.Direction, run.ID, outcome, summary),
+		Databases: run.Databases,
+	}
+
+	if err := ticket.Post(ctx, webhook, project.Tickets.Headers, n); err != nil {
+		warn(os.Stderr, warnTicketFailed, "could not post the run summary to %s: %v", run.Ticket, err)
+		return
+	}
+	fmt.Fprintf(out, "Posted run summary to %s\n", run.Ticket)
+}
@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"crypto/fips140"
+	"fmt"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// minTLSVersion is the required TLS version of database connections from
+// --tls-min-version or the project config, and where it was set
+func minTLSVersion(cmd *cli.Command) (setting, error) {
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return setting{}, err
+	}
+	minVersion := layered(cmd, "tls-min-version", envTLSMinVersion, "")
+	if !minVersion.Set() && project.TLS.MinVersion != "" {
+		minVersion = setting{Value: project.TLS.MinVersion, Source: "project config tls.min_version"}
+	}
+	if minVersion.Set() {
+		if _, err := migration.ParseTLSVersion(minVersion.Value); err != nil {
+			return setting{}, fmt.Errorf("%w [%s]", err, minVersion.Source)
+		}
+	}
+	return minVersion, nil
+}
+
+// enforceTLSPolicy refuses a connection the project's TLS policy forbids
+// before it is attempted, and makes its TLS handshake refuse older versions.
+// Cloud SQL connector connections are always encrypted by the connector.
+func enforceTLSPolicy(cmd *cli.Command, mapping *types.DatabaseMapping) error {
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if project.TLS.RequireFIPS && !fips140.Enabled() {
+		return fmt.Errorf("tls.require_fips is set, but FIPS 140-3 mode is off; run with GODEBUG=fips140=on")
+	}
+
+	minVersion, err := minTLSVersion(cmd)
+	if err != nil {
+		return err
+	}
+	viaConnector := mapping.CloudSQLInstance != "" && mapping.Host == ""
+	if !viaConnector && minVersion.Set() && (mapping.SSLMode == "allow" || mapping.SSLMode == "prefer") {
+		return fmt.Errorf("database %s: TLS %s or later is required [%s], but sslmode %s allows unencrypted connections; use require, verify-ca or verify-full",
+			mapping.EncoreName, minVersion.Value, minVersion.Source, mapping.SSLMode)
+	}
+	if !viaConnector && (mapping.SSLMode == "" || mapping.SSLMode == "disable") {
+		if minVersion.Set() {
+			return fmt.Errorf("database %s: TLS %s or later is required [%s], but sslmode is disable; add a tls_config to its server in the InfraConfig",
+				mapping.EncoreName, minVersion.Value, minVersion.Source)
+		}
+		if project.TLS.RequireInProduction && mapping.Production {
+			return fmt.Errorf("database %s: sslmode=disable is not allowed in a production environment [project config tls.require_in_production]; add a tls_config to its server in the InfraConfig",
+				mapping.EncoreName)
+		}
+	}
+	mapping.TLSMinVersion = minVersion.Value
+	return nil
+}
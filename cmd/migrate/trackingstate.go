@@ -0,0 +1,203 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+// trackingExport is the document `state export` writes and `state import` reads:
+//
+//	{"schema_version": 1, "exported_at": "...", "databases": [{"name": "users", "pg_database": "users", "version": 3, "dirty": false, "history": [...]}]}
+type trackingExport struct {
+	SchemaVersion int               `json:"schema_version"`
+	ExportedAt    time.Time         `json:"exported_at"`
+	Databases     []trackedDatabase `json:"databases"`
+}
+
+type trackedDatabase struct {
+	Name       string `json:"name"`
+	PGDatabase string `json:"pg_database"`
+	migration.TrackingState
+}
+
+func stateExportCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Write each database's schema_migrations version and migration history to JSON",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Specific Encore database name (default: all)",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "File to write (default: stdout)",
+			},
+			&cli.StringFlag{
+				Name:  "table",
+				Usage: "Read the version from this table instead of schema_migrations, e.g. one being renamed",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return exportTracking(ctx, cmd)
+		},
+	}
+}
+
+func stateImportCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "import",
+		Usage:     "Restore the schema_migrations version and migration history written by state export",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Only import this Encore database (default: all in the file)",
+			},
+			&cli.BoolFlag{
+				Name:  "overwrite",
+				Usage: "Replace the state of databases that already have a version or history",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return importTracking(ctx, cmd)
+		},
+	}
+}
+
+func exportTracking(ctx context.Context, cmd *cli.Command) error {
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if name := cmd.String("database"); name != "" {
+		if databases = discovery.FilterDatabases(databases, name); len(databases) == 0 {
+			return fmt.Errorf("database %q not found", name)
+		}
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	migrator := newMigrator(cmd)
+	export := trackingExport{SchemaVersion: reportSchemaVersion, ExportedAt: time.Now().UTC()}
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			warn(os.Stderr, warnNoConfig, "skipping %q: %v", db.Name, err)
+			continue
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+		connStr, err := migration.BuildConnectionString(mapping)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		session, err := sessionOptions(cmd, project, db.Name)
+		if err != nil {
+			return err
+		}
+		tracking, err := migrator.WithSession(session).ExportTracking(connStr, cmd.String("table"))
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", db.Name, err)
+		}
+		export.Databases = append(export.Databases, trackedDatabase{Name: db.Name, PGDatabase: mapping.PGDBName, TrackingState: *tracking})
+	}
+
+	path := cmd.String("out")
+	if path == "" {
+		return encodeJSON(os.Stdout, export)
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d databases to %s\n", len(export.Databases), path)
+	return nil
+}
+
+// importTracking restores an export by Encore database name. It needs only
+// the InfraConfig, not the app, so state can be restored before the app is
+// deployed against the new servers.
+func importTracking(ctx context.Context, cmd *cli.Command) error {
+	path := cmd.Args().First()
+	if path == "" {
+		return fmt.Errorf("usage: encore-migrator state import <file>")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	var export trackingExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if export.SchemaVersion != reportSchemaVersion {
+		return fmt.Errorf("%s has schema_version %d; this version reads %d", path, export.SchemaVersion, reportSchemaVersion)
+	}
+
+	databases := export.Databases
+	if name := cmd.String("database"); name != "" {
+		databases = nil
+		for _, db := range export.Databases {
+			if db.Name == name {
+				databases = append(databases, db)
+			}
+		}
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found in %s", name, path)
+		}
+	}
+
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	migrator := newMigrator(cmd)
+	for _, db := range databases {
+		mapping, err := infraConfig.GetMapping(db.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		if err := applyConnectionOverrides(cmd, mapping); err != nil {
+			return err
+		}
+		connStr, err := migration.BuildConnectionString(mapping)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.Name, err)
+		}
+		session, err := sessionOptions(cmd, project, db.Name)
+		if err != nil {
+			return err
+		}
+		if err := migrator.WithSession(session).ImportTracking(connStr, db.TrackingState, cmd.Bool("overwrite")); err != nil {
+			return fmt.Errorf("importing %s: %w", db.Name, err)
+		}
+		fmt.Printf("%s (%s): version %d, %d history rows\n", db.Name, mapping.PGDBName, db.Version, len(db.History))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func validateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "Check migration files for duplicate versions, gaps, missing down files, empty files and invalid UTF-8",
+		Description: "Runs offline: only the discovered migrations directories are read.\n" +
+			"Exits non-zero if any check fails. Checks: " + strings.Join(migration.HygieneChecks, ", ") + ".",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "database",
+				Aliases: []string{"d"},
+				Usage:   "Validate only this Encore database",
+			},
+			&cli.StringSliceFlag{
+				Name:  "skip",
+				Usage: "Check to skip, e.g. missing-down for apps that never roll back (repeatable)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return validateMigrations(ctx, cmd)
+		},
+	}
+}
+
+// validateReport is the `validate` document with the global --output json
+//
+//	{"schema_version": 1, "valid": false, "databases": [{"name": "users", "valid": false,
+//	 "problems": [{"check": "missing-down", "file": "2_add_email.up.sql", "message": "no down file for version 2"}]}]}
+type validateReport struct {
+	SchemaVersion int                `json:"schema_version"`
+	Valid         bool               `json:"valid"`
+	Databases     []validateDatabase `json:"databases"`
+}
+
+type validateDatabase struct {
+	Name     string            `json:"name"`
+	Valid    bool              `json:"valid"`
+	Problems []validateProblem `json:"problems"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type validateProblem struct {
+	Check   string `json:"check"`
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+func (report validateReport) text(w io.Writer) {
+	for _, db := range report.Databases {
+		switch {
+		case db.Error != "":
+			fmt.Fprintf(w, "%s: error: %s\n", db.Name, db.Error)
+		case db.Valid:
+			fmt.Fprintf(w, "%s: ok\n", db.Name)
+		default:
+			fmt.Fprintf(w, "%s: %d problems\n", db.Name, len(db.Problems))
+		}
+		for _, p := range db.Problems {
+			if p.File != "" {
+				fmt.Fprintf(w, "  %s: %s: %s\n", p.File, p.Check, p.Message)
+			} else {
+				fmt.Fprintf(w, "  %s: %s\n", p.Check, p.Message)
+			}
+		}
+	}
+}
+
+func (report validateReport) markdown(w io.Writer) {
+	fmt.Fprintf(w, "### Migration file validation\n\n")
+	fmt.Fprintf(w, "| Database | Result | Problems |\n")
+	fmt.Fprintf(w, "|---|---|---|\n")
+	for _, db := range report.Databases {
+		result := "ok"
+		switch {
+		case db.Error != "":
+			result = "error: " + markdownCell(db.Error)
+		case !db.Valid:
+			result = fmt.Sprintf("%d problems", len(db.Problems))
+		}
+		problems := make([]string, len(db.Problems))
+		for i, p := range db.Problems {
+			problems[i] = p.Check + ": " + markdownCell(p.Message)
+			if p.File != "" {
+				problems[i] = "`" + p.File + "` " + problems[i]
+			}
+		}
+		cell := "-"
+		if len(problems) > 0 {
+			cell = strings.Join(problems, "<br>")
+		}
+		fmt.Fprintf(w, "| `%s` | %s | %s |\n", db.Name, result, cell)
+	}
+}
+
+func (report validateReport) records() []any { return databaseRecords(report.Databases) }
+
+func validateMigrations(ctx context.Context, cmd *cli.Command) error {
+	for _, check := range cmd.StringSlice("skip") {
+		if !migration.IsHygieneCheck(check) {
+			return fmt.Errorf("unknown check %q (want one of %s)", check, strings.Join(migration.HygieneChecks, ", "))
+		}
+	}
+
+	databases, err := discoverDatabases(cmd)
+	if err != nil {
+		return err
+	}
+	if target := cmd.String("database"); target != "" {
+		databases = discovery.FilterDatabases(databases, target)
+		if len(databases) == 0 {
+			return fmt.Errorf("database %q not found", target)
+		}
+	}
+
+	report := validateReport{SchemaVersion: reportSchemaVersion, Valid: true, Databases: []validateDatabase{}}
+	for _, db := range databases {
+		entry := validateDatabase{Name: db.Name, Problems: []validateProblem{}}
+		problems, err := migration.CheckHygiene(db.MigrationsPath, cmd.StringSlice("skip"))
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		for _, p := range problems {
+			entry.Problems = append(entry.Problems, validateProblem{Check: p.Check, File: p.File, Message: p.Message})
+		}
+		entry.Valid = err == nil && len(problems) == 0
+		report.Valid = report.Valid && entry.Valid
+		report.Databases = append(report.Databases, entry)
+	}
+
+	if err := outputRenderer(cmd).report(os.Stdout, report); err != nil {
+		return err
+	}
+
+	if !report.Valid {
+		return fmt.Errorf("migration files failed validation")
+	}
+	return nil
+}
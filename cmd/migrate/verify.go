@@ -0,0 +1,226 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/discovery"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+func verifyCommand() *cli.Command {
+	databaseFlag := func() cli.Flag {
+		return &cli.StringFlag{
+			Name:    "database",
+			Aliases: []string{"d"},
+			Usage:   "Specific Encore database name (default: all)",
+		}
+	}
+
+	return &cli.Command{
+		Name:  "verify",
+		Usage: "Check that no applied migration file changed since it ran, against the checksums in each database's encore_migrate_checksums table",
+		Description: "up records the checksum of every migration file it applies. verify fails if an applied\n" +
+			"file's content changed or the file is gone. Migrations applied without a recorded\n" +
+			"checksum, e.g. before checksums were recorded, are unverified and fail it too until\n" +
+			"verify baseline records their current checksums.\n" +
+			"verify itself only reads.",
+		Flags: []cli.Flag{databaseFlag()},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return verifyChecksums(ctx, cmd, false)
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "baseline",
+				Usage: "Write the current checksums of applied migrations that have none to each database, trusting the files as they are, then verify",
+				Flags: []cli.Flag{databaseFlag()},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					return verifyChecksums(ctx, cmd, true)
+				},
+			},
+		},
+	}
+}
+
+// verifyReport is the `verify` document with the global --output json; only
+// migrations whose checksum is not ok are listed
+//
+//	{"schema_version": 1, "valid": false, "databases": [{"name": "users", "version": 3, "valid": false,
+//	 "migrations": [{"version": 2, "file": "2_add_email.up.sql", "status": "changed", "recorded": "sha256:...", "current": "sha256:..."}]}]}
+type verifyReport struct {
+	SchemaVersion int              `json:"schema_version"`
+	Valid         bool             `json:"valid"`
+	Databases     []verifyDatabase `json:"databases"`
+}
+
+type verifyDatabase struct {
+	Name       string                     `json:"name"`
+	Version    uint                       `json:"version"`
+	Valid      bool                       `json:"valid"`
+	Verified   int                        `json:"verified"` // applied migrations matching their checksum
+	Baselined  int                        `json:"baselined,omitempty"`
+	Migrations []migration.ChecksumResult `json:"migrations"`
+	Error      string                     `json:"error,omitempty"`
+}
+
+// verifyChecksums verifies the checksums of each database, first recording
+// those of unrecorded migrations with baseline
+func verifyChecksums(ctx context.Context, cmd *cli.Command, baseline bool) error {
+	infraConfig, databases, err := loadConfigAndDiscover(cmd)
+	if err != nil {
+		return err
+	}
+	if name := cmd.String("database"); name != "" {
+		if databases = discovery.FilterDatabases(databases, name); len(databases) == 0 {
+			return fmt.Errorf("database %q not found", name)
+		}
+	}
+	if databases, err = activeDatabases(cmd, databases); err != nil {
+		return err
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found")
+	}
+	project, err := loadProjectConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	migrator := newMigrator(cmd)
+	report := verifyReport{SchemaVersion: reportSchemaVersion, Valid: true, Databases: []verifyDatabase{}}
+	for _, db := range databases {
+		entry := verifyDatabase{Name: db.Name, Migrations: []migration.ChecksumResult{}}
+		err := func() error {
+			mapping, err := infraConfig.GetMapping(db.Name)
+			if err != nil {
+				return err
+			}
+			if err := applyConnectionOverrides(cmd, mapping); err != nil {
+				return err
+			}
+			connStr, err := migration.BuildConnectionString(mapping)
+			if err != nil {
+				return err
+			}
+			session, err := sessionOptions(cmd, project, db.Name)
+			if err != nil {
+				return err
+			}
+			dbMigrator := migrator.WithSession(session)
+			if baseline {
+				if entry.Baselined, err = dbMigrator.BaselineChecksums(connStr, db.MigrationsPath); err != nil {
+					return err
+				}
+			}
+			version, results, err := dbMigrator.VerifyChecksums(connStr, db.MigrationsPath)
+			if err != nil {
+				return err
+			}
+			entry.Version = version
+			for _, r := range results {
+				if r.Status == migration.ChecksumOK {
+					entry.Verified++
+					continue
+				}
+				entry.Migrations = append(entry.Migrations, r)
+			}
+			return nil
+		}()
+		if err != nil {
+			slog.Debug("failed to verify checksums", "database", db.Name, "error", err)
+			entry.Error = err.Error()
+		}
+		entry.Valid = err == nil
+		if len(entry.Migrations) > 0 {
+			entry.Valid = false
+		}
+		report.Valid = report.Valid && entry.Valid
+		report.Databases = append(report.Databases, entry)
+	}
+
+	if err := outputRenderer(cmd).report(os.Stdout, report); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("applied migrations changed since they ran, have no recorded checksum or could not be verified")
+	}
+	return nil
+}
+
+func (report verifyReport) text(w io.Writer) {
+	for _, db := range report.Databases {
+		if db.Error != "" {
+			fmt.Fprintf(w, "%s: error: %s\n", db.Name, db.Error)
+			continue
+		}
+		if db.Baselined > 0 {
+			fmt.Fprintf(w, "%s: recorded the checksums of %d applied migrations\n", db.Name, db.Baselined)
+		}
+		unrecorded := 0
+		for _, r := range db.Migrations {
+			if r.Status == migration.ChecksumUnrecorded {
+				unrecorded++
+			}
+		}
+		if db.Valid {
+			fmt.Fprintf(w, "%s: ok (%d applied migrations match, version %d)\n", db.Name, db.Verified, db.Version)
+		} else {
+			fmt.Fprintf(w, "%s: %d applied migrations changed or missing, %d unverified\n", db.Name, len(db.Migrations)-unrecorded, unrecorded)
+		}
+		for _, r := range db.Migrations {
+			switch r.Status {
+			case migration.ChecksumChanged:
+				fmt.Fprintf(w, "  %s: changed since it ran on %s (recorded %s, now %s)\n", r.File, r.AppliedAt.Local().Format("2006-01-02 15:04"), shortChecksum(r.Recorded), shortChecksum(r.Current))
+			case migration.ChecksumMissing:
+				fmt.Fprintf(w, "  version %d: applied on %s, but no up file has this version any more\n", r.Version, r.AppliedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+		if unrecorded > 0 {
+			fmt.Fprintf(w, "  %d applied migrations have no recorded checksum; verify baseline records their current files if you trust them\n", unrecorded)
+		}
+	}
+}
+
+func (report verifyReport) markdown(w io.Writer) {
+	fmt.Fprintf(w, "### Migration checksums\n\n")
+	fmt.Fprintf(w, "| Database | Version | Result | Changed or missing | Unrecorded |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|\n")
+	for _, db := range report.Databases {
+		if db.Error != "" {
+			fmt.Fprintf(w, "| `%s` | - | error: %s | - | - |\n", db.Name, markdownCell(db.Error))
+			continue
+		}
+		result := fmt.Sprintf("ok (%d match)", db.Verified)
+		if !db.Valid {
+			result = "not verified"
+		}
+		var changed []string
+		unrecorded := 0
+		for _, r := range db.Migrations {
+			switch r.Status {
+			case migration.ChecksumChanged:
+				changed = append(changed, r.File)
+			case migration.ChecksumMissing:
+				changed = append(changed, fmt.Sprintf("version %d (file gone)", r.Version))
+			case migration.ChecksumUnrecorded:
+				unrecorded++
+			}
+		}
+		fmt.Fprintf(w, "| `%s` | %d | %s | %s | %d |\n", db.Name, db.Version, result, markdownFiles(changed), unrecorded)
+	}
+}
+
+func (report verifyReport) records() []any { return databaseRecords(report.Databases) }
+
+// shortChecksum abbreviates a checksum for display
+func shortChecksum(checksum string) string {
+	if len(checksum) > len("sha256:")+12 {
+		return checksum[:len("sha256:")+12]
+	}
+	return checksum
+}
@@ -0,0 +1,183 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v3"
+)
+
+// warningCode identifies a kind of warning, so known and accepted ones can
+// be suppressed with --suppress or the project config's warnings.suppress
+// without hiding new ones, and others made errors with --warning-as-error.
+// Codes are never reused.
+type warningCode string
+
+const (
+	warnNoConfig           warningCode = "W001"
+	warnNoDownFiles        warningCode = "W002"
+	warnDiscoverySkipped   warningCode = "W003"
+	warnOverride           warningCode = "W004"
+	warnSSHCloudSQL        warningCode = "W005"
+	warnAnalyzeFailed      warningCode = "W006"
+	warnSkipFailedEnabled  warningCode = "W007"
+	warnStatementSkipped   warningCode = "W008"
+	warnFailureInjected    warningCode = "W009"
+	warnAlertFailed        warningCode = "W010"
+	warnTicketFailed       warningCode = "W011"
+	warnRunNotSaved        warningCode = "W012"
+	warnHistoryNotRecorded warningCode = "W013"
+	warnPauseFailed        warningCode = "W014"
+	warnResumeFailed       warningCode = "W015"
+	warnFlagSwitchFailed   warningCode = "W016"
+	warnDestructiveSQL     warningCode = "W017"
+	warnReplicaLag         warningCode = "W018"
+	warnUnknownDirective   warningCode = "W019"
+)
+
+// warningCodes describes every code, in order, for `warnings`
+var warningCodes = []struct {
+	code    warningCode
+	summary string
+}{
+	{warnNoConfig, "a database is skipped because the InfraConfig has no entry for it"},
+	{warnNoDownFiles, "a database is skipped by down --missing-down skip because it lacks down files"},
+	{warnDiscoverySkipped, "discovery skipped a NewDatabase call it could not resolve, or whose migrations directory is missing"},
+	{warnOverride, "a profile, environment variable or flag overrides the InfraConfig's host, user or password"},
+	{warnSSHCloudSQL, "an SSH tunnel is ignored for a database reached through the Cloud SQL connector"},
+	{warnAnalyzeFailed, "ANALYZE failed after migrating"},
+	{warnSkipFailedEnabled, "--skip-failed-statement is set"},
+	{warnStatementSkipped, "a failing statement was skipped by --skip-failed-statement"},
+	{warnFailureInjected, "--inject-failure will fail a migration on purpose"},
+	{warnAlertFailed, "an alert could not be raised"},
+	{warnTicketFailed, "the run summary could not be posted to the change ticket"},
+	{warnRunNotSaved, "the run report could not be saved to the state directory"},
+	{warnHistoryNotRecorded, "a retirement or snapshot restore could not be recorded in the database's history table"},
+	{warnPauseFailed, "a cron job or subscription could not be paused or resumed around migrations"},
+	{warnResumeFailed, "the quiesced writers of a database could not be resumed after migrating"},
+	{warnFlagSwitchFailed, "a feature flag of a flag-after directive could not be switched"},
+	{warnDestructiveSQL, "a pending migration drops, truncates, narrows a column or builds an index without CONCURRENTLY"},
+	{warnReplicaLag, "a replica had not replayed the migrations when --replica-timeout passed"},
+	{warnUnknownDirective, "a migration's leading comments have a directive the migrator does not know, usually a misspelt one"},
+}
+
+// warnings tracks suppressed and escalated codes and the warnings already shown
+var warnings = struct {
+	sync.Mutex
+	suppressed map[warningCode]bool
+	escalated  map[warningCode]bool
+	allErrors  bool            // every warning is an error
+	failed     map[string]bool // escalated warnings printed, by "code: message"
+	shown      map[string]bool
+}{suppressed: map[warningCode]bool{}, escalated: map[warningCode]bool{}, failed: map[string]bool{}, shown: map[string]bool{}}
+
+// suppressWarnings stops warnings with the given codes from being printed
+func suppressWarnings(codes ...string) error {
+	parsed, err := parseWarningCodes(codes)
+	if err != nil {
+		return err
+	}
+	warnings.Lock()
+	defer warnings.Unlock()
+	for _, code := range parsed {
+		warnings.suppressed[code] = true
+	}
+	return nil
+}
+
+// escalateWarnings makes warnings with the given codes, or all warnings,
+// fail the command once it finishes. Escalation beats suppression.
+func escalateWarnings(all bool, codes ...string) error {
+	parsed, err := parseWarningCodes(codes)
+	if err != nil {
+		return err
+	}
+	warnings.Lock()
+	defer warnings.Unlock()
+	warnings.allErrors = warnings.allErrors || all
+	for _, code := range parsed {
+		warnings.escalated[code] = true
+	}
+	return nil
+}
+
+// parseWarningCodes normalizes codes such as "w004" and rejects unknown ones
+func parseWarningCodes(codes []string) ([]warningCode, error) {
+	var parsed []warningCode
+	for _, c := range codes {
+		code := warningCode(strings.ToUpper(strings.TrimSpace(c)))
+		if code == "" {
+			continue
+		}
+		if !knownWarning(code) {
+			return nil, fmt.Errorf("unknown warning code %q (see encore-migrator warnings)", c)
+		}
+		parsed = append(parsed, code)
+	}
+	return parsed, nil
+}
+
+// escalatedWarnings returns an error listing the warnings that were treated
+// as errors, or nil
+func escalatedWarnings() error {
+	warnings.Lock()
+	defer warnings.Unlock()
+	if len(warnings.failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("warnings treated as errors:\n  %s", strings.Join(slices.Sorted(maps.Keys(warnings.failed)), "\n  "))
+}
+
+func knownWarning(code warningCode) bool {
+	for _, w := range warningCodes {
+		if w.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// warn prints a warning to w, usually stderr, unless its code is suppressed
+// or the same warning was already printed by this process. Escalated
+// warnings are printed as errors and fail the command when it finishes.
+func warn(w io.Writer, code warningCode, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	warnings.Lock()
+	escalated := warnings.allErrors || warnings.escalated[code]
+	suppressed := warnings.suppressed[code] && !escalated
+	repeated := warnings.shown[string(code)+message]
+	warnings.shown[string(code)+message] = true
+	if escalated {
+		warnings.failed[fmt.Sprintf("%s: %s", code, message)] = true
+	}
+	warnings.Unlock()
+
+	slog.Debug("warning", "code", code, "message", message, "suppressed", suppressed, "escalated", escalated)
+	switch {
+	case suppressed || repeated:
+		// not printed; an escalated repeat still fails the command
+	case escalated:
+		fmt.Fprintf(w, "Error [%s]: %s\n", code, message)
+	default:
+		fmt.Fprintf(w, "Warning [%s]: %s\n", code, message)
+	}
+}
+
+func warningsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "warnings",
+		Usage: "List the warning codes that --suppress, --warning-as-error and the project config's warnings settings accept",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			for _, w := range warningCodes {
+				fmt.Printf("%s  %s\n", w.code, w.summary)
+			}
+			return nil
+		},
+	}
+}
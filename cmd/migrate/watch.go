@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+)
+
+// watchSettle is how long a migrations directory must be quiet before a
+// change is applied, so an editor's save or a copied batch triggers one run
+const watchSettle = 500 * time.Millisecond
+
+// watchMigrations runs `up` and then again whenever a .sql file is created
+// or written in the migrations directories of the databases it covers, until
+// interrupted. Failed runs are reported and wait for the next change.
+func watchMigrations(ctx context.Context, cmd *cli.Command) error {
+	for _, flag := range []string{"dry-run", "resume", "steps", "to-version", "phase"} {
+		if cmd.IsSet(flag) {
+			return fmt.Errorf("--watch cannot be combined with --%s", flag)
+		}
+	}
+	infraConfig, err := config.LoadInfraConfig(cmd.String("config"))
+	if err != nil {
+		return fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	if infraConfig.IsProduction() {
+		return fmt.Errorf("refusing --watch: the InfraConfig is labelled %s", config.EnvTypeProduction)
+	}
+
+	targets, err := selectTargets(cmd, "up")
+	if err != nil {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("starting file watcher: %w", err)
+	}
+	defer watcher.Close()
+	for _, db := range targets.databases {
+		if err := watcher.Add(db.MigrationsPath); err != nil {
+			return fmt.Errorf("watching %s migrations in %s: %w", db.Name, db.MigrationsPath, err)
+		}
+		slog.Debug("watching migrations", "database", db.Name, "path", db.MigrationsPath)
+	}
+
+	// Interrupts stop the watch between runs; a run in progress finishes first
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	stdout := progressOutput(cmd)
+	for {
+		if err := runMigrations(ctx, cmd, "up"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		fmt.Fprintf(stdout, "Watching %d migrations directories for changes (Ctrl-C to stop)\n", len(targets.databases))
+
+		var settle <-chan time.Time
+		changed := map[string]bool{}
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-interrupts:
+				return nil
+			case err := <-watcher.Errors:
+				return fmt.Errorf("watching migrations: %w", err)
+			case event := <-watcher.Events:
+				if !strings.HasSuffix(event.Name, ".sql") || !event.Has(fsnotify.Create|fsnotify.Write) {
+					continue
+				}
+				slog.Debug("migrations changed", "file", event.Name, "op", event.Op.String())
+				changed[filepath.Base(event.Name)] = true
+				settle = time.After(watchSettle)
+			case <-settle:
+				break wait
+			}
+		}
+		fmt.Fprintf(stdout, "\n%s changed; applying pending migrations\n", strings.Join(slices.Sorted(maps.Keys(changed)), ", "))
+	}
+}
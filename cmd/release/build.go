@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	binaryName    = "encore-migrator"
+	modulePath    = "github.com/theoffensivecoder/encoredev-migrator"
+	versionSymbol = modulePath + "/cmd/migrate.Version"
+)
+
+// defaultDownloadURL is where GitHub serves release assets; %s is the version tag
+const defaultDownloadURL = "https://" + modulePath + "/releases/download/%s"
+
+// target is a GOOS/GOARCH pair
+type target struct {
+	OS   string
+	Arch string
+}
+
+func (t target) String() string {
+	return t.OS + "/" + t.Arch
+}
+
+// defaultTargets are the platforms engineers run the CLI on
+var defaultTargets = []target{
+	{"darwin", "amd64"},
+	{"darwin", "arm64"},
+	{"linux", "amd64"},
+	{"linux", "arm64"},
+	{"windows", "amd64"},
+	{"windows", "arm64"},
+}
+
+// parseTargets parses GOOS/GOARCH values
+func parseTargets(values []string) ([]target, error) {
+	var targets []target
+	for _, v := range values {
+		goos, goarch, ok := strings.Cut(v, "/")
+		if !ok || goos == "" || goarch == "" {
+			return nil, fmt.Errorf("invalid target %q: expected GOOS/GOARCH", v)
+		}
+		targets = append(targets, target{goos, goarch})
+	}
+	return targets, nil
+}
+
+// artifact is one packaged platform build
+type artifact struct {
+	Target  target
+	Archive string // file name inside the output directory
+	SHA256  string
+}
+
+// release collects the artifacts of one packaging run
+type release struct {
+	Version     string
+	OutDir      string
+	DownloadURL string // may contain %s for the version tag
+	Artifacts   []artifact
+}
+
+// URL returns the download URL of an archive
+func (r *release) URL(a artifact) string {
+	base := r.DownloadURL
+	if strings.Contains(base, "%s") {
+		base = fmt.Sprintf(base, r.Version)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + a.Archive
+}
+
+// build cross-compiles the CLI for a target and archives it
+func (r *release) build(ctx context.Context, t target) (artifact, error) {
+	workDir, err := os.MkdirTemp("", "encore-migrator-release-")
+	if err != nil {
+		return artifact{}, err
+	}
+	defer os.RemoveAll(workDir)
+
+	binary := binaryName
+	if t.OS == "windows" {
+		binary += ".exe"
+	}
+	binPath := filepath.Join(workDir, binary)
+
+	slog.Debug("building", "target", t.String(), "output", binPath)
+	cmd := exec.CommandContext(ctx, "go", "build",
+		"-trimpath",
+		"-ldflags", fmt.Sprintf("-s -w -X %s=%s", versionSymbol, r.Version),
+		"-o", binPath,
+		modulePath,
+	)
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS="+t.OS, "GOARCH="+t.Arch)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return artifact{}, fmt.Errorf("go build: %w", err)
+	}
+
+	name := fmt.Sprintf("%s_%s_%s_%s", binaryName, strings.TrimPrefix(r.Version, "v"), t.OS, t.Arch)
+	if t.OS == "windows" {
+		name += ".zip"
+		err = writeZip(filepath.Join(r.OutDir, name), binPath, binary)
+	} else {
+		name += ".tar.gz"
+		err = writeTarGz(filepath.Join(r.OutDir, name), binPath, binary)
+	}
+	if err != nil {
+		return artifact{}, fmt.Errorf("archiving: %w", err)
+	}
+
+	sum, err := sha256File(filepath.Join(r.OutDir, name))
+	if err != nil {
+		return artifact{}, err
+	}
+
+	return artifact{Target: t, Archive: name, SHA256: sum}, nil
+}
+
+// writeTarGz writes a gzipped tarball holding a single executable
+func writeTarGz(archivePath, binPath, name string) error {
+	info, err := os.Stat(binPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0755,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	if err := copyFileTo(tw, binPath); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeZip writes a zip archive holding a single executable
+func writeZip(archivePath, binPath, name string) error {
+	info, err := os.Stat(binPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if err := copyFileTo(w, binPath); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
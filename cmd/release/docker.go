@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+func dockerCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "docker",
+		Usage: "Build the distroless container image from the repository Dockerfile",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "version",
+				Usage:    "Release version tag (e.g., v1.2.3)",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "tag",
+				Usage: "Image tag (default: encore-migrator:<version>)",
+			},
+			&cli.StringFlag{
+				Name:  "platform",
+				Usage: "Target platform(s) passed to docker build (e.g., linux/amd64,linux/arm64)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return buildImage(ctx, cmd)
+		},
+	}
+}
+
+func buildImage(ctx context.Context, cmd *cli.Command) error {
+	root, err := moduleRoot(ctx)
+	if err != nil {
+		return err
+	}
+
+	version := cmd.String("version")
+	tags := cmd.StringSlice("tag")
+	if len(tags) == 0 {
+		tags = []string{binaryName + ":" + strings.TrimPrefix(version, "v")}
+	}
+
+	args := []string{"build", "--build-arg", "VERSION=" + version}
+	for _, t := range tags {
+		args = append(args, "--tag", t)
+	}
+	if p := cmd.String("platform"); p != "" {
+		args = append(args, "--platform", p)
+	}
+	args = append(args, root)
+
+	docker := exec.CommandContext(ctx, "docker", args...)
+	docker.Stdout = os.Stdout
+	docker.Stderr = os.Stderr
+	if err := docker.Run(); err != nil {
+		return fmt.Errorf("docker build: %w", err)
+	}
+
+	fmt.Printf("\nBuilt %s\n", strings.Join(tags, ", "))
+	return nil
+}
+
+// moduleRoot returns the directory holding go.mod, which is the Docker build context
+func moduleRoot(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "go", "env", "GOMOD").Output()
+	if err != nil {
+		return "", fmt.Errorf("locating module root: %w", err)
+	}
+	gomod := strings.TrimSpace(string(out))
+	if gomod == "" || gomod == os.DevNull {
+		return "", fmt.Errorf("locating module root: not inside the %s module", modulePath)
+	}
+	return filepath.Dir(gomod), nil
+}
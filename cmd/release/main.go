@@ -0,0 +1,118 @@
+// Command release builds distributable archives of encore-migrator.
+//
+//	go run ./cmd/release package --version v1.2.3
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v3"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/logging"
+)
+
+func main() {
+	if err := run(context.Background(), os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	app := &cli.Command{
+		Name:  "release",
+		Usage: "Release tooling for encore-migrator",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "debug",
+				Usage: "Enable debug logging",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			logging.Setup(cmd.Bool("debug"))
+			return ctx, nil
+		},
+		Commands: []*cli.Command{
+			packageCommand(),
+			dockerCommand(),
+		},
+	}
+
+	return app.Run(ctx, args)
+}
+
+func packageCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "package",
+		Usage: "Cross-compile, archive and checksum the CLI and generate Homebrew and Scoop manifests",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "version",
+				Usage:    "Release version tag (e.g., v1.2.3)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "Output directory",
+				Value: "dist",
+			},
+			&cli.StringSliceFlag{
+				Name:  "target",
+				Usage: "GOOS/GOARCH to build (default: all supported targets)",
+			},
+			&cli.StringFlag{
+				Name:  "download-url",
+				Usage: "Base URL the archives will be published under (%s is replaced by the version tag)",
+				Value: defaultDownloadURL,
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			return packageRelease(ctx, cmd)
+		},
+	}
+}
+
+func packageRelease(ctx context.Context, cmd *cli.Command) error {
+	targets := defaultTargets
+	if cmd.IsSet("target") {
+		var err error
+		targets, err = parseTargets(cmd.StringSlice("target"))
+		if err != nil {
+			return err
+		}
+	}
+
+	rel := release{
+		Version:     cmd.String("version"),
+		OutDir:      cmd.String("out"),
+		DownloadURL: cmd.String("download-url"),
+	}
+
+	if err := os.MkdirAll(rel.OutDir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+
+	for _, t := range targets {
+		artifact, err := rel.build(ctx, t)
+		if err != nil {
+			return fmt.Errorf("building %s: %w", t, err)
+		}
+		rel.Artifacts = append(rel.Artifacts, artifact)
+		fmt.Printf("  %-40s %s\n", artifact.Archive, artifact.SHA256)
+	}
+
+	if err := rel.writeChecksums(); err != nil {
+		return err
+	}
+	if err := rel.writeHomebrewFormula(); err != nil {
+		return err
+	}
+	if err := rel.writeScoopManifest(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nRelease %s packaged in %s\n", rel.Version, rel.OutDir)
+	return nil
+}
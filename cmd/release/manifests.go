@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// writeChecksums writes checksums.txt in the format sha256sum -c accepts
+func (r *release) writeChecksums() error {
+	var b strings.Builder
+	for _, a := range r.Artifacts {
+		fmt.Fprintf(&b, "%s  %s\n", a.SHA256, a.Archive)
+	}
+	return writeOutput(filepath.Join(r.OutDir, "checksums.txt"), []byte(b.String()))
+}
+
+// find returns the artifact for a platform, if it was built
+func (r *release) find(goos, goarch string) *artifact {
+	for i := range r.Artifacts {
+		if r.Artifacts[i].Target == (target{goos, goarch}) {
+			return &r.Artifacts[i]
+		}
+	}
+	return nil
+}
+
+var formulaTemplate = template.Must(template.New("formula").Parse(`class EncoreMigrator < Formula
+  desc "Run database migrations for Encore.dev applications"
+  homepage "https://{{.Homepage}}"
+  version "{{.Version}}"
+{{- range .Platforms}}
+
+  {{.Block}} do
+{{- range .Archs}}
+    {{.Block}} do
+      url "{{.URL}}"
+      sha256 "{{.SHA256}}"
+    end
+{{- end}}
+  end
+{{- end}}
+
+  def install
+    bin.install "encore-migrator"
+  end
+
+  test do
+    system "#{bin}/encore-migrator", "--version"
+  end
+end
+`))
+
+type formulaArch struct {
+	Block  string
+	URL    string
+	SHA256 string
+}
+
+type formulaPlatform struct {
+	Block string
+	Archs []formulaArch
+}
+
+// writeHomebrewFormula writes encore-migrator.rb for a Homebrew tap
+func (r *release) writeHomebrewFormula() error {
+	data := struct {
+		Homepage  string
+		Version   string
+		Platforms []formulaPlatform
+	}{Homepage: modulePath, Version: strings.TrimPrefix(r.Version, "v")}
+
+	for _, p := range []struct{ goos, block string }{{"darwin", "on_macos"}, {"linux", "on_linux"}} {
+		platform := formulaPlatform{Block: p.block}
+		for _, a := range []struct{ goarch, block string }{{"amd64", "on_intel"}, {"arm64", "on_arm"}} {
+			if art := r.find(p.goos, a.goarch); art != nil {
+				platform.Archs = append(platform.Archs, formulaArch{Block: a.block, URL: r.URL(*art), SHA256: art.SHA256})
+			}
+		}
+		if len(platform.Archs) > 0 {
+			data.Platforms = append(data.Platforms, platform)
+		}
+	}
+	if len(data.Platforms) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	if err := formulaTemplate.Execute(&b, data); err != nil {
+		return fmt.Errorf("rendering Homebrew formula: %w", err)
+	}
+	return writeOutput(filepath.Join(r.OutDir, binaryName+".rb"), []byte(b.String()))
+}
+
+type scoopArch struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+type scoopManifest struct {
+	Version      string               `json:"version"`
+	Description  string               `json:"description"`
+	Homepage     string               `json:"homepage"`
+	Architecture map[string]scoopArch `json:"architecture"`
+	Bin          string               `json:"bin"`
+}
+
+// writeScoopManifest writes encore-migrator.json for a Scoop bucket
+func (r *release) writeScoopManifest() error {
+	manifest := scoopManifest{
+		Version:      strings.TrimPrefix(r.Version, "v"),
+		Description:  "Run database migrations for Encore.dev applications",
+		Homepage:     "https://" + modulePath,
+		Architecture: map[string]scoopArch{},
+		Bin:          binaryName + ".exe",
+	}
+	for goarch, key := range map[string]string{"amd64": "64bit", "arm64": "arm64"} {
+		if art := r.find("windows", goarch); art != nil {
+			manifest.Architecture[key] = scoopArch{URL: r.URL(*art), Hash: art.SHA256}
+		}
+	}
+	if len(manifest.Architecture) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return fmt.Errorf("encoding Scoop manifest: %w", err)
+	}
+	return writeOutput(filepath.Join(r.OutDir, binaryName+".json"), append(data, '\n'))
+}
+
+func writeOutput(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	fmt.Printf("  %s\n", filepath.Base(path))
+	return nil
+}
@@ -0,0 +1,133 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Default event endpoints
+const (
+	PagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	OpsgenieURL  = "https://api.opsgenie.com/v2/alerts"
+)
+
+// sendTimeout bounds how long raising an alert may take
+const sendTimeout = 10 * time.Second
+
+// opsgenieMessageLimit is the maximum length of an Opsgenie alert message
+const opsgenieMessageLimit = 130
+
+// Alert is a failure worth paging someone for
+type Alert struct {
+	Summary  string            // one line, e.g. "encore-migrator up failed in prod: users"
+	Source   string            // the environment or host the failure happened in
+	DedupKey string            // repeated alerts with the same key are grouped, e.g. the run ID
+	Details  map[string]string // shown with the incident, e.g. per-database errors
+}
+
+// Notifier raises an alert with an incident management service
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, a Alert) error
+}
+
+// PagerDuty triggers an incident through the Events API v2
+type PagerDuty struct {
+	RoutingKey string // integration key of the service to page
+	URL        string // defaults to PagerDutyURL
+}
+
+// Name identifies the service in messages
+func (p *PagerDuty) Name() string { return "PagerDuty" }
+
+// Notify triggers an incident deduplicated by the alert's DedupKey
+func (p *PagerDuty) Notify(ctx context.Context, a Alert) error {
+	url := p.URL
+	if url == "" {
+		url = PagerDutyURL
+	}
+	event := map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.DedupKey,
+		"payload": map[string]any{
+			"summary":        a.Summary,
+			"source":         a.Source,
+			"severity":       "critical",
+			"component":      "encore-migrator",
+			"custom_details": a.Details,
+		},
+	}
+	return post(ctx, url, nil, event)
+}
+
+// Opsgenie creates an alert through the Alert API
+type Opsgenie struct {
+	APIKey   string // API key of an API integration
+	Priority string // P1-P5, default P1
+	URL      string // defaults to OpsgenieURL; use https://api.eu.opsgenie.com/v2/alerts for EU accounts
+}
+
+// Name identifies the service in messages
+func (o *Opsgenie) Name() string { return "Opsgenie" }
+
+// Notify creates an alert aliased by the alert's DedupKey
+func (o *Opsgenie) Notify(ctx context.Context, a Alert) error {
+	url := o.URL
+	if url == "" {
+		url = OpsgenieURL
+	}
+	priority := o.Priority
+	if priority == "" {
+		priority = "P1"
+	}
+	message := a.Summary
+	if len(message) > opsgenieMessageLimit {
+		message = message[:opsgenieMessageLimit-3] + "..."
+	}
+	body := map[string]any{
+		"message":     message,
+		"alias":       a.DedupKey,
+		"description": a.Summary,
+		"source":      a.Source,
+		"priority":    priority,
+		"tags":        []string{"encore-migrator"},
+		"details":     a.Details,
+	}
+	return post(ctx, url, map[string]string{"Authorization": "GenieKey " + o.APIKey}, body)
+}
+
+// post sends body as JSON and fails on a non-2xx response
+func post(ctx context.Context, url string, headers map[string]string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding alert: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("creating alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sending alert: unexpected status %s", resp.Status)
+	}
+	return nil
+}
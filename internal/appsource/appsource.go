@@ -0,0 +1,186 @@
+// Package appsource unpacks application source archives, so a migration job
+// can run from a build artifact such as app-source.tar.gz instead of a checkout.
+package appsource
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appMarker is the file at the root of every Encore application
+const appMarker = "encore.app"
+
+// IsArchive reports whether path names a supported archive: .tar, .tar.gz,
+// .tgz or .zip
+func IsArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract unpacks an archive into a new temporary directory, which the caller
+// removes, and returns it with the app root inside it. When everything is
+// under one top-level directory, as with `git archive --prefix`, that
+// directory is the root unless encore.app sits beside it.
+func Extract(archive string) (root, tmpDir string, err error) {
+	dir, err := os.MkdirTemp("", "encore-migrate-app-")
+	if err != nil {
+		return "", "", fmt.Errorf("creating directory for app archive: %w", err)
+	}
+
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		err = extractZip(archive, dir)
+	} else {
+		err = extractTar(archive, dir)
+	}
+	if err == nil {
+		root, err = appRoot(dir)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", fmt.Errorf("extracting %s: %w", archive, err)
+	}
+	return root, dir, nil
+}
+
+// appRoot descends into a lone top-level directory
+func appRoot(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, appMarker)); err == nil {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
+
+func extractTar(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lower := strings.ToLower(archive)
+	return untar(f, dir, strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz"))
+}
+
+// untar extracts a tar stream, optionally gzip-compressed, into dir
+func untar(r io.Reader, dir string, gzipped bool) error {
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = writeEntry(dir, hdr.Name, os.ModeDir, nil, "")
+		case tar.TypeReg:
+			err = writeEntry(dir, hdr.Name, hdr.FileInfo().Mode(), tr, "")
+		case tar.TypeSymlink:
+			err = writeEntry(dir, hdr.Name, os.ModeSymlink, nil, hdr.Linkname)
+		default:
+			// Hard links, devices and pax headers carry no source
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(archive, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if err := func() error {
+			if mode.IsDir() {
+				return writeEntry(dir, f.Name, os.ModeDir, nil, "")
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			if mode&os.ModeSymlink != 0 {
+				target, err := io.ReadAll(rc)
+				if err != nil {
+					return err
+				}
+				return writeEntry(dir, f.Name, os.ModeSymlink, nil, string(target))
+			}
+			return writeEntry(dir, f.Name, mode, rc, "")
+		}(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntry creates one archive entry below dir, refusing names and
+// symlink targets that would leave it
+func writeEntry(dir, name string, mode os.FileMode, content io.Reader, linkTarget string) error {
+	rel := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if rel == "." || rel == "" {
+		return nil
+	}
+	if !filepath.IsLocal(rel) {
+		return fmt.Errorf("entry %q is outside the archive root", name)
+	}
+	path := filepath.Join(dir, rel)
+
+	if mode.IsDir() {
+		return os.MkdirAll(path, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if mode&os.ModeSymlink != 0 {
+		target := filepath.FromSlash(linkTarget)
+		if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(rel), target)) {
+			return fmt.Errorf("symlink %q points outside the archive root", name)
+		}
+		return os.Symlink(target, path)
+	}
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, content); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,114 @@
+package appsource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+)
+
+// DefaultBundleLabel is the application image label recording the digest of
+// the migration bundle built with it, e.g. set with
+// docker build --label encoredev-migrator.bundle-digest=sha256:...
+const DefaultBundleLabel = "encoredev-migrator.bundle-digest"
+
+// maxConfigSize bounds the image config read from a registry
+const maxConfigSize = 4 << 20
+
+// ImageLabels returns the labels of a container image, registry/repo:tag or
+// @digest with or without oci://. For a multi-platform index the first
+// platform's image is read; a build labels them all alike.
+func ImageLabels(ctx context.Context, image string) (map[string]string, error) {
+	if !IsOCI(image) {
+		image = OCIScheme + image
+	}
+	r, err := ParseReference(image)
+	if err != nil {
+		return nil, err
+	}
+	if err := offline.Check("reading image " + r.String()); err != nil {
+		return nil, err
+	}
+	c := newRegistryClient(r)
+
+	target := r.Digest
+	if target == "" {
+		target = r.Tag
+	}
+	m, _, err := c.fetchManifest(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("reading image %s: %w", r, err)
+	}
+	if m.isIndex() {
+		var child string
+		for _, entry := range m.Manifests {
+			// Attestation manifests are listed with platform unknown/unknown
+			if entry.Platform == nil || entry.Platform.OS != "unknown" {
+				child = entry.Digest
+				break
+			}
+		}
+		if !digestPattern.MatchString(child) {
+			return nil, fmt.Errorf("reading image %s: index lists no image", r)
+		}
+		if m, _, err = c.fetchManifest(ctx, child); err != nil {
+			return nil, fmt.Errorf("reading image %s: %w", r, err)
+		}
+	}
+	if !digestPattern.MatchString(m.Config.Digest) {
+		return nil, fmt.Errorf("reading image %s: manifest has no config", r)
+	}
+
+	resp, err := c.get(ctx, "/blobs/"+m.Config.Digest, "")
+	if err != nil {
+		return nil, fmt.Errorf("reading image %s config: %w", r, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading image %s config: %w", r, err)
+	}
+	h := newDigester(m.Config.Digest)
+	h.Write(data)
+	if got := digestOf(m.Config.Digest, h); got != m.Config.Digest {
+		return nil, fmt.Errorf("image %s config digest is %s, not %s", r, got, m.Config.Digest)
+	}
+
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing image %s config: %w", r, err)
+	}
+	return config.Config.Labels, nil
+}
+
+// ArchiveDigest is the sha256 digest of an archive file, the digest of an
+// archive bundle as an image label records it
+func ArchiveDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LabelMatches reports whether a label value names digest, either alone or
+// as the digest of a reference such as registry/repo@sha256:...
+func LabelMatches(value, digest string) bool {
+	value = strings.TrimSpace(value)
+	return value == digest || strings.HasSuffix(value, "@"+digest)
+}
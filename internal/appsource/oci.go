@@ -0,0 +1,521 @@
+package appsource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/gcpauth"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+)
+
+// OCIScheme prefixes an --app reference to an OCI artifact
+const OCIScheme = "oci://"
+
+// Media types of the manifests and layers a migration bundle may use.
+// Artifacts pushed with `oras push` carry each file or directory as a
+// layer titled by the org.opencontainers.image.title annotation.
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	annotationTitle  = "org.opencontainers.image.title"
+	annotationUnpack = "io.deis.oras.content.unpack" // set by oras on directory layers
+)
+
+// maxManifestSize bounds the manifest read from a registry
+const maxManifestSize = 4 << 20
+
+var (
+	digestPattern = regexp.MustCompile(`^(sha256:[a-f0-9]{64}|sha512:[a-f0-9]{128})$`)
+	tagPattern    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+)
+
+// IsOCI reports whether ref is an oci:// reference
+func IsOCI(ref string) bool {
+	return strings.HasPrefix(ref, OCIScheme)
+}
+
+// Reference is a parsed oci://registry/repository[:tag][@digest]
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string // pins the manifest; the tag is then only informative
+}
+
+// ParseReference parses an oci:// reference. Without a tag or digest the
+// tag is "latest".
+func ParseReference(ref string) (Reference, error) {
+	rest, ok := strings.CutPrefix(ref, OCIScheme)
+	if !ok {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q: want %sregistry/repository[:tag][@digest]", ref, OCIScheme)
+	}
+	var r Reference
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		if !digestPattern.MatchString(digest) {
+			return Reference{}, fmt.Errorf("invalid OCI reference %q: bad digest %q", ref, digest)
+		}
+		rest, r.Digest = name, digest
+	}
+	registry, repo, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || repo == "" {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q: want %sregistry/repository[:tag][@digest]", ref, OCIScheme)
+	}
+	if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo, r.Tag = repo[:i], repo[i+1:]
+		if !tagPattern.MatchString(r.Tag) {
+			return Reference{}, fmt.Errorf("invalid OCI reference %q: bad tag %q", ref, r.Tag)
+		}
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	if repo != strings.ToLower(repo) {
+		return Reference{}, fmt.Errorf("invalid OCI reference %q: repository must be lowercase", ref)
+	}
+	r.Registry, r.Repository = registry, repo
+	return r, nil
+}
+
+func (r Reference) String() string {
+	s := OCIScheme + r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// descriptor is an OCI content descriptor
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ociManifest is an image or artifact manifest, or an index of them
+type ociManifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []struct {
+		descriptor
+		Platform *struct {
+			OS string `json:"os"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+func (m *ociManifest) isIndex() bool {
+	return m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerList || len(m.Manifests) > 0
+}
+
+// Pull downloads an OCI artifact into a new temporary directory, which the
+// caller removes, verifying the manifest and every layer against their
+// digests. It returns the app root as Extract does, the directory, and the
+// manifest digest, which pins what was pulled.
+func Pull(ctx context.Context, ref string) (root, tmpDir, digest string, err error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return "", "", "", err
+	}
+	if err := offline.Check("pulling " + r.String()); err != nil {
+		return "", "", "", err
+	}
+	c := newRegistryClient(r)
+
+	manifest, digest, err := c.manifest(ctx)
+	if err != nil {
+		return "", "", "", fmt.Errorf("pulling %s: %w", r, err)
+	}
+
+	dir, err := os.MkdirTemp("", "encore-migrate-app-")
+	if err != nil {
+		return "", "", "", fmt.Errorf("creating directory for OCI artifact: %w", err)
+	}
+	for _, layer := range manifest.Layers {
+		if err = c.pullLayer(ctx, layer, dir); err != nil {
+			err = fmt.Errorf("pulling %s: layer %s: %w", r, layer.Digest, err)
+			break
+		}
+	}
+	if err == nil {
+		root, err = appRoot(dir)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", "", err
+	}
+	return root, dir, digest, nil
+}
+
+// pullLayer downloads a layer and unpacks it into dir: tar layers are
+// extracted, other files are written under their title
+func (c *registryClient) pullLayer(ctx context.Context, layer descriptor, dir string) error {
+	if !digestPattern.MatchString(layer.Digest) {
+		return fmt.Errorf("invalid digest %q", layer.Digest)
+	}
+	blob, err := os.CreateTemp("", "encore-migrate-blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(blob.Name())
+	defer blob.Close()
+
+	resp, err := c.get(ctx, "/blobs/"+layer.Digest, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	h := newDigester(layer.Digest)
+	n, err := io.Copy(io.MultiWriter(blob, h), resp.Body)
+	if err != nil {
+		return fmt.Errorf("downloading: %w", err)
+	}
+	if layer.Size > 0 && n != layer.Size {
+		return fmt.Errorf("downloaded %d bytes, manifest says %d", n, layer.Size)
+	}
+	if got := digestOf(layer.Digest, h); got != layer.Digest {
+		return fmt.Errorf("content digest is %s", got)
+	}
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	title := layer.Annotations[annotationTitle]
+	lower := strings.ToLower(title)
+	switch {
+	case title == "" || layer.Annotations[annotationUnpack] == "true":
+		// An image layer, or a directory pushed with oras
+		if !strings.Contains(layer.MediaType, "tar") {
+			return fmt.Errorf("media type %s without a title annotation", layer.MediaType)
+		}
+		return untar(blob, dir, strings.Contains(layer.MediaType, "gzip"))
+	case strings.HasSuffix(lower, ".zip"):
+		return extractZip(blob.Name(), dir)
+	case IsArchive(title):
+		return untar(blob, dir, strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz"))
+	default:
+		return writeEntry(dir, title, 0o644, blob, "")
+	}
+}
+
+// registryClient talks to the OCI distribution API of one repository
+type registryClient struct {
+	ref           Reference
+	base          string // scheme and host of the API
+	authorization string // Authorization header after a challenge
+	client        *http.Client
+}
+
+func newRegistryClient(r Reference) *registryClient {
+	scheme, host := "https", r.Registry
+	if host == "docker.io" || host == "index.docker.io" {
+		host = "registry-1.docker.io"
+	}
+	// Like docker, talk plain HTTP to registries on the local machine
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" || net.ParseIP(hostname).IsLoopback() {
+		scheme = "http"
+	}
+	return &registryClient{ref: r, base: scheme + "://" + host, client: http.DefaultClient}
+}
+
+// manifest fetches the artifact's manifest and returns it with its digest,
+// which must match a pinned digest
+func (c *registryClient) manifest(ctx context.Context) (*ociManifest, string, error) {
+	target := c.ref.Digest
+	if target == "" {
+		target = c.ref.Tag
+	}
+	m, digest, err := c.fetchManifest(ctx, target)
+	if err != nil {
+		return nil, "", err
+	}
+	if m.isIndex() {
+		return nil, "", fmt.Errorf("%s is a multi-platform index, not a migration bundle", c.ref)
+	}
+	if len(m.Layers) == 0 {
+		return nil, "", fmt.Errorf("manifest has no layers")
+	}
+	return m, digest, nil
+}
+
+// fetchManifest fetches a manifest or index by tag or digest, verifying
+// its content against a digest
+func (c *registryClient) fetchManifest(ctx context.Context, target string) (*ociManifest, string, error) {
+	accept := strings.Join([]string{mediaTypeOCIManifest, mediaTypeDockerManifest, mediaTypeOCIIndex, mediaTypeDockerList}, ", ")
+	resp, err := c.get(ctx, "/manifests/"+target, accept)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading manifest: %w", err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, "", fmt.Errorf("manifest exceeds %d bytes", maxManifestSize)
+	}
+
+	algorithm := "sha256:"
+	pinned := digestPattern.MatchString(target)
+	if pinned {
+		algorithm = target[:strings.Index(target, ":")+1]
+	}
+	h := newDigester(algorithm)
+	h.Write(data)
+	digest := digestOf(algorithm, h)
+	if pinned && digest != target {
+		return nil, "", fmt.Errorf("manifest digest is %s, not the pinned %s", digest, target)
+	}
+
+	var m ociManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, "", fmt.Errorf("parsing manifest: %w", err)
+	}
+	if m.MediaType == "" {
+		m.MediaType = resp.Header.Get("Content-Type")
+	}
+	return &m, digest, nil
+}
+
+// get requests a repository path, answering one authentication challenge
+func (c *registryClient) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	url := c.base + "/v2/" + c.ref.Repository + path
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			if err := c.authenticate(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if msg := strings.TrimSpace(string(body)); msg != "" {
+			return nil, fmt.Errorf("GET %s: %s: %s", url, resp.Status, msg)
+		}
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+}
+
+// authenticate answers a Basic or Bearer challenge with the registry's
+// credentials, or anonymously for a Bearer token without any
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	user, secret, err := registryCredentials(ctx, c.ref.Registry)
+	if err != nil {
+		return err
+	}
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if user == "" {
+			return fmt.Errorf("registry %s requires credentials; run docker login %s", c.ref.Registry, c.ref.Registry)
+		}
+		c.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+secret))
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("registry %s: unsupported authentication challenge %q", c.ref.Registry, challenge)
+	}
+
+	p := parseChallenge(params)
+	if p["realm"] == "" {
+		return fmt.Errorf("registry %s: bearer challenge without realm", c.ref.Registry)
+	}
+	scope := p["scope"]
+	if scope == "" {
+		scope = "repository:" + c.ref.Repository + ":pull"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p["realm"], nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	if p["service"] != "" {
+		q.Set("service", p["service"])
+	}
+	q.Set("scope", scope)
+	req.URL.RawQuery = q.Encode()
+	if user != "" {
+		req.SetBasicAuth(user, secret)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := gcpauth.DoJSON(req, &token); err != nil {
+		return fmt.Errorf("getting a token for %s: %w", c.ref.Registry, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return fmt.Errorf("registry %s returned an empty token", c.ref.Registry)
+	}
+	c.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// parseChallenge parses the comma-separated key="value" pairs of a challenge
+func parseChallenge(params string) map[string]string {
+	p := map[string]string{}
+	for params != "" {
+		key, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		p[key] = value
+		_, params, _ = strings.Cut(rest, ",")
+	}
+	return p
+}
+
+// registryCredentials finds credentials for a registry the way docker does:
+// a credential helper or an auth entry in $DOCKER_CONFIG/config.json. Google
+// Artifact Registry and Container Registry fall back to Application Default
+// Credentials. Empty credentials mean anonymous access.
+func registryCredentials(ctx context.Context, registry string) (user, secret string, err error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".docker")
+	}
+	key := registry
+	if registry == "docker.io" || registry == "index.docker.io" {
+		key = "https://index.docker.io/v1/"
+	}
+
+	var cfg struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredHelpers map[string]string `json:"credHelpers"`
+		CredsStore  string            `json:"credsStore"`
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "config.json")); err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return "", "", fmt.Errorf("parsing docker config: %w", err)
+		}
+	}
+
+	helper := cfg.CredHelpers[key]
+	if helper == "" {
+		helper = cfg.CredsStore
+	}
+	if helper != "" {
+		user, secret, err := credentialHelper(ctx, helper, key)
+		if err != nil || user != "" {
+			return user, secret, err
+		}
+	}
+	for _, k := range []string{key, "https://" + key} {
+		if entry, ok := cfg.Auths[k]; ok && entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("docker config auth for %s: %w", registry, err)
+			}
+			user, secret, _ := strings.Cut(string(decoded), ":")
+			return user, secret, nil
+		}
+	}
+
+	if strings.HasSuffix(registry, "-docker.pkg.dev") || registry == "gcr.io" || strings.HasSuffix(registry, ".gcr.io") {
+		token, err := gcpauth.AccessToken(ctx)
+		if err != nil {
+			return "", "", fmt.Errorf("getting Application Default Credentials token for %s: %w", registry, err)
+		}
+		return "oauth2accesstoken", token, nil
+	}
+	return "", "", nil
+}
+
+// credentialHelper runs docker-credential-<helper> get. A helper without
+// credentials for the registry yields none.
+func credentialHelper(ctx context.Context, helper, registry string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(string(out)+stderr.String(), "credentials not found") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("docker-credential-%s: %w: %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("docker-credential-%s: %w", helper, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func newDigester(digest string) hash.Hash {
+	if strings.HasPrefix(digest, "sha512:") {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func digestOf(digest string, h hash.Hash) string {
+	algorithm, _, _ := strings.Cut(digest, ":")
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,366 @@
+// Package cloudsql dials Cloud SQL for PostgreSQL instances the way the
+// Cloud SQL connectors do: it fetches the instance's address and server CA
+// and an ephemeral client certificate from the SQL Admin API, then opens a
+// mutually authenticated TLS connection to the instance's server-side proxy.
+// No auth proxy sidecar is needed.
+package cloudsql
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/gcpauth"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+)
+
+// serverProxyPort is the port of the server-side proxy on every instance
+const serverProxyPort = "3307"
+
+// certRefreshMargin renews an ephemeral certificate this long before it expires
+const certRefreshMargin = 4 * time.Minute
+
+// sqlAdminEndpoint is the SQL Admin REST API base
+var sqlAdminEndpoint = "https://sqladmin.googleapis.com/sql/v1beta4/"
+
+// IP types selecting which instance address to dial
+const (
+	IPTypePublic  = "public"
+	IPTypePrivate = "private"
+)
+
+// Instance is a parsed instance connection name, project:region:instance.
+// Projects in a domain, such as example.com:project, keep their prefix.
+type Instance struct {
+	Project string
+	Region  string
+	Name    string
+}
+
+// ParseInstance parses an instance connection name
+func ParseInstance(connectionName string) (Instance, error) {
+	parts := strings.Split(connectionName, ":")
+	if len(parts) < 3 || len(parts) > 4 {
+		return Instance{}, fmt.Errorf("invalid Cloud SQL instance %q (want project:region:instance)", connectionName)
+	}
+	n := len(parts)
+	inst := Instance{Project: strings.Join(parts[:n-2], ":"), Region: parts[n-2], Name: parts[n-1]}
+	for _, p := range []string{inst.Project, inst.Region, inst.Name} {
+		if p == "" {
+			return Instance{}, fmt.Errorf("invalid Cloud SQL instance %q (want project:region:instance)", connectionName)
+		}
+	}
+	return inst, nil
+}
+
+func (i Instance) String() string {
+	return i.Project + ":" + i.Region + ":" + i.Name
+}
+
+// Dialer connects to one instance. It implements lib/pq's Dialer and
+// DialerContext, and ignores the address lib/pq asks for.
+type Dialer struct {
+	Instance Instance
+	// IAMAuthN embeds the caller's OAuth2 token in the client certificate so
+	// the database user authenticates as an IAM principal without a password
+	IAMAuthN bool
+	// IPType is IPTypePublic (the default) or IPTypePrivate
+	IPType string
+	// MinVersion raises the minimum TLS version from TLS 1.2
+	MinVersion uint16
+}
+
+// Dial implements pq.Dialer
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements pq.Dialer
+func (d *Dialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext
+func (d *Dialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	info, err := connectInfo(ctx, d.Instance, d.IAMAuthN)
+	if err != nil {
+		return nil, err
+	}
+	ip, err := info.address(d.IPType)
+	if err != nil {
+		return nil, fmt.Errorf("Cloud SQL instance %s: %w", d.Instance, err)
+	}
+
+	var nd net.Dialer
+	raw, err := nd.DialContext(ctx, "tcp", net.JoinHostPort(ip, serverProxyPort))
+	if err != nil {
+		return nil, fmt.Errorf("dialing Cloud SQL instance %s: %w", d.Instance, err)
+	}
+	conf := info.tlsConfig(d.Instance)
+	conf.MinVersion = max(conf.MinVersion, d.MinVersion)
+	conn := tls.Client(raw, conf)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("TLS handshake with Cloud SQL instance %s: %w", d.Instance, err)
+	}
+	return conn, nil
+}
+
+// instanceInfo is what a connection needs from the SQL Admin API
+type instanceInfo struct {
+	addresses map[string]string // by IP type
+	serverCAs *x509.CertPool
+	dnsName   string
+	casCA     bool // the server certificate is issued by Certificate Authority Service
+	cert      tls.Certificate
+	expires   time.Time
+}
+
+func (i *instanceInfo) address(ipType string) (string, error) {
+	if ipType == "" {
+		ipType = IPTypePublic
+	}
+	if ip, ok := i.addresses[ipType]; ok {
+		return ip, nil
+	}
+	return "", fmt.Errorf("no %s IP address", ipType)
+}
+
+// tlsConfig verifies the server against the instance's CA. Certificates from
+// Certificate Authority Service carry the instance's DNS name and are
+// verified as usual; older per-instance CAs only name the instance as
+// project:instance in the common name, which crypto/tls no longer checks, so
+// for those the chain and name are verified in VerifyConnection instead.
+func (i *instanceInfo) tlsConfig(inst Instance) *tls.Config {
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{i.cert},
+		RootCAs:      i.serverCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if i.casCA && i.dnsName != "" {
+		conf.ServerName = strings.TrimSuffix(i.dnsName, ".")
+		return conf
+	}
+
+	conf.InsecureSkipVerify = true // only skips the host name check; see VerifyConnection
+	conf.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("server sent no certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		leaf := cs.PeerCertificates[0]
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: i.serverCAs, Intermediates: intermediates}); err != nil {
+			return fmt.Errorf("verifying server certificate: %w", err)
+		}
+		if leaf.Subject.CommonName != inst.Project+":"+inst.Name {
+			return fmt.Errorf("server certificate is not for instance %s", inst)
+		}
+		return nil
+	}
+	return conf
+}
+
+var (
+	keyOnce   sync.Once
+	clientKey *rsa.PrivateKey
+	keyErr    error
+
+	infoMu sync.Mutex
+	infos  = map[string]*cachedInfo{} // by instance and IAM mode
+)
+
+// cachedInfo is an instance's connection details and the refresh, if any,
+// replacing them
+type cachedInfo struct {
+	info    *instanceInfo
+	err     error         // of the last refresh
+	refresh chan struct{} // closed when the running refresh ends; nil when none runs
+}
+
+// connectInfo returns the instance's connection details and a client
+// certificate, cached until the certificate is about to expire. Dials of an
+// instance wait for one refresh; other instances refresh independently.
+func connectInfo(ctx context.Context, inst Instance, iam bool) (*instanceInfo, error) {
+	if err := offline.Check("Cloud SQL connector for " + inst.String()); err != nil {
+		return nil, err
+	}
+	keyOnce.Do(func() {
+		clientKey, keyErr = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	if keyErr != nil {
+		return nil, fmt.Errorf("generating client key: %w", keyErr)
+	}
+
+	cacheKey := fmt.Sprintf("%s/%t", inst, iam)
+	infoMu.Lock()
+	cached, ok := infos[cacheKey]
+	if !ok {
+		cached = &cachedInfo{}
+		infos[cacheKey] = cached
+	}
+	if cached.info != nil && time.Now().Before(cached.info.expires) {
+		infoMu.Unlock()
+		return cached.info, nil
+	}
+
+	done := cached.refresh
+	if done == nil {
+		done = make(chan struct{})
+		cached.refresh = done
+		infoMu.Unlock()
+
+		info, err := fetchInfo(ctx, inst, iam)
+
+		infoMu.Lock()
+		cached.err, cached.refresh = err, nil
+		if err == nil {
+			cached.info = info
+		}
+		infoMu.Unlock()
+		close(done)
+		return info, err
+	}
+	infoMu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	infoMu.Lock()
+	defer infoMu.Unlock()
+	if cached.err != nil {
+		return nil, cached.err
+	}
+	return cached.info, nil
+}
+
+// fetchInfo gets the instance's connection details and a client certificate
+// from the SQL Admin API
+func fetchInfo(ctx context.Context, inst Instance, iam bool) (*instanceInfo, error) {
+	creds, err := gcpauth.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("finding Application Default Credentials: %w", err)
+	}
+	token, err := creds.TokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("getting Application Default Credentials token: %w", err)
+	}
+	base := sqlAdminEndpoint + "projects/" + inst.Project + "/instances/" + inst.Name
+
+	var settings struct {
+		IPAddresses []struct {
+			Type      string `json:"type"`
+			IPAddress string `json:"ipAddress"`
+		} `json:"ipAddresses"`
+		ServerCACert struct {
+			Cert string `json:"cert"`
+		} `json:"serverCaCert"`
+		ServerCAMode    string `json:"serverCaMode"`
+		DNSName         string `json:"dnsName"`
+		Region          string `json:"region"`
+		DatabaseVersion string `json:"databaseVersion"`
+	}
+	if err := call(ctx, token.AccessToken, http.MethodGet, base+"/connectSettings", nil, &settings); err != nil {
+		return nil, fmt.Errorf("getting connect settings of %s: %w", inst, err)
+	}
+	if settings.Region != "" && settings.Region != inst.Region {
+		return nil, fmt.Errorf("Cloud SQL instance %s is in region %s", inst, settings.Region)
+	}
+	if !strings.HasPrefix(settings.DatabaseVersion, "POSTGRES") {
+		return nil, fmt.Errorf("Cloud SQL instance %s runs %s, not PostgreSQL", inst, settings.DatabaseVersion)
+	}
+
+	info := &instanceInfo{
+		addresses: map[string]string{},
+		serverCAs: x509.NewCertPool(),
+		dnsName:   settings.DNSName,
+		casCA:     strings.HasSuffix(settings.ServerCAMode, "_CAS_CA"),
+	}
+	for _, addr := range settings.IPAddresses {
+		switch addr.Type {
+		case "PRIMARY":
+			info.addresses[IPTypePublic] = addr.IPAddress
+		case "PRIVATE":
+			info.addresses[IPTypePrivate] = addr.IPAddress
+		}
+	}
+	if !info.serverCAs.AppendCertsFromPEM([]byte(settings.ServerCACert.Cert)) {
+		return nil, fmt.Errorf("Cloud SQL instance %s returned no server CA certificate", inst)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	request := map[string]string{
+		"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+	}
+	if iam {
+		request["access_token"] = token.AccessToken
+	}
+	var ephemeral struct {
+		EphemeralCert struct {
+			Cert string `json:"cert"`
+		} `json:"ephemeralCert"`
+	}
+	if err := call(ctx, token.AccessToken, http.MethodPost, base+":generateEphemeralCert", request, &ephemeral); err != nil {
+		return nil, fmt.Errorf("getting a client certificate for %s: %w", inst, err)
+	}
+
+	block, _ := pem.Decode([]byte(ephemeral.EphemeralCert.Cert))
+	if block == nil {
+		return nil, fmt.Errorf("Cloud SQL instance %s returned an invalid client certificate", inst)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing client certificate: %w", err)
+	}
+	info.cert = tls.Certificate{Certificate: [][]byte{block.Bytes}, PrivateKey: clientKey, Leaf: cert}
+
+	// the server rejects an IAM login once the embedded token expires, even
+	// though the certificate itself is still valid
+	expires := cert.NotAfter
+	if iam && !token.Expiry.IsZero() && token.Expiry.Before(expires) {
+		expires = token.Expiry
+	}
+	info.expires = expires.Add(-certRefreshMargin)
+	return info, nil
+}
+
+// call sends an authenticated SQL Admin API request with an optional JSON body
+func call(ctx context.Context, token, method, url string, body, v any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return gcpauth.DoJSON(req, v)
+}
@@ -0,0 +1,129 @@
+package cloudsql
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority issuing server certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCA{cert: cert, key: key}
+}
+
+// issue returns a server certificate with the common name and DNS names
+func (ca testCA) issue(t *testing.T, commonName string, dnsNames ...string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake runs a TLS handshake between a server presenting cert and a
+// client using conf, returning the client's error
+func handshake(t *testing.T, conf *tls.Config, cert tls.Certificate) error {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return tls.Client(conn, conf).Handshake()
+}
+
+func TestTLSConfig(t *testing.T) {
+	inst := Instance{Project: "proj", Region: "europe-west1", Name: "db"}
+	const dnsName = "abc123.europe-west1.sql.goog."
+	instanceCA := newTestCA(t, "instance CA")
+	otherCA := newTestCA(t, "other CA")
+
+	tests := []struct {
+		name    string
+		casCA   bool
+		cert    tls.Certificate
+		wantErr bool
+	}{
+		{name: "CAS certificate for the DNS name", casCA: true, cert: instanceCA.issue(t, "", "abc123.europe-west1.sql.goog")},
+		{name: "CAS certificate for another DNS name", casCA: true, cert: instanceCA.issue(t, "", "other.europe-west1.sql.goog"), wantErr: true},
+		{name: "CAS certificate from another CA", casCA: true, cert: otherCA.issue(t, "", "abc123.europe-west1.sql.goog"), wantErr: true},
+		{name: "legacy common name", cert: instanceCA.issue(t, "proj:db")},
+		{name: "legacy wrong common name", cert: instanceCA.issue(t, "proj:other"), wantErr: true},
+		{name: "legacy certificate from another CA", cert: otherCA.issue(t, "proj:db"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots := x509.NewCertPool()
+			roots.AddCert(instanceCA.cert)
+			info := &instanceInfo{serverCAs: roots, dnsName: dnsName, casCA: tt.casCA}
+
+			err := handshake(t, info.tlsConfig(inst), tt.cert)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
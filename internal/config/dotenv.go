@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultEnvFile is the env file loaded from the app root when present
+const DefaultEnvFile = ".env"
+
+// LoadEnvFile sets the variables of a .env file that are not already set in
+// the environment, so exported values win over the file. It returns the names
+// it set.
+//
+// Lines are KEY=VALUE, optionally prefixed with "export ". Blank lines and
+// lines starting with # are skipped. Single-quoted values are literal;
+// double-quoted values expand \n, \t, \" and \\; unquoted values end at " #".
+func LoadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening env file: %w", err)
+	}
+	defer f.Close()
+
+	var set []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := parseEnvLine(line)
+		if err != nil {
+			return set, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if _, exists := os.LookupEnv(key); exists {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return set, fmt.Errorf("%s:%d: setting %s: %w", path, n, key, err)
+		}
+		set = append(set, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return set, fmt.Errorf("reading env file: %w", err)
+	}
+	return set, nil
+}
+
+// parseEnvLine splits a non-blank, non-comment .env line into key and value
+func parseEnvLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(line, "export ")
+	key, value, ok := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !validEnvName(key) {
+		return "", "", fmt.Errorf("want KEY=VALUE, got %q", line)
+	}
+	value = strings.TrimSpace(value)
+
+	switch {
+	case value == "":
+		return key, "", nil
+	case value[0] == '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("%s: unterminated single quote", key)
+		}
+		return key, value[1 : end+1], nil
+	case value[0] == '"':
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == '"':
+				return key, b.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(value[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", "", fmt.Errorf("%s: unterminated double quote", key)
+	}
+
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return key, value, nil
+}
+
+// validEnvName reports whether name is a portable environment variable name
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
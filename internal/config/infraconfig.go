@@ -3,22 +3,67 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/theoffensivecoder/encoredev-migrator/internal/cloudsql"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/credexec"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/gcpsecret"
 	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+	"gopkg.in/yaml.v3"
 )
 
 // InfraConfig represents the Encore infrastructure configuration
 type InfraConfig struct {
+	Metadata   *Metadata   `json:"metadata,omitempty"`
 	SQLServers []SQLServer `json:"sql_servers"`
 }
 
+// Metadata describes the environment an InfraConfig belongs to
+type Metadata struct {
+	AppID   string `json:"app_id,omitempty"`
+	EnvName string `json:"env_name,omitempty"`
+	EnvType string `json:"env_type,omitempty"` // e.g. production, development, ephemeral
+	Cloud   string `json:"cloud,omitempty"`
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// EnvTypeProduction is the metadata env_type of production environments
+const EnvTypeProduction = "production"
+
+// IsProduction reports whether the config is labelled as a production environment
+func (c *InfraConfig) IsProduction() bool {
+	return c.Metadata != nil && strings.EqualFold(c.Metadata.EnvType, EnvTypeProduction)
+}
+
 // SQLServer represents a PostgreSQL server configuration
 type SQLServer struct {
 	Host      string                    `json:"host"`
 	TLSConfig *TLSConfig                `json:"tls_config,omitempty"`
 	Databases map[string]DatabaseConfig `json:"databases"` // key is Encore DB name
+
+	// CloudSQLInstance connects through the Cloud SQL connector to this
+	// project:region:instance instead of Host, authenticating with
+	// Application Default Credentials; tls_config is not used
+	CloudSQLInstance string `json:"cloudsql_instance,omitempty"`
+	// CloudSQLIAMAuth logs in as the IAM principal named by username, with
+	// no password
+	CloudSQLIAMAuth bool `json:"cloudsql_iam_auth,omitempty"`
+	// CloudSQLIPType is "public" (the default) or "private"
+	CloudSQLIPType string `json:"cloudsql_ip_type,omitempty"`
+
+	// KerberosServiceName authenticates with GSSAPI when the server asks for
+	// it, to the principal <krb_srvname>/<host> (default postgres);
+	// KerberosSPN names the whole principal instead. Tickets come from the
+	// credential cache kinit fills, see package kerberos.
+	KerberosServiceName string `json:"krb_srvname,omitempty"`
+	KerberosSPN         string `json:"krb_spn,omitempty"`
+	// ChannelBinding is SCRAM-SHA-256-PLUS channel binding, as in libpq:
+	// "disable", "prefer" (the default) or "require". The driver doesn't
+	// implement it, so prefer never binds and require is refused.
+	ChannelBinding string `json:"channel_binding,omitempty"`
 }
 
 // TLSConfig represents TLS settings for database connections
@@ -45,11 +90,20 @@ type DatabaseConfig struct {
 	MaxConnections *int           `json:"max_connections"` // optional max pool size
 }
 
-// StringOrEnvRef handles both string literals and {"$env": "VAR"} references
+// StringOrEnvRef handles string literals, {"$env": "VAR"} references,
+// {"$gcp_secret": "projects/p/secrets/s/versions/v"} Secret Manager references
+// and {"$exec": "get-db-cred --db users"} credential commands
 type StringOrEnvRef struct {
-	Value  string
-	EnvVar string
-	IsEnv  bool
+	Value     string
+	EnvVar    string
+	IsEnv     bool
+	GCPSecret string   // secret version resource name; set for $gcp_secret references
+	Exec      []string // command and arguments; set for $exec references, see credexec.Run
+}
+
+// IsLiteral reports whether the value is written in the config rather than referenced
+func (s *StringOrEnvRef) IsLiteral() bool {
+	return !s.IsEnv && s.GCPSecret == "" && len(s.Exec) == 0
 }
 
 // UnmarshalJSON implements custom unmarshaling for StringOrEnvRef
@@ -62,12 +116,43 @@ func (s *StringOrEnvRef) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 
-	// Try parsing as {"$env": "VAR_NAME"} object
+	// Try parsing as {"$env": "VAR_NAME"}, {"$gcp_secret": "projects/..."}
+	// or {"$exec": "command args"} object
 	var envRef struct {
-		Env string `json:"$env"`
+		Env       string          `json:"$env"`
+		GCPSecret string          `json:"$gcp_secret"`
+		Exec      json.RawMessage `json:"$exec"`
 	}
 	if err := json.Unmarshal(data, &envRef); err != nil {
-		return fmt.Errorf("invalid value: expected string or {\"$env\": \"VAR_NAME\"}")
+		return fmt.Errorf("invalid value: expected string, {\"$env\": \"VAR_NAME\"}, {\"$gcp_secret\": \"projects/p/secrets/s/versions/v\"} or {\"$exec\": \"command args\"}")
+	}
+
+	if envRef.Exec != nil {
+		if envRef.Env != "" || envRef.GCPSecret != "" {
+			return fmt.Errorf("invalid value: $exec, $env and $gcp_secret are mutually exclusive")
+		}
+		// A string is split at spaces; an array passes arguments containing them
+		var line string
+		if err := json.Unmarshal(envRef.Exec, &line); err == nil {
+			s.Exec = strings.Fields(line)
+		} else if err := json.Unmarshal(envRef.Exec, &s.Exec); err != nil {
+			return fmt.Errorf("invalid $exec: want a command line or an array of arguments")
+		}
+		if len(s.Exec) == 0 || s.Exec[0] == "" {
+			return fmt.Errorf("empty $exec command")
+		}
+		return nil
+	}
+
+	if envRef.GCPSecret != "" {
+		if envRef.Env != "" {
+			return fmt.Errorf("invalid value: $env and $gcp_secret are mutually exclusive")
+		}
+		if !gcpsecret.ValidName(envRef.GCPSecret) {
+			return fmt.Errorf("invalid $gcp_secret %q: want projects/<project>/secrets/<secret>/versions/<version>", envRef.GCPSecret)
+		}
+		s.GCPSecret = envRef.GCPSecret
+		return nil
 	}
 
 	if envRef.Env == "" {
@@ -79,8 +164,31 @@ func (s *StringOrEnvRef) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// Resolve returns the actual value, resolving env vars if needed
+// UnmarshalYAML accepts the same forms as UnmarshalJSON, for references in
+// the project config
+func (s *StringOrEnvRef) UnmarshalYAML(node *yaml.Node) error {
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	if err := s.UnmarshalJSON(data); err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	return nil
+}
+
+// Resolve returns the actual value, resolving env vars and secrets if needed
 func (s *StringOrEnvRef) Resolve() (string, error) {
+	if s.GCPSecret != "" {
+		return gcpsecret.Access(s.GCPSecret)
+	}
+	if len(s.Exec) > 0 {
+		return credexec.Run(s.Exec)
+	}
 	if !s.IsEnv {
 		return s.Value, nil
 	}
@@ -103,6 +211,12 @@ func (s *StringOrEnvRef) MustResolve() string {
 
 // String returns a safe representation (not revealing secrets)
 func (s *StringOrEnvRef) String() string {
+	if s.GCPSecret != "" {
+		return fmt.Sprintf("$gcp_secret:%s", s.GCPSecret)
+	}
+	if len(s.Exec) > 0 {
+		return fmt.Sprintf("$exec:%s", strings.Join(s.Exec, " "))
+	}
 	if s.IsEnv {
 		return fmt.Sprintf("$env:%s", s.EnvVar)
 	}
@@ -124,63 +238,186 @@ func LoadInfraConfig(path string) (*InfraConfig, error) {
 	return &config, nil
 }
 
+// Resolution records how a DatabaseMapping was resolved, for explaining configuration
+type Resolution struct {
+	ServerIndex int               // index into sql_servers of the matching server
+	ServerHost  string            // the server's host entry as written
+	Fields      []FieldResolution // credential and name fields, in resolution order
+	SSLMode     string            // resolved sslmode
+	SSLReason   string            // why that sslmode was chosen
+}
+
+// FieldResolution describes where one mapping field came from
+type FieldResolution struct {
+	Field     string // e.g. "username"
+	Source    string // "literal", "env", "gcp_secret", "exec", or "default"
+	EnvVar    string // set when Source is "env"
+	GCPSecret string // set when Source is "gcp_secret"
+	Exec      string // command line; set when Source is "exec"
+	Value     string // resolved value (callers redact secrets)
+}
+
 // GetMapping returns a DatabaseMapping for the given Encore database name
 func (c *InfraConfig) GetMapping(encoreName string) (*types.DatabaseMapping, error) {
-	for _, server := range c.SQLServers {
+	mapping, _, err := c.ResolveMapping(encoreName)
+	return mapping, err
+}
+
+// ResolveMapping returns a DatabaseMapping for the given Encore database name
+// together with a record of how each field was resolved
+func (c *InfraConfig) ResolveMapping(encoreName string) (*types.DatabaseMapping, *Resolution, error) {
+	for i, server := range c.SQLServers {
 		if dbConfig, ok := server.Databases[encoreName]; ok {
+			res := &Resolution{ServerIndex: i, ServerHost: server.Host}
+			if server.CloudSQLInstance != "" {
+				res.ServerHost = "cloudsql " + server.CloudSQLInstance
+				if err := server.validateCloudSQL(); err != nil {
+					return nil, res, err
+				}
+			}
+			if err := server.validateAuth(); err != nil {
+				return nil, res, err
+			}
+
 			// Parse host and port
 			host, port := parseHostPort(server.Host)
 
 			// Resolve credentials
 			username, err := dbConfig.Username.Resolve()
 			if err != nil {
-				return nil, fmt.Errorf("resolving username for %s: %w", encoreName, err)
+				return nil, res, fmt.Errorf("resolving username for %s: %w", encoreName, err)
 			}
+			res.Fields = append(res.Fields, fieldResolution("username", &dbConfig.Username, username))
 
 			password, err := dbConfig.Password.Resolve()
 			if err != nil {
-				return nil, fmt.Errorf("resolving password for %s: %w", encoreName, err)
+				return nil, res, fmt.Errorf("resolving password for %s: %w", encoreName, err)
 			}
+			res.Fields = append(res.Fields, fieldResolution("password", &dbConfig.Password, password))
 
 			// Resolve actual database name (defaults to Encore name if not specified)
 			pgDBName, err := dbConfig.Name.Resolve()
 			if err != nil {
 				// If name resolution fails but value is empty, use encore name
-				if dbConfig.Name.Value == "" && !dbConfig.Name.IsEnv {
+				if dbConfig.Name.Value == "" && dbConfig.Name.IsLiteral() {
 					pgDBName = encoreName
 				} else {
-					return nil, fmt.Errorf("resolving database name for %s: %w", encoreName, err)
+					return nil, res, fmt.Errorf("resolving database name for %s: %w", encoreName, err)
 				}
 			}
+			nameField := fieldResolution("name", &dbConfig.Name, pgDBName)
 			if pgDBName == "" {
 				pgDBName = encoreName
+				nameField = FieldResolution{Field: "name", Source: "default", Value: pgDBName}
 			}
+			res.Fields = append(res.Fields, nameField)
 
-			// Determine SSL mode
-			// Default to disable; only enable if client cert is specified and TLS is not disabled
-			sslMode := "disable"
-			if server.TLSConfig != nil && !server.TLSConfig.Disabled && server.TLSConfig.ClientCert != nil {
-				sslMode = "require"
+			// Determine SSL mode: without a tls_config, or with it disabled,
+			// connect in plain text; otherwise verify as much as the config allows
+			tls := server.TLSConfig
+			switch {
+			case server.CloudSQLInstance != "":
+				res.SSLMode, res.SSLReason = "disable", "the Cloud SQL connector encrypts and authenticates the connection itself"
+				tls = nil
+			case tls == nil:
+				res.SSLMode, res.SSLReason = "disable", "no tls_config"
+			case tls.Disabled:
+				res.SSLMode, res.SSLReason = "disable", "tls_config.disabled is true"
+			case tls.DisableCAValidation:
+				res.SSLMode, res.SSLReason = "require", "tls_config.disable_ca_validation is true"
+			case tls.DisableTLSHostnameVerification:
+				res.SSLMode, res.SSLReason = "verify-ca", "tls_config.disable_tls_hostname_verification is true"
+			default:
+				res.SSLMode, res.SSLReason = "verify-full", "tls_config verifies the CA and hostname"
 			}
 
-			return &types.DatabaseMapping{
+			mapping := &types.DatabaseMapping{
 				EncoreName: encoreName,
 				PGDBName:   pgDBName,
 				Host:       host,
 				Port:       port,
 				Username:   username,
 				Password:   password,
-				SSLMode:    sslMode,
-			}, nil
+				SSLMode:    res.SSLMode,
+				Production: c.IsProduction(),
+			}
+			if server.CloudSQLInstance != "" {
+				mapping.Host, mapping.Port = "", ""
+				mapping.CloudSQLInstance = server.CloudSQLInstance
+				mapping.CloudSQLIAMAuth = server.CloudSQLIAMAuth
+				mapping.CloudSQLIPType = server.CloudSQLIPType
+			}
+			mapping.KerberosServiceName = server.KerberosServiceName
+			mapping.KerberosSPN = server.KerberosSPN
+			if tls != nil && !tls.Disabled {
+				// A CA would make lib/pq verify it even in require mode
+				if !tls.DisableCAValidation {
+					mapping.SSLRootCert = tls.CA
+				}
+				if tls.ClientCert != nil {
+					mapping.SSLCert = tls.ClientCert.Cert
+					mapping.SSLKey = tls.ClientCert.Key
+				}
+			}
+			return mapping, res, nil
 		}
 	}
 
-	return nil, &types.ConfigError{
+	return nil, nil, &types.ConfigError{
 		Field:   "sql_servers.databases",
 		Message: fmt.Sprintf("database %q not found in InfraConfig", encoreName),
 	}
 }
 
+// validateCloudSQL checks the Cloud SQL settings of a server
+func (s SQLServer) validateCloudSQL() error {
+	if _, err := cloudsql.ParseInstance(s.CloudSQLInstance); err != nil {
+		return &types.ConfigError{Field: "sql_servers.cloudsql_instance", Message: err.Error()}
+	}
+	switch s.CloudSQLIPType {
+	case "", cloudsql.IPTypePublic, cloudsql.IPTypePrivate:
+		return nil
+	}
+	return &types.ConfigError{
+		Field:   "sql_servers.cloudsql_ip_type",
+		Message: fmt.Sprintf("unknown IP type %q (want %s or %s)", s.CloudSQLIPType, cloudsql.IPTypePublic, cloudsql.IPTypePrivate),
+	}
+}
+
+// validateAuth checks the Kerberos and channel binding settings of a server
+func (s SQLServer) validateAuth() error {
+	if s.CloudSQLInstance != "" && (s.KerberosServiceName != "" || s.KerberosSPN != "") {
+		return &types.ConfigError{Field: "sql_servers.krb_srvname", Message: "Cloud SQL does not support Kerberos authentication"}
+	}
+	switch s.ChannelBinding {
+	case "", "disable", "prefer":
+		return nil
+	case "require":
+		return &types.ConfigError{
+			Field:   "sql_servers.channel_binding",
+			Message: "require is not supported: lib/pq does not implement SCRAM-SHA-256-PLUS; authenticate the server with tls_config instead (sslmode verify-full)",
+		}
+	}
+	return &types.ConfigError{
+		Field:   "sql_servers.channel_binding",
+		Message: fmt.Sprintf("unknown channel binding %q (want disable, prefer or require)", s.ChannelBinding),
+	}
+}
+
+// fieldResolution describes a resolved StringOrEnvRef field
+func fieldResolution(field string, ref *StringOrEnvRef, value string) FieldResolution {
+	if ref.GCPSecret != "" {
+		return FieldResolution{Field: field, Source: "gcp_secret", GCPSecret: ref.GCPSecret, Value: value}
+	}
+	if len(ref.Exec) > 0 {
+		return FieldResolution{Field: field, Source: "exec", Exec: strings.Join(ref.Exec, " "), Value: value}
+	}
+	if ref.IsEnv {
+		return FieldResolution{Field: field, Source: "env", EnvVar: ref.EnvVar, Value: value}
+	}
+	return FieldResolution{Field: field, Source: "literal", Value: value}
+}
+
 // ListDatabaseNames returns all Encore database names defined in the config
 func (c *InfraConfig) ListDatabaseNames() []string {
 	var names []string
@@ -192,6 +429,21 @@ func (c *InfraConfig) ListDatabaseNames() []string {
 	return names
 }
 
+// EnvVars returns the sorted, de-duplicated environment variables referenced by $env values
+func (c *InfraConfig) EnvVars() []string {
+	seen := map[string]bool{}
+	for _, server := range c.SQLServers {
+		for _, db := range server.Databases {
+			for _, ref := range []StringOrEnvRef{db.Name, db.Username, db.Password} {
+				if ref.IsEnv {
+					seen[ref.EnvVar] = true
+				}
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
 // parseHostPort splits a host string into host and port components
 func parseHostPort(hostStr string) (host, port string) {
 	host = hostStr
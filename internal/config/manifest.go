@@ -19,8 +19,9 @@ type Manifest struct {
 
 // ManifestDatabase defines a database in the manifest
 type ManifestDatabase struct {
-	Name       string `yaml:"name" json:"name"`
-	Migrations string `yaml:"migrations" json:"migrations"`
+	Name       string      `yaml:"name" json:"name"`
+	Migrations string      `yaml:"migrations" json:"migrations"`
+	Retired    *Retirement `yaml:"retired,omitempty" json:"retired,omitempty"`
 }
 
 // LoadManifest loads a manifest file and returns discovered databases
@@ -56,10 +57,10 @@ func LoadManifest(manifestPath string, rootDir string) ([]types.EncoreDatabase,
 			return nil, fmt.Errorf("manifest database %q missing migrations path", db.Name)
 		}
 
-		// Resolve relative path from the root directory
-		migrationsPath := db.Migrations
+		// Manifests store slash-separated paths; resolve relative ones from the root directory
+		migrationsPath := filepath.FromSlash(db.Migrations)
 		if !filepath.IsAbs(migrationsPath) {
-			migrationsPath = filepath.Join(rootDir, db.Migrations)
+			migrationsPath = filepath.Join(rootDir, migrationsPath)
 		}
 
 		// Validate the migrations directory exists
@@ -71,6 +72,7 @@ func LoadManifest(manifestPath string, rootDir string) ([]types.EncoreDatabase,
 			Name:           db.Name,
 			MigrationsPath: migrationsPath,
 			SourceFile:     manifestPath,
+			Retired:        db.Retired != nil,
 		})
 	}
 
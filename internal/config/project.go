@@ -0,0 +1,291 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfig holds migrator settings that are not part of Encore's InfraConfig
+type ProjectConfig struct {
+	Databases map[string]ProjectDatabase `yaml:"databases" json:"databases"` // key is Encore DB name
+	Profiles  map[string]Profile         `yaml:"profiles" json:"profiles"`   // named connection override sets
+	CI        CI                         `yaml:"ci" json:"ci"`               // settings for generated CI pipelines
+	Runs      RunHistory                 `yaml:"runs" json:"runs"`           // retention of local run reports
+	Tickets   Tickets                    `yaml:"tickets" json:"tickets"`     // change tickets recorded with up/down (--ticket)
+	Alerts    Alerts                     `yaml:"alerts" json:"alerts"`       // paging when up fails in production
+	Lint      Lint                       `yaml:"lint" json:"lint"`           // idempotency lint rules (`lint`)
+	Discovery Discovery                  `yaml:"discovery" json:"discovery"` // directories the AST scan skips or includes
+	TLS       TLSPolicy                  `yaml:"tls" json:"tls"`             // compliance baseline for database connections
+	Warnings  Warnings                   `yaml:"warnings" json:"warnings"`   // warnings not to print
+	Timeouts  Timeouts                   `yaml:"timeouts" json:"timeouts"`   // statement and lock timeouts of migration sessions
+	Pauses    Pauses                     `yaml:"pauses" json:"pauses"`       // cron jobs and subscriptions to pause around migrations
+
+	FeatureFlags FeatureFlags `yaml:"feature_flags" json:"feature_flags"` // provider switching the flags of flag-before and flag-after directives
+
+	// SkipLowerPriorityOnFailure skips the remaining priority groups once a database in an earlier group fails
+	SkipLowerPriorityOnFailure bool `yaml:"skip_lower_priority_on_failure,omitempty" json:"skip_lower_priority_on_failure,omitempty"`
+}
+
+// CI parameterizes the pipelines emitted by `ci generate`
+type CI struct {
+	Branch      string `yaml:"branch,omitempty" json:"branch,omitempty"`           // branch whose pushes deploy migrations (default main)
+	Config      string `yaml:"config,omitempty" json:"config,omitempty"`           // InfraConfig path in the repository (default: --config)
+	Profile     string `yaml:"profile,omitempty" json:"profile,omitempty"`         // connection profile to select in CI
+	Environment string `yaml:"environment,omitempty" json:"environment,omitempty"` // deployment environment gating the up job
+	Version     string `yaml:"version,omitempty" json:"version,omitempty"`         // encore-migrator version to install (default: this binary's)
+}
+
+// DefaultKeepRuns is how many local run reports are kept when runs.keep is unset
+const DefaultKeepRuns = 100
+
+// RunHistory controls retention of the run reports saved in the state directory
+type RunHistory struct {
+	Keep   int    `yaml:"keep,omitempty" json:"keep,omitempty"`       // most recent runs to keep (default 100; -1 keeps all)
+	MaxAge string `yaml:"max_age,omitempty" json:"max_age,omitempty"` // also delete runs older than this Go duration, e.g. 720h
+}
+
+// Tickets validates the --ticket of up/down runs and reports runs back to the ticket
+type Tickets struct {
+	Pattern  string            `yaml:"pattern,omitempty" json:"pattern,omitempty"`   // regexp a ticket must match (default: Jira/Linear keys like ENG-1234)
+	Required bool              `yaml:"required,omitempty" json:"required,omitempty"` // refuse up/down without --ticket
+	Webhook  string            `yaml:"webhook,omitempty" json:"webhook,omitempty"`   // URL receiving the run summary as JSON; $VARS are expanded
+	Headers  map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`   // extra webhook headers, e.g. Authorization; $VARS are expanded
+}
+
+// Discovery selects how the source is scanned and extends the directories
+// the AST scan skips (vendor, testdata, node_modules, hidden and _-prefixed
+// directories) or walks despite that. Patterns without a slash match
+// directory names, others paths relative to the app root, e.g. "gen",
+// "vendor" or "services/*/fixtures".
+type Discovery struct {
+	Mode        string   `yaml:"mode,omitempty" json:"mode,omitempty"`                 // ast (default) or typed, see --discovery
+	SkipDirs    []string `yaml:"skip_dirs,omitempty" json:"skip_dirs,omitempty"`       // additional directories to skip
+	IncludeDirs []string `yaml:"include_dirs,omitempty" json:"include_dirs,omitempty"` // directories to walk even if skipped, e.g. vendor
+}
+
+// Warnings quiets known warnings so new ones stand out, e.g. in CI logs,
+// and makes others fail the command
+type Warnings struct {
+	Suppress []string `yaml:"suppress,omitempty" json:"suppress,omitempty"` // codes such as W004, as listed by `warnings`
+	Errors   []string `yaml:"errors,omitempty" json:"errors,omitempty"`     // codes to treat as errors, as --warning-as-error does
+}
+
+// Timeouts bound how long a migration session's statements may run and wait
+// for locks, so a stuck ALTER TABLE cannot hold locks for the whole deploy.
+// Values are Go durations such as 30s; empty or 0 means no limit.
+type Timeouts struct {
+	Statement string `yaml:"statement,omitempty" json:"statement,omitempty"` // statement_timeout
+	Lock      string `yaml:"lock,omitempty" json:"lock,omitempty"`           // lock_timeout
+}
+
+// Pauses has up and down pause the Encore cron jobs and PubSub subscriptions
+// declared in a database's service while migrations touching their tables
+// run, and resume them afterwards, so they don't queue behind DDL locks.
+// Nothing is paused unless Endpoint is set.
+type Pauses struct {
+	Endpoint string              `yaml:"endpoint,omitempty" json:"endpoint,omitempty"` // admin URL receiving each pause and resume as JSON; $VARS are expanded
+	Headers  map[string]string   `yaml:"headers,omitempty" json:"headers,omitempty"`   // extra request headers, e.g. Authorization; $VARS are expanded
+	Tables   map[string][]string `yaml:"tables,omitempty" json:"tables,omitempty"`     // resource name to the tables it uses; unlisted resources pause for any table
+	Required bool                `yaml:"required,omitempty" json:"required,omitempty"` // fail the database instead of migrating when a pause fails
+}
+
+// FeatureFlags is the LaunchDarkly or Unleash project and environment whose
+// flags migrations switch with "-- flag-before: <flag>=on|off" and
+// "-- flag-after: <flag>=on|off" directives. Migrations with such directives
+// fail unless Provider is set.
+type FeatureFlags struct {
+	Provider    string          `yaml:"provider,omitempty" json:"provider,omitempty"`       // launchdarkly or unleash
+	URL         string          `yaml:"url,omitempty" json:"url,omitempty"`                 // API base URL, required for Unleash; $VARS are expanded
+	Project     string          `yaml:"project,omitempty" json:"project,omitempty"`         // LaunchDarkly project key or Unleash project ID
+	Environment string          `yaml:"environment,omitempty" json:"environment,omitempty"` // environment whose flags are switched; $VARS are expanded
+	Token       *StringOrEnvRef `yaml:"token,omitempty" json:"token,omitempty"`             // API access token: a string, {$env: VAR}, {$gcp_secret: ...} or {$exec: ...}
+}
+
+// TLSPolicy is a compliance baseline enforced by the client, whatever the
+// database server accepts
+type TLSPolicy struct {
+	MinVersion          string `yaml:"min_version,omitempty" json:"min_version,omitempty"`                     // "1.2" or "1.3"; refuse connections without TLS or negotiating an older version
+	RequireInProduction bool   `yaml:"require_in_production,omitempty" json:"require_in_production,omitempty"` // refuse sslmode=disable when the InfraConfig env_type is production
+	RequireFIPS         bool   `yaml:"require_fips,omitempty" json:"require_fips,omitempty"`                   // refuse to connect unless Go's FIPS 140-3 mode is on (GODEBUG=fips140=on)
+}
+
+// Lint configures the `lint` rules. A database's own lint settings override
+// these, so each team can tune the rules for the databases it owns.
+type Lint struct {
+	Rules           map[string]string `yaml:"rules,omitempty" json:"rules,omitempty"`                       // rule name to error, warning or off
+	EarlyMigrations int               `yaml:"early_migrations,omitempty" json:"early_migrations,omitempty"` // how many of the first migrations must create tables with IF NOT EXISTS (default 1)
+	SeedDir         string            `yaml:"seed_dir,omitempty" json:"seed_dir,omitempty"`                 // directory of <database>.sql seed files (as for preview create --seed-dir) to check
+
+	// BlockDestructive has up refuse pending migrations breaking a
+	// destructive rule at error severity, as with --block-destructive; a
+	// database's own lint settings can only turn it on
+	BlockDestructive bool `yaml:"block_destructive,omitempty" json:"block_destructive,omitempty"`
+}
+
+// Alerts pages on-call when up fails or leaves a database dirty in an
+// environment whose InfraConfig is labelled production. Keys may reference
+// environment variables as $VAR.
+type Alerts struct {
+	PagerDuty *PagerDutyAlerts `yaml:"pagerduty,omitempty" json:"pagerduty,omitempty"`
+	Opsgenie  *OpsgenieAlerts  `yaml:"opsgenie,omitempty" json:"opsgenie,omitempty"`
+}
+
+// PagerDutyAlerts triggers PagerDuty incidents through the Events API v2
+type PagerDutyAlerts struct {
+	RoutingKey string `yaml:"routing_key" json:"routing_key"`     // integration key of the service to page
+	URL        string `yaml:"url,omitempty" json:"url,omitempty"` // events endpoint (default: PagerDuty's)
+}
+
+// OpsgenieAlerts creates Opsgenie alerts through the Alert API
+type OpsgenieAlerts struct {
+	APIKey   string `yaml:"api_key" json:"api_key"`                       // API integration key
+	Priority string `yaml:"priority,omitempty" json:"priority,omitempty"` // P1-P5 (default P1)
+	URL      string `yaml:"url,omitempty" json:"url,omitempty"`           // alerts endpoint (default: US region; EU accounts use api.eu.opsgenie.com)
+}
+
+// Profile is a named set of connection overrides, selected with --profile.
+// Profiles take precedence over the InfraConfig but yield to environment variables and flags.
+type Profile struct {
+	Host     string `yaml:"host,omitempty" json:"host,omitempty"` // host[:port]
+	User     string `yaml:"user,omitempty" json:"user,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	SSH      string `yaml:"ssh,omitempty" json:"ssh,omitempty"`         // user@bastion[:port] to tunnel through
+	SSHKey   string `yaml:"ssh_key,omitempty" json:"ssh_key,omitempty"` // private key for the bastion
+}
+
+// ProjectDatabase holds per-database migrator settings
+type ProjectDatabase struct {
+	Replicas   []string `yaml:"replicas,omitempty" json:"replicas,omitempty"`       // replica host[:port] or DSNs to wait for after up
+	Extensions []string `yaml:"extensions,omitempty" json:"extensions,omitempty"`   // PostgreSQL extensions required before migrating
+	Dialect    string   `yaml:"dialect,omitempty" json:"dialect,omitempty"`         // timescaledb or citus
+	RunAsRole  string   `yaml:"run_as_role,omitempty" json:"run_as_role,omitempty"` // role to SET ROLE to after connecting
+	DependsOn  []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`   // Encore databases to migrate before this one
+	Priority   int      `yaml:"priority,omitempty" json:"priority,omitempty"`       // higher priority groups migrate first (default 0)
+
+	AppVersionGate *AppVersionGate `yaml:"app_version_gate,omitempty" json:"app_version_gate,omitempty"` // gates contract migrations on deployed app versions
+	Lint           *Lint           `yaml:"lint,omitempty" json:"lint,omitempty"`                         // overrides the project lint settings for this database
+	Timeouts       *Timeouts       `yaml:"timeouts,omitempty" json:"timeouts,omitempty"`                 // overrides the project and flag timeouts for this database
+	Retired        *Retirement     `yaml:"retired,omitempty" json:"retired,omitempty"`                   // set by retire for databases discovered in the source
+	Quiesce        *Quiesce        `yaml:"quiesce,omitempty" json:"quiesce,omitempty"`                   // endpoints draining the database's writers around migrations
+}
+
+// DefaultQuiesceTimeout bounds each quiesce and resume request when quiesce.timeout is unset
+const DefaultQuiesceTimeout = "30s"
+
+// Quiesce has up and down ask the services writing to a database to drain
+// their writes before its pending migrations run, and to resume afterwards
+// whatever the outcome. Both requests are POSTs of a JSON description of
+// the run; a failed quiesce fails the database without migrating it.
+type Quiesce struct {
+	QuiesceURL string          `yaml:"quiesce_url" json:"quiesce_url"`                     // called before migrating; $VARS are expanded
+	ResumeURL  string          `yaml:"resume_url" json:"resume_url"`                       // called after migrating; $VARS are expanded
+	AuthHeader string          `yaml:"auth_header,omitempty" json:"auth_header,omitempty"` // header carrying Auth (default Authorization)
+	Auth       *StringOrEnvRef `yaml:"auth,omitempty" json:"auth,omitempty"`               // header value: a string, {$env: VAR}, {$gcp_secret: ...} or {$exec: ...}
+	Timeout    string          `yaml:"timeout,omitempty" json:"timeout,omitempty"`         // Go duration per request, long enough to drain (default 30s)
+}
+
+// AppVersionGate tells `up --phase contract` where to find the versions of the
+// running application instances. Exactly one of URL and Query is set.
+type AppVersionGate struct {
+	URL   string `yaml:"url,omitempty" json:"url,omitempty"`     // GET endpoint returning {"versions": [...]}
+	Query string `yaml:"query,omitempty" json:"query,omitempty"` // SQL returning one version per running instance
+}
+
+// Database returns the settings for an Encore database (zero value if unset)
+func (p *ProjectConfig) Database(name string) ProjectDatabase {
+	if p == nil || p.Databases == nil {
+		return ProjectDatabase{}
+	}
+	return p.Databases[name]
+}
+
+// LintSettings returns the lint settings for an Encore database: the
+// project's, with the database's rules and values layered on top
+func (p *ProjectConfig) LintSettings(name string) Lint {
+	var settings Lint
+	if p != nil {
+		settings = p.Lint
+	}
+	settings.Rules = maps.Clone(settings.Rules)
+
+	override := p.Database(name).Lint
+	if override == nil {
+		return settings
+	}
+	if settings.Rules == nil {
+		settings.Rules = make(map[string]string)
+	}
+	maps.Copy(settings.Rules, override.Rules)
+	if override.EarlyMigrations != 0 {
+		settings.EarlyMigrations = override.EarlyMigrations
+	}
+	if override.SeedDir != "" {
+		settings.SeedDir = override.SeedDir
+	}
+	settings.BlockDestructive = settings.BlockDestructive || override.BlockDestructive
+	return settings
+}
+
+// Profile returns the named profile
+func (p *ProjectConfig) Profile(name string) (Profile, error) {
+	if p != nil {
+		if profile, ok := p.Profiles[name]; ok {
+			return profile, nil
+		}
+	}
+	return Profile{}, &types.ConfigError{
+		Field:   "profiles",
+		Message: fmt.Sprintf("profile %q not found in project config", name),
+	}
+}
+
+// LoadProjectConfig loads a project config file (YAML or JSON by extension)
+func LoadProjectConfig(path string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading project config: %w", err)
+	}
+
+	var project ProjectConfig
+	if strings.HasSuffix(path, ".json") {
+		if err := json.Unmarshal(data, &project); err != nil {
+			return nil, fmt.Errorf("parsing JSON project config: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &project); err != nil {
+			return nil, fmt.Errorf("parsing YAML project config: %w", err)
+		}
+	}
+
+	return &project, nil
+}
+
+// DefaultProjectConfigPaths returns the default paths to look for a project config file
+func DefaultProjectConfigPaths() []string {
+	return []string{
+		"encore-migrate.yaml",
+		"encore-migrate.yml",
+		"encore-migrate.json",
+		".encore/migrate.yaml",
+		".encore/migrate.yml",
+		".encore/migrate.json",
+	}
+}
+
+// FindProjectConfig looks for a project config file in the given directory
+func FindProjectConfig(rootDir string) string {
+	for _, name := range DefaultProjectConfigPaths() {
+		path := filepath.Join(rootDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
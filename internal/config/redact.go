@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// RedactedValue replaces secrets in printed configuration
+const RedactedValue = "(redacted)"
+
+// MarshalJSON writes the value back in InfraConfig form: a string literal,
+// {"$env": "VAR"}, {"$gcp_secret": "projects/..."} or {"$exec": [...]}
+func (s StringOrEnvRef) MarshalJSON() ([]byte, error) {
+	if s.GCPSecret != "" {
+		return json.Marshal(map[string]string{"$gcp_secret": s.GCPSecret})
+	}
+	if len(s.Exec) > 0 {
+		return json.Marshal(map[string][]string{"$exec": s.Exec})
+	}
+	if s.IsEnv {
+		return json.Marshal(map[string]string{"$env": s.EnvVar})
+	}
+	return json.Marshal(s.Value)
+}
+
+// Resolved returns a copy of the config with every $env, $gcp_secret and $exec reference replaced by its value.
+// References that cannot be resolved are left in place and reported in the returned error.
+func (c *InfraConfig) Resolved() (*InfraConfig, error) {
+	out := c.clone()
+
+	var errs []error
+	for i := range out.SQLServers {
+		server := &out.SQLServers[i]
+		for name, db := range server.Databases {
+			for field, ref := range map[string]*StringOrEnvRef{"name": &db.Name, "username": &db.Username, "password": &db.Password} {
+				if ref.IsLiteral() {
+					continue
+				}
+				value, err := ref.Resolve()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s.%s: %w", name, field, err))
+					continue
+				}
+				*ref = StringOrEnvRef{Value: value}
+			}
+			server.Databases[name] = db
+		}
+	}
+
+	return out, errors.Join(errs...)
+}
+
+// Redacted returns a copy of the config with literal passwords and client keys replaced.
+// $env, $gcp_secret and $exec references are kept since they name a secret rather than hold it.
+func (c *InfraConfig) Redacted() *InfraConfig {
+	out := c.clone()
+
+	for i := range out.SQLServers {
+		server := &out.SQLServers[i]
+		if server.TLSConfig != nil && server.TLSConfig.ClientCert != nil && server.TLSConfig.ClientCert.Key != "" {
+			server.TLSConfig.ClientCert.Key = RedactedValue
+		}
+		for name, db := range server.Databases {
+			if !db.Password.IsEnv && db.Password.Value != "" {
+				db.Password.Value = RedactedValue
+			}
+			server.Databases[name] = db
+		}
+	}
+
+	return out
+}
+
+// clone deep-copies the parts of the config that Resolved and Redacted modify
+func (c *InfraConfig) clone() *InfraConfig {
+	out := &InfraConfig{Metadata: c.Metadata, SQLServers: make([]SQLServer, len(c.SQLServers))}
+	for i, server := range c.SQLServers {
+		if server.TLSConfig != nil {
+			tls := *server.TLSConfig
+			if tls.ClientCert != nil {
+				cert := *tls.ClientCert
+				tls.ClientCert = &cert
+			}
+			server.TLSConfig = &tls
+		}
+		server.Databases = maps.Clone(server.Databases)
+		out.SQLServers[i] = server
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RenameTarget is a file that names Encore databases
+type RenameTarget int
+
+const (
+	RenameManifest      RenameTarget = iota // databases[].name
+	RenameProjectConfig                     // databases keys and depends_on entries
+	RenameInfraConfig                       // sql_servers[].databases keys
+)
+
+// RenameDatabase renames an Encore database in a manifest, project config or
+// InfraConfig file and returns the updated content, or changed false if the
+// file does not name it. The file is not written. YAML comments and key
+// order are kept; JSON files are re-indented with two spaces.
+//
+// In an InfraConfig, an entry without a name keeps pointing at the
+// PostgreSQL database of the old name, so no data has to move.
+func RenameDatabase(path string, target RenameTarget, from, to string) (updated []byte, changed bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, false, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return data, false, nil
+	}
+	root := doc.Content[0]
+
+	switch target {
+	case RenameManifest:
+		changed, err = renameManifestDatabase(root, from, to)
+	case RenameProjectConfig:
+		changed, err = renameProjectDatabase(root, from, to)
+	case RenameInfraConfig:
+		changed, err = renameInfraDatabase(root, from, to)
+	default:
+		return nil, false, fmt.Errorf("unknown rename target %d", target)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	if !changed {
+		return data, false, nil
+	}
+
+	updated, err = encodeDocument(path, &doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return updated, true, nil
+}
+
+// encodeDocument renders a document parsed from path in the file's format
+func encodeDocument(path string, doc *yaml.Node) ([]byte, error) {
+	if strings.HasSuffix(path, ".json") {
+		var compact bytes.Buffer
+		if err := writeJSONNode(&compact, doc); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", path, err)
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", path, err)
+		}
+		out.WriteByte('\n')
+		return out.Bytes(), nil
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", path, err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", path, err)
+	}
+	return out.Bytes(), nil
+}
+
+func renameManifestDatabase(root *yaml.Node, from, to string) (bool, error) {
+	_, databases := mappingEntry(root, "databases")
+	if databases == nil || databases.Kind != yaml.SequenceNode {
+		return false, nil
+	}
+	var found *yaml.Node
+	for _, db := range databases.Content {
+		_, name := mappingEntry(db, "name")
+		if name == nil {
+			continue
+		}
+		switch name.Value {
+		case to:
+			return false, fmt.Errorf("database %q already exists", to)
+		case from:
+			found = name
+		}
+	}
+	if found == nil {
+		return false, nil
+	}
+	found.Value = to
+	return true, nil
+}
+
+func renameProjectDatabase(root *yaml.Node, from, to string) (bool, error) {
+	_, databases := mappingEntry(root, "databases")
+	if databases == nil || databases.Kind != yaml.MappingNode {
+		return false, nil
+	}
+	changed, err := renameKey(databases, from, to)
+	if err != nil {
+		return false, err
+	}
+	for i := 1; i < len(databases.Content); i += 2 {
+		_, dependsOn := mappingEntry(databases.Content[i], "depends_on")
+		if dependsOn == nil || dependsOn.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, dep := range dependsOn.Content {
+			if dep.Kind == yaml.ScalarNode && dep.Value == from {
+				dep.Value = to
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+func renameInfraDatabase(root *yaml.Node, from, to string) (bool, error) {
+	_, servers := mappingEntry(root, "sql_servers")
+	if servers == nil || servers.Kind != yaml.SequenceNode {
+		return false, nil
+	}
+	changed := false
+	for _, server := range servers.Content {
+		_, databases := mappingEntry(server, "databases")
+		if databases == nil || databases.Kind != yaml.MappingNode {
+			continue
+		}
+		_, entry := mappingEntry(databases, from)
+		renamed, err := renameKey(databases, from, to)
+		if err != nil {
+			return false, err
+		}
+		if !renamed {
+			continue
+		}
+		changed = true
+		if entry.Kind == yaml.MappingNode {
+			if key, _ := mappingEntry(entry, "name"); key == nil {
+				entry.Content = append([]*yaml.Node{
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: "name"},
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: from},
+				}, entry.Content...)
+			}
+		}
+	}
+	return changed, nil
+}
+
+// renameKey renames a mapping key, refusing to shadow an existing one
+func renameKey(mapping *yaml.Node, from, to string) (bool, error) {
+	key, _ := mappingEntry(mapping, from)
+	if key == nil {
+		return false, nil
+	}
+	if existing, _ := mappingEntry(mapping, to); existing != nil {
+		return false, fmt.Errorf("database %q already exists", to)
+	}
+	key.Value = to
+	return true, nil
+}
+
+// mappingEntry returns the key and value nodes of a mapping entry, or nils
+func mappingEntry(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// writeJSONNode writes a node parsed from JSON back as compact JSON, in its
+// original key order
+func writeJSONNode(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return writeJSONNode(buf, n.Content[0])
+	case yaml.AliasNode:
+		return writeJSONNode(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(n.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch n.ShortTag() {
+		case "!!null":
+			buf.WriteString("null")
+		case "!!bool", "!!int", "!!float":
+			buf.WriteString(n.Value)
+		default:
+			value, err := json.Marshal(n.Value)
+			if err != nil {
+				return err
+			}
+			buf.Write(value)
+		}
+	}
+	return nil
+}
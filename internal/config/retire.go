@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Retirement marks an Encore database whose service was removed. Retired
+// databases are still listed but skipped by up, down and status unless
+// --include-retired is set.
+type Retirement struct {
+	At     string `yaml:"at" json:"at"`                             // RFC 3339 time of the retirement
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"` // why, for whoever finds it later
+	Backup string `yaml:"backup,omitempty" json:"backup,omitempty"` // final backup taken, if any
+}
+
+// RetireDatabase records a retirement for an Encore database in a manifest
+// (on its databases entry) or a project config (as databases.<name>.retired,
+// creating the entry and, when missing, the file) and returns the updated
+// content without writing it
+func RetireDatabase(path string, target RenameTarget, name string, r Retirement) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !(errors.Is(err, os.ErrNotExist) && target == RenameProjectConfig) {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+
+	var retired yaml.Node
+	if err := retired.Encode(r); err != nil {
+		return nil, err
+	}
+
+	var entry *yaml.Node
+	switch target {
+	case RenameManifest:
+		_, databases := mappingEntry(root, "databases")
+		if databases != nil && databases.Kind == yaml.SequenceNode {
+			for _, db := range databases.Content {
+				if _, n := mappingEntry(db, "name"); n != nil && n.Value == name {
+					entry = db
+				}
+			}
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("%s: database %q not found", path, name)
+		}
+	case RenameProjectConfig:
+		databases := setMappingEntry(root, "databases", &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, false)
+		if databases.Kind != yaml.MappingNode {
+			databases = setMappingEntry(root, "databases", &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, true)
+		}
+		entry = setMappingEntry(databases, name, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, false)
+		if entry.Kind != yaml.MappingNode {
+			// e.g. "legacy:" with no settings
+			entry = setMappingEntry(databases, name, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, true)
+		}
+	default:
+		return nil, fmt.Errorf("databases cannot be retired in rename target %d", target)
+	}
+	setMappingEntry(entry, "retired", &retired, true)
+
+	return encodeDocument(path, &doc)
+}
+
+// setMappingEntry returns the value of a mapping entry, adding value under
+// key if it is missing, or replacing it if replace is set
+func setMappingEntry(mapping *yaml.Node, key string, value *yaml.Node, replace bool) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		if replace {
+			mapping.Content[i+1] = value
+		}
+		return mapping.Content[i+1]
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
@@ -0,0 +1,89 @@
+// Package credexec runs the commands of {"$exec": "..."} credential
+// references, so bespoke credential brokers (LDAP, vaults) can supply
+// database names, users and passwords on their standard output. Only the
+// commands allowed with Allow, by the operator rather than the config, run.
+package credexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/secretcache"
+)
+
+// Timeout bounds how long a command may run
+const Timeout = 30 * time.Second
+
+var (
+	mu      sync.Mutex
+	allowed []string
+)
+
+// Allow adds commands that references may run. A name without a slash
+// allows that command looked up in PATH; a path allows exactly that file.
+func Allow(commands ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, c := range commands {
+		if c = strings.TrimSpace(c); c != "" {
+			allowed = append(allowed, clean(c))
+		}
+	}
+}
+
+// clean normalizes commands given as paths
+func clean(command string) string {
+	if strings.ContainsRune(command, '/') || strings.ContainsRune(command, filepath.Separator) {
+		return filepath.Clean(command)
+	}
+	return command
+}
+
+// Run returns the standard output of argv, less its trailing newline.
+// Outputs are cached by secretcache, so a command shared by several fields
+// runs once.
+func Run(argv []string) (string, error) {
+	if len(argv) == 0 {
+		return "", errors.New("empty $exec command")
+	}
+	mu.Lock()
+	ok := slices.Contains(allowed, clean(argv[0]))
+	mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("command %s is not allowed (pass --allow-exec %s to run it)", argv[0], argv[0])
+	}
+	return secretcache.Get(fmt.Sprintf("exec:%q", argv), func() (string, error) { return run(argv) })
+}
+
+// run runs a command and returns its output
+func run(argv []string) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s", Timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("running %s: %w: %s", argv[0], err, msg)
+		}
+		return "", fmt.Errorf("running %s: %w", argv[0], err)
+	}
+
+	value := strings.TrimRight(stdout.String(), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("running %s: printed nothing", argv[0])
+	}
+	return value, nil
+}
@@ -1,46 +1,161 @@
 package discovery
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	gotypes "go/types"
+	"io"
 	"io/fs"
+	"log/slog"
+	"maps"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
 )
 
 const encoreSQLDBImport = "encore.dev/storage/sqldb"
 
+// DefaultMaxFileSize is the largest Go file parsed when ASTDiscoverer.MaxFileSize
+// is unset; larger files are usually generated and never declare databases
+const DefaultMaxFileSize = 2 << 20
+
+// DefaultSkipDirs are the directory patterns discovery doesn't descend into:
+// vendored and test fixture code, JavaScript dependencies, and hidden or
+// underscore-prefixed directories, which the go tool ignores too
+var DefaultSkipDirs = []string{"vendor", "testdata", "node_modules", ".*", "_*"}
+
+// headerBytes is how much of a file is read to look for the sqldb import
+// before deciding whether to read and parse the rest
+const headerBytes = 16 << 10
+
 // ASTDiscoverer discovers Encore databases by parsing Go source files
 type ASTDiscoverer struct {
 	Verbose bool
 	Errors  []error // Non-fatal errors encountered during discovery
+	// MaxFileSize skips Go files larger than this many bytes; zero means
+	// DefaultMaxFileSize and a negative value disables the limit
+	MaxFileSize int64
+	// Workers is how many files are parsed at once; zero means GOMAXPROCS
+	Workers int
+	// SkipDirs are directory patterns skipped in addition to DefaultSkipDirs;
+	// IncludeDirs are walked even if a skip pattern matches them. A pattern
+	// without a slash matches a directory's name, one with a slash its path
+	// relative to the root, as in path.Match.
+	SkipDirs    []string
+	IncludeDirs []string
+
+	// CacheDir, if set, holds a cache of what each file was found to
+	// declare; files whose size and modification time are unchanged since
+	// it was written aren't read again
+	CacheDir string
+
+	// FilesParsed, FilesSkipped and ParseTime count the Go files parsed by
+	// Discover, those skipped for their size, and the time spent reading and
+	// parsing summed across workers, for benchmarks; FilesCached counts the
+	// files whose cached result was used instead
+	FilesParsed  int
+	FilesSkipped int
+	FilesCached  int
+	ParseTime    time.Duration
+
+	mu       sync.Mutex
+	pkgDecls map[string]*declarations // by directory and package name, loaded on demand
+	stamps   map[string]string        // package stamps by directory, see packageStamp
 }
 
-// Discover walks the directory tree and finds all sqldb.NewDatabase calls
+// scanResult is what scanning one file found
+type scanResult struct {
+	databases []types.EncoreDatabase
+	errors    []error
+	skipped   bool // over MaxFileSize
+	candidate bool // imports sqldb, so was parsed
+}
+
+// Discover walks the directory tree and finds all sqldb.NewDatabase calls.
+// Files are parsed by a pool of workers; the result is in walk order.
 func (d *ASTDiscoverer) Discover(rootPath string) ([]types.EncoreDatabase, error) {
 	absRoot, err := filepath.Abs(rootPath)
 	if err != nil {
 		return nil, fmt.Errorf("resolving root path: %w", err)
 	}
 
-	var databases []types.EncoreDatabase
+	skip := append(slices.Clone(DefaultSkipDirs), d.SkipDirs...)
+	for _, pattern := range append(slices.Clone(skip), d.IncludeDirs...) {
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid directory pattern %q: %w", pattern, err)
+		}
+	}
+
+	workers := d.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var cache, next *scanCache
+	if d.CacheDir != "" {
+		cache = d.loadCache()
+		next = &scanCache{Version: cacheVersion, MaxFileSize: d.maxFileSize(), Files: make(map[string]fileEntry)}
+	}
+	misses := 0
 
+	type job struct {
+		index int
+		path  string
+	}
+	jobs := make(chan job, workers)
+	found := make(map[int][]types.EncoreDatabase)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker reuses one FileSet, removing files once parsed so it doesn't grow
+			fset := token.NewFileSet()
+			for j := range jobs {
+				dbs, hit := d.scanFile(fset, absRoot, j.path, cache, next)
+				d.mu.Lock()
+				if len(dbs) > 0 {
+					found[j.index] = dbs
+				}
+				if !hit {
+					misses++
+				}
+				d.mu.Unlock()
+			}
+		}()
+	}
+
+	index := 0
 	err = filepath.WalkDir(absRoot, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories
+		// Skip directories matching a skip pattern and no include pattern
 		if entry.IsDir() {
-			name := entry.Name()
-			// Skip vendor, testdata, hidden directories, and common non-source dirs
-			if name == "vendor" || name == "testdata" || name == "node_modules" ||
-				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			if path == absRoot {
+				return nil
+			}
+			rel, err := filepath.Rel(absRoot, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if matchDir(skip, rel) && !matchDir(d.IncludeDirs, rel) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -56,44 +171,245 @@ func (d *ASTDiscoverer) Discover(rootPath string) ([]types.EncoreDatabase, error
 			return nil
 		}
 
-		dbs, err := d.parseFile(path)
-		if err != nil {
-			// Record error but continue with other files
-			d.Errors = append(d.Errors, &types.DiscoveryError{
-				File:    path,
-				Message: "failed to parse",
-				Cause:   err,
-			})
-			return nil
-		}
-
-		databases = append(databases, dbs...)
+		jobs <- job{index: index, path: path}
+		index++
 		return nil
 	})
+	close(jobs)
+	wg.Wait()
 
 	if err != nil {
 		return nil, fmt.Errorf("walking directory: %w", err)
 	}
 
+	if cache != nil && (misses > 0 || len(next.Files) != len(cache.Files)) {
+		if err := d.saveCache(next); err != nil {
+			slog.Warn("discovery cache not saved", "dir", d.CacheDir, "error", err)
+		}
+	}
+
+	var databases []types.EncoreDatabase
+	for i := 0; i < index; i++ {
+		for _, db := range found[i] {
+			if d.Verbose {
+				fmt.Printf("Found database %q in %s\n", db.Name, db.SourceFile)
+			}
+			// Checked on every run, as the cache doesn't track directories
+			if _, err := os.Stat(db.MigrationsPath); os.IsNotExist(err) {
+				d.Errors = append(d.Errors, &types.DiscoveryError{
+					File:    db.SourceFile,
+					Message: fmt.Sprintf("migrations directory does not exist: %s", db.MigrationsPath),
+				})
+			}
+			databases = append(databases, db)
+		}
+	}
 	return databases, nil
 }
 
-// parseFile parses a single Go file and extracts database definitions
-func (d *ASTDiscoverer) parseFile(filePath string) ([]types.EncoreDatabase, error) {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+// matchDir reports whether a directory, given by its slash-separated path
+// relative to the root, matches any of the patterns
+func matchDir(patterns []string, rel string) bool {
+	name := pathpkg.Base(rel)
+	for _, pattern := range patterns {
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+		if ok, _ := pathpkg.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// scanFile parses one file if it is small enough and mentions the sqldb
+// import, recording parse failures as non-fatal errors. With a cache, an
+// up-to-date entry is used instead, reported by hit, and the file's entry is
+// recorded in next.
+func (d *ASTDiscoverer) scanFile(fset *token.FileSet, absRoot, path string, cache, next *scanCache) (dbs []types.EncoreDatabase, hit bool) {
+	start := time.Now()
+	var (
+		key    string
+		info   os.FileInfo
+		entry  fileEntry
+		result scanResult
+	)
+	if cache != nil {
+		rel, err := filepath.Rel(absRoot, path)
+		if err == nil {
+			info, err = os.Stat(path)
+		}
+		if err == nil {
+			key = filepath.ToSlash(rel)
+			entry, hit = cache.Files[key]
+			hit = hit && d.upToDate(entry, info, path)
+		}
+	}
+	if hit {
+		result = entry.scanResult(absRoot, path)
+	} else {
+		result = d.scan(fset, path)
+		if info != nil {
+			entry = d.newFileEntry(absRoot, path, info, result)
+		}
+	}
+	if result.skipped {
+		// a database declared in it would silently go unmigrated
+		slog.Warn("skipped Go file larger than --max-file-size; databases declared in it are not discovered (-1 for no limit)",
+			"path", path, "limit", d.maxFileSize())
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case hit:
+		d.FilesCached++
+	case result.skipped:
+		d.FilesSkipped++
+	default:
+		d.FilesParsed++
+	}
+	if !hit {
+		d.ParseTime += time.Since(start)
+	}
+	// Record errors but continue with other files
+	d.Errors = append(d.Errors, result.errors...)
+	if info != nil {
+		next.Files[key] = entry
+	}
+	return result.databases, hit
+}
+
+// scan reads and parses one file
+func (d *ASTDiscoverer) scan(fset *token.FileSet, path string) scanResult {
+	src, skipped, err := d.readCandidate(path)
+	result := scanResult{skipped: skipped, candidate: src != nil}
+	if err == nil && src != nil {
+		result.databases, result.errors, err = d.parseFile(fset, path, src)
+	}
+	if err != nil {
+		result.errors = append(result.errors, &types.DiscoveryError{
+			File:    path,
+			Message: "failed to parse",
+			Cause:   err,
+		})
+	}
+	return result
+}
+
+// maxFileSize is the effective MaxFileSize; non-positive means no limit
+func (d *ASTDiscoverer) maxFileSize() int64 {
+	if d.MaxFileSize == 0 {
+		return DefaultMaxFileSize
+	}
+	return d.MaxFileSize
+}
+
+// readCandidate returns the contents of a file that may declare a database,
+// or nil if it doesn't mention the sqldb import. Only the first headerBytes
+// are read when the file's imports end there without it. skipped reports a
+// file over MaxFileSize.
+func (d *ASTDiscoverer) readCandidate(path string) (src []byte, skipped bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if limit := d.maxFileSize(); limit > 0 && info.Size() > limit {
+		return nil, true, nil
+	}
+
+	header := make([]byte, min(info.Size(), headerBytes))
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, false, err
+	}
+	header = header[:n]
+	if !bytes.Contains(header, []byte(encoreSQLDBImport)) {
+		if int64(n) == info.Size() {
+			return nil, false, nil
+		}
+		// The import can only lie beyond the header if the imports do
+		if importsEndWithin(header) {
+			return nil, false, nil
+		}
+	}
+
+	rest, err := io.ReadAll(f)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	src = append(header, rest...)
+	if !bytes.Contains(src, []byte(encoreSQLDBImport)) {
+		return nil, false, nil
+	}
+	return src, false, nil
+}
+
+// importsEndWithin reports whether a file prefix holds the package clause,
+// every import declaration and the start of whatever follows them
+func importsEndWithin(header []byte) bool {
+	var s scanner.Scanner
+	s.Init(token.NewFileSet().AddFile("", -1, len(header)), header, nil, 0)
+	next := func() token.Token {
+		_, tok, _ := s.Scan()
+		return tok
+	}
+
+	if next() != token.PACKAGE {
+		return false
+	}
+	for tok := next(); tok != token.SEMICOLON; tok = next() {
+		if tok == token.EOF {
+			return false
+		}
+	}
+	for {
+		tok := next()
+		if tok != token.IMPORT {
+			return tok != token.EOF
+		}
+		depth := 0
+		for tok = next(); tok != token.SEMICOLON || depth > 0; tok = next() {
+			switch tok {
+			case token.EOF:
+				return false
+			case token.LPAREN:
+				depth++
+			case token.RPAREN:
+				depth--
+			}
+		}
+	}
+}
+
+// parseFile parses a single Go file and extracts database definitions,
+// returning the calls it couldn't evaluate as problems
+func (d *ASTDiscoverer) parseFile(fset *token.FileSet, filePath string, src []byte) (databases []types.EncoreDatabase, problems []error, err error) {
+	node, err := parser.ParseFile(fset, filePath, src, parseMode(src))
+	if node != nil {
+		if file := fset.File(node.Package); file != nil {
+			defer fset.RemoveFile(file)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Find the import alias for encore.dev/storage/sqldb
 	sqldbAlias := findImportAlias(node, encoreSQLDBImport)
 	if sqldbAlias == "" {
 		// File doesn't import sqldb, skip it
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	var databases []types.EncoreDatabase
+	consts := newConstResolver(d, filePath, node)
 
 	ast.Inspect(node, func(n ast.Node) bool {
 		call, ok := n.(*ast.CallExpr)
@@ -106,9 +422,9 @@ func (d *ASTDiscoverer) parseFile(filePath string) ([]types.EncoreDatabase, erro
 			return true
 		}
 
-		db, err := d.extractDatabaseConfig(call, filePath)
+		db, err := extractDatabaseConfig(call, filePath, consts)
 		if err != nil {
-			d.Errors = append(d.Errors, &types.DiscoveryError{
+			problems = append(problems, &types.DiscoveryError{
 				File:    filePath,
 				Message: "failed to extract database config",
 				Cause:   err,
@@ -116,51 +432,39 @@ func (d *ASTDiscoverer) parseFile(filePath string) ([]types.EncoreDatabase, erro
 			return true
 		}
 
-		if d.Verbose {
-			fmt.Printf("Found database %q in %s\n", db.Name, filePath)
-		}
-
 		databases = append(databases, db)
 		return true
 	})
 
-	return databases, nil
+	return databases, problems, nil
 }
 
 // extractDatabaseConfig extracts the database name and migrations path from a NewDatabase call
-func (d *ASTDiscoverer) extractDatabaseConfig(call *ast.CallExpr, filePath string) (types.EncoreDatabase, error) {
+func extractDatabaseConfig(call *ast.CallExpr, filePath string, consts *constResolver) (types.EncoreDatabase, error) {
 	// NewDatabase takes 2 arguments: name (string) and config (DatabaseConfig)
 	if len(call.Args) < 2 {
 		return types.EncoreDatabase{}, fmt.Errorf("expected 2 arguments to NewDatabase, got %d", len(call.Args))
 	}
 
 	// Extract database name from first argument
-	dbName, err := extractStringLiteral(call.Args[0])
+	dbName, err := consts.stringValue(call.Args[0])
 	if err != nil {
 		return types.EncoreDatabase{}, fmt.Errorf("extracting database name: %w", err)
 	}
 
 	// Extract migrations path from DatabaseConfig struct
-	migrationsPath, err := extractMigrationsPath(call.Args[1])
+	migrationsPath, err := extractMigrationsPath(call.Args[1], consts)
 	if err != nil {
 		return types.EncoreDatabase{}, fmt.Errorf("extracting migrations path: %w", err)
 	}
 
-	// Resolve relative path from the Go file's directory
+	// Resolve the slash-separated path relative to the Go file's directory
 	fileDir := filepath.Dir(filePath)
-	absPath := filepath.Join(fileDir, migrationsPath)
+	absPath := filepath.Join(fileDir, filepath.FromSlash(migrationsPath))
 
 	// Clean the path
 	absPath = filepath.Clean(absPath)
 
-	// Verify the migrations directory exists
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		d.Errors = append(d.Errors, &types.DiscoveryError{
-			File:    filePath,
-			Message: fmt.Sprintf("migrations directory does not exist: %s", absPath),
-		})
-	}
-
 	return types.EncoreDatabase{
 		Name:           dbName,
 		MigrationsPath: absPath,
@@ -225,22 +529,17 @@ func extractStringLiteral(expr ast.Expr) (string, error) {
 		return "", fmt.Errorf("expected string literal, got %v", lit.Kind)
 	}
 
-	// Remove quotes from the string
-	value := lit.Value
-	if len(value) >= 2 {
-		if value[0] == '"' && value[len(value)-1] == '"' {
-			return value[1 : len(value)-1], nil
-		}
-		if value[0] == '`' && value[len(value)-1] == '`' {
-			return value[1 : len(value)-1], nil
-		}
+	// Unquote, decoding escapes such as \u00e9 so non-ASCII paths match the filesystem
+	value, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", fmt.Errorf("invalid string literal %s: %w", lit.Value, err)
 	}
 
 	return value, nil
 }
 
 // extractMigrationsPath extracts the Migrations field from a DatabaseConfig composite literal
-func extractMigrationsPath(expr ast.Expr) (string, error) {
+func extractMigrationsPath(expr ast.Expr, consts *constResolver) (string, error) {
 	// Handle: sqldb.DatabaseConfig{Migrations: "./migrations"}
 	composite, ok := expr.(*ast.CompositeLit)
 	if !ok {
@@ -258,8 +557,278 @@ func extractMigrationsPath(expr ast.Expr) (string, error) {
 			continue
 		}
 
-		return extractStringLiteral(kv.Value)
+		return consts.stringValue(kv.Value)
 	}
 
 	return "", fmt.Errorf("Migrations field not found in DatabaseConfig")
 }
+
+// maxConstDepth bounds how many constants deep a value is followed
+const maxConstDepth = 32
+
+// embedDirective marks the variables an embedded FS is declared with
+const embedDirective = "//go:embed"
+
+// parseMode parses comments only when src has //go:embed directives to read
+func parseMode(src []byte) parser.Mode {
+	if bytes.Contains(src, []byte(embedDirective)) {
+		return parser.SkipObjectResolution | parser.ParseComments
+	}
+	return parser.SkipObjectResolution
+}
+
+// constResolver evaluates constant string expressions: literals,
+// concatenations, path.Join and filepath.Join of them, and package-level
+// constants declared in the file or, failing that, in the other files of its
+// package. An embedded FS, or fs.Sub of one, evaluates to the directory it
+// embeds.
+type constResolver struct {
+	d       *ASTDiscoverer
+	path    string
+	pkg     string
+	file    *declarations
+	imports map[string]string // import paths by the name they are used under
+}
+
+// newConstResolver creates the resolver for a parsed file
+func newConstResolver(d *ASTDiscoverer, path string, file *ast.File) *constResolver {
+	imports := make(map[string]string)
+	for _, imp := range file.Imports {
+		importPath := strings.Trim(imp.Path.Value, `"`)
+		name := pathpkg.Base(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		imports[name] = importPath
+	}
+	return &constResolver{d: d, path: path, pkg: file.Name.Name, file: fileDecls(file), imports: imports}
+}
+
+// stringValue evaluates expr to a string
+func (r *constResolver) stringValue(expr ast.Expr) (string, error) {
+	return r.eval(expr, 0)
+}
+
+func (r *constResolver) eval(expr ast.Expr, depth int) (string, error) {
+	if depth > maxConstDepth {
+		return "", fmt.Errorf("constant nested more than %d deep", maxConstDepth)
+	}
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return extractStringLiteral(e)
+	case *ast.ParenExpr:
+		return r.eval(e.X, depth+1)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", fmt.Errorf("expected string constant, got %s expression", e.Op)
+		}
+		left, err := r.eval(e.X, depth+1)
+		if err != nil {
+			return "", err
+		}
+		right, err := r.eval(e.Y, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return left + right, nil
+	case *ast.CallExpr:
+		return r.evalCall(e, depth)
+	case *ast.Ident:
+		if dir, ok := r.embeddedDir(e.Name); ok {
+			return dir, nil
+		}
+		value, ok := r.file.consts[e.Name]
+		if !ok {
+			value, ok = r.d.packageDecls(filepath.Dir(r.path), r.pkg).consts[e.Name]
+		}
+		if !ok {
+			return "", fmt.Errorf("%s is not a string constant declared in package %s", e.Name, r.pkg)
+		}
+		v, err := r.eval(value, depth+1)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", e.Name, err)
+		}
+		return v, nil
+	case *ast.SelectorExpr:
+		if pkg, ok := e.X.(*ast.Ident); ok {
+			return "", fmt.Errorf("%s.%s is declared in another package; use a string literal or a constant of package %s", pkg.Name, e.Sel.Name, r.pkg)
+		}
+		return "", fmt.Errorf("expected string literal or constant, got %T", expr)
+	default:
+		return "", fmt.Errorf("expected string literal or constant, got %T", expr)
+	}
+}
+
+// evalCall evaluates path.Join and filepath.Join of constants, and fs.Sub
+// of an embedded FS, which is the subdirectory of the package's directory
+func (r *constResolver) evalCall(call *ast.CallExpr, depth int) (string, error) {
+	var fn string
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		if pkg, ok := sel.X.(*ast.Ident); ok {
+			fn = r.imports[pkg.Name] + "." + sel.Sel.Name
+		}
+	}
+
+	switch fn {
+	case "path.Join", "path/filepath.Join":
+		if call.Ellipsis.IsValid() {
+			return "", fmt.Errorf("%s with a ... argument is not a constant", fn)
+		}
+		parts := make([]string, len(call.Args))
+		for i, arg := range call.Args {
+			part, err := r.eval(arg, depth+1)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = filepath.ToSlash(part)
+		}
+		return pathpkg.Join(parts...), nil
+	case "io/fs.Sub":
+		if len(call.Args) != 2 {
+			return "", fmt.Errorf("expected 2 arguments to fs.Sub, got %d", len(call.Args))
+		}
+		fsys, ok := call.Args[0].(*ast.Ident)
+		if !ok {
+			return "", fmt.Errorf("fs.Sub of %T is not an embedded FS", call.Args[0])
+		}
+		if _, ok := r.embeddedDir(fsys.Name); !ok {
+			return "", fmt.Errorf("%s is not a //go:embed variable of package %s", fsys.Name, r.pkg)
+		}
+		return r.eval(call.Args[1], depth+1)
+	}
+	return "", fmt.Errorf("expected string literal, constant or path.Join call, got call of %s", gotypes.ExprString(call.Fun))
+}
+
+// embeddedDir returns the directory a //go:embed variable of the package embeds
+func (r *constResolver) embeddedDir(name string) (string, bool) {
+	dir, ok := r.file.embeds[name]
+	if !ok {
+		dir, ok = r.d.packageDecls(filepath.Dir(r.path), r.pkg).embeds[name]
+	}
+	return dir, ok
+}
+
+// declarations are the package-level constants of a file or package, and
+// the variables initialized with a call such as fs.Sub or filepath.Join,
+// mapped to their value expressions, and the directories its //go:embed
+// variables embed
+type declarations struct {
+	consts map[string]ast.Expr
+	embeds map[string]string
+}
+
+// fileDecls collects a file's package-level constants and variables
+func fileDecls(file *ast.File) *declarations {
+	decls := &declarations{consts: make(map[string]ast.Expr), embeds: make(map[string]string)}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || (gen.Tok != token.CONST && gen.Tok != token.VAR) {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if gen.Tok == token.VAR {
+				doc := vs.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				if dir, ok := embedDir(doc); ok && len(vs.Names) == 1 {
+					decls.embeds[vs.Names[0].Name] = dir
+				} else if len(vs.Values) == 1 && vs.Names[0].Name != "_" {
+					// var sub, _ = fs.Sub(migrations, "sql")
+					if call, ok := vs.Values[0].(*ast.CallExpr); ok {
+						decls.consts[vs.Names[0].Name] = call
+					}
+				}
+				continue
+			}
+			for i, name := range vs.Names {
+				if i < len(vs.Values) && name.Name != "_" {
+					decls.consts[name.Name] = vs.Values[i]
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// embedDir is the directory named by the first pattern of a //go:embed
+// directive, or the directory holding the files a glob pattern matches
+func embedDir(doc *ast.CommentGroup) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range doc.List {
+		args, ok := strings.CutPrefix(c.Text, embedDirective)
+		if !ok || (args != "" && args[0] != ' ' && args[0] != '\t') {
+			continue
+		}
+		fields := strings.Fields(args)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern := fields[0]
+		if unquoted, err := strconv.Unquote(pattern); err == nil {
+			pattern = unquoted
+		}
+		pattern = strings.TrimPrefix(pattern, "all:")
+		if strings.ContainsAny(pattern, "*?[") {
+			pattern = pathpkg.Dir(pattern)
+		}
+		return pattern, true
+	}
+	return "", false
+}
+
+// packageDecls collects the declarations of every non-test Go file of
+// package pkg in dir, parsing them once per directory
+func (d *ASTDiscoverer) packageDecls(dir, pkg string) *declarations {
+	key := dir + "\x00" + pkg
+	d.mu.Lock()
+	decls, ok := d.pkgDecls[key]
+	d.mu.Unlock()
+	if ok {
+		return decls
+	}
+
+	decls = &declarations{consts: make(map[string]ast.Expr), embeds: make(map[string]string)}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Debug("reading package directory for constants", "dir", dir, "error", err)
+	}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info, err := entry.Info(); err != nil || (d.maxFileSize() > 0 && info.Size() > d.maxFileSize()) {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			slog.Debug("reading package file for constants", "path", path, "error", err)
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, src, parseMode(src))
+		if err != nil {
+			slog.Debug("parsing package file for constants", "path", path, "error", err)
+			continue
+		}
+		if file.Name.Name != pkg {
+			continue
+		}
+		fileDecls := fileDecls(file)
+		maps.Copy(decls.consts, fileDecls.consts)
+		maps.Copy(decls.embeds, fileDecls.embeds)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pkgDecls == nil {
+		d.pkgDecls = make(map[string]*declarations)
+	}
+	d.pkgDecls[key] = decls
+	return decls
+}
@@ -0,0 +1,52 @@
+package discovery
+
+import (
+	"go/parser"
+	"strings"
+	"testing"
+)
+
+func TestExtractStringLiteral(t *testing.T) {
+	long := strings.Repeat("nested-directory/", 30) + "migrations"
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", expr: `"./migrations"`, want: "./migrations"},
+		{name: "spaces", expr: `"./db migrations"`, want: "./db migrations"},
+		{name: "unicode", expr: `"./迁移/café"`, want: "./迁移/café"},
+		{name: "unicode escape", expr: `"./caf\u00e9"`, want: "./café"},
+		{name: "hex escape", expr: `"./caf\xc3\xa9"`, want: "./café"},
+		{name: "raw string", expr: "`./my app\\migrations`", want: `./my app\migrations`},
+		{name: "escaped backslashes", expr: `"C:\\app\\migrations"`, want: `C:\app\migrations`},
+		{name: "extended-length", expr: `"\\\\?\\C:\\app\\migrations"`, want: `\\?\C:\app\migrations`},
+		{name: "long", expr: `"` + long + `"`, want: long},
+		{name: "integer", expr: `42`, wantErr: true},
+		{name: "rune", expr: `'m'`, wantErr: true},
+		{name: "identifier", expr: `migrationsDir`, wantErr: true},
+		{name: "concatenation", expr: `"./" + "migrations"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("parsing %s: %v", tt.expr, err)
+			}
+			got, err := extractStringLiteral(expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("extractStringLiteral(%s) = %q, want an error", tt.expr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractStringLiteral(%s): %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("extractStringLiteral(%s) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package discovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// CacheFileName is the AST discovery cache's file in ASTDiscoverer.CacheDir
+const CacheFileName = "discovery.json"
+
+// cacheVersion changes whenever what a file scan finds does, discarding
+// caches written by other versions
+const cacheVersion = 1
+
+// scanCache records what scanning each Go file found, so Discover can skip
+// files whose size and modification time are unchanged
+type scanCache struct {
+	Version     int                  `json:"version"`
+	MaxFileSize int64                `json:"max_file_size"`
+	Files       map[string]fileEntry `json:"files"` // by slash-separated path relative to the root
+}
+
+// fileEntry is the result of scanning one file
+type fileEntry struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mod_time"` // Unix nanoseconds
+	// Package stamps the Go files of the file's directory when it imports
+	// sqldb, as its constants may be declared in any of them
+	Package   string          `json:"package,omitempty"`
+	Skipped   bool            `json:"skipped,omitempty"`
+	Databases []cachedDB      `json:"databases,omitempty"`
+	Errors    []cachedProblem `json:"errors,omitempty"`
+}
+
+// cachedDB is a database found in a file, its migrations relative to the root
+type cachedDB struct {
+	Name       string `json:"name"`
+	Migrations string `json:"migrations"`
+}
+
+// cachedProblem is a types.DiscoveryError recorded for a file
+type cachedProblem struct {
+	Message string `json:"message"`
+	Cause   string `json:"cause,omitempty"`
+}
+
+// loadCache reads the cache in CacheDir, returning an empty one if it is missing,
+// unreadable or was written by another version or MaxFileSize
+func (d *ASTDiscoverer) loadCache() *scanCache {
+	empty := &scanCache{Version: cacheVersion, MaxFileSize: d.maxFileSize(), Files: make(map[string]fileEntry)}
+	path := filepath.Join(d.CacheDir, CacheFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("reading discovery cache", "path", path, "error", err)
+		}
+		return empty
+	}
+	var cache scanCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		slog.Debug("parsing discovery cache", "path", path, "error", err)
+		return empty
+	}
+	if cache.Version != cacheVersion || cache.MaxFileSize != d.maxFileSize() || cache.Files == nil {
+		slog.Debug("discarding stale discovery cache", "path", path)
+		return empty
+	}
+	return &cache
+}
+
+// saveCache replaces the cache in CacheDir, writing to a temporary file first so
+// concurrent runs never read a partial one
+func (d *ASTDiscoverer) saveCache(cache *scanCache) error {
+	if err := os.MkdirAll(d.CacheDir, 0755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("marshaling discovery cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(d.CacheDir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing discovery cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing discovery cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.CacheDir, CacheFileName)); err != nil {
+		return fmt.Errorf("saving discovery cache: %w", err)
+	}
+	return nil
+}
+
+// packageStamp hashes the names, sizes and modification times of the
+// non-test Go files in dir, once per directory and run
+func (d *ASTDiscoverer) packageStamp(dir string) string {
+	d.mu.Lock()
+	stamp, ok := d.stamps[dir]
+	d.mu.Unlock()
+	if ok {
+		return stamp
+	}
+
+	h := sha256.New()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Debug("reading package directory for the discovery cache", "dir", dir, "error", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+	stamp = hex.EncodeToString(h.Sum(nil))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stamps == nil {
+		d.stamps = make(map[string]string)
+	}
+	d.stamps[dir] = stamp
+	return stamp
+}
+
+// upToDate reports whether a file's cache entry still holds for it
+func (d *ASTDiscoverer) upToDate(entry fileEntry, info os.FileInfo, path string) bool {
+	if entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return false
+	}
+	return entry.Package == "" || entry.Package == d.packageStamp(filepath.Dir(path))
+}
+
+// newFileEntry records the result of scanning a file
+func (d *ASTDiscoverer) newFileEntry(absRoot, path string, info os.FileInfo, result scanResult) fileEntry {
+	entry := fileEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Skipped: result.skipped}
+	if result.candidate {
+		entry.Package = d.packageStamp(filepath.Dir(path))
+	}
+	for _, db := range result.databases {
+		rel, err := filepath.Rel(absRoot, db.MigrationsPath)
+		if err != nil {
+			rel = db.MigrationsPath
+		}
+		entry.Databases = append(entry.Databases, cachedDB{Name: db.Name, Migrations: filepath.ToSlash(rel)})
+	}
+	for _, err := range result.errors {
+		problem := cachedProblem{Message: err.Error()}
+		var discoveryErr *types.DiscoveryError
+		if errors.As(err, &discoveryErr) {
+			problem.Message = discoveryErr.Message
+			if discoveryErr.Cause != nil {
+				problem.Cause = discoveryErr.Cause.Error()
+			}
+		}
+		entry.Errors = append(entry.Errors, problem)
+	}
+	return entry
+}
+
+// scanResult rebuilds a file's scan result from its cache entry
+func (e fileEntry) scanResult(absRoot, path string) scanResult {
+	result := scanResult{skipped: e.Skipped, candidate: e.Package != ""}
+	for _, db := range e.Databases {
+		migrations := filepath.FromSlash(db.Migrations)
+		if !filepath.IsAbs(migrations) {
+			migrations = filepath.Join(absRoot, migrations)
+		}
+		result.databases = append(result.databases, types.EncoreDatabase{Name: db.Name, MigrationsPath: migrations, SourceFile: path})
+	}
+	for _, problem := range e.Errors {
+		err := &types.DiscoveryError{File: path, Message: problem.Message}
+		if problem.Cause != "" {
+			err.Cause = errors.New(problem.Cause)
+		}
+		result.errors = append(result.errors, err)
+	}
+	return result
+}
@@ -12,10 +12,30 @@ type Discoverer interface {
 	Discover(rootPath string) ([]types.EncoreDatabase, error)
 }
 
+// Discovery modes for source scans
+const (
+	ModeAST   = "ast"   // parse files one by one; fast, needs no dependencies (ASTDiscoverer)
+	ModeTyped = "typed" // type-check the module's packages (TypedDiscoverer)
+)
+
+// ValidMode checks a discovery mode; empty means ModeAST
+func ValidMode(mode string) error {
+	switch mode {
+	case "", ModeAST, ModeTyped:
+		return nil
+	}
+	return fmt.Errorf("unknown discovery mode %q (want %s or %s)", mode, ModeAST, ModeTyped)
+}
+
 // Options configures the discovery process
 type Options struct {
 	ManifestPath string // If set, use manifest instead of AST discovery
+	Mode         string // ModeAST (the default) or ModeTyped
 	Verbose      bool
+	MaxFileSize  int64    // AST discovery skips larger Go files; see ASTDiscoverer.MaxFileSize
+	SkipDirs     []string // directory patterns AST discovery skips besides DefaultSkipDirs
+	IncludeDirs  []string // directory patterns AST discovery walks even if skipped by default
+	CacheDir     string   // AST discovery caches what each file declares here; empty disables the cache
 }
 
 // New creates a Discoverer based on options
@@ -26,8 +46,18 @@ func New(opts Options) Discoverer {
 			verbose: opts.Verbose,
 		}
 	}
+	if opts.Mode == ModeTyped {
+		return &TypedDiscoverer{
+			Verbose:  opts.Verbose,
+			SkipDirs: opts.SkipDirs,
+		}
+	}
 	return &ASTDiscoverer{
-		Verbose: opts.Verbose,
+		Verbose:     opts.Verbose,
+		MaxFileSize: opts.MaxFileSize,
+		SkipDirs:    opts.SkipDirs,
+		IncludeDirs: opts.IncludeDirs,
+		CacheDir:    opts.CacheDir,
 	}
 }
 
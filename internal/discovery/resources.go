@@ -0,0 +1,170 @@
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+const (
+	encoreCronImport   = "encore.dev/cron"
+	encorePubSubImport = "encore.dev/pubsub"
+)
+
+// FindResources walks the source as ASTDiscoverer does and returns the cron
+// jobs and PubSub subscriptions it declares. Declarations whose name is not
+// a string literal are returned as non-fatal errors.
+func FindResources(rootPath string, opts Options) ([]types.EncoreResource, []error, error) {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving root path: %w", err)
+	}
+	skip := append(slices.Clone(DefaultSkipDirs), opts.SkipDirs...)
+	for _, pattern := range append(slices.Clone(skip), opts.IncludeDirs...) {
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return nil, nil, fmt.Errorf("invalid directory pattern %q: %w", pattern, err)
+		}
+	}
+	limit := (&ASTDiscoverer{MaxFileSize: opts.MaxFileSize}).maxFileSize()
+
+	var resources []types.EncoreResource
+	var problems []error
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(absRoot, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == absRoot {
+				return nil
+			}
+			rel, err := filepath.Rel(absRoot, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if matchDir(skip, rel) && !matchDir(opts.IncludeDirs, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		if info, err := entry.Info(); err != nil || (limit > 0 && info.Size() > limit) {
+			return nil
+		}
+
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(src, []byte(encoreCronImport)) && !bytes.Contains(src, []byte(encorePubSubImport)) {
+			return nil
+		}
+		found, errs, err := parseResources(fset, path, src)
+		if err != nil {
+			problems = append(problems, &types.DiscoveryError{File: path, Message: "failed to parse", Cause: err})
+			return nil
+		}
+		resources = append(resources, found...)
+		problems = append(problems, errs...)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("walking directory: %w", err)
+	}
+	return resources, problems, nil
+}
+
+// parseResources finds cron.NewJob and pubsub.NewSubscription calls in a file
+func parseResources(fset *token.FileSet, filePath string, src []byte) (resources []types.EncoreResource, problems []error, err error) {
+	node, err := parser.ParseFile(fset, filePath, src, parseMode(src))
+	if node != nil {
+		if file := fset.File(node.Package); file != nil {
+			defer fset.RemoveFile(file)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cronAlias := findImportAlias(node, encoreCronImport)
+	pubsubAlias := findImportAlias(node, encorePubSubImport)
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+
+		// cron.NewJob(id, cron.JobConfig{...});
+		// pubsub.NewSubscription(topic, name, pubsub.SubscriptionConfig[T]{...})
+		resource := types.EncoreResource{SourceFile: filePath}
+		var name ast.Expr
+		switch {
+		case cronAlias != "" && pkg.Name == cronAlias && sel.Sel.Name == "NewJob" && len(call.Args) >= 1:
+			resource.Kind, name = types.ResourceCron, call.Args[0]
+		case pubsubAlias != "" && pkg.Name == pubsubAlias && sel.Sel.Name == "NewSubscription" && len(call.Args) >= 2:
+			resource.Kind, name = types.ResourceSubscription, call.Args[1]
+			resource.Topic = gotypes.ExprString(call.Args[0])
+		default:
+			return true
+		}
+		value, err := extractStringLiteral(name)
+		if err != nil {
+			problems = append(problems, &types.DiscoveryError{
+				File:    filePath,
+				Message: fmt.Sprintf("failed to extract %s name", resource.Kind),
+				Cause:   err,
+			})
+			return true
+		}
+		resource.Name = value
+		resources = append(resources, resource)
+		return true
+	})
+	return resources, problems, nil
+}
+
+// ServiceDir returns the directory of the Encore service owning a database:
+// that of its NewDatabase call, or for a manifest entry the parent of its
+// migrations directory
+func ServiceDir(db types.EncoreDatabase) string {
+	if strings.HasSuffix(db.SourceFile, ".go") {
+		return filepath.Dir(db.SourceFile)
+	}
+	return filepath.Dir(db.MigrationsPath)
+}
+
+// ResourcesOf returns the resources declared in the service of a database
+// or its subpackages
+func ResourcesOf(db types.EncoreDatabase, resources []types.EncoreResource) []types.EncoreResource {
+	dir := ServiceDir(db)
+	var owned []types.EncoreResource
+	for _, r := range resources {
+		rel, err := filepath.Rel(dir, filepath.Dir(r.SourceFile))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			owned = append(owned, r)
+		}
+	}
+	return owned
+}
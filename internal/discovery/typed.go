@@ -0,0 +1,496 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	gotypes "go/types"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// maxWrapperDepth bounds how many wrapper functions deep a NewDatabase call
+// is followed back to the call that supplies its arguments
+const maxWrapperDepth = 8
+
+// TypedDiscoverer discovers Encore databases in type-checked packages loaded
+// with go/packages. Calls are recognised by what they resolve to rather than
+// how they are spelled, which covers aliased and dot imports, package-level
+// re-exports such as var NewDatabase = sqldb.NewDatabase, constants declared
+// in any package, and wrapper functions whose parameters supply the name or
+// config. It needs the go command and the app's module dependencies, as
+// `go build` does.
+type TypedDiscoverer struct {
+	Verbose bool
+	Errors  []error // Non-fatal errors encountered during discovery
+	// SkipDirs drops packages below directories matching these patterns, as
+	// for ASTDiscoverer. The go tool itself already ignores vendor, testdata
+	// and hidden or _-prefixed directories.
+	SkipDirs []string
+}
+
+// Discover loads every package of the module at rootPath, ./..., and finds
+// the sqldb.NewDatabase calls in it
+func (d *TypedDiscoverer) Discover(rootPath string) ([]types.EncoreDatabase, error) {
+	absRoot, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolving root path: %w", err)
+	}
+	for _, pattern := range d.SkipDirs {
+		if _, err := pathpkg.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid directory pattern %q: %w", pattern, err)
+		}
+	}
+
+	// Dependencies are type-checked from source too, rather than from export
+	// data that must match the version of the go command
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps |
+			packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+		Dir: absRoot,
+	}
+	if offline.Enabled() {
+		// Use only modules already in the module cache
+		cfg.Env = append(os.Environ(), "GOPROXY=off")
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("loading packages: %w", err)
+	}
+
+	idx := &typedIndex{vars: make(map[string]varInit), embeds: make(map[string]string), callers: make(map[string][]callSite)}
+	for _, pkg := range pkgs {
+		if d.skipped(absRoot, pkg) {
+			continue
+		}
+		for _, err := range pkg.Errors {
+			// Type errors leave parts of the package unresolved; carry on with the rest
+			d.Errors = append(d.Errors, &types.DiscoveryError{
+				File:    pkg.PkgPath,
+				Message: "failed to load package",
+				Cause:   err,
+			})
+		}
+		if pkg.TypesInfo != nil {
+			idx.add(pkg)
+		}
+	}
+
+	var databases []types.EncoreDatabase
+	for _, site := range idx.sites {
+		if idx.isNewDatabase(site.pkg, site.call.Fun, 0) {
+			databases = append(databases, d.resolve(idx, site)...)
+		}
+	}
+	// In file order, as ASTDiscoverer walks them
+	slices.SortStableFunc(databases, func(a, b types.EncoreDatabase) int {
+		return strings.Compare(a.SourceFile, b.SourceFile)
+	})
+	return databases, nil
+}
+
+// skipped reports whether a package lies below a directory matching SkipDirs
+func (d *TypedDiscoverer) skipped(absRoot string, pkg *packages.Package) bool {
+	if len(d.SkipDirs) == 0 || len(pkg.GoFiles) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(absRoot, filepath.Dir(pkg.GoFiles[0]))
+	if err != nil || rel == "." {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		if matchDir(d.SkipDirs, strings.Join(parts[:i+1], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve evaluates the arguments of a NewDatabase call. Arguments taken from
+// parameters of the enclosing function are followed back through each call
+// of it, so a wrapper yields one database per call.
+func (d *TypedDiscoverer) resolve(idx *typedIndex, site callSite) []types.EncoreDatabase {
+	var databases []types.EncoreDatabase
+	queue := [][]frame{{{pkg: site.pkg, fn: site.fn}}}
+	for len(queue) > 0 {
+		chain := queue[0]
+		queue = queue[1:]
+
+		db, err := idx.database(chain, site.call)
+		var unbound *unboundError
+		if errors.As(err, &unbound) {
+			top := chain[len(chain)-1]
+			callers := idx.callers[top.fn.FullName()]
+			switch {
+			case len(chain) > maxWrapperDepth:
+				err = fmt.Errorf("wrapper functions nested more than %d deep", maxWrapperDepth)
+			case len(callers) == 0:
+				err = fmt.Errorf("%w, and %s is never called", err, top.fn.Name())
+			default:
+				for _, c := range callers {
+					next := slices.Clone(chain)
+					next[len(next)-1].call = c.call
+					queue = append(queue, append(next, frame{pkg: c.pkg, fn: c.fn}))
+				}
+				continue
+			}
+		}
+		if err != nil {
+			d.Errors = append(d.Errors, &types.DiscoveryError{
+				File:    declaringPosition(chain, site.call).Filename,
+				Message: "failed to extract database config",
+				Cause:   err,
+			})
+			continue
+		}
+
+		if d.Verbose {
+			fmt.Printf("Found database %q in %s\n", db.Name, db.SourceFile)
+		}
+		if _, err := os.Stat(db.MigrationsPath); os.IsNotExist(err) {
+			d.Errors = append(d.Errors, &types.DiscoveryError{
+				File:    db.SourceFile,
+				Message: fmt.Sprintf("migrations directory does not exist: %s", db.MigrationsPath),
+			})
+		}
+		databases = append(databases, db)
+	}
+	return databases
+}
+
+// callSite is a call expression and the function declaring it, nil for
+// calls in package-level variable initializers
+type callSite struct {
+	pkg  *packages.Package
+	call *ast.CallExpr
+	fn   *gotypes.Func
+}
+
+// varInit is the initializer of a package-level variable
+type varInit struct {
+	pkg   *packages.Package
+	value ast.Expr
+}
+
+// typedIndex holds every call and package-level variable of the loaded packages
+type typedIndex struct {
+	sites   []callSite
+	vars    map[string]varInit    // by package path and name
+	embeds  map[string]string     // directories embedded by //go:embed variables, by package path and name
+	callers map[string][]callSite // calls by the full name of the function called
+}
+
+func (idx *typedIndex) add(pkg *packages.Package) {
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			var fn *gotypes.Func
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				fn, _ = pkg.TypesInfo.Defs[decl.Name].(*gotypes.Func)
+			case *ast.GenDecl:
+				if decl.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					vs := spec.(*ast.ValueSpec)
+					doc := vs.Doc
+					if doc == nil && len(decl.Specs) == 1 {
+						doc = decl.Doc
+					}
+					if dir, ok := embedDir(doc); ok && len(vs.Names) == 1 {
+						if obj, ok := pkg.TypesInfo.Defs[vs.Names[0]].(*gotypes.Var); ok {
+							idx.embeds[varKey(obj)] = dir
+						}
+						continue
+					}
+					if len(vs.Values) == 1 && len(vs.Names) > 1 {
+						// var sub, _ = fs.Sub(migrations, "sql")
+						if obj, ok := pkg.TypesInfo.Defs[vs.Names[0]].(*gotypes.Var); ok {
+							idx.vars[varKey(obj)] = varInit{pkg: pkg, value: vs.Values[0]}
+						}
+						continue
+					}
+					if len(vs.Values) != len(vs.Names) {
+						continue
+					}
+					for i, name := range vs.Names {
+						if obj, ok := pkg.TypesInfo.Defs[name].(*gotypes.Var); ok {
+							idx.vars[varKey(obj)] = varInit{pkg: pkg, value: vs.Values[i]}
+						}
+					}
+				}
+			}
+
+			ast.Inspect(decl, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				site := callSite{pkg: pkg, call: call, fn: fn}
+				idx.sites = append(idx.sites, site)
+				if callee := typeutil.StaticCallee(pkg.TypesInfo, call); callee != nil {
+					idx.callers[callee.FullName()] = append(idx.callers[callee.FullName()], site)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func varKey(v *gotypes.Var) string {
+	if v.Pkg() == nil {
+		return v.Name()
+	}
+	return v.Pkg().Path() + "." + v.Name()
+}
+
+// isNewDatabase reports whether fun is sqldb.NewDatabase, directly or through
+// package-level variables holding it
+func (idx *typedIndex) isNewDatabase(pkg *packages.Package, fun ast.Expr, depth int) bool {
+	var id *ast.Ident
+	switch f := ast.Unparen(fun).(type) {
+	case *ast.Ident:
+		id = f
+	case *ast.SelectorExpr:
+		id = f.Sel
+	default:
+		return false
+	}
+	switch obj := pkg.TypesInfo.Uses[id].(type) {
+	case *gotypes.Func:
+		return obj.Pkg() != nil && obj.Pkg().Path() == encoreSQLDBImport && obj.Name() == "NewDatabase"
+	case *gotypes.Var:
+		if init, ok := idx.vars[varKey(obj)]; ok && depth < maxWrapperDepth {
+			return idx.isNewDatabase(init.pkg, init.value, depth+1)
+		}
+	}
+	return false
+}
+
+// frame is a function body arguments are evaluated in. Its parameters are
+// bound by call, a call of fn in the next frame of the chain; the last frame
+// is unbound.
+type frame struct {
+	pkg  *packages.Package
+	fn   *gotypes.Func
+	call *ast.CallExpr
+}
+
+// unboundError reports a value taken from a parameter of the last frame
+type unboundError struct {
+	param string
+	fn    string
+}
+
+func (e *unboundError) Error() string {
+	return fmt.Sprintf("%s is a parameter of %s", e.param, e.fn)
+}
+
+// database evaluates a NewDatabase call in the innermost frame of chain
+func (idx *typedIndex) database(chain []frame, call *ast.CallExpr) (types.EncoreDatabase, error) {
+	if len(call.Args) < 2 {
+		return types.EncoreDatabase{}, fmt.Errorf("expected 2 arguments to NewDatabase, got %d", len(call.Args))
+	}
+	name, err := idx.stringValue(chain, 0, call.Args[0])
+	if err != nil {
+		return types.EncoreDatabase{}, fmt.Errorf("extracting database name: %w", err)
+	}
+	migrations, err := idx.migrationsPath(chain, 0, call.Args[1])
+	if err != nil {
+		return types.EncoreDatabase{}, fmt.Errorf("extracting migrations path: %w", err)
+	}
+
+	// Paths are relative to the file declaring the database, which for a
+	// wrapper is the one calling it rather than the wrapper's own
+	file := declaringPosition(chain, call).Filename
+	return types.EncoreDatabase{
+		Name:           name,
+		MigrationsPath: filepath.Clean(filepath.Join(filepath.Dir(file), filepath.FromSlash(migrations))),
+		SourceFile:     file,
+	}, nil
+}
+
+// declaringPosition is where the outermost call of chain is
+func declaringPosition(chain []frame, call *ast.CallExpr) token.Position {
+	last := chain[len(chain)-1]
+	if len(chain) > 1 {
+		call = chain[len(chain)-2].call
+	}
+	return last.pkg.Fset.Position(call.Pos())
+}
+
+// stringValue evaluates a constant string expression in frame i, following
+// parameters to the arguments bound to them
+func (idx *typedIndex) stringValue(chain []frame, i int, expr ast.Expr) (string, error) {
+	expr = ast.Unparen(expr)
+	info := chain[i].pkg.TypesInfo
+	if tv, ok := info.Types[expr]; ok && tv.Value != nil {
+		if tv.Value.Kind() != constant.String {
+			return "", fmt.Errorf("%s is not a string constant", gotypes.ExprString(expr))
+		}
+		return constant.StringVal(tv.Value), nil
+	}
+
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		if e.Op == token.ADD {
+			left, err := idx.stringValue(chain, i, e.X)
+			if err != nil {
+				return "", err
+			}
+			right, err := idx.stringValue(chain, i, e.Y)
+			if err != nil {
+				return "", err
+			}
+			return left + right, nil
+		}
+	case *ast.CallExpr:
+		return idx.callValue(chain, i, e)
+	case *ast.Ident:
+		if arg, ok, err := idx.argument(chain, i, e); ok || err != nil {
+			if err != nil {
+				return "", err
+			}
+			return idx.stringValue(chain, i+1, arg)
+		}
+		if v, ok := info.Uses[e].(*gotypes.Var); ok {
+			if dir, ok := idx.embeds[varKey(v)]; ok {
+				return dir, nil
+			}
+			if init, ok := idx.vars[varKey(v)]; ok {
+				return idx.stringValue([]frame{{pkg: init.pkg}}, 0, init.value)
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is not a string constant", gotypes.ExprString(expr))
+}
+
+// callValue evaluates path.Join and filepath.Join of string values, and
+// fs.Sub of an embedded FS, which is the subdirectory of the package's directory
+func (idx *typedIndex) callValue(chain []frame, i int, call *ast.CallExpr) (string, error) {
+	callee := typeutil.StaticCallee(chain[i].pkg.TypesInfo, call)
+	if callee == nil {
+		return "", fmt.Errorf("%s is not a string constant", gotypes.ExprString(call))
+	}
+	switch callee.FullName() {
+	case "path.Join", "path/filepath.Join":
+		if call.Ellipsis.IsValid() {
+			return "", fmt.Errorf("%s with a ... argument is not a constant", callee.FullName())
+		}
+		parts := make([]string, len(call.Args))
+		for n, arg := range call.Args {
+			part, err := idx.stringValue(chain, i, arg)
+			if err != nil {
+				return "", err
+			}
+			parts[n] = filepath.ToSlash(part)
+		}
+		return pathpkg.Join(parts...), nil
+	case "io/fs.Sub":
+		// The root of an embedded FS is its package's directory
+		fsys, ok := ast.Unparen(call.Args[0]).(*ast.Ident)
+		if !ok {
+			return "", fmt.Errorf("fs.Sub of %s is not an embedded FS", gotypes.ExprString(call.Args[0]))
+		}
+		if v, ok := chain[i].pkg.TypesInfo.Uses[fsys].(*gotypes.Var); !ok || idx.embeds[varKey(v)] == "" {
+			return "", fmt.Errorf("%s is not a //go:embed variable", fsys.Name)
+		}
+		return idx.stringValue(chain, i, call.Args[1])
+	}
+	return "", fmt.Errorf("%s is not a string constant", gotypes.ExprString(call))
+}
+
+// migrationsPath evaluates the Migrations field of a sqldb.DatabaseConfig
+// literal, given directly, through a parameter or as a package-level variable
+func (idx *typedIndex) migrationsPath(chain []frame, i int, expr ast.Expr) (string, error) {
+	expr = ast.Unparen(expr)
+	info := chain[i].pkg.TypesInfo
+	switch e := expr.(type) {
+	case *ast.CompositeLit:
+		if !isDatabaseConfig(info.TypeOf(e)) {
+			return "", fmt.Errorf("expected sqldb.DatabaseConfig, got %s", gotypes.ExprString(e))
+		}
+		for _, elt := range e.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Migrations" {
+				return idx.stringValue(chain, i, kv.Value)
+			}
+		}
+		return "", fmt.Errorf("Migrations field not found in DatabaseConfig")
+	case *ast.Ident:
+		if arg, ok, err := idx.argument(chain, i, e); ok || err != nil {
+			if err != nil {
+				return "", err
+			}
+			return idx.migrationsPath(chain, i+1, arg)
+		}
+		if v, ok := info.Uses[e].(*gotypes.Var); ok {
+			if init, ok := idx.vars[varKey(v)]; ok {
+				return idx.migrationsPath([]frame{{pkg: init.pkg}}, 0, init.value)
+			}
+		}
+	}
+	return "", fmt.Errorf("expected a sqldb.DatabaseConfig literal, got %s", gotypes.ExprString(expr))
+}
+
+// argument returns the argument bound to id when id is a parameter of frame
+// i's function, or an *unboundError when that frame is the last
+func (idx *typedIndex) argument(chain []frame, i int, id *ast.Ident) (ast.Expr, bool, error) {
+	f := chain[i]
+	v, ok := f.pkg.TypesInfo.Uses[id].(*gotypes.Var)
+	if !ok || f.fn == nil {
+		return nil, false, nil
+	}
+	sig := f.fn.Type().(*gotypes.Signature)
+	n := -1
+	for p := range sig.Params().Len() {
+		if sig.Params().At(p) == v {
+			n = p
+		}
+	}
+	if n < 0 {
+		return nil, false, nil
+	}
+	if f.call == nil {
+		return nil, true, &unboundError{param: v.Name(), fn: f.fn.Name()}
+	}
+	if sig.Variadic() && n == sig.Params().Len()-1 {
+		return nil, true, fmt.Errorf("%s is a variadic parameter of %s", v.Name(), f.fn.Name())
+	}
+
+	// A method expression such as T.M passes the receiver as the first argument
+	if sel, ok := ast.Unparen(f.call.Fun).(*ast.SelectorExpr); ok {
+		if s := chain[i+1].pkg.TypesInfo.Selections[sel]; s != nil && s.Kind() == gotypes.MethodExpr {
+			n++
+		}
+	}
+	if n >= len(f.call.Args) {
+		return nil, true, fmt.Errorf("call of %s has no argument for %s", f.fn.Name(), v.Name())
+	}
+	return f.call.Args[n], true, nil
+}
+
+// isDatabaseConfig reports whether t is sqldb.DatabaseConfig, possibly through an alias
+func isDatabaseConfig(t gotypes.Type) bool {
+	named, ok := gotypes.Unalias(t).(*gotypes.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == encoreSQLDBImport && obj.Name() == "DatabaseConfig"
+}
@@ -0,0 +1,125 @@
+// Package featureflag turns LaunchDarkly and Unleash feature flags on and off
+// through their admin APIs, to switch code paths as migrations make a schema
+// available.
+package featureflag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Providers a Client can talk to
+const (
+	ProviderLaunchDarkly = "launchdarkly"
+	ProviderUnleash      = "unleash"
+)
+
+// DefaultLaunchDarklyURL is the LaunchDarkly API used when no URL is set
+const DefaultLaunchDarklyURL = "https://app.launchdarkly.com"
+
+// requestTimeout bounds how long switching a flag may take
+const requestTimeout = 10 * time.Second
+
+// Client switches the flags of one project and environment of a provider
+type Client struct {
+	Provider    string // ProviderLaunchDarkly or ProviderUnleash
+	URL         string // API base URL; required for Unleash; $VARS are expanded
+	Project     string // LaunchDarkly project key or Unleash project ID
+	Environment string // LaunchDarkly environment key or Unleash environment
+	Token       string // API access token
+}
+
+// Validate reports settings the provider cannot work without
+func (c *Client) Validate() error {
+	switch c.Provider {
+	case ProviderLaunchDarkly:
+	case ProviderUnleash:
+		if c.URL == "" {
+			return fmt.Errorf("the %s provider needs a url", c.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown feature flag provider %q: expected %s or %s", c.Provider, ProviderLaunchDarkly, ProviderUnleash)
+	}
+	if c.Project == "" || c.Environment == "" {
+		return fmt.Errorf("the %s provider needs a project and an environment", c.Provider)
+	}
+	return nil
+}
+
+// Set turns a flag on or off in the client's environment. comment is
+// recorded in the flag's audit log where the provider keeps one.
+func (c *Client) Set(ctx context.Context, flag string, on bool, comment string) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var req *http.Request
+	var err error
+	switch c.Provider {
+	case ProviderLaunchDarkly:
+		req, err = c.launchDarklyRequest(ctx, flag, on, comment)
+	case ProviderUnleash:
+		req, err = c.unleashRequest(ctx, flag, on)
+	default:
+		err = c.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("creating request for flag %s: %w", flag, err)
+	}
+	req.Header.Set("Authorization", c.Token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("switching flag %s: %w", flag, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("switching flag %s: unexpected status %s", flag, resp.Status)
+	}
+	return nil
+}
+
+// launchDarklyRequest builds a semantic patch turning the flag on or off
+func (c *Client) launchDarklyRequest(ctx context.Context, flag string, on bool, comment string) (*http.Request, error) {
+	kind := "turnFlagOff"
+	if on {
+		kind = "turnFlagOn"
+	}
+	body, err := json.Marshal(map[string]any{
+		"environmentKey": c.Environment,
+		"comment":        comment,
+		"instructions":   []map[string]string{{"kind": kind}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := DefaultLaunchDarklyURL
+	if c.URL != "" {
+		base = os.ExpandEnv(c.URL)
+	}
+	endpoint := strings.TrimSuffix(base, "/") + "/api/v2/flags/" + url.PathEscape(c.Project) + "/" + url.PathEscape(flag)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json; domain-model=launchdarkly.semanticpatch")
+	return req, nil
+}
+
+// unleashRequest builds an admin API call enabling or disabling the flag
+func (c *Client) unleashRequest(ctx context.Context, flag string, on bool) (*http.Request, error) {
+	state := "off"
+	if on {
+		state = "on"
+	}
+	endpoint := strings.TrimSuffix(os.ExpandEnv(c.URL), "/") + "/api/admin/projects/" + url.PathEscape(c.Project) +
+		"/features/" + url.PathEscape(flag) + "/environments/" + url.PathEscape(c.Environment) + "/" + state
+	return http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+}
@@ -0,0 +1,72 @@
+// Package gcpauth authenticates to Google Cloud APIs with Application
+// Default Credentials.
+package gcpauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2/google"
+)
+
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// adc is looked up once and shared, so its token is reused across API calls
+var adc struct {
+	sync.Mutex
+	creds *google.Credentials
+}
+
+// Credentials returns cloud-platform scoped Application Default Credentials,
+// found the way Google's client libraries find them: the file named by
+// GOOGLE_APPLICATION_CREDENTIALS (any type gcloud writes, including
+// workload identity federation and impersonation), then gcloud's
+// application-default login, then the metadata server.
+func Credentials(ctx context.Context) (*google.Credentials, error) {
+	adc.Lock()
+	defer adc.Unlock()
+
+	if adc.creds == nil {
+		// the token source outlives ctx, which may be a request's timeout
+		creds, err := google.FindDefaultCredentials(context.WithoutCancel(ctx), cloudPlatformScope)
+		if err != nil {
+			return nil, err
+		}
+		adc.creds = creds
+	}
+	return adc.creds, nil
+}
+
+// AccessToken returns an OAuth2 access token from Application Default
+// Credentials, cached until shortly before it expires
+func AccessToken(ctx context.Context) (string, error) {
+	creds, err := Credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+	token, err := creds.TokenSource.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// DoJSON sends req and decodes a 2xx JSON response into v
+func DoJSON(req *http.Request, v any) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
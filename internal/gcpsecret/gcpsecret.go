@@ -0,0 +1,64 @@
+package gcpsecret
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/gcpauth"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/offline"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/secretcache"
+)
+
+// accessTimeout bounds fetching a token and the secret
+const accessTimeout = 30 * time.Second
+
+// namePattern matches a secret version resource name
+var namePattern = regexp.MustCompile(`^projects/[^/]+/secrets/[^/]+/versions/[^/]+$`)
+
+// ValidName reports whether name is a secret version resource name such as
+// projects/p/secrets/db-pass/versions/latest
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Access returns the payload of a Secret Manager secret version,
+// authenticating with Application Default Credentials. Payloads are cached
+// by secretcache, so a secret shared by several databases is fetched once.
+func Access(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("invalid secret name %q (want projects/<project>/secrets/<secret>/versions/<version>)", name)
+	}
+	return secretcache.Get("gcp_secret:"+name, func() (string, error) { return access(name) })
+}
+
+// access fetches a secret version's payload
+func access(name string) (string, error) {
+	if err := offline.Check("Secret Manager secret " + name); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), accessTimeout)
+	defer cancel()
+
+	creds, err := gcpauth.Credentials(ctx)
+	if err != nil {
+		return "", fmt.Errorf("finding Application Default Credentials: %w", err)
+	}
+	client, err := secretmanager.NewClient(ctx, option.WithCredentials(creds))
+	if err != nil {
+		return "", fmt.Errorf("creating Secret Manager client: %w", err)
+	}
+	defer client.Close()
+
+	resp, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return "", fmt.Errorf("accessing secret %s: %w", name, err)
+	}
+	return string(resp.GetPayload().GetData()), nil
+}
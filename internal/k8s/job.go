@@ -0,0 +1,209 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Paths inside the migration container. ConfigMountPath matches the image's
+// default ENCORE_MIGRATE_CONFIG.
+const (
+	ConfigMountPath = "/run/secrets"
+	ConfigFileName  = "infra.config.json"
+	StateMountPath  = "/var/run/encore-migrate"
+)
+
+// JobOptions describe the migration Job to generate
+type JobOptions struct {
+	Name            string
+	Namespace       string
+	Image           string
+	Args            []string // migrator arguments after the global flags, e.g. ["up"]
+	ConfigSecret    string   // Secret holding the InfraConfig
+	ConfigSecretKey string   // key of the InfraConfig within ConfigSecret
+	EnvSecret       string   // optional Secret exposed as environment variables (credentials for $env references)
+	BackoffLimit    int
+	Deadline        time.Duration // activeDeadlineSeconds; 0 for none
+	ArgoCD          bool          // emit as an ArgoCD PreSync hook
+}
+
+// Job renders the migration Job manifest as YAML
+func Job(opts JobOptions) ([]byte, error) {
+	if opts.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+	if opts.ConfigSecret == "" {
+		return nil, fmt.Errorf("config secret is required")
+	}
+	if opts.ConfigSecretKey == "" {
+		opts.ConfigSecretKey = ConfigFileName
+	}
+
+	labels := map[string]string{
+		"app.kubernetes.io/name":      "encore-migrator",
+		"app.kubernetes.io/instance":  opts.Name,
+		"app.kubernetes.io/component": "database-migration",
+	}
+
+	meta := objectMeta{Name: opts.Name, Namespace: opts.Namespace, Labels: labels}
+	if opts.ArgoCD {
+		// Run before the application syncs; keep a failed Job (and its logs)
+		// around until the next sync replaces it
+		meta.Annotations = map[string]string{
+			"argocd.argoproj.io/hook":               "PreSync",
+			"argocd.argoproj.io/hook-delete-policy": "BeforeHookCreation",
+		}
+	}
+
+	args := append([]string{"--state-dir", StateMountPath}, opts.Args...)
+
+	c := container{
+		Name:  "migrate",
+		Image: opts.Image,
+		Args:  args,
+		Env: []envVar{
+			{Name: "ENCORE_MIGRATE_CONFIG", Value: ConfigMountPath + "/" + ConfigFileName},
+		},
+		VolumeMounts: []volumeMount{
+			{Name: "infra-config", MountPath: ConfigMountPath, ReadOnly: true},
+			{Name: "state", MountPath: StateMountPath},
+		},
+		SecurityContext: &securityContext{
+			RunAsNonRoot:             true,
+			ReadOnlyRootFilesystem:   true,
+			AllowPrivilegeEscalation: false,
+		},
+	}
+	if opts.EnvSecret != "" {
+		c.EnvFrom = []envFromSource{{SecretRef: &secretRef{Name: opts.EnvSecret}}}
+	}
+
+	job := batchJob{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata:   meta,
+		Spec: jobSpec{
+			BackoffLimit: opts.BackoffLimit,
+			Template: podTemplate{
+				Metadata: objectMeta{Labels: maps.Clone(labels)},
+				Spec: podSpec{
+					RestartPolicy: "Never",
+					Containers:    []container{c},
+					Volumes: []volume{
+						{
+							Name: "infra-config",
+							Secret: &secretVolume{
+								SecretName: opts.ConfigSecret,
+								Items:      []keyToPath{{Key: opts.ConfigSecretKey, Path: ConfigFileName}},
+							},
+						},
+						{Name: "state", EmptyDir: &struct{}{}},
+					},
+				},
+			},
+		},
+	}
+	if opts.Deadline > 0 {
+		seconds := int64(opts.Deadline.Seconds())
+		job.Spec.ActiveDeadlineSeconds = &seconds
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(job); err != nil {
+		return nil, fmt.Errorf("encoding job: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding job: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// The types below are the subset of the Kubernetes API the Job needs
+
+type objectMeta struct {
+	Name        string            `yaml:"name,omitempty"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type batchJob struct {
+	APIVersion string     `yaml:"apiVersion"`
+	Kind       string     `yaml:"kind"`
+	Metadata   objectMeta `yaml:"metadata"`
+	Spec       jobSpec    `yaml:"spec"`
+}
+
+type jobSpec struct {
+	BackoffLimit          int         `yaml:"backoffLimit"`
+	ActiveDeadlineSeconds *int64      `yaml:"activeDeadlineSeconds,omitempty"`
+	Template              podTemplate `yaml:"template"`
+}
+
+type podTemplate struct {
+	Metadata objectMeta `yaml:"metadata"`
+	Spec     podSpec    `yaml:"spec"`
+}
+
+type podSpec struct {
+	RestartPolicy string      `yaml:"restartPolicy"`
+	Containers    []container `yaml:"containers"`
+	Volumes       []volume    `yaml:"volumes"`
+}
+
+type container struct {
+	Name            string           `yaml:"name"`
+	Image           string           `yaml:"image"`
+	Args            []string         `yaml:"args"`
+	Env             []envVar         `yaml:"env,omitempty"`
+	EnvFrom         []envFromSource  `yaml:"envFrom,omitempty"`
+	VolumeMounts    []volumeMount    `yaml:"volumeMounts"`
+	SecurityContext *securityContext `yaml:"securityContext,omitempty"`
+}
+
+type envVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type envFromSource struct {
+	SecretRef *secretRef `yaml:"secretRef,omitempty"`
+}
+
+type secretRef struct {
+	Name string `yaml:"name"`
+}
+
+type volumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type securityContext struct {
+	RunAsNonRoot             bool `yaml:"runAsNonRoot"`
+	ReadOnlyRootFilesystem   bool `yaml:"readOnlyRootFilesystem"`
+	AllowPrivilegeEscalation bool `yaml:"allowPrivilegeEscalation"`
+}
+
+type volume struct {
+	Name     string        `yaml:"name"`
+	Secret   *secretVolume `yaml:"secret,omitempty"`
+	EmptyDir *struct{}     `yaml:"emptyDir,omitempty"`
+}
+
+type secretVolume struct {
+	SecretName string      `yaml:"secretName"`
+	Items      []keyToPath `yaml:"items,omitempty"`
+}
+
+type keyToPath struct {
+	Key  string `yaml:"key"`
+	Path string `yaml:"path"`
+}
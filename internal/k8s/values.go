@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValuesOptions describe the values for the shared migration-job Helm chart
+type ValuesOptions struct {
+	Image           string
+	ConfigSecret    string
+	ConfigSecretKey string
+	EnvSecret       string
+	Args            []string
+	Databases       []ValuesDatabase
+	Resources       Resources
+	Key             string // nest the values under this key (e.g. a subchart alias); empty for top level
+}
+
+// ValuesDatabase is a database the Job migrates
+type ValuesDatabase struct {
+	Name       string `yaml:"name"`
+	Migrations string `yaml:"migrations"` // slash-separated path relative to the app root
+}
+
+// Resources are container resource requests and limits; empty values are omitted
+type Resources struct {
+	CPURequest    string
+	MemoryRequest string
+	CPULimit      string
+	MemoryLimit   string
+}
+
+type values struct {
+	Image        imageValues      `yaml:"image"`
+	ConfigSecret configSecret     `yaml:"configSecret"`
+	EnvSecret    string           `yaml:"envSecret,omitempty"`
+	Args         []string         `yaml:"args"`
+	Databases    []ValuesDatabase `yaml:"databases"`
+	Resources    resourceValues   `yaml:"resources,omitempty"`
+}
+
+type imageValues struct {
+	Repository string `yaml:"repository"`
+	Tag        string `yaml:"tag,omitempty"`
+}
+
+type configSecret struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type resourceValues struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+// Values renders the Helm values snippet as YAML
+func Values(opts ValuesOptions) ([]byte, error) {
+	if opts.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+	if opts.ConfigSecret == "" {
+		return nil, fmt.Errorf("config secret is required")
+	}
+	if opts.ConfigSecretKey == "" {
+		opts.ConfigSecretKey = ConfigFileName
+	}
+
+	repo, tag := splitImage(opts.Image)
+	v := values{
+		Image:        imageValues{Repository: repo, Tag: tag},
+		ConfigSecret: configSecret{Name: opts.ConfigSecret, Key: opts.ConfigSecretKey},
+		EnvSecret:    opts.EnvSecret,
+		Args:         opts.Args,
+		Databases:    opts.Databases,
+		Resources: resourceValues{
+			Requests: quantities(map[string]string{"cpu": opts.Resources.CPURequest, "memory": opts.Resources.MemoryRequest}),
+			Limits:   quantities(map[string]string{"cpu": opts.Resources.CPULimit, "memory": opts.Resources.MemoryLimit}),
+		},
+	}
+
+	var doc any = v
+	if opts.Key != "" {
+		doc = map[string]any{opts.Key: v}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encoding values: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding values: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// splitImage splits an image reference into repository and tag; digests stay in the repository
+func splitImage(image string) (repo, tag string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, ""
+}
+
+// quantities drops unset resource quantities, returning nil if none are set
+func quantities(m map[string]string) map[string]string {
+	for k, v := range m {
+		if v == "" {
+			delete(m, k)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
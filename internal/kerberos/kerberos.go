@@ -0,0 +1,130 @@
+// Package kerberos authenticates PostgreSQL connections with GSSAPI, using
+// the Kerberos tickets of the credential cache kinit fills: $KRB5CCNAME, or
+// /tmp/krb5cc_<uid>, with the realms of $KRB5_CONFIG or /etc/krb5.conf.
+// It has the API of github.com/lib/pq/auth/kerberos, which it stands in for
+// until that module can be required here:
+//
+//	pq.RegisterGSSProvider(func() (pq.GSS, error) { return kerberos.NewGSS() })
+package kerberos
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/lib/pq"
+)
+
+// DefaultServiceName is the service of PostgreSQL's principal, as in
+// postgres/db.example.com@EXAMPLE.COM, unless a server sets krb_srvname
+const DefaultServiceName = "postgres"
+
+// gss is a pq.GSS backed by the credential cache
+type gss struct {
+	cl *client.Client
+}
+
+// NewGSS returns a pq.GSS using the credential cache. lib/pq calls it, through
+// the provider registered with pq.RegisterGSSProvider, only once a server asks
+// for GSSAPI.
+func NewGSS() (pq.GSS, error) {
+	confPath := os.Getenv("KRB5_CONFIG")
+	if confPath == "" {
+		confPath = "/etc/krb5.conf"
+	}
+	conf, err := config.Load(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading Kerberos config %s: %w", confPath, err)
+	}
+
+	ccPath, err := credentialCache()
+	if err != nil {
+		return nil, err
+	}
+	ccache, err := credentials.LoadCCache(ccPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading Kerberos credential cache %s (run kinit first): %w", ccPath, err)
+	}
+	cl, err := client.NewFromCCache(ccache, conf, client.DisablePAFXFAST(true))
+	if err != nil {
+		return nil, fmt.Errorf("using Kerberos credential cache %s: %w", ccPath, err)
+	}
+	return &gss{cl: cl}, nil
+}
+
+// credentialCache is the path of the file credential cache to use
+func credentialCache() (string, error) {
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		kind, path, ok := strings.Cut(name, ":")
+		switch {
+		case !ok:
+			return name, nil
+		case kind == "FILE":
+			return path, nil
+		}
+		return "", fmt.Errorf("KRB5CCNAME %s: only FILE credential caches are supported", name)
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("finding the default Kerberos credential cache: %w", err)
+	}
+	return "/tmp/krb5cc_" + u.Uid, nil
+}
+
+// GetInitToken starts authenticating to service/host, canonicalizing the
+// host as krb5.conf's dns_canonicalize_hostname asks
+func (g *gss) GetInitToken(host, service string) ([]byte, error) {
+	if g.cl.Config.LibDefaults.DNSCanonicalizeHostname {
+		canonical, err := canonicalHostname(host)
+		if err != nil {
+			return nil, fmt.Errorf("canonicalizing %s: %w", host, err)
+		}
+		host = canonical
+	}
+	return g.GetInitTokenFromSpn(service + "/" + host)
+}
+
+// GetInitTokenFromSpn starts authenticating to the service principal spn
+func (g *gss) GetInitTokenFromSpn(spn string) ([]byte, error) {
+	token, err := spnego.SPNEGOClient(g.cl, spn).InitSecContext()
+	if err != nil {
+		return nil, fmt.Errorf("getting a ticket for %s: %w", spn, err)
+	}
+	return token.Marshal()
+}
+
+// Continue checks the server's answer; Kerberos needs a single round trip
+func (g *gss) Continue(inToken []byte) (bool, []byte, error) {
+	var token spnego.SPNEGOToken
+	if err := token.Unmarshal(inToken); err != nil {
+		return true, nil, fmt.Errorf("parsing GSSAPI response: %w", err)
+	}
+	if !token.Resp {
+		return true, nil, errors.New("GSSAPI response is not a negotiation response")
+	}
+	if state := token.NegTokenResp.State(); state != spnego.NegStateAcceptCompleted {
+		return true, nil, fmt.Errorf("GSSAPI negotiation ended in state %d", state)
+	}
+	return true, nil, nil
+}
+
+// canonicalHostname resolves host to the name of its first address, as
+// MIT Kerberos does
+func canonicalHostname(host string) (string, error) {
+	addrs, err := net.LookupHost(host)
+	if err != nil || len(addrs) == 0 {
+		return host, err
+	}
+	names, err := net.LookupAddr(addrs[0])
+	if err != nil || len(names) == 0 {
+		return host, err
+	}
+	return strings.TrimSuffix(names[0], "."), nil
+}
@@ -69,15 +69,25 @@ func copyFile(src, dst string) error {
 		return fmt.Errorf("stat source file: %w", err)
 	}
 
+	// Remove any previous copy first: a read-only file preserved from an earlier
+	// run can't be truncated in place on Windows
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("replacing destination file: %w", err)
+	}
+
 	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcInfo.Mode())
 	if err != nil {
 		return fmt.Errorf("creating destination file: %w", err)
 	}
-	defer dstFile.Close()
 
 	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
 		return fmt.Errorf("copying file contents: %w", err)
 	}
 
+	if err := dstFile.Close(); err != nil {
+		return fmt.Errorf("closing destination file: %w", err)
+	}
+
 	return nil
 }
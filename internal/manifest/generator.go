@@ -20,6 +20,13 @@ type GenerateOptions struct {
 	CopyTo     string // Optional: copy migrations to this directory
 	Format     string // yaml or json (auto-detected from OutputPath if empty)
 	Verbose    bool
+	// Mode selects the source scan; MaxFileSize, SkipDirs, IncludeDirs and
+	// CacheDir tune it, see discovery.ASTDiscoverer and discovery.TypedDiscoverer
+	Mode        string
+	MaxFileSize int64
+	SkipDirs    []string
+	IncludeDirs []string
+	CacheDir    string
 }
 
 // Generator creates manifest files from discovered Encore databases.
@@ -42,9 +49,14 @@ func (g *Generator) Generate() error {
 
 	slog.Debug("discovering databases", "app_path", appPath)
 
-	// Discover databases using AST
+	// Discover databases from the source
 	discoverer := discovery.New(discovery.Options{
-		Verbose: g.opts.Verbose,
+		Mode:        g.opts.Mode,
+		Verbose:     g.opts.Verbose,
+		MaxFileSize: g.opts.MaxFileSize,
+		SkipDirs:    g.opts.SkipDirs,
+		IncludeDirs: g.opts.IncludeDirs,
+		CacheDir:    g.opts.CacheDir,
 	})
 
 	databases, err := discoverer.Discover(appPath)
@@ -0,0 +1,161 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// identPattern matches a possibly schema-qualified, possibly quoted identifier
+const identPattern = `((?:"[^"]+"|[A-Za-z_][\w$]*)(?:\."[^"]+"|\.[A-Za-z_][\w$]*)?)`
+
+// tablePatterns match statements that create or change the contents of a table
+var tablePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bCREATE\s+(?:UNLOGGED\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + identPattern),
+	regexp.MustCompile(`(?i)\bALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern),
+	regexp.MustCompile(`(?i)\bINSERT\s+INTO\s+` + identPattern),
+	regexp.MustCompile(`(?i)\bUPDATE\s+(?:ONLY\s+)?` + identPattern + `\s+(?:AS\s+\w+\s+)?SET\b`),
+	regexp.MustCompile(`(?i)\bDELETE\s+FROM\s+(?:ONLY\s+)?` + identPattern),
+	regexp.MustCompile(`(?i)\bCREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:[\w"]+\s+)?ON\s+(?:ONLY\s+)?` + identPattern),
+	regexp.MustCompile(`(?i)\bCOPY\s+` + identPattern + `\s*(?:\(|FROM\b)`),
+}
+
+// AppliedUpFiles returns the up migrations with versions in (before, after]
+func AppliedUpFiles(migrationsPath string, before, after uint) ([]File, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []File
+	for _, f := range UpFiles(files) {
+		if f.Version > before && f.Version <= after {
+			applied = append(applied, f)
+		}
+	}
+	return applied, nil
+}
+
+// TouchedTables returns the tables created or modified by statements in the files, in first-seen order
+func TouchedTables(files []File) ([]string, error) {
+	seen := make(map[string]bool)
+	var tables []string
+
+	for _, f := range files {
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+
+		for _, stmt := range SplitStatements(string(content)) {
+			for _, pattern := range tablePatterns {
+				for _, match := range pattern.FindAllStringSubmatch(stmt.SQL, -1) {
+					table := normalizeIdent(match[1])
+					if !seen[table] {
+						seen[table] = true
+						tables = append(tables, table)
+					}
+				}
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+// schemaPattern matches CREATE SCHEMA statements
+var schemaPattern = regexp.MustCompile(`(?i)\bCREATE\s+SCHEMA\s+(?:IF\s+NOT\s+EXISTS\s+)?((?:"[^"]+"|[A-Za-z_][\w$]*))`)
+
+// CreatedSchemas returns the schemas created by statements in the files, in first-seen order
+func CreatedSchemas(files []File) ([]string, error) {
+	seen := make(map[string]bool)
+	var schemas []string
+
+	for _, f := range files {
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+
+		for _, stmt := range SplitStatements(string(content)) {
+			for _, match := range schemaPattern.FindAllStringSubmatch(stmt.SQL, -1) {
+				// CREATE SCHEMA AUTHORIZATION role names the schema after the role
+				if strings.EqualFold(match[1], "authorization") {
+					continue
+				}
+				schema := normalizeIdent(match[1])
+				if !seen[schema] {
+					seen[schema] = true
+					schemas = append(schemas, schema)
+				}
+			}
+		}
+	}
+
+	return schemas, nil
+}
+
+// normalizeIdent lowercases the unquoted parts of an identifier, as PostgreSQL does
+func normalizeIdent(ident string) string {
+	parts := strings.Split(ident, ".")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, `"`) {
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// AnalyzeApplied runs ANALYZE on the tables touched by up migrations with versions in (before, after]
+func (m *Migrator) AnalyzeApplied(connStr, migrationsPath string, before, after uint) ([]string, error) {
+	files, err := AppliedUpFiles(migrationsPath, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := TouchedTables(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Analyze(connStr, tables)
+}
+
+// Analyze runs ANALYZE on each table that still exists, returning the tables analyzed
+func (m *Migrator) Analyze(connStr string, tables []string) ([]string, error) {
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	var analyzed []string
+	for _, table := range tables {
+		// Tables dropped by a later migration in the same run no longer exist
+		var exists bool
+		if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+			return analyzed, fmt.Errorf("checking table %s: %w", table, err)
+		}
+		if !exists {
+			slog.Debug("skipping analyze of missing table", "table", table)
+			continue
+		}
+
+		slog.Debug("analyzing table", "table", table)
+		if _, err := conn.ExecContext(ctx, "ANALYZE "+table); err != nil {
+			return analyzed, fmt.Errorf("analyzing %s: %w", table, err)
+		}
+		analyzed = append(analyzed, table)
+	}
+
+	return analyzed, nil
+}
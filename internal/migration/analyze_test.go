@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTouchedTables(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"create table", "CREATE TABLE users (id int);", []string{"users"}},
+		{"create unlogged table if not exists", "create unlogged table if not exists Events (id int);", []string{"events"}},
+		{"schema-qualified", "CREATE TABLE billing.Invoices (id int);", []string{"billing.invoices"}},
+		{"quoted keeps case", `CREATE TABLE "Billing"."Invoices" (id int);`, []string{`"Billing"."Invoices"`}},
+		{"alter table only", "ALTER TABLE IF EXISTS ONLY orders ADD COLUMN total int;", []string{"orders"}},
+		{"insert", "INSERT INTO audit_log (id) VALUES (1);", []string{"audit_log"}},
+		{"update with alias", "UPDATE ONLY accounts AS a SET balance = 0;", []string{"accounts"}},
+		{"delete", "DELETE FROM sessions WHERE expired;", []string{"sessions"}},
+		{"index", "CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_email ON users (email);", []string{"users"}},
+		{"unnamed index", "CREATE INDEX ON ONLY events (created_at);", []string{"events"}},
+		{"copy", "COPY countries (code) FROM stdin;", []string{"countries"}},
+		{"copy from", "COPY countries FROM '/tmp/countries.csv';", []string{"countries"}},
+		{"select only", "SELECT * FROM users;", nil},
+		{"update in a comment", "-- update the docs\nSELECT 1;", nil},
+		{"first-seen order without repeats", "INSERT INTO b VALUES (1);\nCREATE TABLE a (id int);\nUPDATE b SET x = 1;", []string{"b", "a"}},
+		{"several per statement", "CREATE TABLE a AS SELECT 1;\nALTER TABLE c RENAME TO d;", []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeMigrations(t, map[string]string{"1_test.up.sql": tt.sql})
+			got, err := TouchedTables([]File{{Version: 1, Name: "1_test.up.sql", Path: filepath.Join(dir, "1_test.up.sql"), Direction: "up"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TouchedTables(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatedSchemas(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []string
+	}{
+		{"CREATE SCHEMA billing;", []string{"billing"}},
+		{"create schema if not exists Reporting;", []string{"reporting"}},
+		{`CREATE SCHEMA "Archive";`, []string{`"Archive"`}},
+		{"CREATE SCHEMA AUTHORIZATION app;", nil},
+		{"CREATE TABLE billing.invoices (id int);", nil},
+	}
+	for _, tt := range tests {
+		dir := writeMigrations(t, map[string]string{"1_test.up.sql": tt.sql})
+		got, err := CreatedSchemas([]File{{Version: 1, Name: "1_test.up.sql", Path: filepath.Join(dir, "1_test.up.sql"), Direction: "up"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CreatedSchemas(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// Backup writes a pg_dump custom-format archive of a database to path,
+// restorable with pg_restore. pg_dump must be on the PATH; connections
+// through the Cloud SQL connector or an SSH tunnel are not supported.
+func Backup(ctx context.Context, mapping *types.DatabaseMapping, path string) error {
+	if _, err := pgCommand(ctx, "pg_dump", mapping, "--format=custom", "--file="+path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// DumpSchema returns a plain SQL dump of a database's schema, without
+// ownership or privileges so it restores into a server without its roles.
+// psql meta-commands (\restrict in recent pg_dump versions) are dropped, so
+// RestoreSchema can run it. It has the requirements of Backup.
+func DumpSchema(ctx context.Context, mapping *types.DatabaseMapping) ([]byte, error) {
+	out, err := pgCommand(ctx, "pg_dump", mapping, "--schema-only", "--no-owner", "--no-privileges")
+	if err != nil {
+		return nil, err
+	}
+	var dump bytes.Buffer
+	for _, line := range bytes.SplitAfter(out, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte("\\")) {
+			dump.Write(line)
+		}
+	}
+	return dump.Bytes(), nil
+}
+
+// RestoreSchema runs a schema dump from DumpSchema against an empty database
+// in a single transaction
+func (m *Migrator) RestoreSchema(connStr string, dump []byte) error {
+	db, err := openDB(connStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(string(dump)); err != nil {
+		return fmt.Errorf("restoring schema: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("restoring schema: %w", err)
+	}
+	return nil
+}
+
+// RestoreData loads the data of a pg_dump custom-format archive, such as a
+// Backup, into a database whose schema already exists, in a single
+// transaction. pg_restore must be on the PATH; otherwise it has the
+// requirements of Backup.
+func RestoreData(ctx context.Context, mapping *types.DatabaseMapping, path string) error {
+	_, err := pgCommand(ctx, "pg_restore", mapping, "--data-only", "--no-owner", "--no-privileges", "--single-transaction", "--exit-on-error", "--dbname="+mapping.PGDBName, path)
+	return err
+}
+
+// pgCommand runs a libpq client tool such as pg_dump against a database and
+// returns its standard output
+func pgCommand(ctx context.Context, name string, mapping *types.DatabaseMapping, args ...string) ([]byte, error) {
+	switch {
+	case mapping.CloudSQLInstance != "" && mapping.Host == "":
+		return nil, fmt.Errorf("%s through the Cloud SQL connector is not supported; run it through the Cloud SQL Auth Proxy instead", name)
+	case mapping.SSHBastion != "":
+		return nil, fmt.Errorf("%s through an SSH tunnel is not supported; run it on the bastion instead", name)
+	}
+
+	port := mapping.Port
+	if port == "" {
+		port = "5432"
+	}
+	sslMode := mapping.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	env := append(os.Environ(),
+		"PGHOST="+mapping.Host,
+		"PGPORT="+port,
+		"PGUSER="+mapping.Username,
+		"PGPASSWORD="+mapping.Password,
+		"PGDATABASE="+mapping.PGDBName,
+		"PGSSLMODE="+sslMode,
+	)
+	for _, param := range []struct{ env, name, value string }{
+		{"PGSSLROOTCERT", "sslrootcert", mapping.SSLRootCert},
+		{"PGSSLCERT", "sslcert", mapping.SSLCert},
+		{"PGSSLKEY", "sslkey", mapping.SSLKey},
+	} {
+		if param.value == "" {
+			continue
+		}
+		file, err := tlsFile(param.name, param.value)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, param.env+"="+file)
+	}
+	if mapping.KerberosServiceName != "" {
+		env = append(env, "PGKRBSRVNAME="+mapping.KerberosServiceName)
+	}
+
+	slog.Debug("running "+name, "database", mapping.PGDBName, "args", args)
+	cmd := exec.CommandContext(ctx, name, append([]string{"--no-password"}, args...)...)
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
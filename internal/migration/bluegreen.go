@@ -0,0 +1,130 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SearchPath is the search_path for a blue/green schema. public stays on the
+// path so extension objects installed there keep resolving.
+func SearchPath(schema string) string {
+	return pq.QuoteIdentifier(schema) + ", public"
+}
+
+// EnsureSchema creates the session's schema if missing. It runs after session
+// setup, so the schema is owned by the run-as role when one is configured.
+func (m *Migrator) EnsureSchema(connStr string) error {
+	if m.session.Schema == "" {
+		return nil
+	}
+
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS `+pq.QuoteIdentifier(m.session.Schema)); err != nil {
+		return fmt.Errorf("creating schema %s: %w", m.session.Schema, err)
+	}
+	return nil
+}
+
+// Cutover describes a search_path switch
+type Cutover struct {
+	Database string // PostgreSQL database name
+	Role     string // application role whose per-database default is also switched
+	Schema   string // schema to switch to
+}
+
+// CutoverResult reports the defaults before and after a cutover
+type CutoverResult struct {
+	Previous string // previous database-level search_path default, empty if unset
+	Current  string
+	Version  uint // schema version found in the target schema
+}
+
+// Cutover points new sessions of the database (and of the application role in
+// it) at the target schema. The schema must hold a clean version table, so a
+// half-migrated schema is never made live. Open sessions keep their search_path
+// until they reconnect. Cutting over to the previous schema reverses it.
+func (m *Migrator) Cutover(connStr string, c Cutover) (*CutoverResult, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	version, dirty, err := readVersion(db, SessionOptions{Schema: c.Schema}.versionTable())
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("schema %s has no applied migrations; run up with --schema %s first", c.Schema, c.Schema)
+	}
+	if dirty {
+		return nil, fmt.Errorf("schema %s is dirty at version %d", c.Schema, version)
+	}
+
+	previous, err := databaseSearchPath(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CutoverResult{
+		Previous: previous,
+		Current:  SearchPath(c.Schema),
+		Version:  version,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	name := pq.QuoteIdentifier(c.Database)
+	slog.Info("switching search_path", "database", c.Database, "from", previous, "to", result.Current)
+	if _, err := tx.Exec(`ALTER DATABASE ` + name + ` SET search_path TO ` + result.Current); err != nil {
+		return nil, fmt.Errorf("setting database search_path: %w", err)
+	}
+	// A role-in-database setting overrides the database default
+	if c.Role != "" {
+		if _, err := tx.Exec(`ALTER ROLE ` + pq.QuoteIdentifier(c.Role) + ` IN DATABASE ` + name + ` SET search_path TO ` + result.Current); err != nil {
+			return nil, fmt.Errorf("setting search_path for role %s: %w", c.Role, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("switching search_path: %w", err)
+	}
+	return result, nil
+}
+
+// databaseSearchPath returns the database-level search_path default, if any
+func databaseSearchPath(db *sql.DB) (string, error) {
+	var settings []string
+	err := db.QueryRow(`
+		SELECT setconfig FROM pg_db_role_setting
+		WHERE setdatabase = (SELECT oid FROM pg_database WHERE datname = current_database())
+		  AND setrole = 0`).Scan(pq.Array(&settings))
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading search_path default: %w", err)
+	}
+	for _, s := range settings {
+		if v, ok := strings.CutPrefix(s, "search_path="); ok {
+			return v, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// applicationNamePrefix marks connections opened by the migrator in pg_stat_activity
+const applicationNamePrefix = "encore-migrator/"
+
+// ApplicationName returns the application_name used for a run's connections
+func ApplicationName(runID string) string {
+	return applicationNamePrefix + runID
+}
+
+// WithApplicationName sets the application_name parameter on a connection URL
+func WithApplicationName(connStr, name string) (string, error) {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return "", fmt.Errorf("parsing connection string: %w", err)
+	}
+	q := u.Query()
+	q.Set("application_name", name)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Backend is a migrator connection found in pg_stat_activity
+type Backend struct {
+	PID        int
+	RunID      string
+	State      string
+	QueryStart time.Time
+	Query      string
+}
+
+// CancelRun cancels (or terminates) the migrator backends connected to the
+// database. If runID is empty, backends of any run are targeted.
+func (m *Migrator) CancelRun(connStr, runID string, terminate bool) ([]Backend, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pattern := applicationNamePrefix + "%"
+	if runID != "" {
+		pattern = ApplicationName(runID)
+	}
+
+	rows, err := db.Query(`
+		SELECT pid, application_name, coalesce(state, ''), query_start, left(query, 200)
+		FROM pg_stat_activity
+		WHERE datname = current_database()
+		  AND application_name LIKE $1
+		  AND pid <> pg_backend_pid()`, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("listing migrator backends: %w", err)
+	}
+
+	var backends []Backend
+	for rows.Next() {
+		var (
+			b          Backend
+			appName    string
+			queryStart sql.NullTime
+		)
+		if err := rows.Scan(&b.PID, &appName, &b.State, &queryStart, &b.Query); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("listing migrator backends: %w", err)
+		}
+		b.RunID = strings.TrimPrefix(appName, applicationNamePrefix)
+		b.QueryStart = queryStart.Time
+		backends = append(backends, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing migrator backends: %w", err)
+	}
+
+	fn := "pg_cancel_backend"
+	if terminate {
+		fn = "pg_terminate_backend"
+	}
+
+	for _, b := range backends {
+		var ok bool
+		if err := db.QueryRow(`SELECT `+fn+`($1)`, b.PID).Scan(&ok); err != nil {
+			return backends, fmt.Errorf("%s(%d): %w", fn, b.PID, err)
+		}
+		if !ok {
+			return backends, fmt.Errorf("%s(%d) returned false (backend gone or insufficient privileges)", fn, b.PID)
+		}
+		slog.Info("signalled migrator backend", "function", fn, "pid", b.PID, "run_id", b.RunID)
+	}
+
+	return backends, nil
+}
+
+// IsCancelled reports whether err was caused by the statement being cancelled
+// or the backend terminated by an operator
+func IsCancelled(err error) bool {
+	pqErr := pqError(err)
+	if pqErr == nil {
+		return false
+	}
+	// query_canceled, admin_shutdown
+	return pqErr.Code == "57014" || pqErr.Code == "57P01"
+}
@@ -0,0 +1,212 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// checksumTable keeps the checksum of every applied up migration file, next
+// to golang-migrate's version table, so edits to applied files can be caught
+const checksumTable = "encore_migrate_checksums"
+
+const createChecksumTable = `CREATE TABLE IF NOT EXISTS %s (
+	version    bigint PRIMARY KEY,
+	checksum   text NOT NULL,
+	applied_at timestamptz NOT NULL
+)`
+
+// qualifiedChecksumTable is the (schema-qualified, for blue/green sessions) checksum table name
+func (o SessionOptions) qualifiedChecksumTable() string {
+	if o.Schema == "" {
+		return checksumTable
+	}
+	return pq.QuoteIdentifier(o.Schema) + "." + checksumTable
+}
+
+// Checksum returns the checksum recorded for the content of a migration file
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Results of comparing an applied migration with its recorded checksum
+const (
+	ChecksumOK         = "ok"
+	ChecksumChanged    = "changed"    // the file differs from the one that ran
+	ChecksumMissing    = "missing"    // the file was deleted or renumbered
+	ChecksumUnrecorded = "unrecorded" // applied without a recorded checksum, so unverified
+)
+
+// ChecksumResult compares an applied up migration with the checksum recorded when it ran
+type ChecksumResult struct {
+	Version   uint       `json:"version"`
+	File      string     `json:"file,omitempty"`
+	Status    string     `json:"status"`
+	Recorded  string     `json:"recorded,omitempty"`
+	Current   string     `json:"current,omitempty"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// prepareChecksums readies the driver to keep the checksum table in step
+// with a run in direction, creating the table once before anything is
+// applied so a run that cannot record checksums fails up front
+func (d *sessionDriver) prepareChecksums(direction string) error {
+	table := d.opts.qualifiedChecksumTable()
+	if _, err := d.conn.ExecContext(context.Background(), fmt.Sprintf(createChecksumTable, table)); err != nil {
+		return fmt.Errorf("creating %s: %w", checksumTable, err)
+	}
+	d.direction = direction
+	return nil
+}
+
+// recordChecksum keeps the checksum table in step with a version just
+// marked clean: going up the checksum of the body run is stored, going down
+// the versions rolled back are forgotten. It runs on the migration
+// connection once the version is marked clean, so a failure only warns:
+// the migration is done, and verify reports the version unrecorded.
+func (d *sessionDriver) recordChecksum(version int, body []byte) {
+	ctx := context.Background()
+	table := d.opts.qualifiedChecksumTable()
+	var err error
+	if d.direction == "up" {
+		_, err = d.conn.ExecContext(ctx, `INSERT INTO `+table+` (version, checksum, applied_at) VALUES ($1, $2, now())
+			ON CONFLICT (version) DO UPDATE SET checksum = excluded.checksum, applied_at = excluded.applied_at`,
+			int64(version), Checksum(body))
+	} else {
+		_, err = d.conn.ExecContext(ctx, `DELETE FROM `+table+` WHERE version > $1`, int64(version))
+	}
+	if err != nil {
+		slog.Warn("migration checksum not recorded", "version", version, "table", checksumTable, "error", err)
+	}
+}
+
+// recordedChecksums reads the checksum table; a database migrated before
+// checksums were recorded has none
+func (m *Migrator) recordedChecksums(ctx context.Context, connStr string) (map[uint]ChecksumResult, error) {
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	table := m.session.qualifiedChecksumTable()
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("checking %s: %w", checksumTable, err)
+	}
+	recorded := make(map[uint]ChecksumResult)
+	if !exists {
+		return recorded, nil
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum, applied_at FROM `+table)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", checksumTable, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var r ChecksumResult
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &r.Recorded, &appliedAt); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", checksumTable, err)
+		}
+		r.Version, r.AppliedAt = uint(version), &appliedAt
+		recorded[r.Version] = r
+	}
+	return recorded, rows.Err()
+}
+
+// VerifyChecksums compares the up migration files applied to a database,
+// those up to its current version, with the checksums recorded when they
+// ran, oldest first. Recorded versions whose file is gone are reported
+// missing.
+func (m *Migrator) VerifyChecksums(connStr, migrationsPath string) (uint, []ChecksumResult, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	status, err := m.GetStatus(connStr, migrationsPath)
+	if err != nil {
+		return 0, nil, err
+	}
+	recorded, err := m.recordedChecksums(context.Background(), connStr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var results []ChecksumResult
+	for _, f := range UpFiles(files) {
+		r, ok := recorded[f.Version]
+		delete(recorded, f.Version)
+		if f.Version > status.Version && !ok {
+			continue
+		}
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return 0, nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		r.Version, r.File, r.Current = f.Version, f.Name, Checksum(content)
+		switch {
+		case !ok:
+			r.Status = ChecksumUnrecorded
+		case r.Recorded != r.Current:
+			r.Status = ChecksumChanged
+		default:
+			r.Status = ChecksumOK
+		}
+		results = append(results, r)
+	}
+	for _, r := range recorded {
+		r.Status = ChecksumMissing
+		results = append(results, r)
+	}
+	slices.SortFunc(results, func(a, b ChecksumResult) int { return cmp.Compare(a.Version, b.Version) })
+	return status.Version, results, nil
+}
+
+// BaselineChecksums records the checksums of the current files of applied
+// up migrations that have none, for databases migrated before checksums
+// were recorded, and returns how many it recorded
+func (m *Migrator) BaselineChecksums(connStr, migrationsPath string) (int, error) {
+	_, results, err := m.VerifyChecksums(connStr, migrationsPath)
+	if err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	table := m.session.qualifiedChecksumTable()
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(createChecksumTable, table)); err != nil {
+		return 0, fmt.Errorf("creating %s: %w", checksumTable, err)
+	}
+	recorded := 0
+	for _, r := range results {
+		if r.Status != ChecksumUnrecorded {
+			continue
+		}
+		res, err := conn.ExecContext(ctx, `INSERT INTO `+table+` (version, checksum, applied_at) VALUES ($1, $2, now())
+			ON CONFLICT (version) DO NOTHING`, int64(r.Version), r.Current)
+		if err != nil {
+			return recorded, fmt.Errorf("writing %s: %w", checksumTable, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			recorded++
+		}
+	}
+	return recorded, nil
+}
@@ -0,0 +1,96 @@
+package migration
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBuildSourceURL(t *testing.T) {
+	long := "/srv/" + strings.Repeat("nested-directory/", 20) + "migrations"
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		windows bool
+	}{
+		{name: "plain", path: "/srv/app/migrations", want: "file:///srv/app/migrations"},
+		{name: "spaces", path: "/srv/my app/db migrations", want: "file:///srv/my%20app/db%20migrations"},
+		{name: "unicode", path: "/srv/café/迁移", want: "file:///srv/caf%C3%A9/%E8%BF%81%E7%A7%BB"},
+		{name: "reserved characters", path: "/srv/a#b?c%d/migrations", want: "file:///srv/a%23b%3Fc%25d/migrations"},
+		{name: "long", path: long, want: "file://" + long},
+		{name: "drive letter", path: `C:\Users\dev\app\migrations`, want: "file:///C:/Users/dev/app/migrations", windows: true},
+		{name: "extended-length", path: `\\?\C:\Users\dev\my app\migrations`, want: "file:///C:/Users/dev/my%20app/migrations", windows: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.windows != (runtime.GOOS == "windows") {
+				t.Skip("path syntax of another platform")
+			}
+			got := BuildSourceURL(tt.path)
+			if got != tt.want {
+				t.Errorf("BuildSourceURL(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatalf("url.Parse(%q): %v", got, err)
+			}
+			if want := filepath.ToSlash(strings.TrimPrefix(tt.path, `\\?\`)); strings.TrimPrefix(u.Path, "/") != strings.TrimPrefix(want, "/") {
+				t.Errorf("path of %q = %q, want %q", got, u.Path, want)
+			}
+		})
+	}
+}
+
+func TestOpenSource(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{name: "spaces", dir: "my app/db migrations"},
+		{name: "unicode", dir: "café/迁移"},
+		{name: "reserved characters", dir: "a#b?c%d"},
+		{name: "long", dir: filepath.Join(strings.Repeat("nested-directory-"+strings.Repeat("x", 40)+string(filepath.Separator), 6), "migrations")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" && strings.ContainsAny(tt.dir, "?") {
+				t.Skip("not a valid Windows file name")
+			}
+			dir := filepath.Join(t.TempDir(), tt.dir)
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"1_init.up.sql", "1_init.down.sql", "2_add_email.up.sql"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			src, err := openSource(dir)
+			if err != nil {
+				t.Fatalf("openSource(%q): %v", dir, err)
+			}
+			defer src.Close()
+			first, err := src.First()
+			if err != nil || first != 1 {
+				t.Fatalf("First() = %d, %v, want 1", first, err)
+			}
+			next, err := src.Next(first)
+			if err != nil || next != 2 {
+				t.Fatalf("Next(1) = %d, %v, want 2", next, err)
+			}
+
+			files, err := ListFiles(dir)
+			if err != nil {
+				t.Fatalf("ListFiles(%q): %v", dir, err)
+			}
+			if len(files) != 3 {
+				t.Errorf("ListFiles(%q) found %d files, want 3", dir, len(files))
+			}
+		})
+	}
+}
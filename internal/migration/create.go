@@ -0,0 +1,107 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numbering schemes for new migration versions
+const (
+	NumberingSequential = "sequential" // highest existing version + 1
+	NumberingTimestamp  = "timestamp"  // UTC time as YYYYMMDDHHMMSS
+)
+
+// timestampLayout formats timestamp versions
+const timestampLayout = "20060102150405"
+
+// NextVersion returns the version for a new migration and the zero-padded
+// width to print it with, matching the padding of the latest existing file
+func NextVersion(files []File, numbering string, now time.Time) (uint, int, error) {
+	var latest *File
+	for i := range files {
+		if latest == nil || files[i].Version > latest.Version {
+			latest = &files[i]
+		}
+	}
+
+	switch numbering {
+	case NumberingSequential:
+		if latest == nil {
+			return 1, 0, nil
+		}
+		width := 0
+		if prefix, _, _ := strings.Cut(latest.Name, "_"); strings.HasPrefix(prefix, "0") {
+			width = len(prefix)
+		}
+		return latest.Version + 1, width, nil
+	case NumberingTimestamp:
+		parsed, err := strconv.ParseUint(now.UTC().Format(timestampLayout), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		version := uint(parsed)
+		if latest != nil && version <= latest.Version {
+			return 0, 0, fmt.Errorf("timestamp version %d is not after the latest version %d", version, latest.Version)
+		}
+		return version, 0, nil
+	}
+	return 0, 0, fmt.Errorf("unknown numbering %q (want %s or %s)", numbering, NumberingSequential, NumberingTimestamp)
+}
+
+// MigrationName normalizes a description into a file name identifier:
+// lowercase with runs of other characters replaced by underscores
+func MigrationName(description string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(description) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// CreateFiles writes empty up and down migration stubs to dir and returns their paths.
+// Existing files are never overwritten.
+func CreateFiles(dir string, version uint, width int, name string) (string, string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", fmt.Errorf("creating migrations directory: %w", err)
+	}
+
+	base := fmt.Sprintf("%0*d_%s", width, version, name)
+	up := filepath.Join(dir, base+".up.sql")
+	down := filepath.Join(dir, base+".down.sql")
+
+	if err := writeStub(up, fmt.Sprintf("-- Migration %d: %s\n", version, name)); err != nil {
+		return "", "", err
+	}
+	if err := writeStub(down, fmt.Sprintf("-- Revert migration %d: %s\n", version, name)); err != nil {
+		os.Remove(up)
+		return "", "", err
+	}
+	return up, down, nil
+}
+
+func writeStub(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	_, writeErr := f.WriteString(content)
+	if err := errors.Join(writeErr, f.Close()); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
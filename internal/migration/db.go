@@ -0,0 +1,177 @@
+package migration
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/lib/pq"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/cloudsql"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/sshtunnel"
+)
+
+// migrationsTable is the golang-migrate version table
+const migrationsTable = "schema_migrations"
+
+// connectionsOpened counts the handles openDB has connected, for benchmarks
+var connectionsOpened atomic.Int64
+
+// ConnectionsOpened returns how many database connections have been opened
+// so far by this process
+func ConnectionsOpened() int64 {
+	return connectionsOpened.Load()
+}
+
+// openDB opens a plain database/sql handle for a golang-migrate connection URL,
+// stripping the x-* parameters that only golang-migrate understands
+func openDB(connStr string) (*sql.DB, error) {
+	u, err := url.Parse(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection string: %w", err)
+	}
+
+	var db *sql.DB
+	if instance := u.Query().Get(cloudSQLInstanceParam); instance != "" {
+		db, err = openCloudSQL(u, instance)
+	} else if u.Query().Get(sshBastionParam) != "" {
+		db, err = openSSHTunnel(u)
+	} else {
+		db, err = sql.Open("postgres", migrate.FilterCustomQuery(u).String())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	connectionsOpened.Add(1)
+
+	return db, nil
+}
+
+// openCloudSQL opens a handle whose connections are dialled by the Cloud SQL connector
+func openCloudSQL(u *url.URL, instance string) (*sql.DB, error) {
+	inst, err := cloudsql.ParseInstance(instance)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	var minVersion uint16
+	if v := q.Get(tlsMinVersionParam); v != "" {
+		if minVersion, err = ParseTLSVersion(v); err != nil {
+			return nil, err
+		}
+	}
+	connector, err := pq.NewConnector(migrate.FilterCustomQuery(u).String())
+	if err != nil {
+		return nil, err
+	}
+	connector.Dialer(&cloudsql.Dialer{
+		Instance:   inst,
+		IAMAuthN:   q.Get(cloudSQLIAMParam) == "true",
+		IPType:     q.Get(cloudSQLIPTypeParam),
+		MinVersion: minVersion,
+	})
+	return sql.OpenDB(connector), nil
+}
+
+// openSSHTunnel opens a handle whose connections go through an SSH tunnel
+func openSSHTunnel(u *url.URL) (*sql.DB, error) {
+	dialer, err := sshDialer(u.Query())
+	if err != nil {
+		return nil, err
+	}
+	connector, err := pq.NewConnector(migrate.FilterCustomQuery(u).String())
+	if err != nil {
+		return nil, err
+	}
+	connector.Dialer(dialer)
+	return sql.OpenDB(connector), nil
+}
+
+// sshDialer is the tunnel dialer set by a connection URL's ssh parameters
+func sshDialer(q url.Values) (*sshtunnel.Dialer, error) {
+	b, err := sshtunnel.ParseBastion(q.Get(sshBastionParam))
+	if err != nil {
+		return nil, err
+	}
+	return &sshtunnel.Dialer{
+		Bastion:      b,
+		IdentityFile: q.Get(sshIdentityParam),
+		NoAgent:      q.Get(sshNoAgentParam) == "true",
+		Options:      q[sshOptionParam],
+	}, nil
+}
+
+// sshRemote is the address lib/pq dials, and so tunnels to, for u
+func sshRemote(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "5432"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// versionTable is the (schema-qualified, for blue/green sessions) version table name
+func (o SessionOptions) versionTable() string {
+	if o.Schema == "" {
+		return migrationsTable
+	}
+	return pq.QuoteIdentifier(o.Schema) + "." + migrationsTable
+}
+
+// readVersion reads the golang-migrate version row from table. A missing table or row means version 0.
+func readVersion(db *sql.DB, table string) (version uint, dirty bool, err error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return 0, false, fmt.Errorf("checking %s: %w", table, err)
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	var v int64
+	err = db.QueryRow(`SELECT version, dirty FROM `+table+` LIMIT 1`).Scan(&v, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("reading %s: %w", table, err)
+	}
+	if v < 0 {
+		return 0, dirty, nil
+	}
+
+	return uint(v), dirty, nil
+}
+
+// pqError extracts the PostgreSQL error behind err. golang-migrate's
+// database.Error does not implement Unwrap, so it is unpacked explicitly.
+func pqError(err error) *pq.Error {
+	for err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			return pqErr
+		}
+
+		var dbErr database.Error
+		var dbErrPtr *database.Error
+		switch {
+		case errors.As(err, &dbErr):
+			err = dbErr.OrigErr
+		case errors.As(err, &dbErrPtr):
+			err = dbErrPtr.OrigErr
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Destructive lint rules. Each flags a statement of an up migration that
+// loses data or blocks the tables running code uses while it runs. They
+// apply to pending migrations: `lint --pending` and the pass up runs before
+// applying, which --block-destructive turns into a refusal.
+const (
+	RuleDropTable          = "drop-table"           // DROP TABLE
+	RuleDropColumn         = "drop-column"          // ALTER TABLE ... DROP COLUMN
+	RuleTruncate           = "truncate"             // TRUNCATE
+	RuleNonConcurrentIndex = "non-concurrent-index" // CREATE INDEX on an existing table without CONCURRENTLY
+	RuleNarrowingAlter     = "narrowing-alter"      // ALTER COLUMN ... TYPE to a bounded type
+)
+
+// DestructiveRuleNames lists the destructive rules in the order they are documented
+var DestructiveRuleNames = []string{RuleDropTable, RuleDropColumn, RuleTruncate, RuleNonConcurrentIndex, RuleNarrowingAlter}
+
+var (
+	dropTablePattern   = regexp.MustCompile(`(?i)^\s*DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?` + identPattern)
+	truncatePattern    = regexp.MustCompile(`(?i)^\s*TRUNCATE\s+(?:TABLE\s+)?(?:ONLY\s+)?` + identPattern)
+	alterTableTarget   = regexp.MustCompile(`(?i)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern)
+	dropColumnPattern  = regexp.MustCompile(`(?i)\bDROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?("[^"]+"|[A-Za-z_]\w*)`)
+	createIndexPattern = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:[\w"]+\s+)?ON\s+(?:ONLY\s+)?` + identPattern)
+	alterTypePattern   = regexp.MustCompile(`(?i)\bALTER\s+(?:COLUMN\s+)?("[^"]+"|[A-Za-z_]\w*)\s+(?:SET\s+DATA\s+)?TYPE\s+((?:character\s+varying|double\s+precision|[\w.]+)(?:\s*\([^)]*\))?)`)
+
+	// narrowTypePattern matches the types an ALTER COLUMN may narrow a
+	// column to: those with a length or precision, and the smaller numbers
+	narrowTypePattern = regexp.MustCompile(`(?i)^(?:(?:character\s+varying|varchar|character|char|bit|varbit|numeric|decimal)\s*\(|(?:smallint|int2|integer|int|int4|real|float4)$)`)
+)
+
+// droppedColumnWords follow DROP in ALTER TABLE without naming a column
+var droppedColumnWords = map[string]bool{"CONSTRAINT": true, "DEFAULT": true, "NOT": true, "IDENTITY": true, "EXPRESSION": true}
+
+// LintDestructive checks up migration files, normally those pending on a
+// database, with the destructive rules. Indexes on tables the same file
+// creates are not flagged: the table is still empty.
+func LintDestructive(files []File, opts LintOptions) ([]LintIssue, error) {
+	var issues []LintIssue
+	for _, f := range files {
+		if f.Direction != "up" {
+			continue
+		}
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		created := make(map[string]bool)
+		for _, stmt := range SplitStatements(string(content)) {
+			if match := createTablePattern.FindStringSubmatch(stripLeadingComments(stmt.SQL)); match != nil {
+				created[normalizeIdent(match[2])] = true
+			}
+		}
+		issues = append(issues, lintStatements(f.Name, string(content), opts, func(text string) (string, string) {
+			return lintDestructive(text, created)
+		})...)
+	}
+	return issues, nil
+}
+
+func lintDestructive(text string, created map[string]bool) (string, string) {
+	if match := dropTablePattern.FindStringSubmatch(text); match != nil {
+		return RuleDropTable, fmt.Sprintf("DROP TABLE %s deletes the table and its data", normalizeIdent(match[1]))
+	}
+	if match := truncatePattern.FindStringSubmatch(text); match != nil {
+		return RuleTruncate, fmt.Sprintf("TRUNCATE %s deletes every row", normalizeIdent(match[1]))
+	}
+	if match := createIndexPattern.FindStringSubmatch(text); match != nil {
+		table := normalizeIdent(match[2])
+		if match[1] != "" || created[table] {
+			return "", ""
+		}
+		return RuleNonConcurrentIndex, fmt.Sprintf("CREATE INDEX on %s without CONCURRENTLY blocks writes to it while the index builds (CONCURRENTLY needs -- %s: none)", table, TransactionDirective)
+	}
+	target := alterTableTarget.FindStringSubmatch(text)
+	if target == nil {
+		return "", ""
+	}
+	table := normalizeIdent(target[1])
+	rest := text[len(target[0]):]
+	for _, match := range dropColumnPattern.FindAllStringSubmatch(rest, -1) {
+		if !droppedColumnWords[strings.ToUpper(match[1])] {
+			return RuleDropColumn, fmt.Sprintf("DROP COLUMN %s.%s deletes the column's data and breaks code still reading it", table, normalizeIdent(match[1]))
+		}
+	}
+	for _, match := range alterTypePattern.FindAllStringSubmatch(rest, -1) {
+		if narrowTypePattern.MatchString(match[2]) {
+			return RuleNarrowingAlter, fmt.Sprintf("changing %s.%s to %s may not fit existing values and rewrites the table", table, normalizeIdent(match[1]), match[2])
+		}
+	}
+	return "", ""
+}
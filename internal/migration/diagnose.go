@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Lock is a lock held or awaited by another backend in the database
+type Lock struct {
+	PID             int
+	LockType        string
+	Mode            string
+	Granted         bool
+	Relation        string
+	ApplicationName string
+	State           string
+	Query           string
+	QueryStart      time.Time
+}
+
+// Diagnosis gathers context for recovering a dirty database
+type Diagnosis struct {
+	Version         uint
+	Files           []File // migration files for the dirty version
+	PreviousVersion int    // highest version below the dirty one, -1 if none
+	Locks           []Lock
+}
+
+// Diagnose collects the dirty version's files and the locks currently held in the database
+func (m *Migrator) Diagnose(connStr, migrationsPath string, version uint) (*Diagnosis, error) {
+	diag := &Diagnosis{Version: version, PreviousVersion: -1}
+
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Version == version {
+			diag.Files = append(diag.Files, f)
+		} else if f.Version < version && int(f.Version) > diag.PreviousVersion {
+			diag.PreviousVersion = int(f.Version)
+		}
+	}
+
+	db, err := openDB(connStr)
+	if err != nil {
+		return diag, err
+	}
+	defer db.Close()
+
+	diag.Locks, err = queryLocks(db)
+	return diag, err
+}
+
+// queryLocks lists relation and advisory locks held or awaited by other backends in the current database
+func queryLocks(db *sql.DB) ([]Lock, error) {
+	rows, err := db.Query(`
+		SELECT l.pid, l.locktype, l.mode, l.granted,
+		       coalesce(l.relation::regclass::text, ''),
+		       coalesce(a.application_name, ''), coalesce(a.state, ''),
+		       left(coalesce(a.query, ''), 120), a.query_start
+		FROM pg_locks l
+		LEFT JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+		  AND l.locktype IN ('relation', 'advisory')
+		  AND l.pid <> pg_backend_pid()
+		ORDER BY l.granted, l.pid`)
+	if err != nil {
+		return nil, fmt.Errorf("querying locks: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []Lock
+	for rows.Next() {
+		var (
+			l          Lock
+			queryStart sql.NullTime
+		)
+		if err := rows.Scan(&l.PID, &l.LockType, &l.Mode, &l.Granted, &l.Relation,
+			&l.ApplicationName, &l.State, &l.Query, &queryStart); err != nil {
+			return nil, fmt.Errorf("querying locks: %w", err)
+		}
+		l.QueryStart = queryStart.Time
+		locks = append(locks, l)
+	}
+
+	return locks, rows.Err()
+}
@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Dialect selects PostgreSQL-extension-specific migration behavior
+type Dialect string
+
+const (
+	DialectPostgres  Dialect = ""
+	DialectTimescale Dialect = "timescaledb"
+	DialectCitus     Dialect = "citus"
+)
+
+// Directives understood by dialect-aware execution
+const (
+	// TransactionDirective set to "none" runs each statement of the file on its
+	// own instead of as one implicit transaction, for DDL that refuses to run in
+	// a transaction block (continuous aggregates, CREATE INDEX CONCURRENTLY, ...)
+	TransactionDirective = "transaction"
+
+	HypertableDirective     = "hypertable"      // timescaledb: "table(time_column)"
+	DistributeDirective     = "distribute"      // citus: "table(distribution_column)"
+	ReferenceTableDirective = "reference-table" // citus: "table"
+)
+
+// ParseDialect validates a configured dialect name
+func ParseDialect(name string) (Dialect, error) {
+	switch d := Dialect(strings.ToLower(strings.TrimSpace(name))); d {
+	case DialectPostgres, DialectTimescale, DialectCitus:
+		return d, nil
+	case "postgres", "postgresql":
+		return DialectPostgres, nil
+	case "timescale":
+		return DialectTimescale, nil
+	default:
+		return "", fmt.Errorf("unknown dialect %q (expected timescaledb or citus)", name)
+	}
+}
+
+// Extension returns the PostgreSQL extension the dialect depends on, if any
+func (d Dialect) Extension() string {
+	return string(d)
+}
+
+// tableColumnPattern matches "schema.table(column)" directive values
+var tableColumnPattern = regexp.MustCompile(`^([A-Za-z_][\w.]*)\s*\(\s*([A-Za-z_]\w*)\s*\)$`)
+
+// HelperStatements returns the dialect helper calls requested by a migration's directives,
+// to be executed after the migration body
+func (d Dialect) HelperStatements(directives Directives) ([]string, error) {
+	var statements []string
+
+	switch d {
+	case DialectTimescale:
+		for _, value := range directives.Get(HypertableDirective) {
+			table, column, err := parseTableColumn(HypertableDirective, value)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, fmt.Sprintf(
+				"SELECT create_hypertable(%s, %s, if_not_exists => TRUE)",
+				pq.QuoteLiteral(table), pq.QuoteLiteral(column)))
+		}
+	case DialectCitus:
+		for _, value := range directives.Get(DistributeDirective) {
+			table, column, err := parseTableColumn(DistributeDirective, value)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, fmt.Sprintf(
+				"SELECT create_distributed_table(%s, %s)",
+				pq.QuoteLiteral(table), pq.QuoteLiteral(column)))
+		}
+		for _, table := range directives.Get(ReferenceTableDirective) {
+			statements = append(statements, fmt.Sprintf(
+				"SELECT create_reference_table(%s)", pq.QuoteLiteral(table)))
+		}
+	}
+
+	return statements, nil
+}
+
+func parseTableColumn(directive, value string) (table, column string, err error) {
+	match := tableColumnPattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", "", fmt.Errorf("invalid %s directive %q: expected table(column)", directive, value)
+	}
+	return match[1], match[2], nil
+}
@@ -0,0 +1,94 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// directivePattern matches SQL comment directives such as "-- requires-extension: pgcrypto"
+var directivePattern = regexp.MustCompile(`^--\s*([a-z][a-z0-9-]*)\s*:\s*(.+?)\s*$`)
+
+// Directives are the comment directives declared in a migration file, keyed by name
+type Directives map[string][]string
+
+// Get returns all values for a directive. Comma-separated values are split.
+func (d Directives) Get(name string) []string {
+	var values []string
+	for _, raw := range d[name] {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// knownDirectives are the directive names the migrator acts on
+var knownDirectives = []string{
+	ContractForDirective,
+	DistributeDirective,
+	ExtensionDirective,
+	FlagAfterDirective,
+	FlagBeforeDirective,
+	HypertableDirective,
+	PhaseDirective,
+	ReferenceTableDirective,
+	RequiresAppVersionDirective,
+	RequiresDirective,
+	TransactionDirective,
+}
+
+// Unknown returns the names of the directives the migrator does not act on,
+// usually misspelt ones, sorted
+func (d Directives) Unknown() []string {
+	var unknown []string
+	for name := range d {
+		if !slices.Contains(knownDirectives, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	return unknown
+}
+
+// ParseDirectives extracts "-- name: value" comment directives from the
+// leading comment block of SQL content, the comment and blank lines before
+// the first statement. A comment further down, such as "-- note: ..." above a
+// statement, is not a directive.
+func ParseDirectives(content []byte) Directives {
+	directives := make(Directives)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		match := directivePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		directives[match[1]] = append(directives[match[1]], match[2])
+	}
+
+	return directives
+}
+
+// ReadDirectives parses the directives of a migration file
+func ReadDirectives(path string) (Directives, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return ParseDirectives(content), nil
+}
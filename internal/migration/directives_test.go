@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Directives
+		unknown []string
+	}{
+		{
+			name:    "leading block",
+			content: "-- phase: expand\n-- requires-extension: pgcrypto, citext\nCREATE TABLE t (id int);\n",
+			want:    Directives{"phase": {"expand"}, "requires-extension": {"pgcrypto, citext"}},
+		},
+		{
+			name:    "blank lines and plain comments in the block",
+			content: "\n-- Adds the users table.\n\n  -- transaction: none\nCREATE INDEX CONCURRENTLY i ON t (id);\n",
+			want:    Directives{"transaction": {"none"}},
+		},
+		{
+			name:    "repeated directive",
+			content: "-- requires: users>=2\n-- requires: orders>=5\nSELECT 1;\n",
+			want:    Directives{"requires": {"users>=2", "orders>=5"}},
+		},
+		{
+			name:    "comment after the first statement",
+			content: "-- phase: contract\nALTER TABLE t DROP COLUMN c;\n-- transaction: none\n",
+			want:    Directives{"phase": {"contract"}},
+		},
+		{
+			name:    "comment above a later statement",
+			content: "CREATE TABLE t (id int);\n-- note: backfilled below\nUPDATE t SET id = 1;\n",
+			want:    Directives{},
+		},
+		{
+			name:    "unknown names",
+			content: "-- transation: none\n-- owner: payments\n-- phase: expand\nSELECT 1;\n",
+			want:    Directives{"transation": {"none"}, "owner": {"payments"}, "phase": {"expand"}},
+			unknown: []string{"owner", "transation"},
+		},
+		{
+			name:    "not a directive",
+			content: "-- TODO: tidy up\n--no-colon here\nSELECT 1;\n",
+			want:    Directives{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseDirectives([]byte(tt.content))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDirectives() = %v, want %v", got, tt.want)
+			}
+			if unknown := got.Unknown(); !reflect.DeepEqual(unknown, tt.unknown) {
+				t.Errorf("Unknown() = %v, want %v", unknown, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestDirectivesGet(t *testing.T) {
+	d := Directives{"requires-extension": {"pgcrypto, citext", " ,postgis"}}
+	want := []string{"pgcrypto", "citext", "postgis"}
+	if got := d.Get("requires-extension"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+	if got := d.Get("phase"); got != nil {
+		t.Errorf("Get() of a missing directive = %v, want nil", got)
+	}
+}
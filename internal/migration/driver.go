@@ -0,0 +1,445 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/lib/pq"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// SessionOptions configure the connection migrations run on
+type SessionOptions struct {
+	Dialect Dialect
+	Role    string // if set, SET ROLE to this role after connecting so created objects share an owner
+	Schema  string // if set, migrations and their version table live in this schema (blue/green deploys)
+
+	// StatementTimeout and LockTimeout set statement_timeout and lock_timeout
+	// on the session; zero leaves the server's setting
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+}
+
+// sessionDriver wraps golang-migrate's postgres driver around a connection we
+// own, so session setup and per-file execution rules apply to exactly the
+// connection the migrations run on
+type sessionDriver struct {
+	*postgres.Postgres
+	db     *sql.DB
+	conn   *sql.Conn
+	opts   SessionOptions
+	server types.ServerInfo // the server conn landed on
+
+	// perStatement runs transactional files one statement at a time, timing each
+	perStatement bool
+	// skipFailed skips failing statements, rolling back to a savepoint in transactions
+	skipFailed bool
+	timings    []fileTimings
+
+	// failVersion is the version of the migration file to fail instead of running (FailAtVersion)
+	failVersion uint
+	// running is the version of the migration file golang-migrate runs next,
+	// known from the dirty mark it sets first
+	running uint
+
+	// onApplied is called with the version of the file last run when
+	// golang-migrate marks it clean
+	onApplied func(version uint, elapsed time.Duration)
+	applying  []byte
+	started   time.Time
+
+	// direction of the run, up or down, for the checksum table
+	direction string
+}
+
+// fileTimings are the statement timings of one migration file, in the order run
+type fileTimings struct {
+	version    uint
+	statements []types.StatementTiming
+}
+
+// open creates a golang-migrate instance for the migrations directory on a dedicated connection
+func (m *Migrator) open(connStr, migrationsPath string) (*migrate.Migrate, *sessionDriver, error) {
+	src, err := openSource(migrationsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.Background()
+	var db *sql.DB
+	var conn *sql.Conn
+	err = m.retry("connect", IsTransient, func() (err error) {
+		db, conn, err = m.sessionConn(ctx, connStr)
+		return err
+	})
+	if err != nil {
+		src.Close()
+		return nil, nil, err
+	}
+
+	server, err := queryServerInfo(ctx, conn)
+	if err != nil {
+		conn.Close()
+		db.Close()
+		src.Close()
+		return nil, nil, err
+	}
+
+	pg, err := postgres.WithConnection(ctx, conn, &postgres.Config{MigrationsTable: migrationsTable})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		src.Close()
+		return nil, nil, fmt.Errorf("initializing postgres driver: %w", err)
+	}
+
+	driver := &sessionDriver{
+		Postgres:     pg,
+		db:           db,
+		conn:         conn,
+		opts:         m.session,
+		server:       *server,
+		perStatement: m.PerStatement,
+		skipFailed:   m.PerStatement && m.SkipFailedStatements,
+	}
+
+	mig, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		src.Close()
+		return nil, nil, fmt.Errorf("opening migrations source: %w", err)
+	}
+
+	return mig, driver, nil
+}
+
+// sessionConn opens a pool and a single connection with session setup applied.
+// The caller must close both.
+func (m *Migrator) sessionConn(ctx context.Context, connStr string) (*sql.DB, *sql.Conn, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("acquiring connection: %w", err)
+	}
+
+	// Session setup runs before the driver touches the version table so it is owned by the same role
+	if err := m.session.apply(ctx, conn); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, nil, err
+	}
+
+	return db, conn, nil
+}
+
+// apply runs session-level setup statements on conn
+func (o SessionOptions) apply(ctx context.Context, conn *sql.Conn) error {
+	if o.Role != "" {
+		slog.Debug("setting session role", "role", o.Role)
+		if _, err := conn.ExecContext(ctx, "SET ROLE "+pq.QuoteIdentifier(o.Role)); err != nil {
+			return fmt.Errorf("setting role %q: %w", o.Role, err)
+		}
+	}
+	if o.Schema != "" {
+		slog.Debug("setting search_path", "schema", o.Schema)
+		if _, err := conn.ExecContext(ctx, "SET search_path TO "+SearchPath(o.Schema)); err != nil {
+			return fmt.Errorf("setting search_path to %q: %w", o.Schema, err)
+		}
+	}
+	return o.setTimeouts(ctx, conn, o.StatementTimeout, o.LockTimeout)
+}
+
+// setTimeouts sets the session's statement_timeout and lock_timeout; zero
+// values are left alone
+func (o SessionOptions) setTimeouts(ctx context.Context, conn *sql.Conn, statement, lock time.Duration) error {
+	for _, t := range []struct {
+		name  string
+		value time.Duration
+		set   bool
+	}{
+		{"statement_timeout", statement, o.StatementTimeout > 0},
+		{"lock_timeout", lock, o.LockTimeout > 0},
+	} {
+		if !t.set {
+			continue
+		}
+		slog.Debug("setting session timeout", "setting", t.name, "value", t.value)
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET %s = %d", t.name, t.value.Milliseconds())); err != nil {
+			return fmt.Errorf("setting %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// Lock takes golang-migrate's advisory lock with the session timeouts lifted,
+// so waiting for another run is bounded by the lock retries, not by them
+func (d *sessionDriver) Lock() error {
+	if d.opts.StatementTimeout <= 0 && d.opts.LockTimeout <= 0 {
+		return d.Postgres.Lock()
+	}
+	ctx := context.Background()
+	if err := d.opts.setTimeouts(ctx, d.conn, 0, 0); err != nil {
+		return err
+	}
+	if err := d.Postgres.Lock(); err != nil {
+		return err
+	}
+	return d.opts.setTimeouts(ctx, d.conn, d.opts.StatementTimeout, d.opts.LockTimeout)
+}
+
+// Run executes a migration body, honoring per-file directives
+func (d *sessionDriver) Run(migration io.Reader) error {
+	body, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+
+	if d.failVersion != 0 && d.running == d.failVersion {
+		slog.Warn("injecting failure", "version", d.failVersion)
+		return fmt.Errorf("injected failure at version %d", d.failVersion)
+	}
+
+	d.applying, d.started = body, time.Now()
+	directives := ParseDirectives(body)
+	helpers, err := d.opts.Dialect.HelperStatements(directives)
+	if err != nil {
+		return err
+	}
+
+	if d.perStatement {
+		d.timings = append(d.timings, fileTimings{version: d.running})
+	}
+
+	switch {
+	case transactional(directives) && d.perStatement:
+		if err := d.runStatements(body); err != nil {
+			return err
+		}
+	case transactional(directives):
+		if err := d.Postgres.Run(bytes.NewReader(body)); err != nil {
+			return withStatement(err, body, 0, string(body))
+		}
+	default:
+		slog.Debug("running migration statements individually")
+		for _, stmt := range SplitStatements(string(body)) {
+			start := time.Now()
+			err := d.Postgres.Run(bytes.NewReader([]byte(stmt.SQL)))
+			if err != nil && d.skipFailed {
+				d.skip(stmt, time.Since(start), err)
+				continue
+			}
+			d.record(stmt, time.Since(start))
+			if err != nil {
+				return atStatement(err, body, stmt.Offset, stmt.SQL)
+			}
+		}
+	}
+
+	for _, helper := range helpers {
+		slog.Debug("running dialect helper", "dialect", d.opts.Dialect, "sql", helper)
+		if err := d.Postgres.Run(bytes.NewReader([]byte(helper))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetVersion records the version as golang-migrate does, reporting the
+// migration just run once its version is marked clean
+func (d *sessionDriver) SetVersion(version int, dirty bool) error {
+	// golang-migrate marks a migration dirty before running it, holding the
+	// lock: an up run must not roll back a database another run moved on.
+	// Going up the file run is the version marked; going down it is the
+	// version rolled back from.
+	if d.direction != "" && dirty {
+		current, _, err := d.Postgres.Version()
+		if err != nil {
+			return err
+		}
+		if d.direction == "up" && version < current {
+			return fmt.Errorf("refusing to roll back from version %d to %d in an up run", current, version)
+		}
+		d.running = uint(version)
+		if d.direction == "down" {
+			d.running = uint(current)
+		}
+	}
+	if err := d.Postgres.SetVersion(version, dirty); err != nil {
+		return err
+	}
+	if !dirty && d.applying != nil {
+		body := d.applying
+		d.applying = nil
+		if d.onApplied != nil {
+			d.onApplied(d.running, time.Since(d.started))
+		}
+		if d.direction != "" {
+			d.recordChecksum(version, body)
+		}
+	}
+	return nil
+}
+
+// statementSavepoint is the savepoint each statement runs under when failed statements are skipped
+const statementSavepoint = "encore_migrator_statement"
+
+// injectFailure arranges for the migration file of version in direction to
+// fail instead of running
+func (d *sessionDriver) injectFailure(migrationsPath, direction string, version uint) error {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Version == version && f.Direction == direction {
+			d.failVersion = version
+			slog.Warn("will inject a failure", "file", f.Name)
+			return nil
+		}
+	}
+	return fmt.Errorf("no %s migration with version %d to inject a failure into", direction, version)
+}
+
+// runStatements runs each statement of body separately inside one
+// transaction, so a failure is pinned to its statement and each is timed
+func (d *sessionDriver) runStatements(body []byte) error {
+	ctx := context.Background()
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Error{OrigErr: err, Err: "beginning transaction"}
+	}
+
+	for _, stmt := range SplitStatements(string(body)) {
+		if d.skipFailed {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT "+statementSavepoint); err != nil {
+				tx.Rollback()
+				return database.Error{OrigErr: err, Err: "creating savepoint"}
+			}
+		}
+
+		start := time.Now()
+		_, err := tx.ExecContext(ctx, stmt.SQL)
+		elapsed := time.Since(start)
+
+		if err != nil && d.skipFailed {
+			if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+statementSavepoint); rbErr == nil {
+				d.skip(stmt, elapsed, err)
+				continue
+			}
+		}
+		d.record(stmt, elapsed)
+		if err != nil {
+			tx.Rollback()
+			return atStatement(database.Error{OrigErr: err, Err: "migration failed", Query: []byte(stmt.SQL)}, body, stmt.Offset, stmt.SQL)
+		}
+
+		if d.skipFailed {
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+statementSavepoint); err != nil {
+				tx.Rollback()
+				return database.Error{OrigErr: err, Err: "releasing savepoint"}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.Error{OrigErr: err, Err: "committing transaction"}
+	}
+	return nil
+}
+
+// record adds a statement's duration to the current file's timings
+func (d *sessionDriver) record(stmt Statement, elapsed time.Duration) {
+	if !d.perStatement {
+		return
+	}
+	slog.Debug("statement finished", "line", stmt.Line, "duration", elapsed)
+	current := &d.timings[len(d.timings)-1]
+	current.statements = append(current.statements, types.StatementTiming{
+		Line:     stmt.Line,
+		SQL:      shortSQL(stmt.SQL),
+		Duration: elapsed,
+	})
+}
+
+// skip records a failed statement that was skipped, warning loudly
+func (d *sessionDriver) skip(stmt Statement, elapsed time.Duration, err error) {
+	message := err.Error()
+	if pqErr := pqError(err); pqErr != nil {
+		message = pqErr.Message
+	}
+	slog.Warn("SKIPPED FAILED STATEMENT", "line", stmt.Line, "sql", shortSQL(stmt.SQL), "error", message)
+	current := &d.timings[len(d.timings)-1]
+	current.statements = append(current.statements, types.StatementTiming{
+		Line:     stmt.Line,
+		SQL:      shortSQL(stmt.SQL),
+		Duration: elapsed,
+		Skipped:  message,
+	})
+}
+
+// statementTimings returns the recorded timings with their file names resolved
+func (d *sessionDriver) statementTimings(migrationsPath, direction string) []types.StatementTiming {
+	if len(d.timings) == 0 {
+		return nil
+	}
+	files, _ := ListFiles(migrationsPath)
+	var all []types.StatementTiming
+	for _, ft := range d.timings {
+		name := "(unknown file)"
+		if f := fileForVersion(files, direction, ft.version); f != nil {
+			name = f.Name
+		}
+		for _, t := range ft.statements {
+			t.File = name
+			all = append(all, t)
+		}
+	}
+	return all
+}
+
+// shortSQL shortens a statement to its first line for display
+func shortSQL(sql string) string {
+	const limit = 60
+	line, _, multiline := strings.Cut(sql, "\n")
+	line = strings.TrimSpace(line)
+	if len(line) > limit {
+		return line[:limit-3] + "..."
+	}
+	if multiline {
+		return line + " ..."
+	}
+	return line
+}
+
+// Close closes the connection and the pool behind it
+func (d *sessionDriver) Close() error {
+	err := d.Postgres.Close()
+	if dbErr := d.db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+// transactional reports whether a file runs as one implicit transaction (the default)
+func transactional(directives Directives) bool {
+	values := directives.Get(TransactionDirective)
+	return len(values) == 0 || values[len(values)-1] != "none"
+}
+
+var _ database.Driver = (*sessionDriver)(nil)
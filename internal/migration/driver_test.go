@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFailAtVersionIdenticalBodies(t *testing.T) {
+	connStr := testDatabase(t)
+	// Versions 1 and 2 have the same body; only version 2 may fail
+	body := "SELECT 1;\n"
+	dir := writeMigrations(t, map[string]string{
+		"1_first.up.sql":    body,
+		"1_first.down.sql":  body,
+		"2_second.up.sql":   body,
+		"2_second.down.sql": body,
+		"3_third.up.sql":    "SELECT 3;\n",
+		"3_third.down.sql":  "SELECT 3;\n",
+	})
+
+	m := NewMigrator(false)
+	m.FailAtVersion = 2
+	if _, err := m.Up(connStr, dir, 0); err == nil {
+		t.Fatal("Up with FailAtVersion 2 succeeded")
+	}
+	status, err := NewMigrator(false).GetStatus(connStr, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 2 || !status.Dirty {
+		t.Fatalf("status is version %d (dirty %t), want version 2 (dirty true)", status.Version, status.Dirty)
+	}
+
+	if err := m.Force(connStr, dir, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(connStr, dir, 0); err == nil {
+		t.Fatal("Down with FailAtVersion 2 succeeded")
+	}
+	if status, err = NewMigrator(false).GetStatus(connStr, dir); err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 1 || !status.Dirty {
+		t.Fatalf("status is version %d (dirty %t), want version 1 (dirty true) after failing to roll back 2", status.Version, status.Dirty)
+	}
+}
+
+func TestOnMigrationAppliedIdenticalBodies(t *testing.T) {
+	connStr := testDatabase(t)
+	body := "SELECT 1;\n"
+	dir := writeMigrations(t, map[string]string{
+		"1_first.up.sql":    body,
+		"1_first.down.sql":  body,
+		"2_second.up.sql":   body,
+		"2_second.down.sql": body,
+	})
+
+	var applied []string
+	m := NewMigrator(false)
+	m.OnMigrationApplied = func(file File, _ time.Duration) { applied = append(applied, file.Name) }
+	if _, err := m.Up(connStr, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(connStr, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1_first.up.sql", "2_second.up.sql", "2_second.down.sql", "1_first.down.sql"}
+	if !slices.Equal(applied, want) {
+		t.Fatalf("applied %v, want %v", applied, want)
+	}
+}
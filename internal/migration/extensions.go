@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+// ExtensionDirective declares a PostgreSQL extension a migration depends on
+const ExtensionDirective = "requires-extension"
+
+// RequiredExtensions collects extension directives from every up migration in a directory
+func RequiredExtensions(migrationsPath string) ([]string, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var extensions []string
+	for _, f := range UpFiles(files) {
+		directives, err := ReadDirectives(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range directives.Get(ExtensionDirective) {
+			if !slices.Contains(extensions, ext) {
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+
+	return extensions, nil
+}
+
+// MissingExtensions returns the required extensions that are not installed in the database
+func (m *Migrator) MissingExtensions(connStr string, required []string) ([]string, error) {
+	if len(required) == 0 {
+		return nil, nil
+	}
+
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT extname FROM pg_extension`)
+	if err != nil {
+		return nil, fmt.Errorf("listing installed extensions: %w", err)
+	}
+	defer rows.Close()
+
+	var installed []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("listing installed extensions: %w", err)
+		}
+		installed = append(installed, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing installed extensions: %w", err)
+	}
+
+	var missing []string
+	for _, ext := range required {
+		if !slices.Contains(installed, ext) {
+			missing = append(missing, ext)
+		}
+	}
+
+	slog.Debug("checked extensions", "required", required, "missing", missing)
+	return missing, nil
+}
+
+// CreateExtensions installs the given extensions. The connection needs
+// sufficient privileges (typically a superuser or the database owner).
+func (m *Migrator) CreateExtensions(connStr string, names []string) error {
+	db, err := openDB(connStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, name := range names {
+		slog.Info("creating extension", "extension", name)
+		if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS ` + pq.QuoteIdentifier(name)); err != nil {
+			return fmt.Errorf("creating extension %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
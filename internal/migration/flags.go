@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Feature flag directives switch a flag of the configured provider around a
+// migration, e.g. "-- flag-after: new-checkout=on". flag-before flags are
+// switched before the run applying the migration starts, flag-after flags
+// once the migration itself is applied.
+const (
+	FlagBeforeDirective = "flag-before"
+	FlagAfterDirective  = "flag-after"
+)
+
+// FlagSwitch is a feature flag to turn on or off
+type FlagSwitch struct {
+	Flag string
+	On   bool
+}
+
+func (s FlagSwitch) String() string {
+	if s.On {
+		return s.Flag + "=on"
+	}
+	return s.Flag + "=off"
+}
+
+// ParseFlagSwitch parses a flag-before or flag-after directive value
+func ParseFlagSwitch(value string) (FlagSwitch, error) {
+	flag, state, ok := strings.Cut(value, "=")
+	flag = strings.TrimSpace(flag)
+	if !ok || flag == "" {
+		return FlagSwitch{}, fmt.Errorf("invalid flag switch %q: expected <flag>=on or <flag>=off", value)
+	}
+	switch strings.ToLower(strings.TrimSpace(state)) {
+	case "on", "true":
+		return FlagSwitch{Flag: flag, On: true}, nil
+	case "off", "false":
+		return FlagSwitch{Flag: flag}, nil
+	}
+	return FlagSwitch{}, fmt.Errorf("invalid flag switch %q: state must be on or off", value)
+}
+
+// ReadFlagSwitches returns the flag-before and flag-after switches of a migration file
+func ReadFlagSwitches(f File) (before, after []FlagSwitch, err error) {
+	directives, err := ReadDirectives(f.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range []struct {
+		name     string
+		switches *[]FlagSwitch
+	}{
+		{FlagBeforeDirective, &before},
+		{FlagAfterDirective, &after},
+	} {
+		for _, v := range directives.Get(d.name) {
+			s, err := ParseFlagSwitch(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s: %w", f.Name, d.name, err)
+			}
+			*d.switches = append(*d.switches, s)
+		}
+	}
+	return before, after, nil
+}
@@ -0,0 +1,187 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequiresAppVersionDirective declares the application version every instance
+// must run before a contract migration may apply, e.g. "-- requires-app-version: 1.4.0"
+const RequiresAppVersionDirective = "requires-app-version"
+
+// gateTimeout bounds the version endpoint request
+const gateTimeout = 10 * time.Second
+
+// AppVersionGate reports the versions of the running application instances,
+// from an HTTP endpoint or a version table
+type AppVersionGate struct {
+	URL   string // GET endpoint returning {"versions": ["1.4.0", ...]}
+	Query string // SQL run on the migrated database returning one version per instance
+}
+
+// AppVersionError indicates instances are still running an older application version
+type AppVersionError struct {
+	Required string
+	Outdated []string
+}
+
+func (e *AppVersionError) Error() string {
+	return fmt.Sprintf("application instances below required version %s are still running (%s); refusing to apply contract migrations",
+		e.Required, strings.Join(e.Outdated, ", "))
+}
+
+// CheckAppVersions confirms every reported instance runs at least version required
+func (m *Migrator) CheckAppVersions(ctx context.Context, connStr string, gate AppVersionGate, required string) error {
+	var versions []string
+	var err error
+	switch {
+	case gate.URL != "" && gate.Query != "":
+		return fmt.Errorf("app version gate must set either a url or a query, not both")
+	case gate.URL != "":
+		versions, err = endpointVersions(ctx, gate.URL)
+	case gate.Query != "":
+		versions, err = queryVersions(ctx, connStr, gate.Query)
+	default:
+		return fmt.Errorf("app version gate has neither a url nor a query")
+	}
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("app version gate reported no running instances")
+	}
+
+	var outdated []string
+	for _, v := range versions {
+		if CompareVersions(v, required) < 0 {
+			outdated = append(outdated, v)
+		}
+	}
+	slog.Info("checked application versions", "required", required, "instances", len(versions), "outdated", len(outdated))
+	if len(outdated) > 0 {
+		return &AppVersionError{Required: required, Outdated: outdated}
+	}
+	return nil
+}
+
+func endpointVersions(ctx context.Context, url string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gateTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building version request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying app versions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("querying app versions: %s returned %s", url, resp.Status)
+	}
+
+	var body struct {
+		Versions []string `json:"versions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding app versions: %w", err)
+	}
+	return body.Versions, nil
+}
+
+func queryVersions(ctx context.Context, connStr, query string) ([]string, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("querying app versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("reading app versions: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading app versions: %w", err)
+	}
+	return versions, nil
+}
+
+// CompareVersions compares dotted versions such as v1.4.0 or 1.4.0-rc.1,
+// returning -1, 0 or 1. Numeric components compare numerically and a
+// pre-release sorts before its release.
+func CompareVersions(a, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+
+	for i := 0; i < max(len(aCore), len(bCore)); i++ {
+		var x, y string
+		if i < len(aCore) {
+			x = aCore[i]
+		}
+		if i < len(bCore) {
+			y = bCore[i]
+		}
+		if c := compareComponent(x, y); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return strings.Compare(aPre, bPre)
+}
+
+func splitVersion(v string) (core []string, pre string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ = strings.Cut(v, "-")
+	return strings.Split(v, "."), pre
+}
+
+func compareComponent(a, b string) int {
+	x, errX := strconv.ParseUint(orZero(a), 10, 64)
+	y, errY := strconv.ParseUint(orZero(b), 10, 64)
+	if errX != nil || errY != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func orZero(s string) string {
+	if s == "" {
+		return "0"
+	}
+	return s
+}
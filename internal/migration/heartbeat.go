@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// maxStatementLog is how much of the running statement a heartbeat logs
+const maxStatementLog = 200
+
+// activity is our backend's row in pg_stat_activity
+type activity struct {
+	State        sql.NullString
+	WaitType     sql.NullString
+	WaitEvent    sql.NullString
+	QueryRuntime sql.NullFloat64 // seconds since the current statement started
+	Query        sql.NullString
+	BlockedBy    sql.NullString // comma-separated PIDs holding locks we wait on
+}
+
+// startHeartbeat logs the migration backend's activity every interval until stop is called
+func (d *sessionDriver) startHeartbeat(interval time.Duration) (stop func()) {
+	if interval <= 0 || d.server.BackendPID == 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	start := time.Now()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.logHeartbeat(ctx, time.Since(start))
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// logHeartbeat queries pg_stat_activity for the migration backend on a separate connection
+func (d *sessionDriver) logHeartbeat(ctx context.Context, elapsed time.Duration) {
+	var a activity
+	err := d.db.QueryRowContext(ctx, `
+		SELECT state, wait_event_type, wait_event,
+		       EXTRACT(EPOCH FROM now() - query_start),
+		       left(query, $2),
+		       array_to_string(pg_blocking_pids(pid), ',')
+		FROM pg_stat_activity
+		WHERE pid = $1`, d.server.BackendPID, maxStatementLog).
+		Scan(&a.State, &a.WaitType, &a.WaitEvent, &a.QueryRuntime, &a.Query, &a.BlockedBy)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Debug("heartbeat query failed", "error", err)
+			slog.Info("migration heartbeat", "elapsed", elapsed.Round(time.Second), "backend_pid", d.server.BackendPID)
+		}
+		return
+	}
+
+	attrs := []any{
+		"elapsed", elapsed.Round(time.Second),
+		"backend_pid", d.server.BackendPID,
+		"state", a.State.String,
+		"statement_runtime", (time.Duration(a.QueryRuntime.Float64 * float64(time.Second))).Round(time.Second),
+		"statement", a.Query.String,
+	}
+	if a.WaitType.Valid {
+		attrs = append(attrs, "wait_event", a.WaitType.String+":"+a.WaitEvent.String)
+	}
+	if a.BlockedBy.String != "" {
+		attrs = append(attrs, "blocked_by_pids", a.BlockedBy.String)
+		slog.Warn("migration heartbeat: waiting on locks", attrs...)
+		return
+	}
+	slog.Info("migration heartbeat", attrs...)
+}
@@ -0,0 +1,180 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// historyTable keeps an audit row for every up and down run against a
+// database, next to golang-migrate's version table
+const historyTable = "encore_migrate_history"
+
+// RunInfo identifies a run in the history table; set Migrator.RecordRun to
+// record up and down runs
+type RunInfo struct {
+	RunID       string
+	Ticket      string
+	Operator    string // who ran it: a CI identity or the local user
+	GitSHA      string // commit of the migrations, when known
+	ToolVersion string
+}
+
+// HistoryEntry is a row of the history table
+type HistoryEntry struct {
+	ID            int64         `json:"id"`
+	RunID         string        `json:"run_id"`
+	StartedAt     time.Time     `json:"started_at"`
+	Direction     string        `json:"direction"`
+	VersionBefore uint          `json:"version_before"`
+	VersionAfter  uint          `json:"version_after"`
+	Duration      time.Duration `json:"-"`
+	DurationMS    int64         `json:"duration_ms"`
+	Succeeded     bool          `json:"succeeded"`
+	Error         string        `json:"error,omitempty"`
+	Operator      string        `json:"operator,omitempty"`
+	GitSHA        string        `json:"git_sha,omitempty"`
+	ToolVersion   string        `json:"tool_version,omitempty"`
+	Ticket        string        `json:"ticket,omitempty"`
+}
+
+const createHistoryTable = `CREATE TABLE IF NOT EXISTS %s (
+	id             bigserial PRIMARY KEY,
+	run_id         text NOT NULL,
+	started_at     timestamptz NOT NULL,
+	direction      text NOT NULL,
+	version_before bigint NOT NULL,
+	version_after  bigint NOT NULL,
+	duration_ms    bigint NOT NULL,
+	succeeded      boolean NOT NULL,
+	error          text,
+	operator       text,
+	git_sha        text,
+	tool_version   text,
+	ticket         text
+)`
+
+// qualifiedHistoryTable is the (schema-qualified, for blue/green sessions) history table name
+func (o SessionOptions) qualifiedHistoryTable() string {
+	if o.Schema == "" {
+		return historyTable
+	}
+	return pq.QuoteIdentifier(o.Schema) + "." + historyTable
+}
+
+// recordHistory appends a run's outcome to the history table, creating it
+// on first use. It runs on the migration connection, so the table belongs to
+// the run-as role. Failures only warn: the migration itself is done.
+func (d *sessionDriver) recordHistory(info *RunInfo, direction string, before, after uint, started time.Time, runErr error) {
+	// Waiting out another run's lock applied nothing
+	if info == nil || isLockTimeout(runErr) {
+		return
+	}
+	ctx := context.Background()
+	table := d.opts.qualifiedHistoryTable()
+	if _, err := d.conn.ExecContext(ctx, fmt.Sprintf(createHistoryTable, table)); err != nil {
+		slog.Warn("migration history not recorded", "error", err)
+		return
+	}
+	var message sql.NullString
+	if runErr != nil {
+		message = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO `+table+`
+		(run_id, started_at, direction, version_before, version_after, duration_ms, succeeded, error, operator, git_sha, tool_version, ticket)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		info.RunID, started, direction, int64(before), int64(after), time.Since(started).Milliseconds(), runErr == nil, message,
+		nullable(info.Operator), nullable(info.GitSHA), nullable(info.ToolVersion), nullable(info.Ticket))
+	if err != nil {
+		slog.Warn("migration history not recorded", "error", err)
+		return
+	}
+	slog.Debug("migration history recorded", "run_id", info.RunID, "direction", direction)
+}
+
+func nullable(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// History returns up to limit rows of the history table, newest first; zero
+// returns them all. A database that was never migrated by a recording run
+// has no table and no history.
+func (m *Migrator) History(connStr string, limit int) ([]HistoryEntry, error) {
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	table := m.session.qualifiedHistoryTable()
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("checking %s: %w", historyTable, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	query := `SELECT id, run_id, started_at, direction, version_before, version_after, duration_ms, succeeded,
+		coalesce(error, ''), coalesce(operator, ''), coalesce(git_sha, ''), coalesce(tool_version, ''), coalesce(ticket, '')
+		FROM ` + table + ` ORDER BY id DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", historyTable, err)
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		var before, after int64
+		if err := rows.Scan(&e.ID, &e.RunID, &e.StartedAt, &e.Direction, &before, &after, &e.DurationMS, &e.Succeeded,
+			&e.Error, &e.Operator, &e.GitSHA, &e.ToolVersion, &e.Ticket); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", historyTable, err)
+		}
+		e.VersionBefore, e.VersionAfter = uint(before), uint(after)
+		e.Duration = time.Duration(e.DurationMS) * time.Millisecond
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// RecordEvent appends a row for something other than an up or down run,
+// such as a retirement, to the history table at the database's current
+// version, and returns that version
+func (m *Migrator) RecordEvent(connStr, event string, info RunInfo) (uint, error) {
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	version, _, err := readVersion(db, m.session.versionTable())
+	if err != nil {
+		return 0, err
+	}
+	table := m.session.qualifiedHistoryTable()
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(createHistoryTable, table)); err != nil {
+		return 0, fmt.Errorf("creating %s: %w", historyTable, err)
+	}
+	_, err = conn.ExecContext(ctx, `INSERT INTO `+table+`
+		(run_id, started_at, direction, version_before, version_after, duration_ms, succeeded, operator, git_sha, tool_version, ticket)
+		VALUES ($1, $2, $3, $4, $4, 0, true, $5, $6, $7, $8)`,
+		info.RunID, time.Now(), event, int64(version),
+		nullable(info.Operator), nullable(info.GitSHA), nullable(info.ToolVersion), nullable(info.Ticket))
+	if err != nil {
+		return 0, fmt.Errorf("writing %s: %w", historyTable, err)
+	}
+	return version, nil
+}
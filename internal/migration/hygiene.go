@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// File hygiene checks run by CheckHygiene
+const (
+	CheckDuplicateVersion = "duplicate-version" // two files share a version and direction
+	CheckVersionGap       = "version-gap"       // sequential versions skip a number
+	CheckMissingDown      = "missing-down"      // an up file has no down file
+	CheckEmptyFile        = "empty-file"        // a file has no statements
+	CheckInvalidUTF8      = "invalid-utf8"      // a file is not valid UTF-8
+)
+
+// HygieneChecks lists the checks in the order they run
+var HygieneChecks = []string{CheckDuplicateVersion, CheckVersionGap, CheckMissingDown, CheckEmptyFile, CheckInvalidUTF8}
+
+// timestampVersionMin is the smallest version treated as a timestamp (Unix
+// seconds or YYYYMMDDHHMMSS); directories using them are not checked for gaps
+const timestampVersionMin = 1_000_000_000
+
+// HygieneProblem is a migration file that fails a hygiene check
+type HygieneProblem struct {
+	Check   string
+	File    string // file name; empty for problems between files
+	Message string
+}
+
+// CheckHygiene inspects a migrations directory without connecting to a
+// database. Checks named in skip are not run.
+func CheckHygiene(migrationsPath string, skip []string) ([]HygieneProblem, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	skipped := make(map[string]bool, len(skip))
+	for _, check := range skip {
+		skipped[check] = true
+	}
+
+	var problems []HygieneProblem
+	add := func(check, file, format string, args ...any) {
+		if !skipped[check] {
+			problems = append(problems, HygieneProblem{Check: check, File: file, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	seen := make(map[string]File)
+	downs := make(map[uint]bool)
+	var versions []uint
+	for _, f := range files {
+		key := fmt.Sprintf("%d.%s", f.Version, f.Direction)
+		if first, ok := seen[key]; ok {
+			add(CheckDuplicateVersion, f.Name, "version %d %s is also used by %s", f.Version, f.Direction, first.Name)
+		} else {
+			seen[key] = f
+		}
+		if f.Direction == "down" {
+			downs[f.Version] = true
+		}
+		if len(versions) == 0 || versions[len(versions)-1] != f.Version {
+			versions = append(versions, f.Version)
+		}
+	}
+
+	if len(versions) > 0 && versions[len(versions)-1] < timestampVersionMin {
+		for i := 1; i < len(versions); i++ {
+			if versions[i] != versions[i-1]+1 {
+				add(CheckVersionGap, "", "versions jump from %d to %d", versions[i-1], versions[i])
+			}
+		}
+	}
+
+	for _, f := range files {
+		if f.Direction == "up" && !downs[f.Version] {
+			add(CheckMissingDown, f.Name, "no down file for version %d", f.Version)
+		}
+
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		if !utf8.Valid(content) {
+			add(CheckInvalidUTF8, f.Name, "not valid UTF-8")
+			continue
+		}
+		if len(SplitStatements(string(content))) == 0 {
+			add(CheckEmptyFile, f.Name, "no SQL statements")
+		}
+	}
+
+	return problems, nil
+}
+
+// IsHygieneCheck reports whether name is one of HygieneChecks
+func IsHygieneCheck(name string) bool {
+	for _, check := range HygieneChecks {
+		if check == name {
+			return true
+		}
+	}
+	return false
+}
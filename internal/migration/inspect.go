@@ -0,0 +1,36 @@
+package migration
+
+// Inspection is a database's migration state together with the migrations not yet applied
+type Inspection struct {
+	Version uint
+	Dirty   bool
+	Pending []File // up migrations after Version, oldest first
+}
+
+// Inspect reads the database's version and dirty flag and lists its pending up migrations
+func (m *Migrator) Inspect(connStr, migrationsPath string) (*Inspection, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := m.GetStatus(connStr, migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	inspection := &Inspection{Version: status.Version, Dirty: status.Dirty}
+	for _, step := range PlanUp(files, status.Version, 0).Steps {
+		inspection.Pending = append(inspection.Pending, *step.File)
+	}
+	return inspection, nil
+}
+
+// PendingNames returns the file names of the pending migrations
+func (i *Inspection) PendingNames() []string {
+	names := []string{}
+	for _, f := range i.Pending {
+		names = append(names, f.Name)
+	}
+	return names
+}
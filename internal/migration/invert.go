@@ -0,0 +1,187 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// columnPattern matches a column, constraint or index name
+const columnPattern = `("[^"]+"|[A-Za-z_][\w$]*)`
+
+var (
+	invertCreateTable = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:UNLOGGED\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + identPattern)
+	invertCreateIndex = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?` + columnPattern + `\s+ON\s+(?:ONLY\s+)?` + identPattern)
+	invertAlterTable  = regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern + `\s+(.*)$`)
+	invertAddColumn   = regexp.MustCompile(`(?is)^ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?` + columnPattern)
+	invertAddNamed    = regexp.MustCompile(`(?is)^ADD\s+CONSTRAINT\s+` + columnPattern)
+	invertAddKeyword  = regexp.MustCompile(`(?i)^ADD\s+(?:CONSTRAINT|PRIMARY|UNIQUE|CHECK|FOREIGN|EXCLUDE)\b`)
+	invertRenameTable = regexp.MustCompile(`(?is)^RENAME\s+TO\s+` + columnPattern + `$`)
+	invertRenameCol   = regexp.MustCompile(`(?is)^RENAME\s+(?:COLUMN\s+)?` + columnPattern + `\s+TO\s+` + columnPattern + `$`)
+	invertCreateTrig  = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:CONSTRAINT\s+)?TRIGGER\s+` + columnPattern + `\s+.*?\bON\s+(?:ONLY\s+)?` + identPattern)
+	invertAddValue    = regexp.MustCompile(`(?is)^\s*ALTER\s+TYPE\s+` + identPattern + `\s+ADD\s+VALUE\b`)
+	invertRowChange   = regexp.MustCompile(`(?i)^\s*(?:UPDATE|DELETE)\b`)
+)
+
+// invertCreate maps CREATE statements to the DROP undoing them; the
+// pattern's first group is the object's name
+var invertCreate = []struct {
+	pattern *regexp.Regexp
+	drop    string
+}{
+	{invertCreateTable, "DROP TABLE IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+MATERIALIZED\s+VIEW\s+(?:IF\s+NOT\s+EXISTS\s+)?` + identPattern), "DROP MATERIALIZED VIEW IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+(?:RECURSIVE\s+)?VIEW\s+` + identPattern), "DROP VIEW IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+TYPE\s+` + identPattern), "DROP TYPE IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+DOMAIN\s+` + identPattern), "DROP DOMAIN IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+SEQUENCE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + identPattern), "DROP SEQUENCE IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+SCHEMA\s+(?:IF\s+NOT\s+EXISTS\s+)?` + identPattern), "DROP SCHEMA IF EXISTS %s;"},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+EXTENSION\s+(?:IF\s+NOT\s+EXISTS\s+)?` + identPattern), "DROP EXTENSION IF EXISTS %s;"},
+}
+
+// InvertStatement returns the statement undoing a simple up statement:
+// creating a table, index, view, type, domain, sequence, schema, extension
+// or trigger; ALTER TABLE ... ADD COLUMN or ADD CONSTRAINT; and renames.
+// ok is false for anything else, including CREATE OR REPLACE, whose previous
+// definition is unknown.
+func InvertStatement(sql string) (string, bool) {
+	text := strings.TrimSuffix(strings.TrimSpace(stripLeadingComments(sql)), ";")
+
+	for _, c := range invertCreate {
+		if m := c.pattern.FindStringSubmatch(text); m != nil {
+			return fmt.Sprintf(c.drop, m[1]), true
+		}
+	}
+
+	if m := invertCreateTrig.FindStringSubmatch(text); m != nil {
+		return fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s;", m[1], m[2]), true
+	}
+
+	if m := invertCreateIndex.FindStringSubmatch(text); m != nil {
+		name := m[2]
+		if schema, _, ok := strings.Cut(m[3], "."); ok {
+			name = schema + "." + name
+		}
+		concurrently := ""
+		if m[1] != "" {
+			concurrently = "CONCURRENTLY "
+		}
+		return fmt.Sprintf("DROP INDEX %sIF EXISTS %s;", concurrently, name), true
+	}
+
+	if m := invertAlterTable.FindStringSubmatch(text); m != nil {
+		action := strings.TrimSpace(m[2])
+		if r := invertRenameTable.FindStringSubmatch(action); r != nil {
+			renamed := r[1]
+			if schema, _, ok := strings.Cut(m[1], "."); ok {
+				renamed = schema + "." + renamed
+			}
+			return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", renamed, unqualified(m[1])), true
+		}
+		if r := invertRenameCol.FindStringSubmatch(action); r != nil {
+			return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", m[1], r[2], r[1]), true
+		}
+
+		var drops []string
+		for _, action := range splitTopLevel(m[2], ',') {
+			action = strings.TrimSpace(action)
+			switch {
+			case invertAddNamed.MatchString(action):
+				drops = append(drops, "DROP CONSTRAINT IF EXISTS "+invertAddNamed.FindStringSubmatch(action)[1])
+			case invertAddKeyword.MatchString(action):
+				return "", false // unnamed constraint: its generated name is unknown
+			case invertAddColumn.MatchString(action):
+				drops = append(drops, "DROP COLUMN IF EXISTS "+invertAddColumn.FindStringSubmatch(action)[1])
+			default:
+				return "", false
+			}
+		}
+		// Undo the actions in reverse order
+		for i, j := 0, len(drops)-1; i < j; i, j = i+1, j-1 {
+			drops[i], drops[j] = drops[j], drops[i]
+		}
+		return fmt.Sprintf("ALTER TABLE %s %s;", m[1], strings.Join(drops, ", ")), true
+	}
+
+	return "", false
+}
+
+// DownFromUp drafts a down migration from an up migration by inverting its
+// statements in reverse order. Statements that cannot be inverted are listed
+// as TODO comments, marked IRREVERSIBLE when they destroy data or can't be
+// undone in PostgreSQL; their count is returned.
+func DownFromUp(upName, upSQL string) (string, int) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Generated from %s. Review before committing: only simple statements are inverted.\n", upName)
+
+	statements := SplitStatements(upSQL)
+	todo := 0
+	for i := len(statements) - 1; i >= 0; i-- {
+		stmt := statements[i]
+		b.WriteString("\n")
+		if down, ok := InvertStatement(stmt.SQL); ok {
+			b.WriteString(down + "\n")
+			continue
+		}
+		todo++
+		text := shortSQL(stripLeadingComments(stmt.SQL))
+		if reason := irreversible(stmt.SQL); reason != "" {
+			fmt.Fprintf(&b, "-- TODO: IRREVERSIBLE line %d (%s): %s\n", stmt.Line, reason, text)
+		} else {
+			fmt.Fprintf(&b, "-- TODO: undo line %d: %s\n", stmt.Line, text)
+		}
+	}
+	return b.String(), todo
+}
+
+// irreversible explains why a statement cannot be undone by a down
+// migration, or returns "" if it might be
+func irreversible(sql string) string {
+	text := stripLeadingComments(sql)
+	if invertAddValue.MatchString(text) {
+		return "enum values cannot be removed"
+	}
+	for _, f := range AssessSQL("", sql) {
+		if f.Destructive != "" {
+			return f.Destructive
+		}
+	}
+	if invertRowChange.MatchString(text) {
+		return "changes existing rows"
+	}
+	return ""
+}
+
+// unqualified drops the schema from a possibly qualified name
+func unqualified(name string) string {
+	if _, rest, ok := strings.Cut(name, "."); ok {
+		return rest
+	}
+	return name
+}
+
+// splitTopLevel splits s on sep outside parentheses and quotes
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
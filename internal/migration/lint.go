@@ -0,0 +1,198 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Lint rules. Each flags a statement that fails when it runs a second time,
+// which is what leaves a database dirty when a migration is retried after a
+// partial failure or replayed against a database that already has the objects.
+const (
+	RuleCreateTableIfNotExists = "create-table-if-not-exists" // CREATE TABLE in an early migration
+	RuleDownIfExists           = "down-if-exists"             // DROP in a down file
+	RuleIdempotentSeed         = "idempotent-seed"            // INSERT in a seed file
+)
+
+// Lint severities; SeverityOff disables a rule
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityOff     = "off"
+)
+
+// LintRuleNames lists the rules, destructive ones included, in the order they are documented
+var LintRuleNames = append([]string{RuleCreateTableIfNotExists, RuleDownIfExists, RuleIdempotentSeed}, DestructiveRuleNames...)
+
+// DefaultEarlyMigrations is how many of a database's first migrations the
+// create-table rule applies to when unset
+const DefaultEarlyMigrations = 1
+
+// LintOptions select the rules and their severities
+type LintOptions struct {
+	Severities      map[string]string // rule to severity; unlisted rules are errors
+	EarlyMigrations int               // the create-table rule applies to this many of the first versions
+}
+
+// LintIssue is a statement that breaks a lint rule
+type LintIssue struct {
+	File     string
+	Line     int
+	Rule     string
+	Severity string
+	Message  string
+}
+
+// Validate rejects unknown rules and severities
+func (o LintOptions) Validate() error {
+	for rule, severity := range o.Severities {
+		if !isLintRule(rule) {
+			return fmt.Errorf("unknown lint rule %q (want one of %s)", rule, strings.Join(LintRuleNames, ", "))
+		}
+		switch severity {
+		case SeverityError, SeverityWarning, SeverityOff:
+		default:
+			return fmt.Errorf("lint rule %s: unknown severity %q (want %s, %s or %s)", rule, severity, SeverityError, SeverityWarning, SeverityOff)
+		}
+	}
+	if o.EarlyMigrations < 0 {
+		return fmt.Errorf("lint early_migrations must not be negative")
+	}
+	return nil
+}
+
+func (o LintOptions) severity(rule string) string {
+	if severity, ok := o.Severities[rule]; ok {
+		return severity
+	}
+	return SeverityError
+}
+
+func isLintRule(name string) bool {
+	for _, rule := range LintRuleNames {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNLOGGED\s+)?TABLE\s+(IF\s+NOT\s+EXISTS\s+)?` + identPattern)
+	dropPattern        = regexp.MustCompile(`(?i)^\s*DROP\s+(MATERIALIZED\s+VIEW|TABLE|INDEX(?:\s+CONCURRENTLY)?|VIEW|SEQUENCE|TYPE|DOMAIN|SCHEMA|FUNCTION|PROCEDURE|TRIGGER|EXTENSION)\s+(IF\s+EXISTS\s+)?`)
+	alterDropPattern   = regexp.MustCompile(`(?i)\bDROP\s+(COLUMN|CONSTRAINT)\s+(IF\s+EXISTS\s+)?`)
+	alterTablePattern  = regexp.MustCompile(`(?i)^\s*ALTER\s+TABLE\b`)
+	insertPattern      = regexp.MustCompile(`(?i)^\s*INSERT\s+INTO\s+` + identPattern)
+	onConflictPattern  = regexp.MustCompile(`(?i)\bON\s+CONFLICT\b|\bWHERE\s+NOT\s+EXISTS\b`)
+)
+
+// LintFiles checks a database's migration files. The create-table rule
+// applies to the up files of the first EarlyMigrations versions, the
+// drop rule to every down file.
+func LintFiles(files []File, opts LintOptions) ([]LintIssue, error) {
+	early := opts.EarlyMigrations
+	if early == 0 {
+		early = DefaultEarlyMigrations
+	}
+	versions := make(map[uint]bool)
+	for _, f := range files {
+		versions[f.Version] = true
+	}
+	ordered := make([]uint, 0, len(versions))
+	for v := range versions {
+		ordered = append(ordered, v)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i] < ordered[j] })
+	earlyVersions := make(map[uint]bool)
+	for i := 0; i < early && i < len(ordered); i++ {
+		earlyVersions[ordered[i]] = true
+	}
+
+	var issues []LintIssue
+	for _, f := range files {
+		content, err := os.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		switch {
+		case f.Direction == "up" && earlyVersions[f.Version]:
+			issues = append(issues, lintStatements(f.Name, string(content), opts, lintCreateTable)...)
+		case f.Direction == "down":
+			issues = append(issues, lintStatements(f.Name, string(content), opts, lintDrop)...)
+		}
+	}
+	return issues, nil
+}
+
+// LintSeed checks a seed file, which runs again on every preview and must not
+// fail on rows that already exist
+func LintSeed(path string, opts LintOptions) ([]LintIssue, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seed: %w", err)
+	}
+	return lintStatements(path, string(content), opts, lintInsert), nil
+}
+
+// lintCheck returns the rule a statement breaks and why, or "" if it is fine
+type lintCheck func(text string) (rule, message string)
+
+func lintStatements(file, sql string, opts LintOptions, check lintCheck) []LintIssue {
+	var issues []LintIssue
+	for _, stmt := range SplitStatements(sql) {
+		text := stripLeadingComments(stmt.SQL)
+		rule, message := check(text)
+		if rule == "" {
+			continue
+		}
+		severity := opts.severity(rule)
+		if severity == SeverityOff {
+			continue
+		}
+		issues = append(issues, LintIssue{
+			File:     file,
+			Line:     stmt.Line + strings.Count(stmt.SQL[:len(stmt.SQL)-len(text)], "\n"),
+			Rule:     rule,
+			Severity: severity,
+			Message:  message,
+		})
+	}
+	return issues
+}
+
+func lintCreateTable(text string) (string, string) {
+	match := createTablePattern.FindStringSubmatch(text)
+	if match == nil || match[1] != "" {
+		return "", ""
+	}
+	return RuleCreateTableIfNotExists, fmt.Sprintf("CREATE TABLE %s without IF NOT EXISTS in an early migration", normalizeIdent(match[2]))
+}
+
+func lintDrop(text string) (string, string) {
+	if match := dropPattern.FindStringSubmatch(text); match != nil {
+		if match[2] != "" {
+			return "", ""
+		}
+		kind := strings.ToUpper(strings.Join(strings.Fields(match[1]), " "))
+		return RuleDownIfExists, fmt.Sprintf("DROP %s without IF EXISTS", kind)
+	}
+	if alterTablePattern.MatchString(text) {
+		for _, match := range alterDropPattern.FindAllStringSubmatch(text, -1) {
+			if match[2] == "" {
+				return RuleDownIfExists, fmt.Sprintf("DROP %s without IF EXISTS", strings.ToUpper(match[1]))
+			}
+		}
+	}
+	return "", ""
+}
+
+func lintInsert(text string) (string, string) {
+	match := insertPattern.FindStringSubmatch(text)
+	if match == nil || onConflictPattern.MatchString(text) {
+		return "", ""
+	}
+	return RuleIdempotentSeed, fmt.Sprintf("INSERT INTO %s without ON CONFLICT fails when the seed runs again", normalizeIdent(match[1]))
+}
@@ -4,10 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 
 	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
 )
@@ -15,6 +14,32 @@ import (
 // Migrator handles database migrations using golang-migrate
 type Migrator struct {
 	Verbose bool
+	// HeartbeatInterval is how often to log the running statement during
+	// up/down; zero disables the heartbeat
+	HeartbeatInterval time.Duration
+	// Retries is how many more times to try connecting, or taking the
+	// migration lock, after a transient failure
+	Retries int
+	// RetryBackoff is the wait before the first retry; it doubles each time
+	RetryBackoff time.Duration
+	// PerStatement runs each statement of a transactional migration file
+	// separately inside the file's transaction, reporting which statement
+	// failed and how long each took
+	PerStatement bool
+	// SkipFailedStatements, in per-statement mode, wraps each statement in a
+	// savepoint and rolls back to it when the statement fails, skipping the
+	// statement instead of failing the migration. Emergency use only.
+	SkipFailedStatements bool
+	// FailAtVersion, for testing orchestration, fails the migration file of
+	// this version instead of running it, leaving the database dirty
+	FailAtVersion uint
+	// OnMigrationApplied, if set, is called after each migration file of an
+	// up or down run is applied, with how long it took
+	OnMigrationApplied func(file File, elapsed time.Duration)
+	// RecordRun, if set, records each up and down run in the database's
+	// encore_migrate_history table
+	RecordRun *RunInfo
+	session   SessionOptions
 }
 
 // NewMigrator creates a new Migrator instance
@@ -22,10 +47,56 @@ func NewMigrator(verbose bool) *Migrator {
 	return &Migrator{Verbose: verbose}
 }
 
+// WithSession returns a copy of the Migrator that applies opts to its connections
+func (m *Migrator) WithSession(opts SessionOptions) *Migrator {
+	c := *m
+	c.session = opts
+	return &c
+}
+
 // Up applies pending migrations
 // If steps is 0 or negative, applies all pending migrations
 // If steps is positive, applies that many migrations
 func (m *Migrator) Up(connStr, migrationsPath string, steps int) (*types.MigrationResult, error) {
+	var result *types.MigrationResult
+	err := m.retry("acquire migration lock", isLockTimeout, func() (err error) {
+		result, err = m.up(connStr, migrationsPath, func(mig *migrate.Migrate) error {
+			if steps > 0 {
+				slog.Debug("applying specific number of migrations", "steps", steps)
+				return mig.Steps(steps)
+			}
+			slog.Debug("applying all pending migrations")
+			return mig.Up()
+		})
+		return err
+	})
+	return result, err
+}
+
+// UpTo runs up migrations until the database is at version, which must be
+// that of an up migration file. It refuses to migrate down, also when
+// another run moves the database past version before the lock is taken.
+func (m *Migrator) UpTo(connStr, migrationsPath string, version uint) (*types.MigrationResult, error) {
+	var result *types.MigrationResult
+	err := m.retry("acquire migration lock", isLockTimeout, func() (err error) {
+		result, err = m.up(connStr, migrationsPath, func(mig *migrate.Migrate) error {
+			current, _, err := mig.Version()
+			if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+				return err
+			}
+			if current > version {
+				return fmt.Errorf("database is at version %d, past %d (use down to roll back)", current, version)
+			}
+			slog.Debug("migrating up to version", "version", version)
+			return mig.Migrate(version)
+		})
+		return err
+	})
+	return result, err
+}
+
+// up runs the up migrations apply chooses
+func (m *Migrator) up(connStr, migrationsPath string, apply func(*migrate.Migrate) error) (*types.MigrationResult, error) {
 	sourceURL := BuildSourceURL(migrationsPath)
 
 	slog.Debug("creating migration instance",
@@ -33,7 +104,7 @@ func (m *Migrator) Up(connStr, migrationsPath string, steps int) (*types.Migrati
 		"direction", "up",
 	)
 
-	mig, err := migrate.New(sourceURL, connStr)
+	mig, driver, err := m.open(connStr, migrationsPath)
 	if err != nil {
 		slog.Error("failed to create migrator", "error", err)
 		return nil, fmt.Errorf("creating migrator: %w", err)
@@ -48,25 +119,35 @@ func (m *Migrator) Up(connStr, migrationsPath string, steps int) (*types.Migrati
 
 	if dirty {
 		slog.Error("database in dirty state", "version", versionBefore)
-		return nil, fmt.Errorf("database is in dirty state at version %d, manual intervention required", versionBefore)
+		return nil, &types.DirtyStateError{Version: versionBefore}
 	}
 
-	var migErr error
-	if steps > 0 {
-		slog.Debug("applying specific number of migrations", "steps", steps)
-		migErr = mig.Steps(steps)
-	} else {
-		slog.Debug("applying all pending migrations")
-		migErr = mig.Up()
+	if err := driver.prepareChecksums("up"); err != nil {
+		return nil, err
 	}
+	m.reportApplied(driver, migrationsPath, "up")
+
+	if m.FailAtVersion != 0 {
+		if err := driver.injectFailure(migrationsPath, "up", m.FailAtVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	started := time.Now()
+	stopHeartbeat := driver.startHeartbeat(m.HeartbeatInterval)
+	migErr := apply(mig)
+	stopHeartbeat()
 
 	// migrate.ErrNoChange is not an error for our purposes
 	if migErr != nil && !errors.Is(migErr, migrate.ErrNoChange) {
 		slog.Error("migration failed", "error", migErr)
-		return nil, fmt.Errorf("running migrations: %w", migErr)
+		versionAfter, _, _ := mig.Version()
+		driver.recordHistory(m.RecordRun, "up", versionBefore, versionAfter, started, migErr)
+		return nil, fmt.Errorf("running migrations: %w", locateError(migErr, migrationsPath, "up", driver.running))
 	}
 
 	versionAfter, _, _ := mig.Version()
+	driver.recordHistory(m.RecordRun, "up", versionBefore, versionAfter, started, nil)
 	slog.Debug("migration complete",
 		"version_before", versionBefore,
 		"version_after", versionAfter,
@@ -76,6 +157,8 @@ func (m *Migrator) Up(connStr, migrationsPath string, steps int) (*types.Migrati
 		Direction:     "up",
 		VersionBefore: versionBefore,
 		VersionAfter:  versionAfter,
+		Statements:    driver.statementTimings(migrationsPath, "up"),
+		Server:        &driver.server,
 	}, nil
 }
 
@@ -83,6 +166,49 @@ func (m *Migrator) Up(connStr, migrationsPath string, steps int) (*types.Migrati
 // If steps is 0 or negative, rolls back ALL migrations (dangerous!)
 // If steps is positive, rolls back that many migrations
 func (m *Migrator) Down(connStr, migrationsPath string, steps int) (*types.MigrationResult, error) {
+	var result *types.MigrationResult
+	err := m.retry("acquire migration lock", isLockTimeout, func() (err error) {
+		result, err = m.down(connStr, migrationsPath, func(mig *migrate.Migrate) error {
+			if steps > 0 {
+				slog.Debug("rolling back specific number of migrations", "steps", steps)
+				// Negative steps for down migrations
+				return mig.Steps(-steps)
+			}
+			slog.Warn("rolling back ALL migrations")
+			return mig.Down()
+		})
+		return err
+	})
+	return result, err
+}
+
+// RollBackTo runs down migrations until the database is at version, e.g.
+// the version it had before a run; 0 rolls back every migration. It refuses
+// to migrate up.
+func (m *Migrator) RollBackTo(connStr, migrationsPath string, version uint) (*types.MigrationResult, error) {
+	var result *types.MigrationResult
+	err := m.retry("acquire migration lock", isLockTimeout, func() (err error) {
+		result, err = m.down(connStr, migrationsPath, func(mig *migrate.Migrate) error {
+			current, _, err := mig.Version()
+			if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+				return err
+			}
+			if current < version {
+				return fmt.Errorf("database is at version %d, below %d", current, version)
+			}
+			slog.Debug("rolling back to version", "version", version)
+			if version == 0 {
+				return mig.Down()
+			}
+			return mig.Migrate(version)
+		})
+		return err
+	})
+	return result, err
+}
+
+// down runs the down migrations apply chooses
+func (m *Migrator) down(connStr, migrationsPath string, apply func(*migrate.Migrate) error) (*types.MigrationResult, error) {
 	sourceURL := BuildSourceURL(migrationsPath)
 
 	slog.Debug("creating migration instance",
@@ -90,7 +216,7 @@ func (m *Migrator) Down(connStr, migrationsPath string, steps int) (*types.Migra
 		"direction", "down",
 	)
 
-	mig, err := migrate.New(sourceURL, connStr)
+	mig, driver, err := m.open(connStr, migrationsPath)
 	if err != nil {
 		slog.Error("failed to create migrator", "error", err)
 		return nil, fmt.Errorf("creating migrator: %w", err)
@@ -105,27 +231,35 @@ func (m *Migrator) Down(connStr, migrationsPath string, steps int) (*types.Migra
 
 	if dirty {
 		slog.Error("database in dirty state", "version", versionBefore)
-		return nil, fmt.Errorf("database is in dirty state at version %d, manual intervention required", versionBefore)
+		return nil, &types.DirtyStateError{Version: versionBefore}
 	}
 
-	var migErr error
-	if steps > 0 {
-		slog.Debug("rolling back specific number of migrations", "steps", steps)
-		// Negative steps for down migrations
-		migErr = mig.Steps(-steps)
-	} else {
-		slog.Warn("rolling back ALL migrations")
-		// Roll back all migrations
-		migErr = mig.Down()
+	if err := driver.prepareChecksums("down"); err != nil {
+		return nil, err
 	}
+	m.reportApplied(driver, migrationsPath, "down")
+
+	if m.FailAtVersion != 0 {
+		if err := driver.injectFailure(migrationsPath, "down", m.FailAtVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	started := time.Now()
+	stopHeartbeat := driver.startHeartbeat(m.HeartbeatInterval)
+	migErr := apply(mig)
+	stopHeartbeat()
 
 	// migrate.ErrNoChange is not an error for our purposes
 	if migErr != nil && !errors.Is(migErr, migrate.ErrNoChange) {
 		slog.Error("migration rollback failed", "error", migErr)
-		return nil, fmt.Errorf("running migrations: %w", migErr)
+		versionAfter, _, _ := mig.Version()
+		driver.recordHistory(m.RecordRun, "down", versionBefore, versionAfter, started, migErr)
+		return nil, fmt.Errorf("running migrations: %w", locateError(migErr, migrationsPath, "down", driver.running))
 	}
 
 	versionAfter, _, _ := mig.Version()
+	driver.recordHistory(m.RecordRun, "down", versionBefore, versionAfter, started, nil)
 	slog.Debug("rollback complete",
 		"version_before", versionBefore,
 		"version_after", versionAfter,
@@ -135,9 +269,28 @@ func (m *Migrator) Down(connStr, migrationsPath string, steps int) (*types.Migra
 		Direction:     "down",
 		VersionBefore: versionBefore,
 		VersionAfter:  versionAfter,
+		Statements:    driver.statementTimings(migrationsPath, "down"),
+		Server:        &driver.server,
 	}, nil
 }
 
+// reportApplied passes the files driver applies to OnMigrationApplied
+func (m *Migrator) reportApplied(driver *sessionDriver, migrationsPath, direction string) {
+	if m.OnMigrationApplied == nil {
+		return
+	}
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		slog.Warn("applied migrations will not be reported", "error", err)
+		return
+	}
+	driver.onApplied = func(version uint, elapsed time.Duration) {
+		if f := fileForVersion(files, direction, version); f != nil {
+			m.OnMigrationApplied(*f, elapsed)
+		}
+	}
+}
+
 // Status returns the current migration version and dirty state
 type Status struct {
 	Version uint
@@ -147,9 +300,7 @@ type Status struct {
 
 // GetStatus returns the current migration status for a database
 func (m *Migrator) GetStatus(connStr, migrationsPath string) (*Status, error) {
-	sourceURL := BuildSourceURL(migrationsPath)
-
-	mig, err := migrate.New(sourceURL, connStr)
+	mig, _, err := m.open(connStr, migrationsPath)
 	if err != nil {
 		return nil, fmt.Errorf("creating migrator: %w", err)
 	}
@@ -173,9 +324,7 @@ func (m *Migrator) GetStatus(connStr, migrationsPath string) (*Status, error) {
 // Force sets the migration version without running any migrations
 // This is useful for recovering from a dirty state
 func (m *Migrator) Force(connStr, migrationsPath string, version int) error {
-	sourceURL := BuildSourceURL(migrationsPath)
-
-	mig, err := migrate.New(sourceURL, connStr)
+	mig, _, err := m.open(connStr, migrationsPath)
 	if err != nil {
 		return fmt.Errorf("creating migrator: %w", err)
 	}
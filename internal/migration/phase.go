@@ -0,0 +1,204 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// Phase is an expand/contract deployment phase. Expand migrations are
+// backwards compatible and run before new code rolls out; contract migrations
+// remove what old code still needs and run after.
+type Phase string
+
+const (
+	PhaseExpand   Phase = "expand"
+	PhaseContract Phase = "contract"
+)
+
+const (
+	// PhaseDirective tags a migration: "-- phase: expand" or "-- phase: contract".
+	// Untagged migrations are expand migrations.
+	PhaseDirective = "phase"
+
+	// ContractForDirective names the version(s) of the expand migration(s) a
+	// contract migration completes, e.g. "-- contract-for: 20240101120000"
+	ContractForDirective = "contract-for"
+)
+
+// ParsePhase validates a phase name
+func ParsePhase(name string) (Phase, error) {
+	switch Phase(name) {
+	case PhaseExpand, PhaseContract:
+		return Phase(name), nil
+	}
+	return "", fmt.Errorf("unknown phase %q: expected expand or contract", name)
+}
+
+// PhasedFile is an up migration with its expand/contract tagging
+type PhasedFile struct {
+	File
+	Phase              Phase
+	ContractFor        []uint // expand counterparts of a contract migration
+	RequiresAppVersion string // application version all instances must run first
+}
+
+// ReadPhases returns the up migrations in a directory with their phase directives
+func ReadPhases(migrationsPath string) ([]PhasedFile, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var phased []PhasedFile
+	for _, f := range UpFiles(files) {
+		directives, err := ReadDirectives(f.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		p := PhasedFile{File: f, Phase: PhaseExpand}
+		if values := directives.Get(PhaseDirective); len(values) > 0 {
+			if p.Phase, err = ParsePhase(values[len(values)-1]); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		for _, v := range directives.Get(ContractForDirective) {
+			version, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid %s version %q", f.Name, ContractForDirective, v)
+			}
+			p.ContractFor = append(p.ContractFor, uint(version))
+		}
+		if values := directives.Get(RequiresAppVersionDirective); len(values) > 0 {
+			p.RequiresAppVersion = values[len(values)-1]
+		}
+		phased = append(phased, p)
+	}
+	return phased, nil
+}
+
+// ValidatePhases checks that every contract counterpart exists, is an expand
+// migration, and comes before the contract migration
+func ValidatePhases(files []PhasedFile) error {
+	byVersion := make(map[uint]PhasedFile, len(files))
+	for _, f := range files {
+		byVersion[f.Version] = f
+	}
+
+	for _, f := range files {
+		if len(f.ContractFor) > 0 && f.Phase != PhaseContract {
+			return fmt.Errorf("%s: %s is only valid on contract migrations", f.Name, ContractForDirective)
+		}
+		if f.RequiresAppVersion != "" && f.Phase != PhaseContract {
+			return fmt.Errorf("%s: %s is only valid on contract migrations", f.Name, RequiresAppVersionDirective)
+		}
+		for _, v := range f.ContractFor {
+			expand, ok := byVersion[v]
+			switch {
+			case !ok:
+				return fmt.Errorf("%s: expand counterpart %d not found", f.Name, v)
+			case expand.Phase != PhaseExpand:
+				return fmt.Errorf("%s: counterpart %s is not an expand migration", f.Name, expand.Name)
+			case v >= f.Version:
+				return fmt.Errorf("%s: contract migration precedes its expand counterpart %s", f.Name, expand.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// PhaseSteps returns how many pending migrations after version current belong
+// to phase. Expand applies everything before the first pending contract
+// migration; contract applies the contract migrations that follow, and
+// refuses while expand migrations ahead of them are still pending.
+func PhaseSteps(files []PhasedFile, current uint, phase Phase) (int, error) {
+	pending := pendingFiles(files, current)
+
+	steps := 0
+	for _, f := range pending {
+		if f.Phase != phase {
+			break
+		}
+		steps++
+	}
+
+	if phase == PhaseContract && steps == 0 && len(pending) > 0 {
+		return 0, fmt.Errorf("expand migration %s is pending; run up --phase expand first", pending[0].Name)
+	}
+	return steps, nil
+}
+
+// PhaseOptions configure an expand/contract run
+type PhaseOptions struct {
+	Phase Phase
+
+	// Contract migrations wait until every application instance runs at least
+	// RequireAppVersion, or the highest requires-app-version of the migrations
+	// being applied, as reported by Gate
+	RequireAppVersion string
+	Gate              *AppVersionGate
+}
+
+// pendingFiles returns the files after version current
+func pendingFiles(files []PhasedFile, current uint) []PhasedFile {
+	var pending []PhasedFile
+	for _, f := range files {
+		if f.Version > current {
+			pending = append(pending, f)
+		}
+	}
+	return pending
+}
+
+// UpPhase applies the pending migrations of one expand/contract phase
+func (m *Migrator) UpPhase(ctx context.Context, connStr, migrationsPath string, opts PhaseOptions) (*types.MigrationResult, error) {
+	files, err := ReadPhases(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidatePhases(files); err != nil {
+		return nil, err
+	}
+
+	status, err := m.GetStatus(connStr, migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+	if status.Dirty {
+		return nil, &types.DirtyStateError{Version: status.Version}
+	}
+
+	steps, err := PhaseSteps(files, status.Version, opts.Phase)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Phase == PhaseContract && steps > 0 {
+		required := opts.RequireAppVersion
+		for _, f := range pendingFiles(files, status.Version)[:steps] {
+			if f.RequiresAppVersion != "" && (required == "" || CompareVersions(f.RequiresAppVersion, required) > 0) {
+				required = f.RequiresAppVersion
+			}
+		}
+		if required != "" {
+			if opts.Gate == nil {
+				return nil, fmt.Errorf("contract migrations require app version %s but no app version gate is configured", required)
+			}
+			if err := m.CheckAppVersions(ctx, connStr, *opts.Gate, required); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if steps == 0 {
+		return &types.MigrationResult{
+			Direction:     "up",
+			VersionBefore: status.Version,
+			VersionAfter:  status.Version,
+		}, nil
+	}
+	return m.Up(connStr, migrationsPath, steps)
+}
@@ -0,0 +1,145 @@
+package migration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadPhases(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		phase       Phase
+		contractFor []uint
+		appVersion  string
+		wantErr     string
+	}{
+		{name: "untagged is expand", content: "CREATE TABLE t (id int);", phase: PhaseExpand},
+		{name: "expand", content: "-- phase: expand\nSELECT 1;", phase: PhaseExpand},
+		{name: "contract", content: "-- phase: contract\n-- contract-for: 1, 2\nSELECT 1;", phase: PhaseContract, contractFor: []uint{1, 2}},
+		{name: "last phase wins", content: "-- phase: expand\n-- phase: contract\nSELECT 1;", phase: PhaseContract},
+		{name: "app version", content: "-- phase: contract\n-- requires-app-version: 1.4.0\nSELECT 1;", phase: PhaseContract, appVersion: "1.4.0"},
+		{name: "phase below the first statement", content: "SELECT 1;\n-- phase: contract\n", phase: PhaseExpand},
+		{name: "unknown phase", content: "-- phase: migrate\nSELECT 1;", wantErr: `unknown phase "migrate"`},
+		{name: "bad contract-for", content: "-- phase: contract\n-- contract-for: v1\nSELECT 1;", wantErr: `invalid contract-for version "v1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeMigrations(t, map[string]string{
+				"3_test.up.sql":   tt.content,
+				"3_test.down.sql": "SELECT 1;",
+			})
+			phased, err := ReadPhases(dir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadPhases() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(phased) != 1 {
+				t.Fatalf("ReadPhases() = %d files, want the up file only", len(phased))
+			}
+			got := phased[0]
+			if got.Phase != tt.phase || !reflect.DeepEqual(got.ContractFor, tt.contractFor) || got.RequiresAppVersion != tt.appVersion {
+				t.Errorf("ReadPhases() = phase %s, contract-for %v, app version %q; want %s, %v, %q",
+					got.Phase, got.ContractFor, got.RequiresAppVersion, tt.phase, tt.contractFor, tt.appVersion)
+			}
+		})
+	}
+}
+
+// phased names files after their version and phase, as error messages quote them
+func phased(files ...PhasedFile) []PhasedFile {
+	for i := range files {
+		files[i].Name = fmt.Sprintf("%d_%s.up.sql", files[i].Version, files[i].Phase)
+	}
+	return files
+}
+
+func TestValidatePhases(t *testing.T) {
+	expand := func(v uint) PhasedFile { return PhasedFile{File: File{Version: v}, Phase: PhaseExpand} }
+	contract := func(v uint, of ...uint) PhasedFile {
+		return PhasedFile{File: File{Version: v}, Phase: PhaseContract, ContractFor: of}
+	}
+	tests := []struct {
+		name    string
+		files   []PhasedFile
+		wantErr string
+	}{
+		{name: "valid", files: phased(expand(1), expand(2), contract(3, 1, 2))},
+		{name: "contract without counterparts", files: phased(expand(1), contract(2))},
+		{name: "missing counterpart", files: phased(expand(1), contract(3, 2)), wantErr: "expand counterpart 2 not found"},
+		{name: "counterpart is a contract", files: phased(expand(1), contract(2), contract(3, 2)), wantErr: "counterpart 2_contract.up.sql is not an expand migration"},
+		{name: "counterpart comes later", files: phased(contract(1, 2), expand(2)), wantErr: "precedes its expand counterpart"},
+		{name: "contract-for on expand", files: phased(expand(1), PhasedFile{File: File{Version: 2}, Phase: PhaseExpand, ContractFor: []uint{1}}), wantErr: "only valid on contract migrations"},
+		{name: "app version on expand", files: phased(PhasedFile{File: File{Version: 1}, Phase: PhaseExpand, RequiresAppVersion: "1.0.0"}), wantErr: "only valid on contract migrations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePhases(tt.files)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidatePhases() = %v, want nil", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidatePhases() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPhaseSteps(t *testing.T) {
+	files := []PhasedFile{
+		{File: File{Version: 1, Name: "1.up.sql"}, Phase: PhaseExpand},
+		{File: File{Version: 2, Name: "2.up.sql"}, Phase: PhaseExpand},
+		{File: File{Version: 3, Name: "3.up.sql"}, Phase: PhaseContract},
+		{File: File{Version: 4, Name: "4.up.sql"}, Phase: PhaseContract},
+		{File: File{Version: 5, Name: "5.up.sql"}, Phase: PhaseExpand},
+	}
+	tests := []struct {
+		current uint
+		phase   Phase
+		want    int
+		wantErr string
+	}{
+		{current: 0, phase: PhaseExpand, want: 2},
+		{current: 0, phase: PhaseContract, wantErr: "expand migration 1.up.sql is pending"},
+		{current: 2, phase: PhaseExpand, want: 0},
+		{current: 2, phase: PhaseContract, want: 2},
+		{current: 3, phase: PhaseContract, want: 1},
+		{current: 4, phase: PhaseExpand, want: 1},
+		{current: 4, phase: PhaseContract, wantErr: "expand migration 5.up.sql is pending"},
+		{current: 5, phase: PhaseExpand, want: 0},
+		{current: 5, phase: PhaseContract, want: 0},
+	}
+	for _, tt := range tests {
+		got, err := PhaseSteps(files, tt.current, tt.phase)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("PhaseSteps(%d, %s) error = %v, want %q", tt.current, tt.phase, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("PhaseSteps(%d, %s) = %d, %v, want %d", tt.current, tt.phase, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePhase(t *testing.T) {
+	for _, name := range []string{"expand", "contract"} {
+		if got, err := ParsePhase(name); err != nil || string(got) != name {
+			t.Errorf("ParsePhase(%q) = %q, %v", name, got, err)
+		}
+	}
+	for _, name := range []string{"", "Expand", "both"} {
+		if _, err := ParsePhase(name); err == nil {
+			t.Errorf("ParsePhase(%q) succeeded, want an error", name)
+		}
+	}
+}
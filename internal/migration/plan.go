@@ -0,0 +1,119 @@
+package migration
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Step is one migration a plan would run
+type Step struct {
+	Version    uint
+	Identifier string
+	File       *File // nil for a down step without a down file (only the version changes)
+}
+
+// Plan is what up or down would do to a database, computed without running any SQL
+type Plan struct {
+	Direction      string
+	CurrentVersion uint
+	Dirty          bool
+	TargetVersion  uint
+	Steps          []Step
+}
+
+// PlanUp lists the up migrations after version current, limited to steps if positive
+func PlanUp(files []File, current uint, steps int) *Plan {
+	plan := &Plan{Direction: "up", CurrentVersion: current, TargetVersion: current}
+	for _, f := range UpFiles(files) {
+		if f.Version <= current {
+			continue
+		}
+		if steps > 0 && len(plan.Steps) == steps {
+			break
+		}
+		plan.Steps = append(plan.Steps, Step{Version: f.Version, Identifier: f.Identifier, File: &f})
+		plan.TargetVersion = f.Version
+	}
+	return plan
+}
+
+// StopAt trims an up plan to the steps up to and including version, which
+// must be the current version or that of a pending migration
+func (p *Plan) StopAt(version uint) error {
+	if version < p.CurrentVersion {
+		return fmt.Errorf("database is at version %d, past %d (use down to roll back)", p.CurrentVersion, version)
+	}
+	if version == p.CurrentVersion {
+		p.Steps, p.TargetVersion = nil, p.CurrentVersion
+		return nil
+	}
+	for i, step := range p.Steps {
+		if step.Version == version {
+			p.Steps, p.TargetVersion = p.Steps[:i+1], version
+			return nil
+		}
+	}
+	return fmt.Errorf("no pending up migration with version %d", version)
+}
+
+// PlanDown lists the down migrations from version current backwards, limited
+// to steps if positive. The target is the version before the last step, or 0.
+func PlanDown(files []File, current uint, steps int) *Plan {
+	plan := &Plan{Direction: "down", CurrentVersion: current, TargetVersion: current}
+
+	// Versions are defined by up files; a down file is optional
+	var versions []File
+	for _, f := range UpFiles(files) {
+		if f.Version <= current {
+			versions = append(versions, f)
+		}
+	}
+	slices.Reverse(versions)
+
+	for i, up := range versions {
+		if steps > 0 && len(plan.Steps) == steps {
+			break
+		}
+		step := Step{Version: up.Version, Identifier: up.Identifier}
+		for _, f := range files {
+			if f.Version == up.Version && f.Direction == "down" {
+				step.File = &f
+				break
+			}
+		}
+		plan.Steps = append(plan.Steps, step)
+
+		plan.TargetVersion = 0
+		if i+1 < len(versions) {
+			plan.TargetVersion = versions[i+1].Version
+		}
+	}
+	return plan
+}
+
+// Plan reads the database's current version and computes what up or down
+// would apply. steps follows Up and Down: 0 means all for up and, for down,
+// every migration.
+func (m *Migrator) Plan(connStr, migrationsPath, direction string, steps int) (*Plan, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := m.GetStatus(connStr, migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan *Plan
+	switch direction {
+	case "up":
+		plan = PlanUp(files, status.Version, steps)
+	case "down":
+		plan = PlanDown(files, status.Version, steps)
+	default:
+		return nil, fmt.Errorf("unknown direction %q", direction)
+	}
+	plan.Dirty = status.Dirty
+	return plan, nil
+}
@@ -0,0 +1,118 @@
+package migration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// planFiles has down files for versions 1, 5 and 7 but not 2
+var planFiles = []File{
+	{Version: 1, Identifier: "init", Direction: "down", Name: "1_init.down.sql"},
+	{Version: 1, Identifier: "init", Direction: "up", Name: "1_init.up.sql"},
+	{Version: 2, Identifier: "seed", Direction: "up", Name: "2_seed.up.sql"},
+	{Version: 5, Identifier: "orders", Direction: "down", Name: "5_orders.down.sql"},
+	{Version: 5, Identifier: "orders", Direction: "up", Name: "5_orders.up.sql"},
+	{Version: 7, Identifier: "email", Direction: "down", Name: "7_email.down.sql"},
+	{Version: 7, Identifier: "email", Direction: "up", Name: "7_email.up.sql"},
+}
+
+// planSteps renders a plan's steps as version:file, "-" for a step without a file
+func planSteps(p *Plan) []string {
+	var steps []string
+	for _, s := range p.Steps {
+		name := "-"
+		if s.File != nil {
+			name = s.File.Name
+		}
+		steps = append(steps, fmt.Sprintf("%d:%s", s.Version, name))
+	}
+	return steps
+}
+
+func TestPlanUp(t *testing.T) {
+	tests := []struct {
+		current uint
+		steps   int
+		target  uint
+		want    []string
+	}{
+		{current: 0, steps: 0, target: 7, want: []string{"1:1_init.up.sql", "2:2_seed.up.sql", "5:5_orders.up.sql", "7:7_email.up.sql"}},
+		{current: 0, steps: 2, target: 2, want: []string{"1:1_init.up.sql", "2:2_seed.up.sql"}},
+		{current: 2, steps: 0, target: 7, want: []string{"5:5_orders.up.sql", "7:7_email.up.sql"}},
+		{current: 3, steps: 1, target: 5, want: []string{"5:5_orders.up.sql"}},
+		{current: 5, steps: 10, target: 7, want: []string{"7:7_email.up.sql"}},
+		{current: 7, steps: 0, target: 7},
+		{current: 9, steps: 0, target: 9},
+	}
+	for _, tt := range tests {
+		plan := PlanUp(planFiles, tt.current, tt.steps)
+		if got := planSteps(plan); !reflect.DeepEqual(got, tt.want) || plan.TargetVersion != tt.target || plan.CurrentVersion != tt.current || plan.Direction != "up" {
+			t.Errorf("PlanUp(%d, %d) = %s %d->%d %q, want up %d->%d %q",
+				tt.current, tt.steps, plan.Direction, plan.CurrentVersion, plan.TargetVersion, got, tt.current, tt.target, tt.want)
+		}
+	}
+}
+
+func TestPlanDown(t *testing.T) {
+	tests := []struct {
+		current uint
+		steps   int
+		target  uint
+		want    []string
+	}{
+		{current: 7, steps: 0, target: 0, want: []string{"7:7_email.down.sql", "5:5_orders.down.sql", "2:-", "1:1_init.down.sql"}},
+		{current: 7, steps: 1, target: 5, want: []string{"7:7_email.down.sql"}},
+		{current: 7, steps: 2, target: 2, want: []string{"7:7_email.down.sql", "5:5_orders.down.sql"}},
+		{current: 5, steps: 2, target: 1, want: []string{"5:5_orders.down.sql", "2:-"}},
+		{current: 6, steps: 1, target: 2, want: []string{"5:5_orders.down.sql"}},
+		{current: 1, steps: 5, target: 0, want: []string{"1:1_init.down.sql"}},
+		{current: 0, steps: 0, target: 0},
+	}
+	for _, tt := range tests {
+		plan := PlanDown(planFiles, tt.current, tt.steps)
+		if got := planSteps(plan); !reflect.DeepEqual(got, tt.want) || plan.TargetVersion != tt.target || plan.CurrentVersion != tt.current || plan.Direction != "down" {
+			t.Errorf("PlanDown(%d, %d) = %s %d->%d %q, want down %d->%d %q",
+				tt.current, tt.steps, plan.Direction, plan.CurrentVersion, plan.TargetVersion, got, tt.current, tt.target, tt.want)
+		}
+	}
+}
+
+func TestPlanStopAt(t *testing.T) {
+	tests := []struct {
+		current uint
+		version uint
+		target  uint
+		want    []string
+		wantErr string
+	}{
+		{current: 0, version: 5, target: 5, want: []string{"1:1_init.up.sql", "2:2_seed.up.sql", "5:5_orders.up.sql"}},
+		{current: 0, version: 7, target: 7, want: []string{"1:1_init.up.sql", "2:2_seed.up.sql", "5:5_orders.up.sql", "7:7_email.up.sql"}},
+		{current: 2, version: 2, target: 2},
+		{current: 2, version: 1, wantErr: "database is at version 2, past 1"},
+		{current: 0, version: 3, wantErr: "no pending up migration with version 3"},
+		{current: 0, version: 8, wantErr: "no pending up migration with version 8"},
+	}
+	for _, tt := range tests {
+		plan := PlanUp(planFiles, tt.current, 0)
+		err := plan.StopAt(tt.version)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("StopAt(%d) from %d error = %v, want %q", tt.version, tt.current, err, tt.wantErr)
+			}
+			continue
+		}
+		if got := planSteps(plan); err != nil || !reflect.DeepEqual(got, tt.want) || plan.TargetVersion != tt.target {
+			t.Errorf("StopAt(%d) from %d = %d %q, %v, want %d %q", tt.version, tt.current, plan.TargetVersion, got, err, tt.target, tt.want)
+		}
+	}
+}
+
+func TestPlanStopAtLimitedPlan(t *testing.T) {
+	// a version beyond the steps a plan was limited to is not pending in it
+	plan := PlanUp(planFiles, 0, 1)
+	if err := plan.StopAt(5); err == nil {
+		t.Errorf("StopAt(5) on a one-step plan succeeded, want an error")
+	}
+}
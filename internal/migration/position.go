@@ -0,0 +1,150 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang-migrate/migrate/v4/database"
+)
+
+// SQLError is a PostgreSQL error located in the migration file that caused it
+type SQLError struct {
+	File    string // path of the migration file
+	Line    int    // 1-based
+	Column  int    // 1-based, in characters
+	Message string // the server's message, with detail and hint if any
+	Snippet string // the failing line with a caret under the error position
+	Err     error
+}
+
+func (e *SQLError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s\n%s", e.File, e.Line, e.Column, e.Message, e.Snippet)
+}
+
+func (e *SQLError) Unwrap() error { return e.Err }
+
+// statementError records where in a migration body a failed statement
+// started, so a server-reported position can be mapped back to the file
+type statementError struct {
+	err    error
+	body   []byte
+	offset int // byte offset of the failed statement within body
+	query  string
+}
+
+func (e *statementError) Error() string { return e.err.Error() }
+
+func (e *statementError) Unwrap() error { return e.err }
+
+// withStatement attaches the statement's location to err if the server
+// reported an error position
+func withStatement(err error, body []byte, offset int, query string) error {
+	if pqErr := pqError(err); pqErr == nil || pqErr.Position == "" {
+		return err
+	}
+	return atStatement(err, body, offset, query)
+}
+
+// atStatement attaches the statement's location to err unconditionally, for
+// statements run on their own: without a server-reported position the error
+// is located at the start of the statement
+func atStatement(err error, body []byte, offset int, query string) error {
+	return &statementError{err: err, body: body, offset: offset, query: query}
+}
+
+// locateError turns a statementError from running the migration of version
+// into a SQLError naming its file and line. Other errors are returned
+// unchanged.
+func locateError(err error, migrationsPath, direction string, version uint) error {
+	var stmtErr *statementError
+	if !errors.As(err, &stmtErr) {
+		return err
+	}
+	position := 1
+	pqErr := pqError(err)
+	if pqErr != nil && pqErr.Position != "" {
+		var convErr error
+		position, convErr = strconv.Atoi(pqErr.Position)
+		if convErr != nil || position < 1 {
+			return err
+		}
+	}
+
+	// The server counts characters from 1 within the query it was sent
+	offset := stmtErr.offset
+	for i := 1; i < position && offset-stmtErr.offset < len(stmtErr.query); i++ {
+		_, size := utf8.DecodeRuneInString(stmtErr.query[offset-stmtErr.offset:])
+		offset += size
+	}
+
+	path := "(unknown file)"
+	if files, listErr := ListFiles(migrationsPath); listErr == nil {
+		if f := fileForVersion(files, direction, version); f != nil {
+			path = f.Path
+		}
+	}
+
+	body := string(stmtErr.body)
+	lineStart := strings.LastIndexByte(body[:offset], '\n') + 1
+	lineEnd := strings.IndexByte(body[offset:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(body)
+	} else {
+		lineEnd += offset
+	}
+	line := strings.Count(body[:offset], "\n") + 1
+	column := utf8.RuneCountInString(body[lineStart:offset]) + 1
+
+	message := stmtErr.err.Error()
+	var dbErr database.Error
+	if errors.As(stmtErr.err, &dbErr) && dbErr.OrigErr != nil {
+		message = dbErr.OrigErr.Error()
+	}
+	if pqErr != nil {
+		message = pqErr.Message
+		if pqErr.Detail != "" {
+			message += "\nDetail: " + pqErr.Detail
+		}
+		if pqErr.Hint != "" {
+			message += "\nHint: " + pqErr.Hint
+		}
+	}
+
+	return &SQLError{
+		File:    path,
+		Line:    line,
+		Column:  column,
+		Message: message,
+		Snippet: caretSnippet(body[lineStart:lineEnd], line, body[lineStart:offset]),
+		Err:     err,
+	}
+}
+
+// fileForVersion finds the migration file of version in the given direction
+func fileForVersion(files []File, direction string, version uint) *File {
+	for i, f := range files {
+		if f.Direction == direction && f.Version == version {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+// caretSnippet renders a source line with a caret under the end of prefix,
+// keeping tabs so the caret lines up
+func caretSnippet(text string, line int, prefix string) string {
+	text = strings.TrimRight(text, "\r")
+	gutter := strconv.Itoa(line)
+	var caret strings.Builder
+	for _, r := range prefix {
+		if r == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	return fmt.Sprintf("  %s | %s\n  %s | %s^", gutter, text, strings.Repeat(" ", len(gutter)), caret.String())
+}
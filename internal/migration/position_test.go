@@ -0,0 +1,31 @@
+package migration
+
+import "testing"
+
+func TestFileForVersion(t *testing.T) {
+	files := []File{
+		{Version: 1, Name: "1_a.up.sql", Direction: "up"},
+		{Version: 1, Name: "1_a.down.sql", Direction: "down"},
+		{Version: 2, Name: "2_b.up.sql", Direction: "up"},
+	}
+	tests := []struct {
+		direction string
+		version   uint
+		want      string
+	}{
+		{"up", 1, "1_a.up.sql"},
+		{"down", 1, "1_a.down.sql"},
+		{"up", 2, "2_b.up.sql"},
+		{"down", 2, ""},
+		{"up", 3, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if f := fileForVersion(files, tt.direction, tt.version); f != nil {
+			got = f.Name
+		}
+		if got != tt.want {
+			t.Errorf("fileForVersion(%s, %d) = %q, want %q", tt.direction, tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/lib/pq"
+)
+
+// Provision describes a database and the login role that owns it
+type Provision struct {
+	Database string
+	Role     string
+	Password string
+}
+
+// ProvisionResult reports what EnsureDatabase changed
+type ProvisionResult struct {
+	CreatedRole     bool
+	CreatedDatabase bool
+}
+
+// EnsureDatabase creates the role and database if missing, sets the role's
+// password, and grants the role baseline privileges. maintenanceConnStr and
+// targetConnStr are admin connections to the maintenance database (e.g.
+// postgres) and to the target database, which is only opened once it exists.
+func (m *Migrator) EnsureDatabase(maintenanceConnStr, targetConnStr string, p Provision) (*ProvisionResult, error) {
+	db, err := openDB(maintenanceConnStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var result ProvisionResult
+	role := pq.QuoteIdentifier(p.Role)
+
+	var exists, isAdmin bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1), current_user = $1`, p.Role).Scan(&exists, &isAdmin); err != nil {
+		return nil, fmt.Errorf("checking role %s: %w", p.Role, err)
+	}
+	// Passwords can't be bound parameters in role DDL
+	password := pq.QuoteLiteral(p.Password)
+	switch {
+	case isAdmin:
+		// Migrating as the admin itself; leave its password alone
+	case exists:
+		if _, err := db.Exec(`ALTER ROLE ` + role + ` WITH LOGIN PASSWORD ` + password); err != nil {
+			return nil, fmt.Errorf("updating role %s: %w", p.Role, err)
+		}
+	default:
+		slog.Info("creating role", "role", p.Role)
+		if _, err := db.Exec(`CREATE ROLE ` + role + ` WITH LOGIN PASSWORD ` + password); err != nil {
+			return nil, fmt.Errorf("creating role %s: %w", p.Role, err)
+		}
+		result.CreatedRole = true
+	}
+
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, p.Database).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("checking database %s: %w", p.Database, err)
+	}
+	if !exists {
+		if err := ensureMembership(db, p.Role); err != nil {
+			return nil, err
+		}
+		slog.Info("creating database", "database", p.Database, "owner", p.Role)
+		if _, err := db.Exec(`CREATE DATABASE ` + pq.QuoteIdentifier(p.Database) + ` OWNER ` + role); err != nil {
+			return nil, fmt.Errorf("creating database %s: %w", p.Database, err)
+		}
+		result.CreatedDatabase = true
+	}
+
+	if _, err := db.Exec(`GRANT CONNECT, TEMPORARY ON DATABASE ` + pq.QuoteIdentifier(p.Database) + ` TO ` + role); err != nil {
+		return &result, fmt.Errorf("granting database privileges: %w", err)
+	}
+
+	target, err := openDB(targetConnStr)
+	if err != nil {
+		return &result, err
+	}
+	defer target.Close()
+
+	// PostgreSQL 15+ no longer lets every role create objects in public
+	if _, err := target.Exec(`GRANT USAGE, CREATE ON SCHEMA public TO ` + role); err != nil {
+		return &result, fmt.Errorf("granting schema privileges: %w", err)
+	}
+
+	return &result, nil
+}
+
+// ensureMembership makes the current (non-superuser) admin a member of role,
+// which CREATE DATABASE ... OWNER requires
+func ensureMembership(db *sql.DB, role string) error {
+	var ok bool
+	err := db.QueryRow(`SELECT rolsuper OR pg_has_role(current_user, $1, 'MEMBER') FROM pg_roles WHERE rolname = current_user`, role).Scan(&ok)
+	if err != nil {
+		return fmt.Errorf("checking membership in %s: %w", role, err)
+	}
+	if ok {
+		return nil
+	}
+	if _, err := db.Exec(`GRANT ` + pq.QuoteIdentifier(role) + ` TO CURRENT_USER`); err != nil {
+		return fmt.Errorf("granting %s to the admin user: %w", role, err)
+	}
+	return nil
+}
+
+// DropDatabase drops a database, disconnecting any sessions (PostgreSQL 13+)
+func (m *Migrator) DropDatabase(maintenanceConnStr, name string) error {
+	db, err := openDB(maintenanceConnStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	slog.Info("dropping database", "database", name)
+	if _, err := db.Exec(`DROP DATABASE IF EXISTS ` + pq.QuoteIdentifier(name) + ` WITH (FORCE)`); err != nil {
+		return fmt.Errorf("dropping database %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropSchemas drops every user schema in the database and recreates an empty
+// public schema, leaving the database itself in place. It returns the dropped schemas.
+func (m *Migrator) DropSchemas(connStr string) ([]string, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT nspname FROM pg_namespace
+		WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'
+		ORDER BY nspname`)
+	if err != nil {
+		return nil, fmt.Errorf("listing schemas: %w", err)
+	}
+	var schemas []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("listing schemas: %w", err)
+		}
+		schemas = append(schemas, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing schemas: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, name := range schemas {
+		slog.Info("dropping schema", "schema", name)
+		if _, err := tx.Exec(`DROP SCHEMA ` + pq.QuoteIdentifier(name) + ` CASCADE`); err != nil {
+			return nil, fmt.Errorf("dropping schema %s: %w", name, err)
+		}
+	}
+	if _, err := tx.Exec(`CREATE SCHEMA IF NOT EXISTS public`); err != nil {
+		return nil, fmt.Errorf("recreating public schema: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("dropping schemas: %w", err)
+	}
+	return schemas, nil
+}
@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// WaitForReplica polls a replica until it has replayed the primary's WAL up
+// to where the primary is when called, so the migrations just applied are
+// visible there, or the context is done. A replica that is not a standby,
+// such as a logical replica, is polled until it reports version expected in
+// a clean state instead. Connection errors are retried until the context is
+// done.
+func (m *Migrator) WaitForReplica(ctx context.Context, primaryConnStr, replicaConnStr string, expected uint, interval time.Duration) error {
+	target, err := currentWALPosition(ctx, primaryConnStr)
+	if err != nil {
+		return fmt.Errorf("reading the primary's WAL position: %w", err)
+	}
+
+	var db *sql.DB
+	defer func() {
+		if db != nil {
+			db.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	status := "not reached"
+	for {
+		if db == nil {
+			db, err = openDB(replicaConnStr)
+		}
+		if db != nil {
+			var caughtUp bool
+			caughtUp, status, err = m.replicaCaughtUp(ctx, db, target, expected)
+			if err == nil && caughtUp {
+				slog.Debug("replica caught up", "wal_position", target, "elapsed", time.Since(start))
+				return nil
+			}
+		}
+		if err != nil {
+			slog.Debug("replica check failed", "error", err)
+		} else {
+			slog.Debug("waiting for replica", "status", status)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("replica did not catch up (%s): %w (last error: %v)", status, ctx.Err(), err)
+			}
+			return fmt.Errorf("replica did not catch up (%s): %w", status, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// currentWALPosition is the primary's current WAL write position
+func currentWALPosition(ctx context.Context, connStr string) (string, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var lsn string
+	if err := db.QueryRowContext(ctx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn); err != nil {
+		return "", err
+	}
+	return lsn, nil
+}
+
+// replicaCaughtUp reports whether a standby replayed the WAL up to target,
+// or another replica reached version expected; status says where it is
+func (m *Migrator) replicaCaughtUp(ctx context.Context, db *sql.DB, target string, expected uint) (bool, string, error) {
+	var standby bool
+	var replayed sql.NullString
+	var caughtUp sql.NullBool
+	err := db.QueryRowContext(ctx, `SELECT pg_is_in_recovery(), pg_last_wal_replay_lsn()::text, pg_last_wal_replay_lsn() >= $1::pg_lsn`, target).
+		Scan(&standby, &replayed, &caughtUp)
+	if err != nil {
+		return false, "", err
+	}
+	if standby {
+		if !replayed.Valid {
+			return false, fmt.Sprintf("replayed nothing yet, primary at %s", target), nil
+		}
+		return caughtUp.Bool, fmt.Sprintf("replayed %s, primary at %s", replayed.String, target), nil
+	}
+
+	version, dirty, err := readVersion(db, m.session.versionTable())
+	if err != nil {
+		return false, "", err
+	}
+	return version == expected && !dirty, fmt.Sprintf("at version %d, dirty=%t", version, dirty), nil
+}
@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// RequiresDirective declares that a migration needs another database to be at
+// a minimum version first, e.g. "-- requires: users>=0042"
+const RequiresDirective = "requires"
+
+// requirementPattern matches "<encore database>>=<version>"
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*>=\s*(\d+)$`)
+
+// Requirement is a cross-database prerequisite declared by a migration
+type Requirement struct {
+	Database   string // Encore database name
+	MinVersion uint
+	File       File // migration declaring the requirement
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s>=%d", r.Database, r.MinVersion)
+}
+
+// ParseRequirement parses a requires directive value
+func ParseRequirement(value string) (Requirement, error) {
+	match := requirementPattern.FindStringSubmatch(value)
+	if match == nil {
+		return Requirement{}, fmt.Errorf("invalid %s %q: expected <database>>=<version>", RequiresDirective, value)
+	}
+	version, err := strconv.ParseUint(match[2], 10, 64)
+	if err != nil {
+		return Requirement{}, fmt.Errorf("invalid %s %q: %w", RequiresDirective, value, err)
+	}
+	return Requirement{Database: match[1], MinVersion: uint(version)}, nil
+}
+
+// ReadRequirements returns the requires directives of the up migrations in a directory
+func ReadRequirements(migrationsPath string) ([]Requirement, error) {
+	files, err := ListFiles(migrationsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var requirements []Requirement
+	for _, f := range UpFiles(files) {
+		directives, err := ReadDirectives(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range directives.Get(RequiresDirective) {
+			r, err := ParseRequirement(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			r.File = f
+			requirements = append(requirements, r)
+		}
+	}
+	return requirements, nil
+}
+
+// PendingRequirements returns the requirements of migrations after version current
+func PendingRequirements(requirements []Requirement, current uint) []Requirement {
+	var pending []Requirement
+	for _, r := range requirements {
+		if r.File.Version > current {
+			pending = append(pending, r)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRequirement(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Requirement
+		wantErr string
+	}{
+		{value: "users>=42", want: Requirement{Database: "users", MinVersion: 42}},
+		{value: "users>=0042", want: Requirement{Database: "users", MinVersion: 42}},
+		{value: "user-events >= 20240101120000", want: Requirement{Database: "user-events", MinVersion: 20240101120000}},
+		{value: "billing_v2>=0", want: Requirement{Database: "billing_v2", MinVersion: 0}},
+		{value: "users>42", wantErr: "expected <database>>=<version>"},
+		{value: "users=42", wantErr: "expected <database>>=<version>"},
+		{value: "users>=", wantErr: "expected <database>>=<version>"},
+		{value: ">=42", wantErr: "expected <database>>=<version>"},
+		{value: "users>=v42", wantErr: "expected <database>>=<version>"},
+		{value: "public.users>=42", wantErr: "expected <database>>=<version>"},
+		{value: "users>=99999999999999999999", wantErr: "value out of range"},
+	}
+	for _, tt := range tests {
+		got, err := ParseRequirement(tt.value)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRequirement(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRequirement(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestReadRequirements(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"1_init.up.sql":      "CREATE TABLE t (id int);",
+		"2_orders.up.sql":    "-- requires: users>=3, billing>=1\n-- requires: audit>=7\nSELECT 1;",
+		"2_orders.down.sql":  "-- requires: ignored>=1\nSELECT 1;",
+		"3_refunds.up.sql":   "-- requires: billing>=4\nSELECT 1;",
+		"4_comments.up.sql":  "SELECT 1;\n-- requires: not-a-directive>=1\n",
+		"5_archive.down.sql": "SELECT 1;",
+	})
+	reqs, err := ReadRequirements(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range reqs {
+		got = append(got, r.File.Name+": "+r.String())
+	}
+	want := []string{
+		"2_orders.up.sql: users>=3",
+		"2_orders.up.sql: billing>=1",
+		"2_orders.up.sql: audit>=7",
+		"3_refunds.up.sql: billing>=4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadRequirements() = %q, want %q", got, want)
+	}
+
+	var pending []string
+	for _, r := range PendingRequirements(reqs, 2) {
+		pending = append(pending, r.String())
+	}
+	if want := []string{"billing>=4"}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("PendingRequirements(2) = %q, want %q", pending, want)
+	}
+}
+
+func TestReadRequirementsInvalid(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{
+		"1_init.up.sql": "-- requires: users > 3\nSELECT 1;",
+	})
+	_, err := ReadRequirements(dir)
+	if err == nil || !strings.Contains(err.Error(), `1_init.up.sql: invalid requires "users > 3"`) {
+		t.Errorf("ReadRequirements() error = %v, want the file and value named", err)
+	}
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// IsTransient reports whether err looks like a temporary failure to reach
+// the database: a network error, a server that is starting up or out of
+// connections, or a dropped connection
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if pqErr := pqError(err); pqErr != nil {
+		switch pqErr.Code {
+		case "57P03", // cannot_connect_now: the server is starting up
+			"53300": // too_many_connections
+			return true
+		}
+		// Class 08: connection exception
+		return pqErr.Code.Class() == "08"
+	}
+	return false
+}
+
+// isLockTimeout reports whether golang-migrate gave up waiting for the
+// migration lock, in which case nothing was applied
+func isLockTimeout(err error) bool {
+	return errors.Is(err, migrate.ErrLockTimeout)
+}
+
+// sleep waits between retries; tests replace it to record the backoff
+var sleep = time.Sleep
+
+// retry runs fn, retrying up to m.Retries more times while it fails with an
+// error retryable accepts. The wait starts at m.RetryBackoff and doubles.
+func (m *Migrator) retry(op string, retryable func(error) bool, fn func() error) error {
+	backoff := m.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > m.Retries || !retryable(err) {
+			return err
+		}
+		slog.Warn("transient failure, retrying",
+			"operation", op,
+			"attempt", attempt,
+			"retries", m.Retries,
+			"backoff", backoff,
+			"error", err,
+		)
+		sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,93 @@
+package migration
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/lib/pq"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"EOF", io.EOF, true},
+		{"unexpected EOF wrapped", fmt.Errorf("reading: %w", io.ErrUnexpectedEOF), true},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"DNS failure", &net.DNSError{Err: "no such host", Name: "db.internal"}, true},
+		{"server starting up", &pq.Error{Code: "57P03"}, true},
+		{"too many connections", &pq.Error{Code: "53300"}, true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"connection exception wrapped by golang-migrate", database.Error{OrigErr: &pq.Error{Code: "08001"}, Err: "migration failed"}, true},
+		{"pointer to a golang-migrate error", &database.Error{OrigErr: &pq.Error{Code: "57P03"}}, true},
+		{"syntax error", &pq.Error{Code: "42601"}, false},
+		{"syntax error wrapped by golang-migrate", database.Error{OrigErr: &pq.Error{Code: "42601"}}, false},
+		{"authentication failure", &pq.Error{Code: "28P01"}, false},
+		{"lock timeout", migrate.ErrLockTimeout, false},
+		{"context cancelled", context.Canceled, false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	transient := &pq.Error{Code: "57P03"}
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int   // calls failing before one succeeds
+		err       error // the failure
+		wantCalls int
+		wantWaits []time.Duration
+		wantErr   bool
+	}{
+		{name: "first try", retries: 5, failures: 0, err: transient, wantCalls: 1},
+		{name: "succeeds on the third try", retries: 5, failures: 2, err: transient, wantCalls: 3, wantWaits: []time.Duration{10, 20}},
+		{name: "retries exhausted", retries: 3, failures: 10, err: transient, wantCalls: 4, wantWaits: []time.Duration{10, 20, 40}, wantErr: true},
+		{name: "not retryable", retries: 5, failures: 10, err: errors.New("syntax error"), wantCalls: 1, wantErr: true},
+		{name: "no retries", retries: 0, failures: 10, err: transient, wantCalls: 1, wantErr: true},
+		{name: "retrying disabled", retries: -1, failures: 10, err: transient, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var waits []time.Duration
+			defer func(s func(time.Duration)) { sleep = s }(sleep)
+			sleep = func(d time.Duration) { waits = append(waits, d) }
+
+			m := &Migrator{Retries: tt.retries, RetryBackoff: 10}
+			calls := 0
+			err := m.retry("connect", IsTransient, func() error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retry() error = %v, want error %t", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls || !reflect.DeepEqual(waits, tt.wantWaits) {
+				t.Errorf("retry() made %d calls waiting %v, want %d waiting %v", calls, waits, tt.wantCalls, tt.wantWaits)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Lock modes, from least to most restrictive, that a statement is estimated to take
+const (
+	LockShareUpdateExclusive = "SHARE UPDATE EXCLUSIVE"
+	LockShare                = "SHARE"
+	LockShareRowExclusive    = "SHARE ROW EXCLUSIVE"
+	LockExclusive            = "EXCLUSIVE"
+	LockAccessExclusive      = "ACCESS EXCLUSIVE"
+)
+
+// Blocking describes what a lock mode blocks for other sessions
+func Blocking(lock string) string {
+	switch lock {
+	case LockShareUpdateExclusive:
+		return "does not block reads or writes"
+	case LockShare, LockShareRowExclusive, LockExclusive:
+		return "blocks writes"
+	case LockAccessExclusive:
+		return "blocks reads and writes"
+	}
+	return ""
+}
+
+// Finding is a destructive change or a notable lock in a migration statement
+type Finding struct {
+	File        string
+	Line        int
+	Table       string // affected table, index or schema; empty if unknown
+	Destructive string // why the statement may lose data or break running code; empty if not destructive
+	Lock        string // estimated lock mode; empty if none worth reporting
+}
+
+type riskRule struct {
+	pattern     *regexp.Regexp
+	destructive string
+	lock        string
+}
+
+// riskRules are checked in order; the first matching rule classifies a
+// statement. More specific forms (e.g. CONCURRENTLY) come first.
+var riskRules = []riskRule{
+	{regexp.MustCompile(`(?i)^\s*DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?` + identPattern), "drops a table", LockAccessExclusive},
+	{regexp.MustCompile(`(?i)^\s*DROP\s+SCHEMA\s+(?:IF\s+EXISTS\s+)?` + identPattern), "drops a schema", LockAccessExclusive},
+	{regexp.MustCompile(`(?i)^\s*DROP\s+(?:MATERIALIZED\s+)?VIEW\s+(?:IF\s+EXISTS\s+)?` + identPattern), "drops a view", LockAccessExclusive},
+	{regexp.MustCompile(`(?i)^\s*DROP\s+TYPE\s+(?:IF\s+EXISTS\s+)?` + identPattern), "drops a type", LockAccessExclusive},
+	{regexp.MustCompile(`(?i)^\s*TRUNCATE\s+(?:TABLE\s+)?(?:ONLY\s+)?` + identPattern), "truncates a table", LockAccessExclusive},
+	{regexp.MustCompile(`(?i)^\s*DROP\s+INDEX\s+CONCURRENTLY\s+(?:IF\s+EXISTS\s+)?` + identPattern), "", LockShareUpdateExclusive},
+	{regexp.MustCompile(`(?i)^\s*DROP\s+INDEX\s+(?:IF\s+EXISTS\s+)?` + identPattern), "", LockAccessExclusive},
+	{regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern + `\s+(?:.*,\s*)?DROP\s+(?:COLUMN\s+)?(?:IF\s+EXISTS\s+)?(?:"[^"]+"|[A-Za-z_]\w*)\s*(?:,|CASCADE\b|RESTRICT\b|$)`), "drops a column", LockAccessExclusive},
+	{regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern + `.*\bALTER\s+(?:COLUMN\s+)?\S+\s+(?:SET\s+DATA\s+)?TYPE\b`), "changes a column type (rewrites the table)", LockAccessExclusive},
+	{regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern + `.*\bRENAME\b`), "renames a table or column", LockAccessExclusive},
+	{regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern + `\s+VALIDATE\s+CONSTRAINT\b`), "", LockShareUpdateExclusive},
+	{regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern + `.*\bFOREIGN\s+KEY\b`), "", LockShareRowExclusive},
+	{regexp.MustCompile(`(?is)^\s*ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(?:ONLY\s+)?` + identPattern), "", LockAccessExclusive},
+	{regexp.MustCompile(`(?i)^\s*DELETE\s+FROM\s+(?:ONLY\s+)?` + identPattern + `\s*(?:(?:AS\s+)?\w+\s*)?$`), "deletes every row (no WHERE clause)", ""},
+	{regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\s+(?:IF\s+NOT\s+EXISTS\s+)?(?:[\w"]+\s+)?ON\s+(?:ONLY\s+)?` + identPattern), "", LockShareUpdateExclusive},
+	{regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:IF\s+NOT\s+EXISTS\s+)?(?:[\w"]+\s+)?ON\s+(?:ONLY\s+)?` + identPattern), "", LockShare},
+	{regexp.MustCompile(`(?is)^\s*CREATE\s+(?:OR\s+REPLACE\s+)?(?:CONSTRAINT\s+)?TRIGGER\s+.*?\bON\s+(?:ONLY\s+)?` + identPattern), "", LockShareRowExclusive},
+	{regexp.MustCompile(`(?i)^\s*REFRESH\s+MATERIALIZED\s+VIEW\s+CONCURRENTLY\s+` + identPattern), "", LockExclusive},
+	{regexp.MustCompile(`(?i)^\s*REFRESH\s+MATERIALIZED\s+VIEW\s+` + identPattern), "", LockAccessExclusive},
+}
+
+// AssessSQL classifies each statement of a migration by the rules above.
+// Locks are estimates from the statement's shape, not from the server.
+func AssessSQL(file, sql string) []Finding {
+	var findings []Finding
+	for _, stmt := range SplitStatements(sql) {
+		text := stripLeadingComments(stmt.SQL)
+		line := stmt.Line + strings.Count(stmt.SQL[:len(stmt.SQL)-len(text)], "\n")
+		for _, rule := range riskRules {
+			match := rule.pattern.FindStringSubmatch(text)
+			if match == nil {
+				continue
+			}
+			finding := Finding{File: file, Line: line, Destructive: rule.destructive, Lock: rule.lock}
+			if len(match) > 1 && match[1] != "" {
+				finding.Table = normalizeIdent(match[1])
+			}
+			findings = append(findings, finding)
+			break
+		}
+	}
+	return findings
+}
+
+// AssessFile reads a migration file and classifies its statements
+func AssessFile(f File) ([]Finding, error) {
+	content, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", f.Name, err)
+	}
+	return AssessSQL(f.Name, string(content)), nil
+}
+
+// stripLeadingComments drops the comments SplitStatements keeps in front of a statement
+func stripLeadingComments(sql string) string {
+	for {
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			nl := strings.IndexByte(sql, '\n')
+			if nl == -1 {
+				return ""
+			}
+			sql = strings.TrimSpace(sql[nl+1:])
+		case strings.HasPrefix(sql, "/*"):
+			sql = strings.TrimSpace(sql[skipBlockComment(sql, 0):])
+		default:
+			return sql
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package migration
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// Seed executes a SQL file against the database in a single transaction.
+// Seeds are plain SQL and are not tracked like migrations.
+func (m *Migrator) Seed(connStr, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading seed: %w", err)
+	}
+
+	db, err := openDB(connStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	slog.Info("applying seed", "file", path)
+	if _, err := tx.Exec(string(data)); err != nil {
+		return fmt.Errorf("applying seed %s: %w", path, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("applying seed %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// File is a migration file found in a migrations directory
+type File struct {
+	Version    uint
+	Identifier string // description part of the file name, e.g. "add_users"
+	Direction  string // "up" or "down"
+	Name       string // base file name
+	Path       string // absolute path
+}
+
+// ListFiles enumerates the migration files in a directory using golang-migrate's
+// naming rules (<version>_<identifier>.<up|down>.<ext>), sorted by version then direction.
+// Files that don't match the pattern are ignored, as golang-migrate does.
+func ListFiles(migrationsPath string) ([]File, error) {
+	entries, err := os.ReadDir(migrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations directory: %w", err)
+	}
+
+	var files []File
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		m, err := source.Parse(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		files = append(files, File{
+			Version:    m.Version,
+			Identifier: m.Identifier,
+			Direction:  string(m.Direction),
+			Name:       entry.Name(),
+			Path:       filepath.Join(migrationsPath, entry.Name()),
+		})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Version != files[j].Version {
+			return files[i].Version < files[j].Version
+		}
+		// "down" sorts before "up"
+		return files[i].Direction < files[j].Direction
+	})
+
+	return files, nil
+}
+
+// openSource opens a migrations directory as a golang-migrate source. The
+// directory is read through io/fs rather than golang-migrate's file:// driver,
+// which cannot parse Windows drive-letter URLs.
+func openSource(migrationsPath string) (source.Driver, error) {
+	abs, err := filepath.Abs(migrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolving migrations path: %w", err)
+	}
+	src, err := iofs.New(os.DirFS(abs), ".")
+	if err != nil {
+		return nil, fmt.Errorf("opening migrations source %s: %w", BuildSourceURL(abs), err)
+	}
+	return src, nil
+}
+
+// UpFiles filters files to up migrations
+func UpFiles(files []File) []File {
+	var up []File
+	for _, f := range files {
+		if f.Direction == string(source.Up) {
+			up = append(up, f)
+		}
+	}
+	return up
+}
@@ -0,0 +1,179 @@
+package migration
+
+import (
+	"strings"
+)
+
+// Statement is a single SQL statement split out of a migration file
+type Statement struct {
+	SQL    string
+	Offset int // byte offset of the statement in the original content
+	Line   int // 1-based line where the statement starts
+}
+
+// SplitStatements splits SQL into individual statements on top-level semicolons.
+// It understands single-quoted strings, E'...' strings with backslash
+// escapes, quoted identifiers, dollar-quoted bodies, and line/block comments,
+// so function bodies and string literals containing semicolons are kept
+// intact. Empty statements are dropped.
+func SplitStatements(sql string) []Statement {
+	var (
+		statements []Statement
+		start      int
+		i          int
+	)
+
+	emit := func(end int) {
+		text := sql[start:end]
+		trimmed := strings.TrimSpace(text)
+		if trimmed != "" && !onlyComments(trimmed) {
+			lead := len(text) - len(strings.TrimLeft(text, " \t\r\n"))
+			offset := start + lead
+			statements = append(statements, Statement{
+				SQL:    trimmed,
+				Offset: offset,
+				Line:   strings.Count(sql[:offset], "\n") + 1,
+			})
+		}
+	}
+
+	for i < len(sql) {
+		switch c := sql[i]; {
+		case c == '\'' && escapeStringPrefix(sql, i):
+			i = skipEscapeString(sql, i)
+		case c == '\'' || c == '"':
+			i = skipQuoted(sql, i, c)
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if nl := strings.IndexByte(sql[i:], '\n'); nl != -1 {
+				i += nl + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		case c == '$':
+			i = skipDollarQuoted(sql, i)
+		case c == ';':
+			emit(i)
+			i++
+			start = i
+		default:
+			i++
+		}
+	}
+	emit(len(sql))
+
+	return statements
+}
+
+// skipQuoted returns the index just past a quoted string or identifier starting at i.
+// Doubled quote characters are escapes.
+func skipQuoted(sql string, i int, quote byte) int {
+	i++
+	for i < len(sql) {
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(sql)
+}
+
+// escapeStringPrefix reports whether the quote at i opens an E'...' string: it
+// follows an E or e that does not end a longer identifier
+func escapeStringPrefix(sql string, i int) bool {
+	if i == 0 || (sql[i-1] != 'E' && sql[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentChar(sql[i-2])
+}
+
+// skipEscapeString returns the index just past an E'...' string whose quote is
+// at i. A backslash escapes the next character, as does a doubled quote.
+func skipEscapeString(sql string, i int) int {
+	i++
+	for i < len(sql) {
+		switch {
+		case sql[i] == '\\':
+			i += 2
+		case sql[i] == '\'' && i+1 < len(sql) && sql[i+1] == '\'':
+			i += 2
+		case sql[i] == '\'':
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the index just past a (possibly nested) /* */ comment at i
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for i < len(sql) {
+		switch {
+		case strings.HasPrefix(sql[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(sql[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(sql)
+}
+
+// skipDollarQuoted returns the index just past a $tag$...$tag$ body at i,
+// or i+1 if the dollar sign does not open a dollar quote (e.g. a $1 parameter)
+func skipDollarQuoted(sql string, i int) int {
+	end := i + 1
+	for end < len(sql) && (isIdentChar(sql[end])) {
+		end++
+	}
+	if end >= len(sql) || sql[end] != '$' {
+		return i + 1
+	}
+	// Tags cannot start with a digit
+	if end > i+1 && sql[i+1] >= '0' && sql[i+1] <= '9' {
+		return i + 1
+	}
+
+	tag := sql[i : end+1]
+	closing := strings.Index(sql[end+1:], tag)
+	if closing == -1 {
+		return len(sql)
+	}
+	return end + 1 + closing + len(tag)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// onlyComments reports whether a trimmed chunk of SQL contains nothing but comments
+func onlyComments(sql string) bool {
+	for sql != "" {
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			nl := strings.IndexByte(sql, '\n')
+			if nl == -1 {
+				return true
+			}
+			sql = strings.TrimSpace(sql[nl+1:])
+		case strings.HasPrefix(sql, "/*"):
+			sql = strings.TrimSpace(sql[skipBlockComment(sql, 0):])
+		default:
+			return false
+		}
+	}
+	return true
+}
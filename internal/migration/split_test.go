@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "plain",
+			sql:  "CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n",
+			want: []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"},
+		},
+		{
+			name: "trailing statement without semicolon",
+			sql:  "SELECT 1;\nSELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "string with semicolon and doubled quote",
+			sql:  "INSERT INTO t VALUES ('a;b''c');SELECT 1;",
+			want: []string{"INSERT INTO t VALUES ('a;b''c')", "SELECT 1"},
+		},
+		{
+			name: "E string with escaped quote",
+			sql:  `INSERT INTO t VALUES (E'it\'s; fine');SELECT 1;`,
+			want: []string{`INSERT INTO t VALUES (E'it\'s; fine')`, "SELECT 1"},
+		},
+		{
+			name: "lowercase e string ending in escaped backslash",
+			sql:  `SELECT e'a\\';SELECT 2;`,
+			want: []string{`SELECT e'a\\'`, "SELECT 2"},
+		},
+		{
+			name: "identifier ending in e before a string",
+			sql:  `SELECT name'x\';SELECT 2;`,
+			want: []string{`SELECT name'x\'`, "SELECT 2"},
+		},
+		{
+			name: "quoted identifier containing semicolon",
+			sql:  `CREATE TABLE "a;b" (id int);SELECT 1;`,
+			want: []string{`CREATE TABLE "a;b" (id int)`, "SELECT 1"},
+		},
+		{
+			name: "dollar-quoted function body",
+			sql:  "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;\nSELECT f();",
+			want: []string{"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql", "SELECT f()"},
+		},
+		{
+			name: "tagged dollar quote containing $$",
+			sql:  "DO $body$ BEGIN PERFORM '$$;'; END $body$;SELECT 1;",
+			want: []string{"DO $body$ BEGIN PERFORM '$$;'; END $body$", "SELECT 1"},
+		},
+		{
+			name: "positional parameter is not a dollar quote",
+			sql:  "PREPARE p AS SELECT $1;SELECT 2;",
+			want: []string{"PREPARE p AS SELECT $1", "SELECT 2"},
+		},
+		{
+			name: "nested block comment",
+			sql:  "/* outer /* inner; */ still comment; */ SELECT 1;SELECT 2;",
+			want: []string{"/* outer /* inner; */ still comment; */ SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "line comment with semicolon",
+			sql:  "SELECT 1 -- not here;\n;SELECT 2;",
+			want: []string{"SELECT 1 -- not here;", "SELECT 2"},
+		},
+		{
+			name: "comment-only chunks are dropped",
+			sql:  "SELECT 1;\n-- trailing note\n;/* nothing */;",
+			want: []string{"SELECT 1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, stmt := range SplitStatements(tt.sql) {
+				got = append(got, stmt.SQL)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SplitStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatementsPositions(t *testing.T) {
+	sql := "SELECT 1;\n\n  SELECT 2;"
+	got := SplitStatements(sql)
+	if len(got) != 2 {
+		t.Fatalf("got %d statements, want 2", len(got))
+	}
+	if got[1].Offset != 13 || got[1].Line != 3 {
+		t.Errorf("second statement at offset %d line %d, want offset 13 line 3", got[1].Offset, got[1].Line)
+	}
+}
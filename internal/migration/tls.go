@@ -0,0 +1,103 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// tlsFiles holds inline PEM material written out for lib/pq, which only
+// reads certificates and keys from files
+var tlsFiles struct {
+	sync.Mutex
+	dir   string
+	paths map[string]string // by content hash
+	users map[string]int    // by path: connection strings not yet released
+}
+
+// tlsFile returns a path lib/pq can read value from: value itself when it is
+// a path, or a private temporary file holding it when it is inline PEM
+func tlsFile(kind, value string) (string, error) {
+	if !strings.Contains(value, "-----BEGIN") {
+		return value, nil
+	}
+
+	tlsFiles.Lock()
+	defer tlsFiles.Unlock()
+
+	sum := sha256.Sum256([]byte(value))
+	key := hex.EncodeToString(sum[:8])
+	if path, ok := tlsFiles.paths[key]; ok {
+		tlsFiles.users[path]++
+		return path, nil
+	}
+	if tlsFiles.dir == "" {
+		dir, err := os.MkdirTemp("", "encore-migrator-tls-")
+		if err != nil {
+			return "", fmt.Errorf("creating directory for %s: %w", kind, err)
+		}
+		tlsFiles.dir = dir
+		tlsFiles.paths = make(map[string]string)
+		tlsFiles.users = make(map[string]int)
+	}
+
+	// lib/pq refuses keys readable by group or others
+	path := filepath.Join(tlsFiles.dir, kind+"-"+key+".pem")
+	if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+		return "", fmt.Errorf("writing %s: %w", kind, err)
+	}
+	tlsFiles.paths[key] = path
+	tlsFiles.users[path] = 1
+	return path, nil
+}
+
+// releaseTLSFile drops one use of a file written by tlsFile, deleting it after
+// the last; paths tlsFile did not write are left alone
+func releaseTLSFile(path string) {
+	tlsFiles.Lock()
+	defer tlsFiles.Unlock()
+
+	n, ok := tlsFiles.users[path]
+	if !ok {
+		return
+	}
+	if n > 1 {
+		tlsFiles.users[path] = n - 1
+		return
+	}
+	os.Remove(path)
+	delete(tlsFiles.users, path)
+	for key, p := range tlsFiles.paths {
+		if p == path {
+			delete(tlsFiles.paths, key)
+		}
+	}
+}
+
+// RemoveTLSFiles deletes the temporary files written for inline PEM material
+func RemoveTLSFiles() {
+	tlsFiles.Lock()
+	defer tlsFiles.Unlock()
+
+	if tlsFiles.dir != "" {
+		os.RemoveAll(tlsFiles.dir)
+		tlsFiles.dir, tlsFiles.paths, tlsFiles.users = "", nil, nil
+	}
+}
+
+// ParseTLSVersion parses a minimum TLS version, "1.2" or "1.3". Older
+// versions are not offered: Go clients never negotiate them.
+func ParseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported minimum TLS version %q (want 1.2 or 1.3)", v)
+}
@@ -0,0 +1,127 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// TrackingState is what a database records about its migrations: the
+// golang-migrate version row and the history table
+type TrackingState struct {
+	Version uint           `json:"version"` // 0 when no migration was applied
+	Dirty   bool           `json:"dirty"`
+	History []HistoryEntry `json:"history"` // oldest first
+}
+
+// ExportTracking reads a database's tracking state. versionTable names the
+// golang-migrate version table to read, schema_migrations if empty, so state
+// can be taken from a differently named table.
+func (m *Migrator) ExportTracking(connStr, versionTable string) (*TrackingState, error) {
+	table := m.session.versionTable()
+	if versionTable != "" {
+		table = pq.QuoteIdentifier(versionTable)
+		if m.session.Schema != "" {
+			table = pq.QuoteIdentifier(m.session.Schema) + "." + table
+		}
+	}
+
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	defer db.Close()
+
+	version, dirty, err := readVersion(db, table)
+	if err != nil {
+		return nil, err
+	}
+	history, err := m.History(connStr, 0)
+	if err != nil {
+		return nil, err
+	}
+	// History lists newest first; restore order is oldest first
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	if history == nil {
+		history = []HistoryEntry{}
+	}
+	return &TrackingState{Version: version, Dirty: dirty, History: history}, nil
+}
+
+// ImportTracking writes a tracking state into a database in one transaction,
+// creating the version and history tables as needed. Unless overwrite is
+// set it refuses a database that already has a version or history rows.
+func (m *Migrator) ImportTracking(connStr string, state TrackingState, overwrite bool) error {
+	ctx := context.Background()
+	db, conn, err := m.sessionConn(ctx, connStr)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	defer conn.Close()
+
+	versionTable := m.session.versionTable()
+	history := m.session.qualifiedHistoryTable()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The version table as golang-migrate's postgres driver creates it
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`); err != nil {
+		return fmt.Errorf("creating %s: %w", migrationsTable, err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(createHistoryTable, history)); err != nil {
+		return fmt.Errorf("creating %s: %w", historyTable, err)
+	}
+
+	if !overwrite {
+		var versions, runs int
+		if err := tx.QueryRowContext(ctx, `SELECT (SELECT count(*) FROM `+versionTable+`), (SELECT count(*) FROM `+history+`)`).Scan(&versions, &runs); err != nil {
+			return fmt.Errorf("checking existing state: %w", err)
+		}
+		if versions > 0 || runs > 0 {
+			return fmt.Errorf("database already has migration state (%d version rows, %d history rows); pass --overwrite to replace it", versions, runs)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+versionTable); err != nil {
+		return fmt.Errorf("clearing %s: %w", migrationsTable, err)
+	}
+	if state.Version > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+versionTable+` (version, dirty) VALUES ($1, $2)`, int64(state.Version), state.Dirty); err != nil {
+			return fmt.Errorf("writing %s: %w", migrationsTable, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+history); err != nil {
+		return fmt.Errorf("clearing %s: %w", historyTable, err)
+	}
+	for _, e := range state.History {
+		var message sql.NullString
+		if e.Error != "" {
+			message = sql.NullString{String: e.Error, Valid: true}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO `+history+`
+			(run_id, started_at, direction, version_before, version_after, duration_ms, succeeded, error, operator, git_sha, tool_version, ticket)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+			e.RunID, e.StartedAt, e.Direction, int64(e.VersionBefore), int64(e.VersionAfter), e.DurationMS, e.Succeeded, message,
+			nullable(e.Operator), nullable(e.GitSHA), nullable(e.ToolVersion), nullable(e.Ticket))
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", historyTable, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// VerificationError indicates the version read back on a fresh connection
+// does not match what the migration reported
+type VerificationError struct {
+	Expected uint
+	Actual   uint
+	Dirty    bool
+	Server   types.ServerInfo
+	// Migrated is the server the migration connection ran on, if known
+	Migrated *types.ServerInfo
+}
+
+func (e *VerificationError) Error() string {
+	if e.Migrated == nil {
+		return fmt.Sprintf("read-back verification failed: expected version %d (clean), fresh connection saw version %d (dirty=%t) on %s; "+
+			"the migration may have been routed to a different server (connection pooler or replica)",
+			e.Expected, e.Actual, e.Dirty, e.Server)
+	}
+	return fmt.Sprintf("read-back verification failed: migrated to version %d on %s, but a fresh connection saw version %d (dirty=%t) on %s; "+
+		"the migration may have been routed to a different server (connection pooler or replica)",
+		e.Expected, e.Migrated, e.Actual, e.Dirty, e.Server)
+}
+
+// VerifyVersion opens a fresh connection and checks that schema_migrations
+// reports the version result migrated to and is not dirty. A mismatch names
+// both the server result's migrations ran on and the one that answered.
+func (m *Migrator) VerifyVersion(connStr string, result *types.MigrationResult) (*types.ServerInfo, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	info, err := queryServerInfo(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+
+	version, dirty, err := readVersion(db, m.session.versionTable())
+	if err != nil {
+		return info, err
+	}
+
+	slog.Debug("read-back verification",
+		"expected_version", result.VersionAfter,
+		"version", version,
+		"dirty", dirty,
+		"server", info.String(),
+		"migration_server", result.Server,
+	)
+
+	if version != result.VersionAfter || dirty {
+		return info, &VerificationError{
+			Expected: result.VersionAfter,
+			Actual:   version,
+			Dirty:    dirty,
+			Server:   *info,
+			Migrated: result.Server,
+		}
+	}
+
+	return info, nil
+}
+
+// Ping connects to the database and reports which server answered
+func (m *Migrator) Ping(connStr string) (*types.ServerInfo, error) {
+	db, err := openDB(connStr)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return queryServerInfo(context.Background(), db)
+}
+
+// queryServerInfo reports which server the connection landed on; conn is a
+// pool or, for the migration connection, a single *sql.Conn
+func queryServerInfo(ctx context.Context, conn interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) (*types.ServerInfo, error) {
+	var (
+		addr sql.NullString
+		port sql.NullInt64
+		info types.ServerInfo
+	)
+	err := conn.QueryRowContext(ctx, `SELECT host(inet_server_addr()), inet_server_port(), pg_is_in_recovery(), pg_backend_pid()`).
+		Scan(&addr, &port, &info.InRecovery, &info.BackendPID)
+	if err != nil {
+		return nil, fmt.Errorf("querying server info: %w", err)
+	}
+
+	info.Addr = addr.String
+	info.Port = int(port.Int64)
+	return &info, nil
+}
@@ -0,0 +1,25 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+func TestVerificationErrorNamesBothServers(t *testing.T) {
+	primary := types.ServerInfo{Addr: "10.0.0.5", Port: 5432, BackendPID: 101}
+	replica := types.ServerInfo{Addr: "10.0.0.6", Port: 5432, InRecovery: true, BackendPID: 202}
+
+	err := &VerificationError{Expected: 7, Actual: 6, Server: replica, Migrated: &primary}
+	for _, want := range []string{"migrated to version 7 on 10.0.0.5:5432 (primary, backend pid 101)", "version 6 (dirty=false) on 10.0.0.6:5432 (replica, backend pid 202)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error() = %q, want it to contain %q", err.Error(), want)
+		}
+	}
+
+	err = &VerificationError{Expected: 7, Actual: 6, Server: replica}
+	if want := "expected version 7 (clean), fresh connection saw version 6 (dirty=false) on 10.0.0.6:5432 (replica, backend pid 202)"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Error() without the migration server = %q, want it to contain %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,51 @@
+// Package offline forbids network access other than database connections,
+// for runs in air-gapped environments. Features that would reach a secret
+// manager, registry or web service check Enabled and fail up front; the HTTP
+// transport is also replaced so nothing slips through unnoticed.
+package offline
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+var enabled atomic.Bool
+
+// Enable turns offline mode on for the rest of the process
+func Enable() {
+	enabled.Store(true)
+	http.DefaultTransport = transport{}
+}
+
+// Enabled reports whether offline mode is on
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Error reports something that needs the network while offline
+type Error struct {
+	What string // e.g. "Secret Manager secret projects/p/secrets/s/versions/1"
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s needs network access, which --offline forbids", e.What)
+}
+
+// Check returns an *Error for what when offline mode is on
+func Check(what string) error {
+	if Enabled() {
+		return &Error{What: what}
+	}
+	return nil
+}
+
+// transport fails every HTTP request
+type transport struct{}
+
+func (transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, &Error{What: "request to " + req.URL.Host}
+}
@@ -0,0 +1,65 @@
+// Package pause asks an admin endpoint to pause and resume Encore cron jobs
+// and PubSub subscriptions around migrations.
+package pause
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// requestTimeout bounds how long a pause or resume request may take
+const requestTimeout = 10 * time.Second
+
+// Actions of a Request
+const (
+	ActionPause  = "pause"
+	ActionResume = "resume"
+)
+
+// Request is the JSON body posted to the endpoint for each resource
+type Request struct {
+	Action   string   `json:"action"`          // ActionPause or ActionResume
+	Kind     string   `json:"kind"`            // cron or subscription
+	Name     string   `json:"name"`            // cron job ID or subscription name
+	Topic    string   `json:"topic,omitempty"` // topic expression of a subscription
+	Database string   `json:"database"`        // Encore database being migrated
+	Tables   []string `json:"tables"`          // tables the migrations touch
+	RunID    string   `json:"run_id"`
+}
+
+// Post sends the request as JSON to url and fails unless it gets a 2xx
+// response. Environment variables in url and header values are expanded.
+func Post(ctx context.Context, url string, headers map[string]string, r Request) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding %s request: %w", r.Action, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(url), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating %s request: %w", r.Action, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s %s: %w", r.Action, r.Kind, r.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s %s: unexpected status %s", r.Action, r.Kind, r.Name, resp.Status)
+	}
+	return nil
+}
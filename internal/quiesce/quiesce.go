@@ -0,0 +1,57 @@
+// Package quiesce calls the endpoints that drain and resume the writers of a
+// database around its migrations.
+package quiesce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Notice is the JSON body posted to the quiesce and resume endpoints
+type Notice struct {
+	Database    string `json:"database"`    // Encore database name
+	PGDatabase  string `json:"pg_database"` // PostgreSQL database name
+	Direction   string `json:"direction"`   // up or down
+	RunID       string `json:"run_id"`
+	FromVersion uint   `json:"from_version"`
+	ToVersion   uint   `json:"to_version"`          // planned version; after a failure the database may be elsewhere
+	Succeeded   *bool  `json:"succeeded,omitempty"` // set when resuming
+}
+
+// Post sends the notice as JSON to url, with the header set to value when
+// both are given, and fails unless it gets a 2xx response within timeout.
+// Environment variables in url are expanded.
+func Post(ctx context.Context, url, header, value string, timeout time.Duration, n Notice) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("encoding notice: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(url), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" && value != "" {
+		req.Header.Set(header, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
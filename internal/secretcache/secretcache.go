@@ -0,0 +1,76 @@
+// Package secretcache resolves each secret reference once per run, however
+// many databases share it: concurrent lookups of the same reference wait for
+// one fetch, and its value is reused until the TTL set with SetTTL passes.
+// Failed fetches aren't cached, so a later lookup tries again.
+package secretcache
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	mu      sync.Mutex
+	ttl     time.Duration // zero keeps values for the life of the process
+	entries = map[string]*entry{}
+)
+
+// entry is a fetched or in-flight value; done is closed once it is set
+type entry struct {
+	done    chan struct{}
+	value   string
+	err     error
+	fetched time.Time
+}
+
+// SetTTL sets how long values are reused; zero, the default, reuses them
+// for the rest of the run
+func SetTTL(d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	ttl = d
+}
+
+// Get returns the value cached for key, calling fetch if there is none or
+// it expired. key names the reference, e.g. "gcp_secret:projects/...", and
+// is logged; values never are.
+func Get(key string, fetch func() (string, error)) (string, error) {
+	mu.Lock()
+	e, ok := entries[key]
+	if ok && !expired(e) {
+		mu.Unlock()
+		<-e.done
+		if e.err == nil {
+			slog.Debug("secret reused", "ref", key)
+		}
+		return e.value, e.err
+	}
+	e = &entry{done: make(chan struct{})}
+	entries[key] = e
+	mu.Unlock()
+
+	e.value, e.err = fetch()
+	e.fetched = time.Now()
+	if e.err != nil {
+		mu.Lock()
+		if entries[key] == e {
+			delete(entries, key)
+		}
+		mu.Unlock()
+	} else {
+		slog.Debug("secret fetched", "ref", key)
+	}
+	close(e.done)
+	return e.value, e.err
+}
+
+// expired reports whether a completed entry is older than the TTL; mu is held
+func expired(e *entry) bool {
+	select {
+	case <-e.done:
+		return ttl > 0 && time.Since(e.fetched) > ttl
+	default:
+		return false // still being fetched
+	}
+}
@@ -0,0 +1,106 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SchemaDir is the default directory of schema snapshots in the app root.
+// Each environment gets a subdirectory named after its InfraConfig file.
+const SchemaDir = "encore-migrate-schemas"
+
+// schemaHeader starts every schema snapshot, followed by "-- key: value" lines
+const schemaHeader = "-- encore-migrate schema snapshot"
+
+// Schema is a database's schema as captured from an environment, with the
+// migration version it was at
+type Schema struct {
+	Database   string // Encore database name
+	Version    uint
+	Dirty      bool
+	CapturedAt time.Time
+	SQL        []byte // plain SQL restoring the schema, without data
+}
+
+// EnvironmentDir returns the schema snapshot directory of the environment
+// an InfraConfig describes, e.g. <dir>/prod for prod.json
+func EnvironmentDir(dir, infraConfigPath string) string {
+	base := filepath.Base(infraConfigPath)
+	return filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// SchemaPath returns the file of a database's schema snapshot in dir
+func SchemaPath(dir, database string) string {
+	return filepath.Join(dir, database+".sql")
+}
+
+// LoadSchema reads a schema snapshot. A missing file yields (nil, nil).
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading schema snapshot: %w", err)
+	}
+	return ParseSchema(data, path)
+}
+
+// ParseSchema decodes schema snapshot content, e.g. from an older commit;
+// path is used in errors
+func ParseSchema(data []byte, path string) (*Schema, error) {
+	header, body, _ := bytes.Cut(data, []byte("\n\n"))
+	lines := bufio.NewScanner(bytes.NewReader(header))
+	if !lines.Scan() || lines.Text() != schemaHeader {
+		return nil, fmt.Errorf("%s is not a schema snapshot", path)
+	}
+	s := &Schema{SQL: body}
+	for lines.Scan() {
+		key, value, ok := strings.Cut(strings.TrimPrefix(lines.Text(), "-- "), ": ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "database":
+			s.Database = value
+		case "version":
+			version, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid version %q", path, value)
+			}
+			s.Version = uint(version)
+		case "dirty":
+			s.Dirty = value == "true"
+		case "captured_at":
+			captured, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid captured_at %q", path, value)
+			}
+			s.CapturedAt = captured
+		}
+	}
+	return s, nil
+}
+
+// Write saves the schema snapshot, creating its directory
+func (s *Schema) Write(path string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n-- database: %s\n-- version: %d\n-- dirty: %t\n-- captured_at: %s\n\n",
+		schemaHeader, s.Database, s.Version, s.Dirty, s.CapturedAt.UTC().Format(time.RFC3339))
+	buf.Write(s.SQL)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("writing schema snapshot: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("writing schema snapshot: %w", err)
+	}
+	return nil
+}
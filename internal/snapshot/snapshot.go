@@ -0,0 +1,123 @@
+// Package snapshot maintains the committed lockfile recording the latest
+// migration of every database, so schema changes stand out in review, and
+// the schema snapshots captured from each environment for simulate.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/types"
+)
+
+// FileName is the lockfile's name in the app root
+const FileName = "encore-migrate.lock.json"
+
+// SchemaVersion is bumped on incompatible changes to the lockfile format
+const SchemaVersion = 1
+
+// Snapshot is the lockfile content
+type Snapshot struct {
+	SchemaVersion int                 `json:"schema_version"`
+	Databases     map[string]Database `json:"databases"` // key is Encore DB name
+}
+
+// Database records the latest migration present in the repository
+type Database struct {
+	Version    uint   `json:"version"`
+	File       string `json:"file,omitempty"` // latest up migration file name
+	Migrations int    `json:"migrations"`     // number of up migrations
+}
+
+// Build snapshots the migrations currently on disk
+func Build(databases []types.EncoreDatabase) (*Snapshot, error) {
+	s := &Snapshot{SchemaVersion: SchemaVersion, Databases: make(map[string]Database)}
+	for _, db := range databases {
+		files, err := migration.ListFiles(db.MigrationsPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", db.Name, err)
+		}
+		up := migration.UpFiles(files)
+
+		entry := Database{Migrations: len(up)}
+		if len(up) > 0 {
+			latest := up[len(up)-1]
+			entry.Version = latest.Version
+			entry.File = latest.Name
+		}
+		s.Databases[db.Name] = entry
+	}
+	return s, nil
+}
+
+// Load reads a lockfile. A missing file yields (nil, nil).
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading lockfile: %w", err)
+	}
+	return Parse(data, path)
+}
+
+// Parse decodes lockfile content, e.g. from an older commit; path is used in errors
+func Parse(data []byte, path string) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing lockfile %s: %w", path, err)
+	}
+	if s.SchemaVersion != SchemaVersion {
+		return nil, fmt.Errorf("lockfile %s has schema_version %d, expected %d", path, s.SchemaVersion, SchemaVersion)
+	}
+	return &s, nil
+}
+
+// Write saves the lockfile. Map keys are sorted by encoding/json, so output is stable.
+func (s *Snapshot) Write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling lockfile: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing lockfile: %w", err)
+	}
+	return nil
+}
+
+// Diff describes how the migrations on disk differ from the committed snapshot,
+// one line per database, sorted by name. It is empty when they match.
+func Diff(committed, current *Snapshot) []string {
+	names := make(map[string]bool)
+	for name := range committed.Databases {
+		names[name] = true
+	}
+	for name := range current.Databases {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diff []string
+	for _, name := range sorted {
+		was, inCommitted := committed.Databases[name]
+		now, inCurrent := current.Databases[name]
+		switch {
+		case !inCommitted:
+			diff = append(diff, fmt.Sprintf("%s: new database at version %d", name, now.Version))
+		case !inCurrent:
+			diff = append(diff, fmt.Sprintf("%s: database removed (was at version %d)", name, was.Version))
+		case was != now:
+			diff = append(diff, fmt.Sprintf("%s: version %d (%d migrations) -> %d (%d migrations)", name, was.Version, was.Migrations, now.Version, now.Migrations))
+		}
+	}
+	return diff
+}
@@ -0,0 +1,289 @@
+// Package sshtunnel reaches databases behind an SSH bastion by running the
+// system ssh client with a local port forward per database server, so keys,
+// agents, known_hosts and ~/.ssh/config work exactly as they do for ssh.
+package sshtunnel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartTimeout bounds how long ssh may take to authenticate and forward
+const StartTimeout = 30 * time.Second
+
+// Bastion is an SSH server parsed from user@host[:port]; User and Port are
+// optional and default to ssh's own configuration
+type Bastion struct {
+	User string
+	Host string
+	Port string
+}
+
+// ParseBastion parses user@host[:port]. IPv6 hosts with a port are bracketed.
+func ParseBastion(target string) (Bastion, error) {
+	var b Bastion
+	hostPort := target
+	if i := strings.LastIndex(target, "@"); i >= 0 {
+		b.User, hostPort = target[:i], target[i+1:]
+		if b.User == "" {
+			return Bastion{}, fmt.Errorf("invalid SSH bastion %q: empty user", target)
+		}
+	}
+
+	b.Host = hostPort
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return Bastion{}, fmt.Errorf("invalid SSH bastion %q: bad port %q", target, port)
+		}
+		b.Host, b.Port = host, port
+	} else if strings.Count(hostPort, ":") == 1 {
+		return Bastion{}, fmt.Errorf("invalid SSH bastion %q: %w", target, err)
+	}
+	b.Host = strings.Trim(b.Host, "[]")
+	if b.Host == "" {
+		return Bastion{}, fmt.Errorf("invalid SSH bastion %q (want user@host[:port])", target)
+	}
+	return b, nil
+}
+
+func (b Bastion) String() string {
+	s := b.Host
+	if b.Port != "" {
+		s = net.JoinHostPort(b.Host, b.Port)
+	}
+	if b.User != "" {
+		s = b.User + "@" + s
+	}
+	return s
+}
+
+// Dialer connects through a port forward on the bastion. It implements
+// lib/pq's Dialer and DialerContext; the address lib/pq asks for is the
+// database server as seen from the bastion, so TLS still verifies its name.
+type Dialer struct {
+	Bastion Bastion
+	// IdentityFile is a private key; when set, ssh offers only this key
+	IdentityFile string
+	// NoAgent stops ssh from offering keys held by ssh-agent
+	NoAgent bool
+	// Options are extra ssh -o options, e.g. StrictHostKeyChecking=accept-new
+	Options []string
+}
+
+// Dial implements pq.Dialer
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements pq.Dialer
+func (d *Dialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext
+func (d *Dialer) DialContext(ctx context.Context, _, address string) (net.Conn, error) {
+	local, err := d.forward(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	var nd net.Dialer
+	conn, err := nd.DialContext(ctx, "tcp", local)
+	if err != nil {
+		return nil, fmt.Errorf("dialing SSH tunnel to %s via %s: %w", address, d.Bastion, err)
+	}
+	return conn, nil
+}
+
+// tunnel is a running ssh process forwarding a local port
+type tunnel struct {
+	local  string
+	cmd    *exec.Cmd
+	done   chan struct{} // closed when ssh exits
+	stderr bytes.Buffer  // read only after done is closed
+}
+
+var (
+	tunnelsMu sync.Mutex
+	tunnels   = map[string]*tunnel{} // by ssh arguments and remote address
+	holds     = map[string]int{}     // likewise: users that have not released
+)
+
+// key identifies the tunnel to remote among those of every dialer
+func (d *Dialer) key(remote string) string {
+	return strings.Join(d.args(), "\x00") + "\x00" + remote
+}
+
+// forward returns the local address of a tunnel to remote, starting ssh
+// unless a running tunnel with the same settings exists
+func (d *Dialer) forward(ctx context.Context, remote string) (string, error) {
+	remoteHost, remotePort, err := net.SplitHostPort(remote)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(remoteHost, ":") {
+		remoteHost = "[" + remoteHost + "]"
+	}
+
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	args := d.args()
+	key := d.key(remote)
+	if t, ok := tunnels[key]; ok {
+		select {
+		case <-t.done:
+			delete(tunnels, key) // ssh exited, e.g. the connection dropped; start a new one
+		default:
+			return t.local, nil
+		}
+	}
+
+	local, err := freeLocalAddr()
+	if err != nil {
+		return "", fmt.Errorf("reserving a local port for the SSH tunnel: %w", err)
+	}
+	_, localPort, _ := net.SplitHostPort(local)
+	args = append(args, "-L", "127.0.0.1:"+localPort+":"+remoteHost+":"+remotePort, d.Bastion.target())
+
+	t := &tunnel{local: local, done: make(chan struct{})}
+	t.cmd = exec.Command("ssh", args...)
+	t.cmd.Stderr = &t.stderr
+	if err := t.cmd.Start(); err != nil {
+		return "", fmt.Errorf("starting ssh: %w", err)
+	}
+	go func() {
+		t.cmd.Wait()
+		close(t.done)
+	}()
+
+	if err := t.wait(ctx); err != nil {
+		t.stop()
+		return "", fmt.Errorf("SSH tunnel to %s via %s: %w", remote, d.Bastion, err)
+	}
+	tunnels[key] = t
+	return local, nil
+}
+
+// args are the ssh options shared by every tunnel of this dialer. BatchMode
+// makes ssh fail instead of prompting for passwords or unknown host keys.
+func (d *Dialer) args() []string {
+	args := []string{"-N",
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+	}
+	if d.Bastion.Port != "" {
+		args = append(args, "-p", d.Bastion.Port)
+	}
+	if d.IdentityFile != "" {
+		args = append(args, "-i", d.IdentityFile, "-o", "IdentitiesOnly=yes")
+	}
+	if d.NoAgent {
+		args = append(args, "-o", "IdentityAgent=none")
+	}
+	for _, opt := range d.Options {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
+
+func (b Bastion) target() string {
+	if b.User != "" {
+		return b.User + "@" + b.Host
+	}
+	return b.Host
+}
+
+// wait blocks until the forwarded port accepts connections
+func (t *tunnel) wait(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, StartTimeout)
+	defer cancel()
+	for {
+		select {
+		case <-t.done:
+			msg := strings.TrimSpace(t.stderr.String())
+			if msg == "" {
+				msg = t.cmd.ProcessState.String()
+			}
+			return fmt.Errorf("ssh exited: %s", msg)
+		default:
+		}
+
+		conn, err := net.DialTimeout("tcp", t.local, 200*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.New("timed out waiting for ssh to forward the port")
+			}
+			return ctx.Err()
+		case <-t.done:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (t *tunnel) stop() {
+	t.cmd.Process.Kill()
+	<-t.done
+}
+
+// freeLocalAddr picks an unused loopback port for ssh to listen on
+func freeLocalAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// Hold marks the tunnel to remote as in use until a matching Release, so a
+// Release by another user doesn't stop it. The tunnel still starts on the
+// first dial.
+func (d *Dialer) Hold(remote string) {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	holds[d.key(remote)]++
+}
+
+// Release ends a Hold, stopping the tunnel to remote after the last one
+func (d *Dialer) Release(remote string) {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	key := d.key(remote)
+	if holds[key] > 1 {
+		holds[key]--
+		return
+	}
+	delete(holds, key)
+	if t, ok := tunnels[key]; ok {
+		t.stop()
+		delete(tunnels, key)
+	}
+	clear(holds)
+}
+
+// CloseAll stops every tunnel this process started
+func CloseAll() {
+	tunnelsMu.Lock()
+	defer tunnelsMu.Unlock()
+	for key, t := range tunnels {
+		t.stop()
+		delete(tunnels, key)
+	}
+	clear(holds)
+}
@@ -0,0 +1,178 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockFileName is the name of the run lock file inside the state directory
+const lockFileName = "lock"
+
+// LockInfo describes the process holding the run lock
+type LockInfo struct {
+	PID       int       `json:"pid"`
+	Hostname  string    `json:"hostname"`
+	Command   string    `json:"command"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// LockedError indicates another live process holds the run lock
+type LockedError struct {
+	Path string
+	Info LockInfo
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("another encore-migrator %q run (pid %d, started %s) holds the lock %s; wait for it to finish or pass --no-lock",
+		e.Info.Command, e.Info.PID, e.Info.StartedAt.Format(time.RFC3339), e.Path)
+}
+
+// Lock is a held run lock
+type Lock struct {
+	path string
+	file os.FileInfo // the lock file this process linked into place
+}
+
+// AcquireLock takes the run lock for command. A lock left behind by a
+// process that is no longer running is treated as stale and replaced; one
+// that cannot be read is treated as held.
+func (s *Store) AcquireLock(command string) (*Lock, error) {
+	path := s.path(lockFileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	info := LockInfo{
+		PID:       os.Getpid(),
+		Hostname:  hostname,
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling lock info: %w", err)
+	}
+
+	// Write the lock contents first, then hard-link into place: the link fails
+	// atomically if a lock exists, and readers never see a half-written file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lock-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating lock file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, writeErr := tmp.Write(data)
+	if err := errors.Join(writeErr, tmp.Close()); err != nil {
+		return nil, fmt.Errorf("writing lock file: %w", err)
+	}
+	file, err := os.Stat(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("writing lock file: %w", err)
+	}
+
+	// Two attempts: the second follows removal of a stale lock
+	for attempt := 0; attempt < 2; attempt++ {
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return &Lock{path: path, file: file}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("creating lock file: %w", err)
+		}
+
+		holder, inspected, err := readLock(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Released since the link failed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lock %s exists but cannot be read; remove it if no run is in progress: %w", path, err)
+		}
+		// A lock from another machine (shared filesystem) cannot be checked for liveness
+		if holder.Hostname != hostname || processAlive(holder.PID) {
+			return nil, &LockedError{Path: path, Info: holder}
+		}
+
+		slog.Warn("removing stale run lock", "path", path, "pid", holder.PID)
+		if err := removeStale(path, inspected); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("could not acquire lock %s", path)
+}
+
+// readLock reads the lock file and identifies the file it read
+func readLock(path string) (LockInfo, os.FileInfo, error) {
+	var holder LockInfo
+	f, err := os.Open(path)
+	if err != nil {
+		return holder, nil, err
+	}
+	defer f.Close()
+
+	file, err := f.Stat()
+	if err != nil {
+		return holder, nil, err
+	}
+	if err := json.NewDecoder(f).Decode(&holder); err != nil {
+		return holder, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return holder, file, nil
+}
+
+// removeStale removes the stale lock that was inspected and nothing else.
+// Another process may have replaced it since, so it is renamed aside first;
+// a lock that turns out not to be the stale one is linked back into place.
+func removeStale(path string, stale os.FileInfo) error {
+	aside := fmt.Sprintf("%s.stale-%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("removing stale lock: %w", err)
+	}
+	defer os.Remove(aside)
+
+	moved, err := os.Stat(aside)
+	if err != nil {
+		return fmt.Errorf("removing stale lock: %w", err)
+	}
+	if os.SameFile(moved, stale) {
+		return nil
+	}
+	if err := os.Link(aside, path); err != nil {
+		return fmt.Errorf("lock %s was taken by another run while removing a stale one; check for concurrent runs: %w", path, err)
+	}
+	var holder LockInfo
+	if err := readJSON(path, &holder); err != nil {
+		return fmt.Errorf("lock %s exists but cannot be read: %w", path, err)
+	}
+	return &LockedError{Path: path, Info: holder}
+}
+
+// Release removes the lock file, unless it is no longer the one this
+// process took
+func (l *Lock) Release() error {
+	current, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("releasing lock: %w", err)
+	}
+	if !os.SameFile(current, l.file) {
+		return fmt.Errorf("releasing lock: %s is held by another run now", l.path)
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("releasing lock: %w", err)
+	}
+	return nil
+}
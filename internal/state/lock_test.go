@@ -0,0 +1,156 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeLockFile puts a lock held by holder in place, as another run would
+func writeLockFile(t *testing.T, s *Store, holder LockInfo) {
+	t.Helper()
+	data, err := json.Marshal(holder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.path(lockFileName), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deadPID returns the PID of a process that has exited
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.ProcessState.Pid()
+}
+
+func TestAcquireLockHeld(t *testing.T) {
+	s := NewStore(t.TempDir())
+	held, err := s.AcquireLock("up")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.AcquireLock("down")
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second AcquireLock returned %v, want a LockedError", err)
+	}
+	if locked.Info.PID != os.Getpid() || locked.Info.Command != "up" {
+		t.Errorf("LockedError names pid %d command %q, want pid %d command up", locked.Info.PID, locked.Info.Command, os.Getpid())
+	}
+
+	if err := held.Release(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.AcquireLock("down")
+	if err != nil {
+		t.Fatalf("AcquireLock after Release: %v", err)
+	}
+	if err := again.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLockOtherHostIsHeld(t *testing.T) {
+	s := NewStore(t.TempDir())
+	writeLockFile(t, s, LockInfo{PID: deadPID(t), Hostname: "elsewhere.invalid", Command: "up", StartedAt: time.Now()})
+
+	_, err := s.AcquireLock("up")
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("AcquireLock returned %v, want a LockedError for a lock from another host", err)
+	}
+}
+
+func TestAcquireLockReplacesStale(t *testing.T) {
+	s := NewStore(t.TempDir())
+	hostname, _ := os.Hostname()
+	writeLockFile(t, s, LockInfo{PID: deadPID(t), Hostname: hostname, Command: "up", StartedAt: time.Now()})
+
+	lock, err := s.AcquireLock("down")
+	if err != nil {
+		t.Fatalf("AcquireLock over a stale lock: %v", err)
+	}
+	var holder LockInfo
+	if err := readJSON(s.path(lockFileName), &holder); err != nil {
+		t.Fatal(err)
+	}
+	if holder.PID != os.Getpid() || holder.Command != "down" {
+		t.Errorf("lock names pid %d command %q, want pid %d command down", holder.PID, holder.Command, os.Getpid())
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireLockUnreadableIsHeld(t *testing.T) {
+	s := NewStore(t.TempDir())
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := s.path(lockFileName)
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AcquireLock("up"); err == nil {
+		t.Fatal("AcquireLock took an unreadable lock")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "not json" {
+		t.Errorf("unreadable lock was changed: %q, %v", data, err)
+	}
+}
+
+func TestAcquireLockRace(t *testing.T) {
+	hostname, _ := os.Hostname()
+	for _, stale := range []bool{false, true} {
+		s := NewStore(t.TempDir())
+		if stale {
+			writeLockFile(t, s, LockInfo{PID: deadPID(t), Hostname: hostname, Command: "up", StartedAt: time.Now()})
+		}
+
+		const acquirers = 16
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			won   []*Lock
+			start = make(chan struct{})
+		)
+		for range acquirers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				lock, err := s.AcquireLock("up")
+				if err != nil {
+					// Losing is fine; only the number of winners matters
+					return
+				}
+				mu.Lock()
+				won = append(won, lock)
+				mu.Unlock()
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if len(won) != 1 {
+			t.Fatalf("stale=%t: %d acquirers hold the lock, want 1", stale, len(won))
+		}
+		if err := won[0].Release(); err != nil {
+			t.Errorf("stale=%t: releasing the winning lock: %v", stale, err)
+		}
+	}
+}
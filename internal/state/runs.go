@@ -0,0 +1,210 @@
+package state
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DatabaseStatus is the progress of a single database within a run
+type DatabaseStatus string
+
+const (
+	StatusPending   DatabaseStatus = "pending"
+	StatusCompleted DatabaseStatus = "completed"
+	StatusFailed    DatabaseStatus = "failed"
+	StatusSkipped   DatabaseStatus = "skipped"
+	StatusCancelled DatabaseStatus = "cancelled"
+	// StatusRolledBack is a database migrated by a run and then rolled back
+	// to its version before it, because another of its atomic group failed
+	StatusRolledBack DatabaseStatus = "rolled_back"
+	// StatusPaused is a database whose rollback the operator stopped at a
+	// down --checkpoint-interval checkpoint; resuming the run carries on
+	StatusPaused DatabaseStatus = "paused"
+)
+
+// DatabaseRun records the outcome of one database within a run
+type DatabaseRun struct {
+	Name          string         `json:"name"`
+	Status        DatabaseStatus `json:"status"`
+	VersionBefore uint           `json:"version_before"`
+	VersionAfter  uint           `json:"version_after"`
+	Error         string         `json:"error,omitempty"`
+	State         *DatabaseState `json:"state,omitempty"`      // captured after a failure
+	Statements    []Statement    `json:"statements,omitempty"` // per-statement mode only
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Statement is how long one migration statement took in per-statement mode
+type Statement struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	SQL        string `json:"sql"`
+	DurationMS int64  `json:"duration_ms"`
+	Skipped    string `json:"skipped,omitempty"` // error of a failed statement skipped with --skip-failed-statement
+}
+
+// DatabaseState is the migration state of a database captured after a failure
+type DatabaseState struct {
+	Version      uint     `json:"version"`
+	Dirty        bool     `json:"dirty"`
+	PendingFiles []string `json:"pending_files"`
+}
+
+// Run is the persisted progress of a single migration invocation
+type Run struct {
+	ID         string        `json:"id"`
+	Direction  string        `json:"direction"`
+	Ticket     string        `json:"ticket,omitempty"` // change ticket given with --ticket
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Databases  []DatabaseRun `json:"databases"`
+}
+
+// ErrRunNotFound is returned when a run ID has no state file
+var ErrRunNotFound = errors.New("run not found")
+
+// runIDPattern matches the IDs NewRunID produces; LoadRun refuses anything
+// else, so an ID given on the command line can't name a file outside runs/
+var runIDPattern = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-[0-9a-f]{4}$`)
+
+// NewRun creates a run with a fresh ID
+func NewRun(direction string) *Run {
+	now := time.Now().UTC()
+	return &Run{
+		ID:        NewRunID(now),
+		Direction: direction,
+		StartedAt: now,
+	}
+}
+
+// NewRunID returns a sortable run ID such as 20240102T150405Z-3f9a
+func NewRunID(now time.Time) string {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b[:])
+}
+
+// Database returns the entry for the named database, or nil if it has none
+func (r *Run) Database(name string) *DatabaseRun {
+	for i := range r.Databases {
+		if r.Databases[i].Name == name {
+			return &r.Databases[i]
+		}
+	}
+	return nil
+}
+
+// Completed reports whether the named database finished successfully in this run
+func (r *Run) Completed(name string) bool {
+	db := r.Database(name)
+	return db != nil && db.Status == StatusCompleted
+}
+
+// Record sets the outcome for a database, adding an entry if needed
+func (r *Run) Record(entry DatabaseRun) {
+	if entry.Status != StatusPending && entry.FinishedAt == nil {
+		now := time.Now().UTC()
+		entry.FinishedAt = &now
+	}
+
+	if existing := r.Database(entry.Name); existing != nil {
+		*existing = entry
+		return
+	}
+	r.Databases = append(r.Databases, entry)
+}
+
+// Finish marks the run as finished
+func (r *Run) Finish() {
+	now := time.Now().UTC()
+	r.FinishedAt = &now
+}
+
+// SaveRun checkpoints the run to runs/<id>.json
+func (s *Store) SaveRun(run *Run) error {
+	if err := writeJSON(s.path("runs", run.ID+".json"), run); err != nil {
+		return fmt.Errorf("saving run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// LoadRun reads a previously saved run
+func (s *Store) LoadRun(id string) (*Run, error) {
+	if !runIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("invalid run ID %q (want one like 20240102T150405Z-3f9a)", id)
+	}
+	var run Run
+	if err := readJSON(s.path("runs", id+".json"), &run); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrRunNotFound, id)
+		}
+		return nil, fmt.Errorf("loading run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+// ListRuns returns all saved runs, newest first. Unreadable files are skipped.
+func (s *Store) ListRuns() ([]*Run, error) {
+	entries, err := os.ReadDir(s.path("runs"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing runs: %w", err)
+	}
+
+	var runs []*Run
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		run, err := s.LoadRun(id)
+		if err != nil {
+			slog.Debug("skipping unreadable run state", "file", entry.Name(), "error", err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+
+	return runs, nil
+}
+
+// PruneRuns deletes saved runs beyond the keep most recent (keep <= 0 keeps
+// all) and runs started before olderThan (zero keeps all). The newest run is
+// always kept. It returns the IDs of the deleted runs.
+func (s *Store) PruneRuns(keep int, olderThan time.Time) ([]string, error) {
+	runs, err := s.ListRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for i, run := range runs {
+		if i == 0 {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := !olderThan.IsZero() && run.StartedAt.Before(olderThan)
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(s.path("runs", run.ID+".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pruned, fmt.Errorf("pruning run %s: %w", run.ID, err)
+		}
+		pruned = append(pruned, run.ID)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,63 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRunID(t *testing.T) {
+	s := NewStore(t.TempDir())
+	run := NewRun("up")
+	if err := s.SaveRun(run); err != nil {
+		t.Fatal(err)
+	}
+	// a state file outside runs/ that a crafted ID would otherwise reach
+	if err := os.WriteFile(filepath.Join(s.dir, "outside.json"), []byte(`{"id":"outside"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		notFound bool
+		invalid  bool
+	}{
+		{name: "saved run", id: run.ID},
+		{name: "unknown run", id: NewRunID(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)), notFound: true},
+		{name: "parent directory", id: "../outside", invalid: true},
+		{name: "absolute path", id: filepath.Join(s.dir, "outside"), invalid: true},
+		{name: "empty", id: "", invalid: true},
+		{name: "trailing text", id: run.ID + "/../../outside", invalid: true},
+		{name: "upper case suffix", id: "20240102T150405Z-3F9A", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.LoadRun(tt.id)
+			switch {
+			case tt.notFound:
+				if !errors.Is(err, ErrRunNotFound) {
+					t.Errorf("LoadRun(%q) error = %v, want ErrRunNotFound", tt.id, err)
+				}
+			case tt.invalid:
+				if err == nil || errors.Is(err, ErrRunNotFound) {
+					t.Errorf("LoadRun(%q) = %v, %v, want an invalid ID error", tt.id, got, err)
+				}
+			default:
+				if err != nil || got.ID != tt.id {
+					t.Errorf("LoadRun(%q) = %v, %v, want the saved run", tt.id, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRunIDMatchesPattern(t *testing.T) {
+	for range 100 {
+		if id := NewRunID(time.Now()); !runIDPattern.MatchString(id) {
+			t.Fatalf("NewRunID() = %q, which LoadRun would refuse", id)
+		}
+	}
+}
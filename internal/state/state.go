@@ -0,0 +1,84 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultDirName is the directory, relative to the app root, holding local run state
+const DefaultDirName = ".encore-migrate"
+
+// Store reads and writes local run state under a single directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a Store rooted at dir. The directory is created lazily on first write.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultDir returns the default state directory for an app root
+func DefaultDir(appRoot string) string {
+	return filepath.Join(appRoot, DefaultDirName)
+}
+
+// Dir returns the root directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// path joins elements onto the store root
+func (s *Store) path(elem ...string) string {
+	return filepath.Join(append([]string{s.dir}, elem...)...)
+}
+
+// writeJSON atomically writes v as indented JSON to path, creating parent directories
+func writeJSON(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+	data = append(data, '\n')
+
+	// Write to a temp file and rename so an interrupted write never leaves a truncated file
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("saving state: %w", err)
+	}
+
+	return nil
+}
+
+// readJSON reads JSON from path into v
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Environment variables controlling telemetry. Telemetry is off unless
+// EnvEnabled is exactly "1" and an endpoint is configured.
+const (
+	EnvEnabled  = "ENCORE_MIGRATE_TELEMETRY"
+	EnvEndpoint = "ENCORE_MIGRATE_TELEMETRY_ENDPOINT"
+)
+
+// sendTimeout bounds how long reporting may delay the process exit
+const sendTimeout = 2 * time.Second
+
+// Event is the complete anonymous usage payload. It deliberately has no
+// fields for hostnames, database names, credentials or paths.
+type Event struct {
+	Command       string `json:"command"`
+	DatabaseCount int    `json:"database_count"`
+	DurationMS    int64  `json:"duration_ms"`
+}
+
+// Settings is the resolved telemetry configuration
+type Settings struct {
+	Enabled  bool
+	Reason   string // why telemetry is on or off
+	Endpoint string
+}
+
+// Resolve determines whether telemetry is enabled. optOut forces it off
+// regardless of the environment.
+func Resolve(optOut bool) Settings {
+	endpoint := os.Getenv(EnvEndpoint)
+	switch {
+	case optOut:
+		return Settings{Reason: "disabled by --no-telemetry", Endpoint: endpoint}
+	case os.Getenv(EnvEnabled) != "1":
+		return Settings{Reason: EnvEnabled + " is not set to 1", Endpoint: endpoint}
+	case endpoint == "":
+		return Settings{Reason: EnvEndpoint + " is not set", Endpoint: endpoint}
+	}
+	return Settings{Enabled: true, Reason: EnvEnabled + "=1", Endpoint: endpoint}
+}
+
+// Send posts the event as JSON to the endpoint
+func Send(ctx context.Context, endpoint string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding telemetry event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating telemetry request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending telemetry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sending telemetry: unexpected status %s", resp.Status)
+	}
+	return nil
+}
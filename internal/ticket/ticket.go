@@ -0,0 +1,78 @@
+package ticket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/state"
+)
+
+// DefaultPattern matches Jira and Linear issue keys such as ENG-1234
+const DefaultPattern = `^[A-Z][A-Z0-9]+-[0-9]+$`
+
+// postTimeout bounds how long posting to the ticket webhook may take
+const postTimeout = 10 * time.Second
+
+// Validate checks a ticket ID against pattern, or DefaultPattern if empty
+func Validate(id, pattern string) error {
+	if pattern == "" {
+		pattern = DefaultPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid tickets.pattern %q: %w", pattern, err)
+	}
+	if !re.MatchString(id) {
+		return fmt.Errorf("ticket %q does not match pattern %s", id, pattern)
+	}
+	return nil
+}
+
+// Notification is the run summary posted to the ticket webhook
+type Notification struct {
+	Ticket    string              `json:"ticket"`
+	RunID     string              `json:"run_id"`
+	Direction string              `json:"direction"`
+	Succeeded bool                `json:"succeeded"`
+	Summary   string              `json:"summary"` // e.g. "2 completed, 1 failed"
+	Text      string              `json:"text"`    // one line for a ticket comment or chat message
+	Databases []state.DatabaseRun `json:"databases"`
+}
+
+// Post sends the notification as JSON to url. Environment variables in url
+// and header values are expanded, so tokens can stay out of the config file.
+func Post(ctx context.Context, url string, headers map[string]string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("encoding ticket notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, postTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(url), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating ticket webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting to ticket webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("posting to ticket webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -1,12 +1,30 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // EncoreDatabase represents a discovered Encore database configuration
 type EncoreDatabase struct {
 	Name           string // Encore database name (e.g., "users")
 	MigrationsPath string // Absolute path to migrations directory
 	SourceFile     string // Go file where this was discovered (for debugging)
+	Retired        bool   // marked retired in the manifest or project config
+}
+
+// Kinds of EncoreResource
+const (
+	ResourceCron         = "cron"
+	ResourceSubscription = "subscription"
+)
+
+// EncoreResource is an Encore cron job or PubSub subscription declared in the source
+type EncoreResource struct {
+	Kind       string // ResourceCron or ResourceSubscription
+	Name       string // cron job ID or subscription name
+	Topic      string // topic expression of a subscription, e.g. orders.Created
+	SourceFile string // Go file declaring it
 }
 
 // DatabaseMapping maps Encore DB name to actual PostgreSQL config
@@ -18,6 +36,31 @@ type DatabaseMapping struct {
 	Username   string
 	Password   string
 	SSLMode    string
+	// TLS material from the InfraConfig tls_config, each a file path or
+	// inline PEM; empty when not configured
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+	// TLSMinVersion, "1.2" or "1.3", refuses connections negotiating an
+	// older TLS version or none; see migration.ParseTLSVersion
+	TLSMinVersion string
+	// Production is set when the InfraConfig is labelled as a production environment
+	Production bool
+	// CloudSQLInstance, when set, connects through the Cloud SQL connector
+	// instead of Host and Port
+	CloudSQLInstance string
+	CloudSQLIAMAuth  bool
+	CloudSQLIPType   string
+	// KerberosServiceName and KerberosSPN choose the principal GSSAPI
+	// authenticates to, when the server asks for it; see package kerberos
+	KerberosServiceName string
+	KerberosSPN         string
+	// SSHBastion, when set, reaches Host and Port through an SSH tunnel
+	// from user@host[:port]; see sshtunnel.Dialer
+	SSHBastion      string
+	SSHIdentityFile string
+	SSHNoAgent      bool
+	SSHOptions      []string
 }
 
 // MigrationResult captures the outcome of a migration operation
@@ -27,6 +70,38 @@ type MigrationResult struct {
 	VersionBefore uint
 	VersionAfter  uint
 	Error         error
+	Statements    []StatementTiming // only in per-statement mode
+	// Server is the server the migrations ran on; nil when none ran
+	Server *ServerInfo
+}
+
+// ServerInfo identifies the PostgreSQL server that answered a connection
+type ServerInfo struct {
+	Addr       string // inet_server_addr(), empty for unix sockets
+	Port       int
+	InRecovery bool // true when connected to a standby/replica
+	BackendPID int
+}
+
+func (s ServerInfo) String() string {
+	addr := s.Addr
+	if addr == "" {
+		addr = "local socket"
+	}
+	role := "primary"
+	if s.InRecovery {
+		role = "replica"
+	}
+	return fmt.Sprintf("%s:%d (%s, backend pid %d)", addr, s.Port, role, s.BackendPID)
+}
+
+// StatementTiming records how long one migration statement took
+type StatementTiming struct {
+	File     string // migration file name
+	Line     int    // 1-based line where the statement starts
+	SQL      string // the statement, shortened to its first line
+	Duration time.Duration
+	Skipped  string // error of a failed statement skipped with SkipFailedStatements
 }
 
 // DiscoveryError indicates a problem during database discovery
@@ -73,3 +148,12 @@ func (e *MigrationError) Error() string {
 func (e *MigrationError) Unwrap() error {
 	return e.Cause
 }
+
+// DirtyStateError indicates the database was left dirty by a failed migration
+type DirtyStateError struct {
+	Version uint
+}
+
+func (e *DirtyStateError) Error() string {
+	return fmt.Sprintf("database is in dirty state at version %d, manual intervention required", e.Version)
+}
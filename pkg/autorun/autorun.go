@@ -0,0 +1,186 @@
+// Package autorun lets an Encore service apply its own database's pending
+// migrations as it starts, for small self-hosted deployments without a
+// separate migration job:
+//
+//	var db = sqldb.NewDatabase("users", sqldb.DatabaseConfig{Migrations: "./migrations"})
+//
+//	func init() {
+//		if _, err := autorun.Up("users", "users/migrations"); err != nil {
+//			panic(err)
+//		}
+//	}
+//
+// Nothing runs unless ENCORE_MIGRATE_AUTORUN is true, so the same build can
+// start without migrating elsewhere. The database is looked up by name in the
+// InfraConfig, without scanning the source, and golang-migrate's advisory
+// lock makes replicas starting together wait for one of them to migrate.
+package autorun
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/config"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/kerberos"
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+)
+
+// EnvEnable turns Up on when set to a true value, e.g. 1 or true
+const EnvEnable = "ENCORE_MIGRATE_AUTORUN"
+
+// DefaultConfigPath is the InfraConfig read when neither Options.ConfigPath,
+// $ENCORE_MIGRATE_CONFIG nor $ENCORE_INFRA_CONFIG_PATH is set
+const DefaultConfigPath = "infra.config.json"
+
+// Options tune Up
+type Options struct {
+	// ConfigPath is the InfraConfig with the database's server and
+	// credentials (default: $ENCORE_MIGRATE_CONFIG, else the
+	// $ENCORE_INFRA_CONFIG_PATH the Encore runtime reads, else
+	// DefaultConfigPath)
+	ConfigPath string
+	// Retries is how many more times to try connecting, or taking the
+	// migration lock while another replica migrates. It defaults to 5, which
+	// with the default backoff waits up to 62s in all before failing, long
+	// enough for a database starting alongside the service; -1 disables
+	// retrying.
+	Retries int
+	// RetryBackoff is the wait before the first retry; it doubles each time
+	// (default 2s, so 2s, 4s, 8s, 16s and 32s)
+	RetryBackoff time.Duration
+	// Force runs even when EnvEnable isn't set
+	Force bool
+	// Hooks are told of the run's progress
+	Hooks Hooks
+}
+
+// Hooks are called as Up runs, for progress displays, metrics or
+// notifications; unset hooks are skipped. They run on Up's goroutine.
+type Hooks struct {
+	// OnDatabaseStart is called before connecting to the database
+	OnDatabaseStart func(database string)
+	// OnMigrationApplied is called after each migration file is applied
+	OnMigrationApplied func(database string, m Migration)
+	// OnError is called with the error Up is about to return
+	OnError func(database string, err error)
+}
+
+// Migration is a migration file that was applied
+type Migration struct {
+	Version  uint
+	Name     string // file name, e.g. 0002_add_email.up.sql
+	Duration time.Duration
+}
+
+// Result is what Up applied; VersionBefore equals VersionAfter when nothing
+// was pending
+type Result struct {
+	Database      string
+	VersionBefore uint
+	VersionAfter  uint
+}
+
+// Up applies the pending migrations of the Encore database in migrationsPath
+// with the default Options. It returns a nil Result when autorun is off.
+func Up(database, migrationsPath string) (*Result, error) {
+	return Options{}.Up(database, migrationsPath)
+}
+
+// Up applies the pending migrations of the Encore database in migrationsPath.
+// It returns a nil Result when autorun is off. When the database's server sets
+// krb_srvname or krb_spn, Up registers a Kerberos GSSAPI provider with lib/pq
+// once; a server asking for GSSAPI without either needs the service to call
+// pq.RegisterGSSProvider itself.
+func (o Options) Up(database, migrationsPath string) (*Result, error) {
+	if !o.Force && !Enabled() {
+		return nil, nil
+	}
+	if o.Hooks.OnDatabaseStart != nil {
+		o.Hooks.OnDatabaseStart(database)
+	}
+	var result *Result
+	var err error
+	if d := registeredDriver(); d != nil {
+		var applied func(Migration)
+		if onApplied := o.Hooks.OnMigrationApplied; onApplied != nil {
+			applied = func(m Migration) { onApplied(database, m) }
+		}
+		result, err = d.Up(database, migrationsPath, applied)
+	} else {
+		result, err = o.up(database, migrationsPath)
+	}
+	if err != nil && o.Hooks.OnError != nil {
+		o.Hooks.OnError(database, err)
+	}
+	return result, err
+}
+
+// registerGSS registers the Kerberos GSSAPI provider with lib/pq the first
+// time a database's server sets krb_srvname or krb_spn, leaving a service that
+// never uses Kerberos, or registers its own provider, alone
+var registerGSS sync.Once
+
+// up applies the pending migrations
+func (o Options) up(database, migrationsPath string) (*Result, error) {
+	infraConfig, err := config.LoadInfraConfig(o.configPath())
+	if err != nil {
+		return nil, fmt.Errorf("loading InfraConfig: %w", err)
+	}
+	mapping, err := infraConfig.GetMapping(database)
+	if err != nil {
+		return nil, fmt.Errorf("database %s: %w", database, err)
+	}
+
+	if mapping.KerberosServiceName != "" || mapping.KerberosSPN != "" {
+		registerGSS.Do(func() {
+			pq.RegisterGSSProvider(func() (pq.GSS, error) { return kerberos.NewGSS() })
+		})
+	}
+	connStr, err := migration.BuildConnectionString(mapping)
+	if err != nil {
+		return nil, fmt.Errorf("database %s: building connection string: %w", database, err)
+	}
+	// only what this call set up: the service may hold other connections
+	defer migration.ReleaseConnection(connStr)
+
+	migrator := migration.NewMigrator(false)
+	migrator.Retries = o.Retries
+	if migrator.Retries == 0 {
+		migrator.Retries = 5
+	}
+	migrator.RetryBackoff = o.RetryBackoff
+	if migrator.RetryBackoff == 0 {
+		migrator.RetryBackoff = 2 * time.Second
+	}
+	if onApplied := o.Hooks.OnMigrationApplied; onApplied != nil {
+		migrator.OnMigrationApplied = func(file migration.File, elapsed time.Duration) {
+			onApplied(database, Migration{Version: file.Version, Name: file.Name, Duration: elapsed})
+		}
+	}
+	result, err := migrator.Up(connStr, migrationsPath, 0)
+	if err != nil {
+		return nil, fmt.Errorf("database %s: %w", database, err)
+	}
+	return &Result{Database: database, VersionBefore: result.VersionBefore, VersionAfter: result.VersionAfter}, nil
+}
+
+// Enabled reports whether EnvEnable turns autorun on
+func Enabled() bool {
+	on, _ := strconv.ParseBool(os.Getenv(EnvEnable))
+	return on
+}
+
+// configPath is the InfraConfig to read
+func (o Options) configPath() string {
+	for _, path := range []string{o.ConfigPath, os.Getenv("ENCORE_MIGRATE_CONFIG"), os.Getenv("ENCORE_INFRA_CONFIG_PATH")} {
+		if path != "" {
+			return path
+		}
+	}
+	return DefaultConfigPath
+}
@@ -0,0 +1,99 @@
+// Package autoruntest provides an in-memory autorun.Driver for testing
+// services that migrate their database with autorun.Up:
+//
+//	func TestMain(m *testing.M) {
+//		fake := autoruntest.NewDriver()
+//		autorun.RegisterDriver(fake)
+//		os.Exit(m.Run())
+//	}
+//
+// The fake reads the migration files from disk but runs none of their SQL;
+// it records the versions it applied to each database instead.
+package autoruntest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/theoffensivecoder/encoredev-migrator/internal/migration"
+	"github.com/theoffensivecoder/encoredev-migrator/pkg/autorun"
+)
+
+// Driver is an in-memory autorun.Driver. It is safe for concurrent use.
+type Driver struct {
+	mu       sync.Mutex
+	versions map[string]uint
+	applied  map[string][]uint
+	failAt   map[string]uint
+}
+
+// NewDriver returns a Driver with every database at version 0
+func NewDriver() *Driver {
+	return &Driver{
+		versions: make(map[string]uint),
+		applied:  make(map[string][]uint),
+		failAt:   make(map[string]uint),
+	}
+}
+
+// SetVersion sets the version database is at, as if earlier migrations had
+// already been applied
+func (d *Driver) SetVersion(database string, version uint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.versions[database] = version
+}
+
+// FailAt makes Up fail at the migration file of version in database, leaving
+// the database at the version before it
+func (d *Driver) FailAt(database string, version uint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failAt[database] = version
+}
+
+// Version is the version database is at
+func (d *Driver) Version(database string) uint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.versions[database]
+}
+
+// Applied lists the versions applied to database, in order, over every Up
+func (d *Driver) Applied(database string) []uint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]uint(nil), d.applied[database]...)
+}
+
+// Up implements autorun.Driver
+func (d *Driver) Up(database, migrationsPath string, applied func(autorun.Migration)) (*autorun.Result, error) {
+	files, err := migration.ListFiles(migrationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("database %s: %w", database, err)
+	}
+
+	before := d.Version(database)
+	for _, step := range migration.PlanUp(files, before, 0).Steps {
+		if err := d.apply(database, step); err != nil {
+			return nil, err
+		}
+		if applied != nil {
+			applied(autorun.Migration{Version: step.Version, Name: step.File.Name})
+		}
+	}
+	return &autorun.Result{Database: database, VersionBefore: before, VersionAfter: d.Version(database)}, nil
+}
+
+// apply records step as applied unless FailAt names it. Hooks run without
+// the lock held, so they may call the Driver.
+func (d *Driver) apply(database string, step migration.Step) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if step.Version == d.failAt[database] {
+		return fmt.Errorf("database %s: migration %s failed (autoruntest.FailAt)", database, step.File.Name)
+	}
+	d.versions[database] = step.Version
+	d.applied[database] = append(d.applied[database], step.Version)
+	return nil
+}
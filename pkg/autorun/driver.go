@@ -0,0 +1,32 @@
+package autorun
+
+import "sync"
+
+// Driver applies a database's migrations for Up. The default connects to the
+// database in the InfraConfig; tests of services that call Up can register a
+// fake such as autoruntest.Driver to run without PostgreSQL.
+type Driver interface {
+	// Up applies the pending migrations in migrationsPath to database,
+	// calling applied after each migration file
+	Up(database, migrationsPath string, applied func(Migration)) (*Result, error)
+}
+
+var (
+	driverMu sync.Mutex
+	driver   Driver
+)
+
+// RegisterDriver makes Up apply migrations with d instead of connecting to
+// the database; nil restores the default. It is meant for tests.
+func RegisterDriver(d Driver) {
+	driverMu.Lock()
+	defer driverMu.Unlock()
+	driver = d
+}
+
+// registeredDriver is the Driver set by RegisterDriver, or nil
+func registeredDriver() Driver {
+	driverMu.Lock()
+	defer driverMu.Unlock()
+	return driver
+}